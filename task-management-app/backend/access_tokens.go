@@ -0,0 +1,936 @@
+package main
+
+// Personal access tokens and service accounts
+// Scripts and CI authenticate with "Authorization: Bearer tm_pat_..." (or the
+// same value in X-API-Key) instead of a user session. Each token carries
+// scopes, expires, and is stored only as a SHA-256 hash alongside a short
+// display prefix; the plaintext is returned once, when the token is minted.
+// Successful uses record when and from where the token was last seen.
+//
+// Service accounts are users with the service role that belong to a single
+// project. The project's owner (or an admin) creates them and mints and
+// revokes their tokens, and their tokens only reach that project's tasks.
+//
+// A token-authenticated request acts as the token's user, so a token cannot
+// impersonate anyone else. Tokens and service accounts are only managed from a
+// verified session: a token can never mint, list or revoke tokens, so a leaked
+// one cannot be used to create a replacement that outlives its revocation.
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// accessTokenPrefix - Marks a bearer value as a personal access token rather than a JWT
+const accessTokenPrefix = "tm_pat_"
+
+// Token lifetimes in days; every token expires
+const (
+	defaultAccessTokenDays = 90
+	maxAccessTokenDays     = 366
+)
+
+// serviceAccountRole - users.role of service accounts
+const serviceAccountRole = "service"
+
+// Access token scopes
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+	ScopeTimeRead   = "time:read"
+	ScopeTimeWrite  = "time:write"
+)
+
+var accessTokenScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeTimeRead, ScopeTimeWrite}
+
+// accessTokenRoutes - API areas reachable with a token and the scope each method needs;
+// everything else, including token management itself, is closed to tokens
+var accessTokenRoutes = []struct {
+	Prefix string
+	Read   string
+	Write  string
+}{
+	{"/api/v1/tasks", ScopeTasksRead, ScopeTasksWrite},
+	{"/api/v1/time", ScopeTimeRead, ScopeTimeWrite},
+}
+
+var serviceAccountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+var (
+	errAccessTokenInvalid = errors.New("invalid access token")
+	errAccessTokenExpired = errors.New("access token has expired")
+	errAccessTokenRevoked = errors.New("access token has been revoked")
+)
+
+// accessTokenRejection - Metric label per authentication failure
+var accessTokenRejection = map[error]string{
+	errAccessTokenInvalid: "invalid",
+	errAccessTokenExpired: "expired",
+	errAccessTokenRevoked: "revoked",
+}
+
+var accessTokenAuthTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "access_token_authentications_total",
+	Help: "Requests presenting a personal access token, by outcome.",
+}, []string{"result"})
+
+// AccessToken - A scoped credential for one user; Token is only set when minted
+type AccessToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// ServiceAccount - A non-human user owned by a project
+type ServiceAccount struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	ProjectID   string     `json:"project_id"`
+	Description string     `json:"description,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TokenPrincipal - Identity and grants of a token-authenticated request
+type TokenPrincipal struct {
+	TokenID   string
+	UserID    string
+	ProjectID string
+	Scopes    []string
+}
+
+// HasScope - Whether the token was granted scope
+func (p *TokenPrincipal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenPrincipalKey struct{}
+
+// tokenPrincipal - The request's token identity, or nil for session requests
+func tokenPrincipal(r *http.Request) *TokenPrincipal {
+	principal, _ := r.Context().Value(tokenPrincipalKey{}).(*TokenPrincipal)
+	return principal
+}
+
+// AccessTokenStore - Tokens and service accounts in PostgreSQL
+type AccessTokenStore struct {
+	db *sql.DB
+}
+
+var accessTokens *AccessTokenStore
+
+const accessTokenSchema = `
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id VARCHAR(50) PRIMARY KEY,
+  user_id VARCHAR(50) NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  token_prefix VARCHAR(20) NOT NULL,
+  scopes TEXT[] NOT NULL,
+  created_by VARCHAR(50),
+  expires_at TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP,
+  last_used_ip VARCHAR(64),
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user ON access_tokens (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS service_accounts (
+  user_id VARCHAR(50) PRIMARY KEY,
+  project_id VARCHAR(50) NOT NULL,
+  description TEXT,
+  created_by VARCHAR(50),
+  disabled_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_accounts_project ON service_accounts (project_id);
+`
+
+// NewAccessTokenStore - Create a store over db
+func NewAccessTokenStore(db *sql.DB) *AccessTokenStore {
+	return &AccessTokenStore{db: db}
+}
+
+// EnsureSchema - Create the token and service account tables
+func (s *AccessTokenStore) EnsureSchema() error {
+	if s.db == nil {
+		return fmt.Errorf("database not available")
+	}
+	_, err := s.db.Exec(accessTokenSchema)
+	return err
+}
+
+// hashAccessToken - Hex SHA-256 of a token; tokens are random, so no salt or stretching is needed
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAccessToken - A fresh token and the prefix shown when listing it
+func generateAccessToken() (token, prefix string, err error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = accessTokenPrefix + hex.EncodeToString(buf)
+	return token, token[:len(accessTokenPrefix)+6], nil
+}
+
+// validateAccessTokenScopes - Reject empty, unknown or duplicate scopes
+func validateAccessTokenScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required (%s)", strings.Join(accessTokenScopes, ", "))
+	}
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		known := false
+		for _, candidate := range accessTokenScopes {
+			if scope == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q (valid: %s)", scope, strings.Join(accessTokenScopes, ", "))
+		}
+		if seen[scope] {
+			return fmt.Errorf("duplicate scope %q", scope)
+		}
+		seen[scope] = true
+	}
+	return nil
+}
+
+// requiredAccessTokenScope - Scope a token needs for a request, or "" when tokens may not call it
+func requiredAccessTokenScope(method, path string) string {
+	for _, route := range accessTokenRoutes {
+		if path != route.Prefix && !strings.HasPrefix(path, route.Prefix+"/") {
+			continue
+		}
+		if method == http.MethodGet || method == http.MethodHead {
+			return route.Read
+		}
+		return route.Write
+	}
+	return ""
+}
+
+const accessTokenColumns = "id, user_id, name, token_prefix, scopes, COALESCE(created_by, ''), expires_at, last_used_at, COALESCE(last_used_ip, ''), revoked_at, created_at"
+
+func scanAccessToken(row interface{ Scan(...interface{}) error }) (*AccessToken, error) {
+	var token AccessToken
+	var lastUsed, revoked sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, pq.Array(&token.Scopes),
+		&token.CreatedBy, &token.ExpiresAt, &lastUsed, &token.LastUsedIP, &revoked, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		token.LastUsedAt = &lastUsed.Time
+	}
+	if revoked.Valid {
+		token.RevokedAt = &revoked.Time
+	}
+	return &token, nil
+}
+
+// CreateToken - Mint a token for userID; the returned token holds the only copy of the plaintext
+func (s *AccessTokenStore) CreateToken(ctx context.Context, userID, name string, scopes []string, lifetime time.Duration, createdBy string) (*AccessToken, error) {
+	plaintext, prefix, err := generateAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token := &AccessToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		ExpiresAt: now.Add(lifetime),
+		CreatedAt: now,
+		Token:     plaintext,
+	}
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO access_tokens (id, user_id, name, token_hash, token_prefix, scopes, created_by, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9)",
+		token.ID, token.UserID, token.Name, hashAccessToken(plaintext), token.Prefix, pq.Array(token.Scopes), token.CreatedBy, token.ExpiresAt, token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ListTokens - A user's tokens, newest first, without hashes
+func (s *AccessTokenStore) ListTokens(ctx context.Context, userID string) ([]AccessToken, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+accessTokenColumns+" FROM access_tokens WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []AccessToken{}
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken - Revoke one of userID's tokens; revoking twice keeps the first time.
+// sql.ErrNoRows when the user has no such token
+func (s *AccessTokenStore) RevokeToken(ctx context.Context, userID, tokenID string) (*AccessToken, error) {
+	token, err := scanAccessToken(s.db.QueryRowContext(ctx,
+		"UPDATE access_tokens SET revoked_at = COALESCE(revoked_at, $3) WHERE id = $1 AND user_id = $2 RETURNING "+accessTokenColumns,
+		tokenID, userID, time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Authenticate - Resolve a presented token and record its use
+func (s *AccessTokenStore) Authenticate(ctx context.Context, plaintext, ipAddress string) (*TokenPrincipal, error) {
+	var principal TokenPrincipal
+	var expiresAt time.Time
+	var revokedAt, disabledAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, t.scopes, t.expires_at, t.revoked_at, COALESCE(sa.project_id, ''), sa.disabled_at
+		FROM access_tokens t
+		LEFT JOIN service_accounts sa ON sa.user_id = t.user_id
+		WHERE t.token_hash = $1`,
+		hashAccessToken(plaintext),
+	).Scan(&principal.TokenID, &principal.UserID, pq.Array(&principal.Scopes), &expiresAt, &revokedAt, &principal.ProjectID, &disabledAt)
+	if err == sql.ErrNoRows {
+		return nil, errAccessTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid || disabledAt.Valid {
+		return nil, errAccessTokenRevoked
+	}
+	if !time.Now().Before(expiresAt) {
+		return nil, errAccessTokenExpired
+	}
+
+	// Busy automation would otherwise write on every request
+	_, err = s.db.ExecContext(ctx,
+		"UPDATE access_tokens SET last_used_at = $2, last_used_ip = $3 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2 - INTERVAL '1 minute' OR last_used_ip IS DISTINCT FROM $3)",
+		principal.TokenID, time.Now(), ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &principal, nil
+}
+
+const serviceAccountColumns = "sa.user_id, u.username, sa.project_id, COALESCE(sa.description, ''), COALESCE(sa.created_by, ''), sa.disabled_at, sa.created_at"
+
+func scanServiceAccount(row interface{ Scan(...interface{}) error }) (*ServiceAccount, error) {
+	var account ServiceAccount
+	var disabled sql.NullTime
+	err := row.Scan(&account.ID, &account.Username, &account.ProjectID, &account.Description, &account.CreatedBy, &disabled, &account.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if disabled.Valid {
+		account.DisabledAt = &disabled.Time
+	}
+	return &account, nil
+}
+
+// CreateServiceAccount - Add a service-role user and attach it to projectID
+func (s *AccessTokenStore) CreateServiceAccount(ctx context.Context, projectID, name, description, createdBy string) (*ServiceAccount, error) {
+	account := &ServiceAccount{
+		ID:          uuid.New().String(),
+		Username:    "svc-" + name,
+		ProjectID:   projectID,
+		Description: description,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO users (id, username, email, role, created_at) VALUES ($1, $2, $3, $4, $5)",
+		account.ID, account.Username, account.Username+"@service-accounts.invalid", serviceAccountRole, account.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO service_accounts (user_id, project_id, description, created_by, created_at) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5)",
+		account.ID, account.ProjectID, account.Description, account.CreatedBy, account.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return account, tx.Commit()
+}
+
+// ListServiceAccounts - Service accounts of a project, oldest first
+func (s *AccessTokenStore) ListServiceAccounts(ctx context.Context, projectID string) ([]ServiceAccount, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+serviceAccountColumns+" FROM service_accounts sa JOIN users u ON u.id = sa.user_id WHERE sa.project_id = $1 ORDER BY sa.created_at", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []ServiceAccount{}
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+	}
+	return accounts, rows.Err()
+}
+
+// GetServiceAccount - One of a project's service accounts; sql.ErrNoRows otherwise
+func (s *AccessTokenStore) GetServiceAccount(ctx context.Context, projectID, accountID string) (*ServiceAccount, error) {
+	return scanServiceAccount(s.db.QueryRowContext(ctx,
+		"SELECT "+serviceAccountColumns+" FROM service_accounts sa JOIN users u ON u.id = sa.user_id WHERE sa.project_id = $1 AND sa.user_id = $2", projectID, accountID))
+}
+
+// DisableServiceAccount - Disable an account and revoke all of its tokens
+func (s *AccessTokenStore) DisableServiceAccount(ctx context.Context, projectID, accountID string) (*ServiceAccount, error) {
+	now := time.Now()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE service_accounts SET disabled_at = COALESCE(disabled_at, $3) WHERE project_id = $1 AND user_id = $2", projectID, accountID, now)
+	if err != nil {
+		return nil, err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE access_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL", accountID, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetServiceAccount(ctx, projectID, accountID)
+}
+
+// presentedAccessToken - The personal access token sent with a request, if any
+func presentedAccessToken(r *http.Request) string {
+	if scheme, value, found := strings.Cut(r.Header.Get("Authorization"), " "); found && strings.EqualFold(scheme, "Bearer") {
+		if value = strings.TrimSpace(value); strings.HasPrefix(value, accessTokenPrefix) {
+			return value
+		}
+	}
+	if key := r.Header.Get("X-API-Key"); strings.HasPrefix(key, accessTokenPrefix) {
+		return key
+	}
+	return ""
+}
+
+// rejectAccessToken - 401/403 with an RFC 6750 challenge
+func rejectAccessToken(w http.ResponseWriter, status int, code, scope, message string) {
+	challenge := fmt.Sprintf(`Bearer error=%q, error_description=%q`, code, message)
+	if scope != "" {
+		challenge += fmt.Sprintf(`, scope=%q`, scope)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, message, status)
+}
+
+// accessTokenMiddleware - Authenticate personal access tokens and enforce their scopes
+func accessTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented := presentedAccessToken(r)
+		if presented == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if accessTokens == nil {
+			http.Error(w, "Access tokens unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		principal, err := accessTokens.Authenticate(r.Context(), presented, clientIP(r))
+		switch {
+		case err == errAccessTokenInvalid || err == errAccessTokenExpired || err == errAccessTokenRevoked:
+			accessTokenAuthTotal.WithLabelValues(accessTokenRejection[err]).Inc()
+			requestLogger(r).With("tokens").Warn("Rejected access token", map[string]interface{}{"reason": err.Error()})
+			rejectAccessToken(w, http.StatusUnauthorized, "invalid_token", "", err.Error())
+			return
+		case err != nil:
+			accessTokenAuthTotal.WithLabelValues("error").Inc()
+			requestLogger(r).With("tokens").Error(err, "Access token lookup failed", nil)
+			http.Error(w, "Access token lookup failed", http.StatusServiceUnavailable)
+			return
+		}
+
+		scope := requiredAccessTokenScope(r.Method, r.URL.Path)
+		if scope == "" {
+			accessTokenAuthTotal.WithLabelValues("forbidden").Inc()
+			rejectAccessToken(w, http.StatusForbidden, "insufficient_scope", "", "Access tokens cannot call this endpoint")
+			return
+		}
+		if !principal.HasScope(scope) {
+			accessTokenAuthTotal.WithLabelValues("insufficient_scope").Inc()
+			rejectAccessToken(w, http.StatusForbidden, "insufficient_scope", scope, "Access token lacks the "+scope+" scope")
+			return
+		}
+		accessTokenAuthTotal.WithLabelValues("ok").Inc()
+
+		// The token decides who the caller is, whatever the request claims
+		r = withPrincipal(r, &Principal{UserID: principal.UserID, Method: PrincipalToken})
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenPrincipalKey{}, principal)))
+	})
+}
+
+// tokenAllowsProject - False when a service-account token reaches outside its project
+func tokenAllowsProject(r *http.Request, projectID string) bool {
+	principal := tokenPrincipal(r)
+	return principal == nil || principal.ProjectID == "" || principal.ProjectID == projectID
+}
+
+// scopeTaskProject - Place a service account's new task in its project; false if it names another
+func scopeTaskProject(r *http.Request, task *Task) bool {
+	if principal := tokenPrincipal(r); principal != nil && principal.ProjectID != "" && task.ProjectID == "" {
+		task.ProjectID = principal.ProjectID
+	}
+	return tokenAllowsProject(r, task.ProjectID)
+}
+
+// requireTokenTaskAccess - 404 when a service-account token asks for a task outside its project
+func requireTokenTaskAccess(w http.ResponseWriter, r *http.Request, taskID string) bool {
+	if principal := tokenPrincipal(r); principal == nil || principal.ProjectID == "" {
+		return true
+	}
+	task, err := taskService.GetTask(r.Context(), taskID)
+	if err == sql.ErrNoRows || (err == nil && !tokenAllowsProject(r, task.ProjectID)) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// requireTaskEditor - 401 for anonymous callers, 404 when a service-account token asks
+// for a task outside its project
+func requireTaskEditor(w http.ResponseWriter, r *http.Request, taskID string) bool {
+	if requestUserID(r) == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+	}
+	return requireTokenTaskAccess(w, r, taskID)
+}
+
+// requireTokenUser - Default userID to a token's own user; 403 when it names someone else
+func requireTokenUser(w http.ResponseWriter, r *http.Request, userID *string) bool {
+	principal := tokenPrincipal(r)
+	if principal == nil {
+		return true
+	}
+	if *userID == "" {
+		*userID = principal.UserID
+	}
+	if *userID != principal.UserID {
+		http.Error(w, "Access tokens can only act for their own user", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireSessionUser - The caller's user ID when they signed in with a session JWT; 401/403 otherwise
+func requireSessionUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	principal := requestPrincipal(r)
+	if principal == nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return "", false
+	}
+	if principal.Method != PrincipalSession {
+		http.Error(w, "Access tokens and service accounts can only be managed from a signed-in session", http.StatusForbidden)
+		return "", false
+	}
+	return principal.UserID, true
+}
+
+// requireProjectAdmin - 401/403/404 unless the session user owns the project or is an admin
+func requireProjectAdmin(w http.ResponseWriter, r *http.Request, projectID string) bool {
+	userID, ok := requireSessionUser(w, r)
+	if !ok {
+		return false
+	}
+	return requireProjectOwner(w, r, projectID, userID)
+}
+
+// requireProjectEditor - 401/403/404 unless the caller, by session or a token that may reach
+// the project, owns it or is an admin
+func requireProjectEditor(w http.ResponseWriter, r *http.Request, projectID string) bool {
+	userID := requestUserID(r)
+	if userID == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+	}
+	if !tokenAllowsProject(r, projectID) {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return false
+	}
+	return requireProjectOwner(w, r, projectID, userID)
+}
+
+// requireProjectOwner - 403/404 unless userID owns the project or is an admin
+func requireProjectOwner(w http.ResponseWriter, r *http.Request, projectID, userID string) bool {
+	if db == nil {
+		http.Error(w, "Database not available", http.StatusServiceUnavailable)
+		return false
+	}
+
+	var ownerID, role string
+	err := db.QueryRowContext(r.Context(),
+		"SELECT COALESCE(p.owner_id, ''), COALESCE(u.role, '') FROM projects p LEFT JOIN users u ON u.id = $2 WHERE p.id = $1",
+		projectID, userID,
+	).Scan(&ownerID, &role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if ownerID != userID && role != "admin" {
+		http.Error(w, "Project admin role required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// ========================================
+// ACCESS TOKEN HANDLERS
+// ========================================
+
+type accessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+type serviceAccountRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+func requireAccessTokens(w http.ResponseWriter) bool {
+	if accessTokens == nil {
+		http.Error(w, "Access tokens unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// mintAccessToken - Validate a token request, mint the token for userID and write it once
+func mintAccessToken(w http.ResponseWriter, r *http.Request, userID string) {
+	// Checked again here so no handler can mint on a token's authority
+	createdBy, ok := requireSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request accessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 100 {
+		http.Error(w, "name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	if err := validateAccessTokenScopes(request.Scopes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.ExpiresInDays == 0 {
+		request.ExpiresInDays = defaultAccessTokenDays
+	}
+	if request.ExpiresInDays < 1 || request.ExpiresInDays > maxAccessTokenDays {
+		http.Error(w, fmt.Sprintf("expires_in_days must be between 1 and %d", maxAccessTokenDays), http.StatusBadRequest)
+		return
+	}
+
+	token, err := accessTokens.CreateToken(r.Context(), userID, request.Name, request.Scopes,
+		time.Duration(request.ExpiresInDays)*24*time.Hour, createdBy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).With("tokens").Audit("Access token created", map[string]interface{}{
+		"token_id":   token.ID,
+		"owner_id":   token.UserID,
+		"scopes":     token.Scopes,
+		"expires_at": token.ExpiresAt,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+// writeAccessTokens - List userID's tokens
+func writeAccessTokens(w http.ResponseWriter, r *http.Request, userID string) {
+	tokens, err := accessTokens.ListTokens(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens":      tokens,
+		"scopes":      accessTokenScopes,
+		"total_count": len(tokens),
+		"timestamp":   time.Now(),
+	})
+}
+
+// revokeAccessToken - Revoke one of userID's tokens
+func revokeAccessToken(w http.ResponseWriter, r *http.Request, userID string) {
+	token, err := accessTokens.RevokeToken(r.Context(), userID, mux.Vars(r)["tokenID"])
+	if err == sql.ErrNoRows {
+		http.Error(w, "Access token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).With("tokens").Audit("Access token revoked", map[string]interface{}{
+		"token_id": token.ID,
+		"owner_id": token.UserID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+// requireTokenOwner - The human user of the session, who may manage their own tokens
+func requireTokenOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !requireAccessTokens(w) {
+		return "", false
+	}
+	userID, ok := requireSessionUser(w, r)
+	if !ok {
+		return "", false
+	}
+
+	var role string
+	err := db.QueryRowContext(r.Context(), "SELECT COALESCE(role, '') FROM users WHERE id = $1", userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return "", false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	if role == serviceAccountRole {
+		http.Error(w, "Service account tokens are managed by project admins", http.StatusForbidden)
+		return "", false
+	}
+	return userID, true
+}
+
+// createMyAccessTokenHandler - Mint a personal access token; the plaintext is only returned here
+func createMyAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if userID, ok := requireTokenOwner(w, r); ok {
+		mintAccessToken(w, r, userID)
+	}
+}
+
+// listMyAccessTokensHandler - List the caller's tokens without their secrets
+func listMyAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if userID, ok := requireTokenOwner(w, r); ok {
+		writeAccessTokens(w, r, userID)
+	}
+}
+
+// revokeMyAccessTokenHandler - Revoke one of the caller's tokens
+func revokeMyAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if userID, ok := requireTokenOwner(w, r); ok {
+		revokeAccessToken(w, r, userID)
+	}
+}
+
+// requireServiceAccount - The {accountID} service account of project {id}, for its project admins
+func requireServiceAccount(w http.ResponseWriter, r *http.Request) (*ServiceAccount, bool) {
+	vars := mux.Vars(r)
+	if !requireAccessTokens(w) || !requireProjectAdmin(w, r, vars["id"]) {
+		return nil, false
+	}
+	account, err := accessTokens.GetServiceAccount(r.Context(), vars["id"], vars["accountID"])
+	if err == sql.ErrNoRows {
+		http.Error(w, "Service account not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return account, true
+}
+
+// listServiceAccountsHandler - List a project's service accounts
+func listServiceAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["id"]
+	if !requireAccessTokens(w) || !requireProjectAdmin(w, r, projectID) {
+		return
+	}
+
+	accounts, err := accessTokens.ListServiceAccounts(r.Context(), projectID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"service_accounts": accounts,
+		"total_count":      len(accounts),
+		"timestamp":        time.Now(),
+	})
+}
+
+// createServiceAccountHandler - Add a service account to a project
+func createServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["id"]
+	if !requireAccessTokens(w) || !requireProjectAdmin(w, r, projectID) {
+		return
+	}
+
+	var request serviceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !serviceAccountNamePattern.MatchString(request.Name) {
+		http.Error(w, "name must be 2-63 lowercase letters, digits or hyphens", http.StatusBadRequest)
+		return
+	}
+
+	account, err := accessTokens.CreateServiceAccount(r.Context(), projectID, request.Name, request.Description, requestUserID(r))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A user named svc-"+request.Name+" already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).With("tokens").Audit("Service account created", map[string]interface{}{
+		"service_account_id": account.ID,
+		"project_id":         projectID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
+// disableServiceAccountHandler - Disable a service account and revoke its tokens
+func disableServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := requireServiceAccount(w, r)
+	if !ok {
+		return
+	}
+
+	account, err := accessTokens.DisableServiceAccount(r.Context(), account.ProjectID, account.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).With("tokens").Audit("Service account disabled", map[string]interface{}{
+		"service_account_id": account.ID,
+		"project_id":         account.ProjectID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// createServiceAccountTokenHandler - Mint a token for a service account
+func createServiceAccountTokenHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := requireServiceAccount(w, r)
+	if !ok {
+		return
+	}
+	if account.DisabledAt != nil {
+		http.Error(w, "Service account is disabled", http.StatusConflict)
+		return
+	}
+	mintAccessToken(w, r, account.ID)
+}
+
+// listServiceAccountTokensHandler - List a service account's tokens
+func listServiceAccountTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if account, ok := requireServiceAccount(w, r); ok {
+		writeAccessTokens(w, r, account.ID)
+	}
+}
+
+// revokeServiceAccountTokenHandler - Revoke a service account's token
+func revokeServiceAccountTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if account, ok := requireServiceAccount(w, r); ok {
+		revokeAccessToken(w, r, account.ID)
+	}
+}
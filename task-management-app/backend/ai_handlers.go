@@ -2,15 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // SimpleAIHandler provides basic AI-powered task management features
@@ -42,7 +47,7 @@ func (ai *SimpleAIHandler) CreateTaskWithBasicAI() http.HandlerFunc {
 		}
 
 		// Create task in database
-		resp, err := couchDBRequest("PUT", "/"+task.ID, task)
+		resp, err := couchDBRequest(r.Context(), "PUT", "/"+task.ID, task)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to create task: %v", err), http.StatusInternalServerError)
 			return
@@ -203,7 +208,22 @@ func containsString(s, substr string) bool {
 }
 
 // couchDBRequest makes an HTTP request to CouchDB
-func couchDBRequest(method, path string, data interface{}) (*http.Response, error) {
+func couchDBRequest(ctx context.Context, method, path string, data interface{}) (resp *http.Response, err error) {
+	ctx, span := tracer.Start(ctx, "couchdb "+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "couchdb"),
+		attribute.String("db.namespace", couchConfig.Database),
+		attribute.String("http.request.method", method),
+	))
+	defer func() {
+		if err == nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+			if resp.StatusCode >= 400 {
+				span.SetStatus(codes.Error, resp.Status)
+			}
+		}
+		endSpan(span, err)
+	}()
+
 	url := fmt.Sprintf("http://%s:%s/%s%s", couchConfig.Host, couchConfig.Port, couchConfig.Database, path)
 
 	var body io.Reader
@@ -215,10 +235,11 @@ func couchDBRequest(method, path string, data interface{}) (*http.Response, erro
 		body = bytes.NewBuffer(jsonData)
 	}
 
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	if couchConfig.Username != "" && couchConfig.Password != "" {
 		req.SetBasicAuth(couchConfig.Username, couchConfig.Password)
@@ -243,9 +264,10 @@ func broadcastUpdate(eventType string, data interface{}) {
 
 	select {
 	case hub.broadcast <- wsMessage:
-		log.Printf("Broadcasted %s event", eventType)
+		componentLogger("websocket").Debug("Broadcast event", map[string]interface{}{"type": eventType})
 	default:
-		log.Printf("Broadcast channel full, skipping %s event", eventType)
+		recordWSDrop(WSDropHubFull)
+		componentLogger("websocket").Warn("Broadcast channel full, event dropped", map[string]interface{}{"type": eventType})
 	}
 }
 
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"sync"
 	"time"
@@ -1095,7 +1094,7 @@ type NotificationBatchProcessor struct {
 // Notification batch
 type NotificationBatch struct {
 	BatchID       string                 `json:"batch_id"`
-	Notifications []*Notification        `json:"notifications"`
+	Notifications []*NotificationMessage `json:"notifications"`
 	CreatedAt     time.Time              `json:"created_at"`
 	ProcessAt     time.Time              `json:"process_at"`
 	Status        string                 `json:"status"`
@@ -1453,7 +1452,7 @@ func NewCollaborationEngine() *CollaborationEngine {
 func (ce *CollaborationEngine) HandleWebSocketConnection(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		requestLogger(r).With("collaboration").Error(err, "WebSocket upgrade failed", nil)
 		return
 	}
 	defer conn.Close()
@@ -1461,7 +1460,7 @@ func (ce *CollaborationEngine) HandleWebSocketConnection(w http.ResponseWriter,
 	// Extract user information from request (JWT token, etc.)
 	userID := extractUserID(r)
 	if userID == "" {
-		log.Printf("No user ID found in request")
+		requestLogger(r).With("collaboration").Warn("Collaboration connection without a user ID", nil)
 		return
 	}
 
@@ -1490,7 +1489,7 @@ func (ce *CollaborationEngine) HandleWebSocketConnection(w http.ResponseWriter,
 		var msg CollaborationMessage
 		err := conn.ReadJSON(&msg)
 		if err != nil {
-			log.Printf("Error reading WebSocket message: %v", err)
+			componentLogger("collaboration").Debug("Collaboration connection closed", map[string]interface{}{"user_id": userID, "error": err.Error()})
 			break
 		}
 
@@ -1501,7 +1500,7 @@ func (ce *CollaborationEngine) HandleWebSocketConnection(w http.ResponseWriter,
 		// Process message with AI-enhanced routing
 		err = ce.processCollaborationMessage(collabConn, &msg)
 		if err != nil {
-			log.Printf("Error processing message: %v", err)
+			componentLogger("collaboration").Warn("Failed to process collaboration message", map[string]interface{}{"user_id": userID, "type": msg.Type, "error": err.Error()})
 			ce.sendErrorMessage(collabConn, err.Error())
 		}
 	}
@@ -1594,6 +1593,7 @@ func (ce *CollaborationEngine) handleDecisionCreated(conn *CollaborationConnecti
 
 	// Set up automated reminders and nudges
 	ce.scheduleDecisionReminders(decision)
+	publishWebhookEvent(WebhookDecisionCreated, decision)
 
 	return nil
 }
@@ -0,0 +1,165 @@
+package main
+
+// Optimistic concurrency
+// Tasks and projects carry a version that every update increments. GET
+// responses send it as a strong ETag ("3"); PUT must send it back in
+// If-Match, and is refused with 412 and the current representation when the
+// row has moved on. PATCH takes an RFC 7396 JSON Merge Patch and applies it
+// to the latest version; with If-Match it is checked the same way as PUT.
+// Members the server owns, such as id and version, cannot be patched.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errVersionConflict - The row changed after the version an update was based on
+var errVersionConflict = errors.New("version conflict")
+
+// maxMergePatchBytes - Largest PATCH body accepted
+const maxMergePatchBytes = 1 << 20
+
+// mergePatchAttempts - Re-applications of an unconditional PATCH racing other writers
+const mergePatchAttempts = 3
+
+// entityTag - ETag of a resource version
+func entityTag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagListMatches - Strong comparison of an If-Match / If-None-Match list against version
+func etagListMatches(header string, version int) bool {
+	tag := entityTag(version)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeVersioned - Write a representation with its ETag
+func writeVersioned(w http.ResponseWriter, status, version int, v interface{}) {
+	w.Header().Set("ETag", entityTag(version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// notModified - Answer 304 when If-None-Match already names this version
+func notModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagListMatches(header, version) {
+		return false
+	}
+	w.Header().Set("ETag", entityTag(version))
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkIfMatch - Verify If-Match against the current version; 428 when it is
+// required but missing, 412 with the current representation when stale
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int, current interface{}, required bool) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if required {
+			http.Error(w, "If-Match header required; GET the resource and send its ETag", http.StatusPreconditionRequired)
+			return false
+		}
+		return true
+	}
+	if etagListMatches(header, version) {
+		return true
+	}
+	writeVersioned(w, http.StatusPreconditionFailed, version, current)
+	return false
+}
+
+// Members of each resource that only the server sets
+var (
+	taskServerMembers    = []string{"id", "created_at", "updated_at", "version"}
+	projectServerMembers = []string{"id", "owner_id", "created_at", "updated_at", "version"}
+)
+
+// readMergePatch - The body of a PATCH request as a JSON Merge Patch; 400 when it
+// touches one of serverMembers rather than silently merging it
+func readMergePatch(w http.ResponseWriter, r *http.Request, serverMembers []string) (interface{}, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		w.Header().Set("Accept-Patch", "application/merge-patch+json")
+		http.Error(w, "PATCH requires Content-Type: application/merge-patch+json", http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMergePatchBytes+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(body) > maxMergePatchBytes {
+		http.Error(w, "Patch too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	var patch interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		http.Error(w, "Merge patch must be a JSON object", http.StatusBadRequest)
+		return nil, false
+	}
+	for _, member := range serverMembers {
+		if _, present := members[member]; present {
+			http.Error(w, fmt.Sprintf("%s is set by the server and cannot be patched", member), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return patch, true
+}
+
+// applyMergePatch - Apply patch to the JSON form of current and decode the result into out
+func applyMergePatch(current interface{}, patch interface{}, out interface{}) error {
+	document, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var target interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(merged, out)
+}
+
+// mergePatch - RFC 7396: objects merge recursively, null removes a member,
+// anything else replaces the target
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
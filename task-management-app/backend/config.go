@@ -0,0 +1,769 @@
+package main
+
+// Configuration
+// Every setting lives in Config and is described once in settings(): its
+// YAML key, environment variable, flag and whether it is a secret. Values are
+// applied in increasing precedence:
+//
+//	defaults < YAML file (-config or CONFIG_FILE) < environment < flags
+//
+// Any setting can also be read from a file - typically a mounted Kubernetes
+// or Docker secret - with <ENV>_FILE (e.g. DB_PASSWORD_FILE) or <key>_file in
+// YAML (e.g. database.password_file). The loaded config is validated before
+// anything starts, and GET /api/v1/admin/config shows it with secrets
+// redacted together with where each value came from.
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"task-management-api/health"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config - All application settings
+type Config struct {
+	Server        ServerConfig
+	Auth          AuthConfig
+	Database      DatabaseConfig
+	CouchDB       CouchDBConfig
+	Notifications NotificationPipelineConfig
+	Logging       LoggerConfig
+	Tracing       TracingConfig
+	Health        HealthCheckConfig
+	Shutdown      ShutdownConfig
+	InboundEmail  InboundEmailConfig
+	SlashCommands SlashCommandConfig
+	RateLimit     RateLimitConfig
+	Idempotency   IdempotencyConfig
+
+	file    string
+	sources map[string]string // setting key -> where its value came from
+}
+
+// ServerConfig - HTTP listener settings
+type ServerConfig struct {
+	Port           string
+	CORSOrigins    []string
+	TrustedProxies []string // proxies whose X-Forwarded-For names the client
+}
+
+// DatabaseConfig - PostgreSQL connection; URL wins over the individual fields
+type DatabaseConfig struct {
+	URL      string
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+}
+
+// DSN - Connection string for lib/pq
+func (dc DatabaseConfig) DSN() string {
+	if dc.URL != "" {
+		return dc.URL
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(dc.User, dc.Password),
+		Host:     dc.Host + ":" + dc.Port,
+		Path:     "/" + dc.Name,
+		RawQuery: "sslmode=" + url.QueryEscape(dc.SSLMode),
+	}
+	return dsn.String()
+}
+
+// Where a setting's value came from
+const (
+	configSourceDefault = "default"
+	configSourceFile    = "config file"
+	configSourceEnv     = "env"
+	configSourceSecret  = "secret file"
+	configSourceFlag    = "flag"
+)
+
+const redactedValue = "********"
+
+// configSetting - One setting and the field it is stored in
+type configSetting struct {
+	Key    string      // YAML path and flag name, e.g. "database.password"
+	Env    string      // environment variable
+	Value  interface{} // pointer into Config
+	Secret bool
+	Usage  string
+}
+
+var appConfig *Config
+
+// defaultConfig - Values used when no source sets a setting
+func defaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:        "8080",
+			CORSOrigins: []string{"http://localhost:3000", "http://localhost:5173"},
+		},
+		Database: DatabaseConfig{
+			Host:    "localhost",
+			Port:    "5432",
+			User:    "taskuser",
+			Name:    "taskmanagement",
+			SSLMode: "disable",
+		},
+		CouchDB: CouchDBConfig{
+			Host:     "localhost",
+			Port:     "5984",
+			Username: "admin",
+			Database: "taskmanagement",
+		},
+		Notifications: NotificationPipelineConfig{
+			SMTPPort:      587,
+			SMTPFrom:      "noreply@taskmanagement.local",
+			SMTPTLS:       true,
+			TemplatesDir:  "templates/notifications",
+			DefaultLocale: "en",
+			BaseURL:       "http://localhost:3002",
+			Throttle: NotificationThrottleConfig{
+				DedupWindow:        5 * time.Minute,
+				BurstWindow:        time.Minute,
+				BurstThreshold:     5,
+				RecipientRateLimit: 30,
+				ChannelRateLimit:   120,
+			},
+		},
+		Logging: LoggerConfig{
+			Dir:             "logs",
+			Format:          LogFormatText,
+			Level:           LogLevelInfo,
+			MaxSizeMB:       100,
+			MaxAge:          24 * time.Hour,
+			Retention:       7 * 24 * time.Hour,
+			MaxBackups:      14,
+			Compress:        true,
+			Color:           true,
+			BufferSize:      5000,
+			ReportRetention: 30 * 24 * time.Hour,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "task-management-api",
+			Version:     "dev",
+		},
+		Health: HealthCheckConfig{
+			Config: health.Config{
+				CacheTTL:        10 * time.Second,
+				RefreshInterval: 15 * time.Second,
+				Timeout:         3 * time.Second,
+				HistorySize:     20,
+				Service:         "Task Management API",
+			},
+			NotificationQueueWarn: 500,
+			NotificationQueueMax:  5000,
+			MaxHeapMB:             512,
+		},
+		Shutdown: ShutdownConfig{
+			GracePeriod:      30 * time.Second,
+			ReadinessDelay:   5 * time.Second,
+			WSReconnectAfter: 3 * time.Second,
+			TimerStateFile:   "data/active_timers.json",
+		},
+		InboundEmail: InboundEmailConfig{
+			ListenAddr: ":2525",
+			MaxSize:    10 << 20,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   RateLimitStoreMemory,
+			Groups: map[string]RateLimit{
+				"ai":                  {Requests: 30, Period: time.Minute, Burst: 10},
+				"analytics":           {Requests: 30, Period: time.Minute, Burst: 10},
+				"admin":               {Requests: 120, Period: time.Minute},
+				defaultRateLimitGroup: {Requests: 600, Period: time.Minute, Burst: 100},
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			Enabled: true,
+			Store:   IdempotencyStorePostgres,
+			TTL:     24 * time.Hour,
+		},
+	}
+}
+
+// settings - Every configurable field, in the order shown by the admin endpoint
+func (c *Config) settings() []configSetting {
+	n := &c.Notifications
+	return []configSetting{
+		{Key: "server.port", Env: "PORT", Value: &c.Server.Port, Usage: "HTTP listen port"},
+		{Key: "server.cors_origins", Env: "CORS_ALLOWED_ORIGINS", Value: &c.Server.CORSOrigins, Usage: "comma-separated allowed CORS origins"},
+		{Key: "server.trusted_proxies", Env: "TRUSTED_PROXIES", Value: &c.Server.TrustedProxies, Usage: "comma-separated proxy IPs or CIDRs whose X-Forwarded-For is trusted"},
+
+		{Key: "auth.jwt_secret", Env: "JWT_SECRET", Value: &c.Auth.JWTSecret, Secret: true, Usage: "HMAC-SHA256 key session JWTs are signed with"},
+		{Key: "auth.jwt_issuer", Env: "JWT_ISSUER", Value: &c.Auth.JWTIssuer, Usage: "required iss claim of session JWTs; empty accepts any"},
+		{Key: "auth.jwt_audience", Env: "JWT_AUDIENCE", Value: &c.Auth.JWTAudience, Usage: "required aud claim of session JWTs; empty accepts any"},
+
+		{Key: "database.url", Env: "DATABASE_URL", Value: &c.Database.URL, Secret: true, Usage: "PostgreSQL URL; overrides the other database settings"},
+		{Key: "database.host", Env: "DB_HOST", Value: &c.Database.Host},
+		{Key: "database.port", Env: "DB_PORT", Value: &c.Database.Port},
+		{Key: "database.user", Env: "DB_USER", Value: &c.Database.User},
+		{Key: "database.password", Env: "DB_PASSWORD", Value: &c.Database.Password, Secret: true},
+		{Key: "database.name", Env: "DB_NAME", Value: &c.Database.Name},
+		{Key: "database.sslmode", Env: "DB_SSLMODE", Value: &c.Database.SSLMode},
+
+		{Key: "couchdb.host", Env: "COUCHDB_HOST", Value: &c.CouchDB.Host},
+		{Key: "couchdb.port", Env: "COUCHDB_PORT", Value: &c.CouchDB.Port},
+		{Key: "couchdb.username", Env: "COUCHDB_USER", Value: &c.CouchDB.Username},
+		{Key: "couchdb.password", Env: "COUCHDB_PASS", Value: &c.CouchDB.Password, Secret: true},
+		{Key: "couchdb.database", Env: "COUCHDB_DB", Value: &c.CouchDB.Database},
+
+		{Key: "notifications.slack_webhook_url", Env: "SLACK_WEBHOOK_URL", Value: &n.SlackWebhookURL, Secret: true},
+		{Key: "notifications.mattermost_webhook_url", Env: "MATTERMOST_WEBHOOK_URL", Value: &n.MattermostWebhookURL, Secret: true},
+		{Key: "notifications.smtp_host", Env: "SMTP_HOST", Value: &n.SMTPHost},
+		{Key: "notifications.smtp_port", Env: "SMTP_PORT", Value: &n.SMTPPort},
+		{Key: "notifications.smtp_username", Env: "SMTP_USERNAME", Value: &n.SMTPUsername},
+		{Key: "notifications.smtp_password", Env: "SMTP_PASSWORD", Value: &n.SMTPPassword, Secret: true},
+		{Key: "notifications.smtp_from", Env: "SMTP_FROM", Value: &n.SMTPFrom},
+		{Key: "notifications.smtp_tls", Env: "SMTP_TLS", Value: &n.SMTPTLS},
+		{Key: "notifications.webhook_url", Env: "NOTIFICATION_WEBHOOK_URL", Value: &n.WebhookURL, Secret: true},
+		{Key: "notifications.webhook_headers", Env: "NOTIFICATION_WEBHOOK_HEADERS", Value: &n.WebhookHeaders, Secret: true, Usage: `"Name: value, Other: value"`},
+		{Key: "notifications.teams_webhook_url", Env: "TEAMS_WEBHOOK_URL", Value: &n.TeamsWebhookURL, Secret: true},
+		{Key: "notifications.discord_webhook_url", Env: "DISCORD_WEBHOOK_URL", Value: &n.DiscordWebhookURL, Secret: true},
+		{Key: "notifications.sms_provider_url", Env: "SMS_PROVIDER_URL", Value: &n.SMSProviderURL, Secret: true},
+		{Key: "notifications.sms_provider_headers", Env: "SMS_PROVIDER_HEADERS", Value: &n.SMSProviderHeaders, Secret: true, Usage: `"Name: value, Other: value"`},
+		{Key: "notifications.sms_from", Env: "SMS_FROM", Value: &n.SMSFrom},
+		{Key: "notifications.rules_file", Env: "NOTIFICATION_RULES_FILE", Value: &n.RulesFile},
+		{Key: "notifications.templates_dir", Env: "NOTIFICATION_TEMPLATES_DIR", Value: &n.TemplatesDir},
+		{Key: "notifications.default_locale", Env: "NOTIFICATION_DEFAULT_LOCALE", Value: &n.DefaultLocale},
+		{Key: "notifications.base_url", Env: "APP_BASE_URL", Value: &n.BaseURL, Usage: "public URL used in notification links"},
+		{Key: "notifications.dedup_window", Env: "NOTIFICATION_DEDUP_WINDOW", Value: &n.Throttle.DedupWindow},
+		{Key: "notifications.burst_window", Env: "NOTIFICATION_BURST_WINDOW", Value: &n.Throttle.BurstWindow},
+		{Key: "notifications.burst_threshold", Env: "NOTIFICATION_BURST_THRESHOLD", Value: &n.Throttle.BurstThreshold},
+		{Key: "notifications.recipient_rate_limit", Env: "NOTIFICATION_RECIPIENT_RATE_LIMIT", Value: &n.Throttle.RecipientRateLimit},
+		{Key: "notifications.channel_rate_limit", Env: "NOTIFICATION_CHANNEL_RATE_LIMIT", Value: &n.Throttle.ChannelRateLimit},
+
+		{Key: "logging.dir", Env: "LOG_DIR", Value: &c.Logging.Dir},
+		{Key: "logging.format", Env: "LOG_FORMAT", Value: &c.Logging.Format, Usage: "text, json or logfmt"},
+		{Key: "logging.level", Env: "LOG_LEVEL", Value: &c.Logging.Level},
+		{Key: "logging.component_levels", Env: "LOG_COMPONENT_LEVELS", Value: &c.Logging.ComponentLevels, Usage: `e.g. "http=WARN,notifications=DEBUG"`},
+		{Key: "logging.max_size_mb", Env: "LOG_MAX_SIZE_MB", Value: &c.Logging.MaxSizeMB},
+		{Key: "logging.max_age", Env: "LOG_MAX_AGE", Value: &c.Logging.MaxAge},
+		{Key: "logging.retention", Env: "LOG_RETENTION", Value: &c.Logging.Retention},
+		{Key: "logging.max_backups", Env: "LOG_MAX_BACKUPS", Value: &c.Logging.MaxBackups},
+		{Key: "logging.compress", Env: "LOG_COMPRESS", Value: &c.Logging.Compress},
+		{Key: "logging.color", Env: "LOG_COLOR", Value: &c.Logging.Color},
+		{Key: "logging.buffer_size", Env: "LOG_BUFFER_SIZE", Value: &c.Logging.BufferSize},
+		{Key: "logging.report_retention", Env: "LOG_REPORT_RETENTION", Value: &c.Logging.ReportRetention, Usage: "security and log reports; 0 keeps them"},
+
+		{Key: "tracing.exporter", Env: "OTEL_TRACES_EXPORTER", Value: &c.Tracing.Exporter, Usage: "otlp, stdout or none"},
+		{Key: "tracing.otlp_endpoint", Env: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: &c.Tracing.OTLPEndpoint},
+		{Key: "tracing.service_name", Env: "OTEL_SERVICE_NAME", Value: &c.Tracing.ServiceName},
+		{Key: "tracing.version", Env: "APP_VERSION", Value: &c.Tracing.Version},
+
+		{Key: "health.cache_ttl", Env: "HEALTH_CHECK_CACHE_TTL", Value: &c.Health.CacheTTL},
+		{Key: "health.interval", Env: "HEALTH_CHECK_INTERVAL", Value: &c.Health.RefreshInterval},
+		{Key: "health.timeout", Env: "HEALTH_CHECK_TIMEOUT", Value: &c.Health.Timeout},
+		{Key: "health.history", Env: "HEALTH_CHECK_HISTORY", Value: &c.Health.HistorySize},
+		{Key: "health.notification_queue_warn", Env: "HEALTH_NOTIFICATION_QUEUE_WARN", Value: &c.Health.NotificationQueueWarn},
+		{Key: "health.notification_queue_max", Env: "HEALTH_NOTIFICATION_QUEUE_MAX", Value: &c.Health.NotificationQueueMax},
+		{Key: "health.max_heap_mb", Env: "HEALTH_MAX_HEAP_MB", Value: &c.Health.MaxHeapMB},
+
+		{Key: "shutdown.grace_period", Env: "SHUTDOWN_GRACE_PERIOD", Value: &c.Shutdown.GracePeriod},
+		{Key: "shutdown.readiness_delay", Env: "SHUTDOWN_READINESS_DELAY", Value: &c.Shutdown.ReadinessDelay},
+		{Key: "shutdown.ws_reconnect_after", Env: "SHUTDOWN_WS_RECONNECT_AFTER", Value: &c.Shutdown.WSReconnectAfter},
+		{Key: "shutdown.timer_state_file", Env: "TIMER_STATE_FILE", Value: &c.Shutdown.TimerStateFile},
+
+		{Key: "inbound_email.mode", Env: "INBOUND_EMAIL_MODE", Value: &c.InboundEmail.Mode, Usage: "smtp, lmtp, maildir or empty to disable"},
+		{Key: "inbound_email.addr", Env: "INBOUND_EMAIL_ADDR", Value: &c.InboundEmail.ListenAddr},
+		{Key: "inbound_email.maildir", Env: "INBOUND_MAILDIR", Value: &c.InboundEmail.Maildir},
+		{Key: "inbound_email.domain", Env: "INBOUND_EMAIL_DOMAIN", Value: &c.InboundEmail.Domain},
+		{Key: "inbound_email.max_bytes", Env: "INBOUND_EMAIL_MAX_BYTES", Value: &c.InboundEmail.MaxSize},
+		{Key: "inbound_email.authserv_id", Env: "INBOUND_EMAIL_AUTHSERV_ID", Value: &c.InboundEmail.AuthServID, Usage: "authserv-id of the MTA whose Authentication-Results headers are trusted"},
+		{Key: "inbound_email.reply_token_secret", Env: "INBOUND_EMAIL_REPLY_TOKEN_SECRET", Value: &c.InboundEmail.ReplyTokenSecret, Secret: true, Usage: "key for per-user task+{id}+{token} reply addresses"},
+
+		{Key: "slash_commands.slack_signing_secret", Env: "SLACK_SIGNING_SECRET", Value: &c.SlashCommands.SlackSigningSecret, Secret: true},
+		{Key: "slash_commands.mattermost_command_token", Env: "MATTERMOST_COMMAND_TOKEN", Value: &c.SlashCommands.MattermostCommandToken, Secret: true},
+
+		{Key: "rate_limit.enabled", Env: "RATE_LIMIT_ENABLED", Value: &c.RateLimit.Enabled},
+		{Key: "rate_limit.store", Env: "RATE_LIMIT_STORE", Value: &c.RateLimit.Store, Usage: "memory (one replica) or postgres (shared by all replicas)"},
+		{Key: "rate_limit.groups", Env: "RATE_LIMIT_GROUPS", Value: &c.RateLimit.Groups, Usage: `requests/period[:burst] per route group (ai, analytics, admin, default), e.g. "ai=30/1m:10"; unlisted groups keep their defaults, 0 disables a group`},
+
+		{Key: "idempotency.enabled", Env: "IDEMPOTENCY_ENABLED", Value: &c.Idempotency.Enabled},
+		{Key: "idempotency.store", Env: "IDEMPOTENCY_STORE", Value: &c.Idempotency.Store, Usage: "postgres (shared by all replicas, falls back to memory without a database) or memory"},
+		{Key: "idempotency.ttl", Env: "IDEMPOTENCY_TTL", Value: &c.Idempotency.TTL, Usage: "how long responses are kept for replay to Idempotency-Key retries"},
+	}
+}
+
+// ConfigError - Every problem found while loading, reported together
+type ConfigError struct {
+	Problems []string
+}
+
+func (ce *ConfigError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(ce.Problems, "\n  - ")
+}
+
+func (ce *ConfigError) add(format string, args ...interface{}) {
+	ce.Problems = append(ce.Problems, fmt.Sprintf(format, args...))
+}
+
+// LoadConfig - Build the config from defaults, the YAML file, the environment and args
+func LoadConfig(args []string) (*Config, error) {
+	config := defaultConfig()
+	config.sources = make(map[string]string)
+	settings := config.settings()
+	problems := &ConfigError{}
+
+	// Flags are parsed first so -config can name the file, but applied last
+	flags := flag.NewFlagSet("task-management-api", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML config file (env CONFIG_FILE)")
+	flagValues := make(map[string]string)
+	for _, setting := range settings {
+		key := setting.Key
+		usage := setting.Usage
+		if usage == "" {
+			usage = key
+		}
+		flags.Func(key, usage+" (env "+setting.Env+")", func(value string) error {
+			flagValues[key] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	config.file = *configFile
+	if config.file != "" {
+		values, err := readConfigFile(config.file, settings)
+		if err != nil {
+			problems.add("%s: %v", config.file, err)
+		}
+		for _, setting := range settings {
+			if value, ok := values[setting.Key]; ok {
+				config.apply(setting, value, configSourceFile, problems)
+			}
+			if path, ok := values[setting.Key+"_file"]; ok {
+				config.applySecretFile(setting, path, setting.Key+"_file", problems)
+			}
+		}
+	}
+
+	for _, setting := range settings {
+		value, hasValue := os.LookupEnv(setting.Env)
+		path, hasFile := os.LookupEnv(setting.Env + "_FILE")
+		switch {
+		case hasValue && hasFile && value != "" && path != "":
+			problems.add("%s: set either %s or %s_FILE, not both", setting.Key, setting.Env, setting.Env)
+		case hasFile && path != "":
+			config.applySecretFile(setting, path, setting.Env+"_FILE", problems)
+		case hasValue && value != "":
+			config.apply(setting, value, configSourceEnv, problems)
+		}
+	}
+
+	for _, setting := range settings {
+		if value, ok := flagValues[setting.Key]; ok {
+			config.apply(setting, value, configSourceFlag, problems)
+		}
+	}
+
+	config.Health.Version = config.Tracing.Version
+	config.validate(problems)
+	if len(problems.Problems) > 0 {
+		return nil, problems
+	}
+	return config, nil
+}
+
+// readConfigFile - Flatten the YAML file to "section.key" -> value
+func readConfigFile(path string, settings []configSetting) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(settings)*2)
+	for _, setting := range settings {
+		known[setting.Key] = true
+		known[setting.Key+"_file"] = true
+	}
+
+	values := make(map[string]string)
+	var unknown []string
+	var walk func(prefix string, node interface{})
+	walk = func(prefix string, node interface{}) {
+		if known[prefix] {
+			values[prefix] = yamlScalar(node)
+			return
+		}
+		section, ok := node.(map[string]interface{})
+		if !ok {
+			unknown = append(unknown, prefix)
+			return
+		}
+		for key, child := range section {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			walk(key, child)
+		}
+	}
+	walk("", document)
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return values, fmt.Errorf("unknown settings %s", strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+// yamlScalar - A YAML value in the same text form the environment uses
+func yamlScalar(node interface{}) string {
+	switch value := node.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = fmt.Sprintf("%s: %v", key, value[key])
+		}
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// applySecretFile - Read a setting from a mounted file, without the trailing newline
+func (c *Config) applySecretFile(setting configSetting, path, origin string, problems *ConfigError) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		problems.add("%s: cannot read %s: %v", setting.Key, origin, err)
+		return
+	}
+	c.apply(setting, strings.TrimRight(string(data), "\r\n"), configSourceSecret, problems)
+}
+
+// apply - Parse value into the setting's field
+func (c *Config) apply(setting configSetting, value, source string, problems *ConfigError) {
+	var err error
+	switch field := setting.Value.(type) {
+	case *string:
+		*field = value
+	case *int:
+		var parsed int
+		if parsed, err = strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			*field = parsed
+		}
+	case *int64:
+		var parsed int64
+		if parsed, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			*field = parsed
+		}
+	case *bool:
+		var parsed bool
+		if parsed, err = strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			*field = parsed
+		}
+	case *time.Duration:
+		var parsed time.Duration
+		if parsed, err = time.ParseDuration(strings.TrimSpace(value)); err == nil {
+			*field = parsed
+		}
+	case *[]string:
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	case *map[string]string:
+		*field = parseHeaderList(value)
+	case *LogLevel:
+		var parsed LogLevel
+		if parsed, err = parseLogLevel(value); err == nil {
+			*field = parsed
+		}
+	case *map[string]LogLevel:
+		var parsed map[string]LogLevel
+		if parsed, err = parseComponentLevels(value); err == nil {
+			*field = parsed
+		}
+	case *map[string]RateLimit:
+		// Merged so that setting one group keeps the defaults of the others
+		var parsed map[string]RateLimit
+		if parsed, err = parseRateLimitGroups(value); err == nil {
+			merged := make(map[string]RateLimit, len(*field)+len(parsed))
+			for group, limit := range *field {
+				merged[group] = limit
+			}
+			for group, limit := range parsed {
+				merged[group] = limit
+			}
+			*field = merged
+		}
+	default:
+		err = fmt.Errorf("unsupported setting type %T", setting.Value)
+	}
+
+	if err != nil {
+		shown := value
+		if setting.Secret {
+			shown = redactedValue
+		}
+		problems.add("%s: invalid value %q from %s: %v", setting.Key, shown, source, err)
+		return
+	}
+	c.sources[setting.Key] = source
+}
+
+// validate - Cross-field and range checks
+func (c *Config) validate(problems *ConfigError) {
+	for _, setting := range c.settings() {
+		switch field := setting.Value.(type) {
+		case *int:
+			if *field < 0 {
+				problems.add("%s: must not be negative", setting.Key)
+			}
+		case *int64:
+			if *field < 0 {
+				problems.add("%s: must not be negative", setting.Key)
+			}
+		case *time.Duration:
+			if *field < 0 {
+				problems.add("%s: must not be negative", setting.Key)
+			}
+		}
+	}
+
+	validatePort(problems, "server.port", c.Server.Port)
+	for _, origin := range c.Server.CORSOrigins {
+		if origin != "*" {
+			validateURL(problems, "server.cors_origins", origin)
+		}
+	}
+	if _, err := parseTrustedProxies(c.Server.TrustedProxies); err != nil {
+		problems.add("server.trusted_proxies: %v", err)
+	}
+
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < minJWTSecretLength {
+		problems.add("auth.jwt_secret: must be at least %d bytes", minJWTSecretLength)
+	}
+
+	if c.Database.URL != "" {
+		if parsed, err := url.Parse(c.Database.URL); err != nil || (parsed.Scheme != "postgres" && parsed.Scheme != "postgresql") {
+			problems.add("database.url: must be a postgres:// URL")
+		}
+	} else {
+		if c.Database.Password == "" {
+			problems.add("database.password: required unless database.url is set (DB_PASSWORD, DB_PASSWORD_FILE or database.password)")
+		}
+		validatePort(problems, "database.port", c.Database.Port)
+	}
+	validatePort(problems, "couchdb.port", c.CouchDB.Port)
+
+	n := c.Notifications
+	if n.SMTPHost != "" {
+		if n.SMTPPort < 1 || n.SMTPPort > 65535 {
+			problems.add("notifications.smtp_port: must be between 1 and 65535")
+		}
+		if !strings.Contains(n.SMTPFrom, "@") {
+			problems.add("notifications.smtp_from: must be an email address")
+		}
+	}
+	for key, value := range map[string]string{
+		"notifications.slack_webhook_url":      n.SlackWebhookURL,
+		"notifications.mattermost_webhook_url": n.MattermostWebhookURL,
+		"notifications.webhook_url":            n.WebhookURL,
+		"notifications.teams_webhook_url":      n.TeamsWebhookURL,
+		"notifications.discord_webhook_url":    n.DiscordWebhookURL,
+		"notifications.sms_provider_url":       n.SMSProviderURL,
+		"notifications.base_url":               n.BaseURL,
+		"tracing.otlp_endpoint":                c.Tracing.OTLPEndpoint,
+	} {
+		if value != "" {
+			validateURL(problems, key, value)
+		}
+	}
+
+	switch c.Logging.Format {
+	case LogFormatText, LogFormatJSON, LogFormatLogfmt:
+	default:
+		problems.add("logging.format: must be text, json or logfmt, got %q", c.Logging.Format)
+	}
+	switch c.Tracing.Exporter {
+	case "", "none", "otlp", "stdout":
+	default:
+		problems.add("tracing.exporter: must be otlp, stdout or none, got %q", c.Tracing.Exporter)
+	}
+	if c.Shutdown.GracePeriod == 0 {
+		problems.add("shutdown.grace_period: must be greater than zero")
+	}
+	switch c.InboundEmail.Mode {
+	case "":
+	case "smtp", "lmtp":
+		if c.InboundEmail.ListenAddr == "" {
+			problems.add("inbound_email.addr: required when inbound_email.mode is %s", c.InboundEmail.Mode)
+		}
+	case "maildir":
+		if c.InboundEmail.Maildir == "" {
+			problems.add("inbound_email.maildir: required when inbound_email.mode is maildir")
+		}
+	default:
+		problems.add("inbound_email.mode: must be smtp, lmtp, maildir or empty, got %q", c.InboundEmail.Mode)
+	}
+	if c.InboundEmail.Mode != "" && c.InboundEmail.Domain == "" {
+		problems.add("inbound_email.domain: required when inbound email is enabled")
+	}
+	if c.InboundEmail.Mode != "" && c.InboundEmail.AuthServID == "" && c.InboundEmail.ReplyTokenSecret == "" {
+		problems.add("inbound_email: set authserv_id, reply_token_secret or both so senders can be verified")
+	}
+	switch c.RateLimit.Store {
+	case RateLimitStoreMemory, RateLimitStorePostgres:
+	default:
+		problems.add("rate_limit.store: must be memory or postgres, got %q", c.RateLimit.Store)
+	}
+	for group := range c.RateLimit.Groups {
+		if !validRateLimitGroup(group) {
+			problems.add("rate_limit.groups: unknown route group %q", group)
+		}
+	}
+	switch c.Idempotency.Store {
+	case IdempotencyStoreMemory, IdempotencyStorePostgres:
+	default:
+		problems.add("idempotency.store: must be memory or postgres, got %q", c.Idempotency.Store)
+	}
+	if c.Idempotency.TTL <= 0 {
+		problems.add("idempotency.ttl: must be positive, got %s", c.Idempotency.TTL)
+	}
+}
+
+func validatePort(problems *ConfigError, key, value string) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		problems.add("%s: must be a port number between 1 and 65535, got %q", key, value)
+	}
+}
+
+func validateURL(problems *ConfigError, key, value string) {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		problems.add("%s: must be an absolute http(s) URL", key)
+	}
+}
+
+// ConfigEntry - One setting as shown by the admin endpoint
+type ConfigEntry struct {
+	Key    string `json:"key"`
+	Env    string `json:"env"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// Redacted - Every setting with secrets masked
+func (c *Config) Redacted() []ConfigEntry {
+	settings := c.settings()
+	entries := make([]ConfigEntry, 0, len(settings))
+	for _, setting := range settings {
+		value := formatConfigValue(setting.Value)
+		if setting.Secret && value != "" {
+			value = redactedValue
+		}
+		source := c.sources[setting.Key]
+		if source == "" {
+			source = configSourceDefault
+		}
+		entries = append(entries, ConfigEntry{
+			Key:    setting.Key,
+			Env:    setting.Env,
+			Value:  value,
+			Source: source,
+			Secret: setting.Secret,
+		})
+	}
+	return entries
+}
+
+// formatConfigValue - A field in the text form accepted by apply
+func formatConfigValue(value interface{}) string {
+	switch field := value.(type) {
+	case *string:
+		return *field
+	case *int:
+		return strconv.Itoa(*field)
+	case *int64:
+		return strconv.FormatInt(*field, 10)
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *time.Duration:
+		return field.String()
+	case *[]string:
+		return strings.Join(*field, ",")
+	case *map[string]string:
+		pairs := make([]string, 0, len(*field))
+		for name, val := range *field {
+			pairs = append(pairs, name+": "+val)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ", ")
+	case *LogLevel:
+		return string(*field)
+	case *map[string]LogLevel:
+		pairs := make([]string, 0, len(*field))
+		for component, level := range *field {
+			pairs = append(pairs, component+"="+string(level))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case *map[string]RateLimit:
+		return formatRateLimitGroups(*field)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// getConfigHandler - GET /admin/config: the running configuration, secrets redacted
+func getConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if appConfig == nil {
+		http.Error(w, "Configuration not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"file":     appConfig.file,
+		"settings": appConfig.Redacted(),
+	})
+}
+
+// isHelpRequest - Whether LoadConfig stopped because -h was given
+func isHelpRequest(err error) bool {
+	return errors.Is(err, flag.ErrHelp)
+}
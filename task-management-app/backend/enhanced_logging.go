@@ -1,10 +1,9 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"sort"
@@ -59,52 +58,63 @@ const (
 // EnhancedLogger - Advanced logging system with security scanning and downloadable reports
 type EnhancedLogger struct {
 	logDir             string
+	config             LoggerConfig
 	currentLogFile     *os.File
-	logBuffer          *bytes.Buffer
+	currentLogPath     string
+	currentSize        int64
+	openedAt           time.Time
+	recent             *logRing
+	subscriberMutex    sync.Mutex
+	subscribers        map[*logSubscription]struct{} // live tails of the log query API
 	colorEnabled       bool
+	minLevel           LogLevel
+	componentLevels    map[string]LogLevel
+	levelMutex         sync.RWMutex
+	writeMutex         sync.Mutex // serializes output; separate from mutex so scan code can log while holding it
 	mutex              sync.RWMutex
 	reportMutex        sync.RWMutex
 	scanResults        *SecurityScanResults
+	scanIndex          map[string]SecurityScanResults // recorded scans without their vulnerabilities
 	downloadableReports map[string]*DownloadableReport
 }
 
 // SecurityScanResults - Results from security scanning
 type SecurityScanResults struct {
-	ScanID         string
-	Timestamp      time.Time
-	ScanType       string
-	Target         string
-	Vulnerabilities []Vulnerability
-	RawOutput      string
-	Status         string
-	Summary        SecurityScanSummary
+	ScanID          string              `json:"scan_id"`
+	Timestamp       time.Time           `json:"timestamp"`
+	ScanType        string              `json:"scan_type"`
+	Target          string              `json:"target"`
+	Vulnerabilities []Vulnerability     `json:"vulnerabilities,omitempty"`
+	RawOutput       string              `json:"-"` // may quote secrets; never persisted
+	Status          string              `json:"status"`
+	Summary         SecurityScanSummary `json:"summary"`
 }
 
 // SecurityScanSummary - Summary of security scan results
 type SecurityScanSummary struct {
-	TotalVulnerabilities int
-	CriticalCount        int
-	HighCount            int
-	MediumCount          int
-	LowCount             int
-	InfoCount            int
-	Recommendations      []string
+	TotalVulnerabilities int      `json:"total"`
+	CriticalCount        int      `json:"critical"`
+	HighCount            int      `json:"high"`
+	MediumCount          int      `json:"medium"`
+	LowCount             int      `json:"low"`
+	InfoCount            int      `json:"info"`
+	Recommendations      []string `json:"recommendations"`
 }
 
 // Vulnerability - Security vulnerability information
 type Vulnerability struct {
-	ID           string
-	Title        string
-	Description  string
-	Severity     VulnerabilitySeverity
-	CVE          string
-	CVSS         float64
-	Package      string
-	Version      string
-	FixedVersion string
-	Location     string
-	LineNumber    int
-	References   []string
+	ID           string                `json:"id"`
+	Title        string                `json:"title"`
+	Description  string                `json:"description,omitempty"`
+	Severity     VulnerabilitySeverity `json:"severity"`
+	CVE          string                `json:"cve,omitempty"`
+	CVSS         float64               `json:"cvss,omitempty"`
+	Package      string                `json:"package,omitempty"`
+	Version      string                `json:"version,omitempty"`
+	FixedVersion string                `json:"fixed_version,omitempty"`
+	Location     string                `json:"location,omitempty"`
+	LineNumber   int                   `json:"line,omitempty"`
+	References   []string              `json:"references,omitempty"`
 }
 
 // VulnerabilitySeverity - Severity levels for vulnerabilities
@@ -119,41 +129,67 @@ const (
 	SeverityUnknown  VulnerabilitySeverity = "UNKNOWN"
 )
 
-// DownloadableReport - Report that can be downloaded
+// DownloadableReport - Report that can be downloaded; the content stays on disk
 type DownloadableReport struct {
-	ID          string
-	Name        string
-	Description string
-	Content     string
-	ContentType string
-	Size        int64
-	CreatedAt   time.Time
-	ExpiresAt   time.Time
-	DownloadURL string
-	Tags        []string
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Filename    string    `json:"filename"`
+	Format      string    `json:"format"`
+	ScanID      string    `json:"scan_id,omitempty"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // nil when reports are kept forever
+	DownloadURL string    `json:"download_url"`
+	Tags        []string  `json:"tags"`
 }
 
 // Initialize the enhanced logger
-func NewEnhancedLogger(logDir string) (*EnhancedLogger, error) {
+func NewEnhancedLogger(config LoggerConfig) (*EnhancedLogger, error) {
+	logDir := config.Dir
 	// Create log directory if it doesn't exist
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %v", err)
 	}
 
+	if config.Format == "" {
+		config.Format = LogFormatText
+	}
+	if config.Level == "" {
+		config.Level = LogLevelInfo
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 5000
+	}
+
 	logger := &EnhancedLogger{
 		logDir:             logDir,
-		logBuffer:          &bytes.Buffer{},
-		colorEnabled:       true,
+		config:             config,
+		recent:             newLogRing(config.BufferSize),
+		subscribers:        make(map[*logSubscription]struct{}),
+		colorEnabled:       config.Color && config.Format == LogFormatText,
+		minLevel:           config.Level,
+		componentLevels:    make(map[string]LogLevel),
 		scanResults:        &SecurityScanResults{},
+		scanIndex:          make(map[string]SecurityScanResults),
 		downloadableReports: make(map[string]*DownloadableReport),
 	}
+	for component, level := range config.ComponentLevels {
+		logger.componentLevels[component] = level
+	}
 
 	// Create new log file
 	if err := logger.rotateLogFile(); err != nil {
 		return nil, fmt.Errorf("failed to create log file: %v", err)
 	}
 
-	// Start cleanup routine for expired reports
+	logger.startRotationTimer()
+
+	// Reports and scans from earlier runs, then periodic cleanup of expired ones
+	if err := logger.loadReports(); err != nil {
+		return nil, fmt.Errorf("failed to load reports: %v", err)
+	}
 	go logger.cleanupExpiredReports()
 
 	return logger, nil
@@ -161,20 +197,30 @@ func NewEnhancedLogger(logDir string) (*EnhancedLogger, error) {
 
 // Log structured entry
 func (el *EnhancedLogger) Log(level LogLevel, component string, message string, details map[string]interface{}) {
+	el.LogContext(context.Background(), level, component, message, details)
+}
+
+// LogContext - Structured entry correlated with the trace and request active in ctx
+func (el *EnhancedLogger) LogContext(ctx context.Context, level LogLevel, component string, message string, details map[string]interface{}) {
 	entry := LogEntry{
 		Timestamp: time.Now(),
 		Level:     level,
 		Component: component,
 		Message:   message,
 		Details:   details,
-		TraceID:   el.generateTraceID(),
 	}
+	entry.TraceID, entry.RequestID = traceIDs(ctx)
 
 	el.writeLogEntry(entry)
 }
 
 // Log with error
 func (el *EnhancedLogger) LogError(component string, err error, message string, details map[string]interface{}) {
+	el.LogErrorContext(context.Background(), component, err, message, details)
+}
+
+// LogErrorContext - Error entry correlated with the trace and request active in ctx
+func (el *EnhancedLogger) LogErrorContext(ctx context.Context, component string, err error, message string, details map[string]interface{}) {
 	entry := LogEntry{
 		Timestamp: time.Now(),
 		Level:     LogLevelError,
@@ -182,8 +228,8 @@ func (el *EnhancedLogger) LogError(component string, err error, message string,
 		Message:   message,
 		Error:     err.Error(),
 		Details:   details,
-		TraceID:   el.generateTraceID(),
 	}
+	entry.TraceID, entry.RequestID = traceIDs(ctx)
 
 	el.writeLogEntry(entry)
 }
@@ -196,7 +242,6 @@ func (el *EnhancedLogger) LogSecurity(component string, event string, severity V
 		Component: component,
 		Message:   event,
 		Details:   details,
-		TraceID:   el.generateTraceID(),
 	}
 
 	// Add severity to details
@@ -217,7 +262,6 @@ func (el *EnhancedLogger) LogAudit(component string, action string, userID strin
 		Message:   action,
 		UserID:    userID,
 		Details:   details,
-		TraceID:   el.generateTraceID(),
 	}
 
 	el.writeLogEntry(entry)
@@ -225,24 +269,41 @@ func (el *EnhancedLogger) LogAudit(component string, action string, userID strin
 
 // Write log entry to file and buffer
 func (el *EnhancedLogger) writeLogEntry(entry LogEntry) {
-	el.mutex.Lock()
-	defer el.mutex.Unlock()
+	if !el.Enabled(entry.Component, entry.Level) {
+		return
+	}
+
+	el.writeMutex.Lock()
+	defer el.writeMutex.Unlock()
 
 	// Format log entry
-	formattedEntry := el.formatLogEntry(entry)
+	formattedEntry := el.encodeLogEntry(entry)
 
-	// Write to file
+	// Write to file, rotating first when it is too big or too old.
+	// Errors go to stderr: the standard logger may be routed back here.
 	if el.currentLogFile != nil {
-		if _, err := el.currentLogFile.WriteString(formattedEntry + "\n"); err != nil {
-			log.Printf("Failed to write to log file: %v", err)
+		if el.shouldRotate(len(formattedEntry) + 1) {
+			if err := el.rotateLogFile(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+			}
+		}
+		n, err := el.currentLogFile.WriteString(formattedEntry + "\n")
+		el.currentSize += int64(n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write to log file: %v\n", err)
 		}
 	}
 
-	// Write to buffer for downloadable reports
-	el.logBuffer.WriteString(formattedEntry + "\n")
+	// Keep recent entries for reports and the log query API
+	el.recent.add(entry)
+	el.publish(entry)
 
-	// Also write to stdout with colors
-	el.writeToStdout(entry)
+	// Also write to stdout; colors only in text mode
+	if el.config.Format == LogFormatText {
+		el.writeToStdout(entry)
+	} else {
+		fmt.Println(formattedEntry)
+	}
 }
 
 // Format log entry for file output
@@ -326,19 +387,15 @@ func (el *EnhancedLogger) getColorForLevel(level LogLevel) string {
 	}
 }
 
-// Generate trace ID
-func (el *EnhancedLogger) generateTraceID() string {
-	return uuid.New().String()[:8]
-}
-
 // Rotate log file
 func (el *EnhancedLogger) rotateLogFile() error {
+	previous := el.currentLogPath
 	if el.currentLogFile != nil {
 		el.currentLogFile.Close()
 	}
 
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	filename := fmt.Sprintf("task-management_%s.log", timestamp)
+	timestamp := time.Now().Format("2006-01-02_15-04-05.000")
+	filename := fmt.Sprintf("%s%s%s", logFilePrefix, timestamp, logFileSuffix)
 	filepath := filepath.Join(el.logDir, filename)
 
 	file, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -347,14 +404,32 @@ func (el *EnhancedLogger) rotateLogFile() error {
 	}
 
 	el.currentLogFile = file
+	el.currentLogPath = filepath
+	el.currentSize = 0
+	el.openedAt = time.Now()
+
+	// Compress and prune in the background so logging is not blocked
+	go func() {
+		if previous != "" && el.config.Compress {
+			if err := compressLogFile(previous); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to compress %s: %v\n", previous, err)
+			}
+		}
+		el.pruneLogFiles()
+	}()
 	return nil
 }
 
-// Record security scan results
-func (el *EnhancedLogger) RecordSecurityScan(scanType string, target string, rawOutput string, vulnerabilities []Vulnerability) {
+// Record security scan results, persist them and export them in every report format
+func (el *EnhancedLogger) RecordSecurityScan(scanType string, target string, rawOutput string, vulnerabilities []Vulnerability) (*SecurityScanResults, []*DownloadableReport) {
 	el.mutex.Lock()
 	defer el.mutex.Unlock()
 
+	if vulnerabilities == nil {
+		vulnerabilities = []Vulnerability{}
+	}
+	el.sortVulnerabilitiesBySeverity(vulnerabilities)
+
 	el.scanResults = &SecurityScanResults{
 		ScanID:         uuid.New().String(),
 		Timestamp:      time.Now(),
@@ -371,8 +446,14 @@ func (el *EnhancedLogger) RecordSecurityScan(scanType string, target string, raw
 	// Log the scan results
 	el.logSecurityScanResults()
 
-	// Create downloadable report
-	el.createSecurityScanReport()
+	if err := el.saveSecurityScan(el.scanResults); err != nil {
+		el.LogError("security-scan", err, "Failed to save security scan", map[string]interface{}{
+			"scan_id": el.scanResults.ScanID,
+		})
+	}
+
+	// Create downloadable reports
+	return el.scanResults, el.createSecurityScanReports(el.scanResults)
 }
 
 // Calculate scan summary
@@ -444,94 +525,6 @@ func (el *EnhancedLogger) logSecurityScanResults() {
 	}
 }
 
-// Create downloadable security scan report
-func (el *EnhancedLogger) createSecurityScanReport() {
-	var report strings.Builder
-
-	report.WriteString("TASK MANAGEMENT AI SYSTEM - SECURITY SCAN REPORT\n")
-	report.WriteString("================================================\n\n")
-	report.WriteString(fmt.Sprintf("Scan ID: %s\n", el.scanResults.ScanID))
-	report.WriteString(fmt.Sprintf("Timestamp: %s\n", el.scanResults.Timestamp.Format("2006-01-02 15:04:05")))
-	report.WriteString(fmt.Sprintf("Scan Type: %s\n", el.scanResults.ScanType))
-	report.WriteString(fmt.Sprintf("Target: %s\n", el.scanResults.Target))
-	report.WriteString(fmt.Sprintf("Status: %s\n\n", el.scanResults.Status))
-
-	report.WriteString("SUMMARY\n")
-	report.WriteString("-------\n")
-	report.WriteString(fmt.Sprintf("Total Vulnerabilities: %d\n", el.scanResults.Summary.TotalVulnerabilities))
-	report.WriteString(fmt.Sprintf("Critical: %d\n", el.scanResults.Summary.CriticalCount))
-	report.WriteString(fmt.Sprintf("High: %d\n", el.scanResults.Summary.HighCount))
-	report.WriteString(fmt.Sprintf("Medium: %d\n", el.scanResults.Summary.MediumCount))
-	report.WriteString(fmt.Sprintf("Low: %d\n", el.scanResults.Summary.LowCount))
-	report.WriteString(fmt.Sprintf("Info: %d\n\n", el.scanResults.Summary.InfoCount))
-
-	if len(el.scanResults.Summary.Recommendations) > 0 {
-		report.WriteString("RECOMMENDATIONS\n")
-		report.WriteString("---------------\n")
-		for _, rec := range el.scanResults.Summary.Recommendations {
-			report.WriteString(fmt.Sprintf("• %s\n", rec))
-		}
-		report.WriteString("\n")
-	}
-
-	report.WriteString("DETAILED VULNERABILITIES\n")
-	report.WriteString("========================\n\n")
-
-	// Sort vulnerabilities by severity
-	sortedVulns := el.sortVulnerabilitiesBySeverity(el.scanResults.Vulnerabilities)
-
-	for i, vuln := range sortedVulns {
-		report.WriteString(fmt.Sprintf("%d. [%s] %s\n", i+1, vuln.Severity, vuln.Title))
-		report.WriteString(fmt.Sprintf("   ID: %s\n", vuln.ID))
-		if vuln.CVE != "" {
-			report.WriteString(fmt.Sprintf("   CVE: %s\n", vuln.CVE))
-		}
-		if vuln.CVSS > 0 {
-			report.WriteString(fmt.Sprintf("   CVSS Score: %.1f\n", vuln.CVSS))
-		}
-		if vuln.Package != "" {
-			report.WriteString(fmt.Sprintf("   Package: %s", vuln.Package))
-			if vuln.Version != "" {
-				report.WriteString(fmt.Sprintf(" (%s)", vuln.Version))
-			}
-			report.WriteString("\n")
-		}
-		if vuln.FixedVersion != "" {
-			report.WriteString(fmt.Sprintf("   Fixed Version: %s\n", vuln.FixedVersion))
-		}
-		if vuln.Location != "" {
-			report.WriteString(fmt.Sprintf("   Location: %s", vuln.Location))
-			if vuln.LineNumber > 0 {
-				report.WriteString(fmt.Sprintf(":%d", vuln.LineNumber))
-			}
-			report.WriteString("\n")
-		}
-		report.WriteString(fmt.Sprintf("   Description: %s\n", vuln.Description))
-		if len(vuln.References) > 0 {
-			report.WriteString("   References:\n")
-			for _, ref := range vuln.References {
-				report.WriteString(fmt.Sprintf("     • %s\n", ref))
-			}
-		}
-		report.WriteString("\n")
-	}
-
-	report.WriteString("RAW SCAN OUTPUT\n")
-	report.WriteString("===============\n")
-	report.WriteString(el.scanResults.RawOutput)
-	report.WriteString("\n")
-
-	// Create downloadable report
-	el.createDownloadableReport(
-		fmt.Sprintf("security-scan-%s.txt", el.scanResults.ScanID[:8]),
-		"Security Scan Report",
-		fmt.Sprintf("Comprehensive security scan results for %s", el.scanResults.Target),
-		report.String(),
-		"text/plain",
-		[]string{"security", "scan", "vulnerabilities", el.scanResults.ScanType},
-	)
-}
-
 // Sort vulnerabilities by severity
 func (el *EnhancedLogger) sortVulnerabilitiesBySeverity(vulns []Vulnerability) []Vulnerability {
 	severityOrder := map[VulnerabilitySeverity]int{
@@ -552,43 +545,59 @@ func (el *EnhancedLogger) sortVulnerabilitiesBySeverity(vulns []Vulnerability) [
 
 // Create downloadable report
 func (el *EnhancedLogger) createDownloadableReport(filename, name, description, content, contentType string, tags []string) string {
-	el.reportMutex.Lock()
-	defer el.reportMutex.Unlock()
-
-	reportID := uuid.New().String()
-
 	report := &DownloadableReport{
-		ID:          reportID,
+		ID:          uuid.New().String(),
 		Name:        name,
 		Description: description,
-		Content:     content,
+		Filename:    filename,
+		Format:      strings.TrimPrefix(filepath.Ext(filename), "."),
 		ContentType: contentType,
-		Size:        int64(len(content)),
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(30 * 24 * time.Hour), // 30 days
-		DownloadURL: fmt.Sprintf("/api/logs/download/%s", reportID),
 		Tags:        tags,
 	}
+	if err := el.storeDownloadableReport(report, []byte(content)); err != nil {
+		return ""
+	}
+	return report.ID
+}
 
-	el.downloadableReports[reportID] = report
+// storeDownloadableReport - Write the content and metadata of report to the reports directory
+func (el *EnhancedLogger) storeDownloadableReport(report *DownloadableReport, content []byte) error {
+	report.Size = int64(len(content))
+	report.CreatedAt = time.Now()
+	if el.config.ReportRetention > 0 {
+		expiresAt := report.CreatedAt.Add(el.config.ReportRetention)
+		report.ExpiresAt = &expiresAt
+	}
+	report.DownloadURL = fmt.Sprintf("/api/v1/admin/reports/%s", report.ID)
 
-	// Save to file
-	filepath := filepath.Join(el.logDir, filename)
-	if err := os.WriteFile(filepath, []byte(content), 0644); err != nil {
+	err := writeFileAtomic(el.reportContentPath(report), content)
+	if err == nil {
+		var metadata []byte
+		metadata, err = json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = writeFileAtomic(el.reportMetadataPath(report.ID), metadata)
+		}
+	}
+	if err != nil {
 		el.LogError("logger", err, "Failed to save downloadable report", map[string]interface{}{
-			"filename": filename,
-			"report_id": reportID,
+			"filename":  report.Filename,
+			"report_id": report.ID,
 		})
+		os.Remove(el.reportContentPath(report))
+		return err
 	}
 
+	el.reportMutex.Lock()
+	el.downloadableReports[report.ID] = report
+	el.reportMutex.Unlock()
+
 	el.Log(LogLevelInfo, "logger", "Created downloadable report", map[string]interface{}{
-		"report_id": reportID,
-		"filename":  filename,
+		"report_id": report.ID,
+		"filename":  report.Filename,
 		"size":      report.Size,
-		"tags":      tags,
+		"tags":      report.Tags,
 	})
-
-	return reportID
+	return nil
 }
 
 // Get downloadable report
@@ -601,28 +610,53 @@ func (el *EnhancedLogger) GetDownloadableReport(reportID string) (*DownloadableR
 		return nil, fmt.Errorf("report not found")
 	}
 
-	if time.Now().After(report.ExpiresAt) {
+	if report.expired(time.Now()) {
 		return nil, fmt.Errorf("report expired")
 	}
 
 	return report, nil
 }
 
-// List downloadable reports
+// ReadReportContent - Content of a report
+func (el *EnhancedLogger) ReadReportContent(report *DownloadableReport) ([]byte, error) {
+	content, err := os.ReadFile(el.reportContentPath(report))
+	if err != nil {
+		return nil, fmt.Errorf("report content unavailable: %v", err)
+	}
+	return content, nil
+}
+
+// List downloadable reports, newest first
 func (el *EnhancedLogger) ListDownloadableReports() []*DownloadableReport {
 	el.reportMutex.RLock()
 	defer el.reportMutex.RUnlock()
 
-	var reports []*DownloadableReport
+	now := time.Now()
+	reports := []*DownloadableReport{}
 	for _, report := range el.downloadableReports {
-		if time.Now().Before(report.ExpiresAt) {
+		if !report.expired(now) {
 			reports = append(reports, report)
 		}
 	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].CreatedAt.After(reports[j].CreatedAt) })
 
 	return reports
 }
 
+// DeleteDownloadableReport - Remove a report and its files
+func (el *EnhancedLogger) DeleteDownloadableReport(reportID string) error {
+	el.reportMutex.Lock()
+	defer el.reportMutex.Unlock()
+
+	report, exists := el.downloadableReports[reportID]
+	if !exists {
+		return fmt.Errorf("report not found")
+	}
+	delete(el.downloadableReports, reportID)
+	el.removeReportFiles(report)
+	return nil
+}
+
 // Create comprehensive log report
 func (el *EnhancedLogger) CreateComprehensiveLogReport() string {
 	el.mutex.RLock()
@@ -635,10 +669,13 @@ func (el *EnhancedLogger) CreateComprehensiveLogReport() string {
 	report.WriteString(fmt.Sprintf("Generated: %s\n", time.Now().Format("2006-01-02 15:04:05")))
 	report.WriteString(fmt.Sprintf("Log Directory: %s\n\n", el.logDir))
 
-	// Add current buffer contents
+	// Add recent entries
 	report.WriteString("RECENT LOG ENTRIES\n")
 	report.WriteString("==================\n")
-	report.WriteString(el.logBuffer.String())
+	for _, entry := range el.recent.entries() {
+		report.WriteString(el.formatLogEntry(entry))
+		report.WriteString("\n")
+	}
 	report.WriteString("\n")
 
 	// Add security scan summary if available
@@ -669,111 +706,45 @@ func (el *EnhancedLogger) CreateComprehensiveLogReport() string {
 
 // Parse vulnerability from various scanner outputs
 func (el *EnhancedLogger) ParseVulnerabilityFromOutput(scannerType string, output string) []Vulnerability {
-	var vulnerabilities []Vulnerability
-
-	switch scannerType {
-	case "trivy":
-		vulnerabilities = el.parseTrivyOutput(output)
-	case "gosec":
-		vulnerabilities = el.parseGosecOutput(output)
-	case "nancy":
-		vulnerabilities = el.parseNancyOutput(output)
-	case "gitleaks":
-		vulnerabilities = el.parseGitleaksOutput(output)
-	default:
-		el.Log(LogLevelWarn, "logger", "Unknown scanner type for parsing", map[string]interface{}{
+	vulnerabilities, err := ParseSecurityScanOutput(scannerType, output)
+	if err != nil {
+		el.LogError("logger", err, "Failed to parse scanner output", map[string]interface{}{
 			"scanner_type": scannerType,
 		})
+		return nil
 	}
-
 	return vulnerabilities
 }
 
-// Missing methods for EnhancedLogger
+// cleanupExpiredReports - Delete expired reports and scans now and every hour
 func (el *EnhancedLogger) cleanupExpiredReports() {
-	el.reportMutex.Lock()
-	defer el.reportMutex.Unlock()
-
-	now := time.Now()
-	for id, report := range el.downloadableReports {
-		if now.After(report.ExpiresAt) {
-			delete(el.downloadableReports, id)
-			// Clean up file
-			filename := fmt.Sprintf("report-%s.txt", id[:8])
-			filepath := filepath.Join(el.logDir, filename)
-			os.Remove(filepath)
-		}
-	}
-}
-
-func (el *EnhancedLogger) parseTrivyOutput(output string) []Vulnerability {
-	var vulnerabilities []Vulnerability
-	// Simple Trivy JSON output parser
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, `"VulnerabilityID"`) {
-			// Parse JSON line (simplified)
-			var vuln Vulnerability
-			vuln.ID = "trivy-" + uuid.New().String()[:8]
-			vuln.Title = "Vulnerability found by Trivy"
-			vuln.Severity = SeverityMedium
-			vuln.Description = "Parsed from Trivy output"
-			vulnerabilities = append(vulnerabilities, vuln)
-		}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		el.removeExpiredReports(time.Now())
+		<-ticker.C
 	}
-	return vulnerabilities
 }
 
-func (el *EnhancedLogger) parseGosecOutput(output string) []Vulnerability {
-	var vulnerabilities []Vulnerability
-	// Simple Gosec JSON output parser
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, `"rule_id"`) {
-			// Parse JSON line (simplified)
-			var vuln Vulnerability
-			vuln.ID = "gosec-" + uuid.New().String()[:8]
-			vuln.Title = "Security issue found by Gosec"
-			vuln.Severity = SeverityMedium
-			vuln.Description = "Parsed from Gosec output"
-			vulnerabilities = append(vulnerabilities, vuln)
+func (el *EnhancedLogger) removeExpiredReports(now time.Time) {
+	el.reportMutex.Lock()
+	for id, report := range el.downloadableReports {
+		if report.expired(now) {
+			delete(el.downloadableReports, id)
+			el.removeReportFiles(report)
 		}
 	}
-	return vulnerabilities
-}
+	el.reportMutex.Unlock()
 
-func (el *EnhancedLogger) parseNancyOutput(output string) []Vulnerability {
-	var vulnerabilities []Vulnerability
-	// Simple Nancy output parser
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "Vulnerable") {
-			// Parse line (simplified)
-			var vuln Vulnerability
-			vuln.ID = "nancy-" + uuid.New().String()[:8]
-			vuln.Title = "Vulnerable dependency found by Nancy"
-			vuln.Severity = SeverityHigh
-			vuln.Description = "Parsed from Nancy output"
-			vulnerabilities = append(vulnerabilities, vuln)
-		}
+	if el.config.ReportRetention <= 0 {
+		return
 	}
-	return vulnerabilities
-}
-
-func (el *EnhancedLogger) parseGitleaksOutput(output string) []Vulnerability {
-	var vulnerabilities []Vulnerability
-	// Simple Gitleaks JSON output parser
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, `"rule"`) {
-			// Parse JSON line (simplified)
-			var vuln Vulnerability
-			vuln.ID = "gitleaks-" + uuid.New().String()[:8]
-			vuln.Title = "Secret leak found by Gitleaks"
-			vuln.Severity = SeverityCritical
-			vuln.Description = "Parsed from Gitleaks output"
-			vulnerabilities = append(vulnerabilities, vuln)
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+	for id, scan := range el.scanIndex {
+		if now.Sub(scan.Timestamp) > el.config.ReportRetention {
+			delete(el.scanIndex, id)
+			os.Remove(el.scanPath(id))
 		}
 	}
-	return vulnerabilities
 }
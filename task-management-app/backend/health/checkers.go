@@ -0,0 +1,382 @@
+package health
+
+// Dependency probes
+// Every checker talks to the real dependency: a Postgres ping and query, a
+// CouchDB /_up request, an SMTP EHLO/NOOP exchange, a HEAD request to a chat
+// webhook, a queue depth read, or a round trip through a worker goroutine.
+// Checkers honour the context deadline set by the service.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// ========================================
+// DATABASE
+// ========================================
+
+// DatabaseChecker - Postgres ping and SELECT 1
+type DatabaseChecker struct {
+	db *sql.DB
+}
+
+// NewDatabaseChecker creates a Postgres checker
+func NewDatabaseChecker(db *sql.DB) *DatabaseChecker {
+	return &DatabaseChecker{db: db}
+}
+
+func (d *DatabaseChecker) Name() string {
+	return "database"
+}
+
+func (d *DatabaseChecker) Check(ctx context.Context) HealthStatus {
+	if d.db == nil {
+		return HealthStatus{Status: StatusUnhealthy, Message: "Database not configured"}
+	}
+
+	if err := d.db.PingContext(ctx); err != nil {
+		return HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("Database ping failed: %v", err),
+			Details: map[string]interface{}{"error": err.Error()},
+		}
+	}
+
+	var result int
+	if err := d.db.QueryRowContext(ctx, "SELECT 1").Scan(&result); err != nil {
+		return HealthStatus{
+			Status:  StatusDegraded,
+			Message: fmt.Sprintf("Database query failed: %v", err),
+			Details: map[string]interface{}{"error": err.Error()},
+		}
+	}
+
+	stats := d.db.Stats()
+	return HealthStatus{
+		Status:  StatusHealthy,
+		Message: "Database connection successful",
+		Details: map[string]interface{}{
+			"connection_pool": map[string]interface{}{
+				"max_open":      stats.MaxOpenConnections,
+				"open":          stats.OpenConnections,
+				"in_use":        stats.InUse,
+				"idle":          stats.Idle,
+				"wait_count":    stats.WaitCount,
+				"wait_duration": stats.WaitDuration.String(),
+			},
+		},
+	}
+}
+
+// ========================================
+// SYSTEM
+// ========================================
+
+// SystemChecker - Goroutines and memory; degraded above the heap threshold
+type SystemChecker struct {
+	maxHeapBytes uint64
+}
+
+// NewSystemChecker creates a runtime checker; maxHeapBytes 0 never degrades
+func NewSystemChecker(maxHeapBytes uint64) *SystemChecker {
+	return &SystemChecker{maxHeapBytes: maxHeapBytes}
+}
+
+func (s *SystemChecker) Name() string {
+	return "system"
+}
+
+func (s *SystemChecker) Check(ctx context.Context) HealthStatus {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	status := HealthStatus{
+		Status:  StatusHealthy,
+		Message: "System resources normal",
+		Details: map[string]interface{}{
+			"goroutines": runtime.NumGoroutine(),
+			"memory": map[string]interface{}{
+				"alloc":        m.Alloc,
+				"sys":          m.Sys,
+				"heap_alloc":   m.HeapAlloc,
+				"heap_inuse":   m.HeapInuse,
+				"heap_objects": m.HeapObjects,
+				"stack_inuse":  m.StackInuse,
+			},
+			"gc": map[string]interface{}{
+				"num_gc":         m.NumGC,
+				"next_gc":        m.NextGC,
+				"pause_total_ns": m.PauseTotalNs,
+			},
+		},
+	}
+	if s.maxHeapBytes > 0 && m.HeapAlloc > s.maxHeapBytes {
+		status.Status = StatusDegraded
+		status.Message = fmt.Sprintf("Heap usage %d MB above %d MB", m.HeapAlloc>>20, s.maxHeapBytes>>20)
+	}
+	return status
+}
+
+// ========================================
+// COUCHDB
+// ========================================
+
+// CouchDBChecker - GET /_up on the CouchDB server
+type CouchDBChecker struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewCouchDBChecker creates a checker for the server at baseURL (e.g. http://localhost:5984)
+func NewCouchDBChecker(baseURL, username, password string) *CouchDBChecker {
+	return &CouchDBChecker{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		client:   &http.Client{},
+	}
+}
+
+func (c *CouchDBChecker) Name() string {
+	return "couchdb"
+}
+
+func (c *CouchDBChecker) Check(ctx context.Context) HealthStatus {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/_up", nil)
+	if err != nil {
+		return HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("Invalid CouchDB URL: %v", err)}
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("CouchDB unreachable: %v", err),
+			Details: map[string]interface{}{"error": err.Error()},
+		}
+	}
+	defer resp.Body.Close()
+
+	details := map[string]interface{}{"status_code": resp.StatusCode}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return HealthStatus{Status: StatusHealthy, Message: "CouchDB is up", Details: details}
+	case resp.StatusCode == http.StatusNotFound:
+		// /_up was added in CouchDB 2.0; anything answering is at least running
+		return HealthStatus{Status: StatusDegraded, Message: "CouchDB does not expose /_up", Details: details}
+	default:
+		return HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("CouchDB returned status %d", resp.StatusCode),
+			Details: details,
+		}
+	}
+}
+
+// ========================================
+// SMTP
+// ========================================
+
+// SMTPChecker - Connect, EHLO and NOOP against the notification mail server
+type SMTPChecker struct {
+	host        string
+	port        int
+	requireTLS  bool
+	dialer      net.Dialer
+	clientHello string
+}
+
+// NewSMTPChecker creates a checker for host:port; requireTLS degrades the
+// result when the server does not offer STARTTLS
+func NewSMTPChecker(host string, port int, requireTLS bool) *SMTPChecker {
+	hello, err := os.Hostname()
+	if err != nil || hello == "" {
+		hello = "localhost"
+	}
+	return &SMTPChecker{host: host, port: port, requireTLS: requireTLS, clientHello: hello}
+}
+
+func (s *SMTPChecker) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPChecker) Check(ctx context.Context) HealthStatus {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	details := map[string]interface{}{"address": addr}
+
+	conn, err := s.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		details["error"] = err.Error()
+		return HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("SMTP server unreachable: %v", err), Details: details}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		details["error"] = err.Error()
+		return HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("SMTP greeting failed: %v", err), Details: details}
+	}
+	defer client.Close()
+
+	if err := client.Hello(s.clientHello); err != nil {
+		details["error"] = err.Error()
+		return HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("SMTP EHLO failed: %v", err), Details: details}
+	}
+	if err := client.Noop(); err != nil {
+		details["error"] = err.Error()
+		return HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("SMTP NOOP failed: %v", err), Details: details}
+	}
+	starttls, _ := client.Extension("STARTTLS")
+	details["starttls"] = starttls
+	client.Quit()
+
+	if s.requireTLS && !starttls {
+		return HealthStatus{Status: StatusDegraded, Message: "SMTP server does not offer STARTTLS", Details: details}
+	}
+	return HealthStatus{Status: StatusHealthy, Message: "SMTP server responding", Details: details}
+}
+
+// ========================================
+// WEBHOOKS
+// ========================================
+
+// WebhookChecker - HEAD request to an incoming-webhook URL
+//
+// Chat webhooks only accept POST, so any HTTP answer below 500 (typically
+// 400, 404 or 405) proves the endpoint is reachable; only transport errors
+// and server errors count as failures. The URL itself is never reported
+// because it contains the webhook secret.
+type WebhookChecker struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// NewWebhookChecker creates a reachability checker named name for url
+func NewWebhookChecker(name, url string) *WebhookChecker {
+	return &WebhookChecker{name: name, url: url, client: &http.Client{}}
+}
+
+func (wc *WebhookChecker) Name() string {
+	return wc.name
+}
+
+func (wc *WebhookChecker) Check(ctx context.Context) HealthStatus {
+	host := ""
+	if parsed, err := url.Parse(wc.url); err == nil {
+		host = parsed.Host
+	}
+	details := map[string]interface{}{"host": host}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, wc.url, nil)
+	if err != nil {
+		return HealthStatus{Status: StatusUnhealthy, Message: "Invalid webhook URL", Details: details}
+	}
+	resp, err := wc.client.Do(req)
+	if err != nil {
+		// Strip the URL (and its secret) from the error
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		details["error"] = err.Error()
+		return HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("Webhook unreachable: %v", err), Details: details}
+	}
+	resp.Body.Close()
+
+	details["status_code"] = resp.StatusCode
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return HealthStatus{Status: StatusDegraded, Message: fmt.Sprintf("Webhook host returned status %d", resp.StatusCode), Details: details}
+	}
+	return HealthStatus{Status: StatusHealthy, Message: "Webhook host reachable", Details: details}
+}
+
+// ========================================
+// QUEUES AND WORKERS
+// ========================================
+
+// QueueDepthChecker - Degraded at warnDepth queued items, unhealthy at maxDepth
+type QueueDepthChecker struct {
+	name      string
+	depth     func(ctx context.Context) (int, error)
+	warnDepth int
+	maxDepth  int
+}
+
+// NewQueueDepthChecker creates a checker around depth; a threshold of 0 is not enforced
+func NewQueueDepthChecker(name string, depth func(ctx context.Context) (int, error), warnDepth, maxDepth int) *QueueDepthChecker {
+	return &QueueDepthChecker{name: name, depth: depth, warnDepth: warnDepth, maxDepth: maxDepth}
+}
+
+func (q *QueueDepthChecker) Name() string {
+	return q.name
+}
+
+func (q *QueueDepthChecker) Check(ctx context.Context) HealthStatus {
+	depth, err := q.depth(ctx)
+	if err != nil {
+		return HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("Queue depth unavailable: %v", err),
+			Details: map[string]interface{}{"error": err.Error()},
+		}
+	}
+
+	details := map[string]interface{}{"depth": depth, "warn_depth": q.warnDepth, "max_depth": q.maxDepth}
+	switch {
+	case q.maxDepth > 0 && depth >= q.maxDepth:
+		return HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("%d items queued", depth), Details: details}
+	case q.warnDepth > 0 && depth >= q.warnDepth:
+		return HealthStatus{Status: StatusDegraded, Message: fmt.Sprintf("%d items queued", depth), Details: details}
+	default:
+		return HealthStatus{Status: StatusHealthy, Message: fmt.Sprintf("%d items queued", depth), Details: details}
+	}
+}
+
+// PingChecker - Round trip through a worker goroutine's main loop
+type PingChecker struct {
+	name string
+	ping func(ctx context.Context) error
+}
+
+// NewPingChecker creates a liveness checker; ping must return once the
+// goroutine has answered or ctx is done
+func NewPingChecker(name string, ping func(ctx context.Context) error) *PingChecker {
+	return &PingChecker{name: name, ping: ping}
+}
+
+func (p *PingChecker) Name() string {
+	return p.name
+}
+
+func (p *PingChecker) Check(ctx context.Context) HealthStatus {
+	start := time.Now()
+	if err := p.ping(ctx); err != nil {
+		return HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("No response from %s: %v", p.name, err),
+			Details: map[string]interface{}{"error": err.Error()},
+		}
+	}
+	return HealthStatus{
+		Status:  StatusHealthy,
+		Message: "Responding",
+		Details: map[string]interface{}{"round_trip": time.Since(start).String()},
+	}
+}
@@ -0,0 +1,582 @@
+package health
+
+// Health checks
+// HealthCheckService runs every registered HealthChecker concurrently, each
+// bounded by its own timeout, and caches the results for Config.CacheTTL. A
+// background loop refreshes the cache so probes normally answer from memory
+// instead of waiting on a slow dependency. A refresh runs under
+// context.Background(), never the caller's context, so a probe that gives up
+// or a client that disconnects cannot cancel the checks and leave failures in
+// the cache; each check is still bounded by its own timeout. Only checkers
+// registered as critical can make the service not ready; a failing
+// non-critical checker only degrades it. Latency, latest status and a count of results per status
+// are exported to Prometheus, and recent results are kept for
+// /health/metrics.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Check results
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"
+	StatusUnhealthy = "unhealthy"
+)
+
+// HealthChecker - One dependency or subsystem probe
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) HealthStatus
+}
+
+// HealthStatus represents the status of a health check
+type HealthStatus struct {
+	Status    string                 `json:"status"`
+	Message   string                 `json:"message,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+	Duration  time.Duration          `json:"duration"`
+	Critical  bool                   `json:"critical"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// HealthResponse represents the overall health check response
+type HealthResponse struct {
+	Status    string                  `json:"status"`
+	Timestamp time.Time               `json:"timestamp"`
+	Version   string                  `json:"version"`
+	Service   string                  `json:"service"`
+	Uptime    string                  `json:"uptime"`
+	Checks    map[string]HealthStatus `json:"checks"`
+	Summary   HealthSummary           `json:"summary"`
+}
+
+// HealthSummary provides a summary of all health checks
+type HealthSummary struct {
+	Total     int `json:"total"`
+	Healthy   int `json:"healthy"`
+	Degraded  int `json:"degraded"`
+	Unhealthy int `json:"unhealthy"`
+}
+
+// Config - Timeouts and caching for health checks
+type Config struct {
+	CacheTTL        time.Duration // how long results are served from the cache
+	RefreshInterval time.Duration // background refresh period; 0 disables it
+	Timeout         time.Duration // default per-check timeout
+	HistorySize     int           // results kept per check for /health/metrics
+	Service         string
+	Version         string
+}
+
+// Options - How a checker is run and whether its failure matters for readiness
+type Options struct {
+	Critical bool
+	Timeout  time.Duration // 0 uses Config.Timeout
+}
+
+type registeredCheck struct {
+	checker HealthChecker
+	options Options
+}
+
+// refreshCall - A refresh in progress; done is closed once results are set
+type refreshCall struct {
+	done    chan struct{}
+	results map[string]HealthStatus
+}
+
+// HealthCheckService manages health checks
+type HealthCheckService struct {
+	config       Config
+	checks       map[string]registeredCheck
+	mutex        sync.RWMutex
+	lastCheck    time.Time
+	cache        map[string]HealthStatus
+	history      map[string][]HealthStatus
+	cacheMutex   sync.RWMutex
+	refreshMutex sync.Mutex
+	inflight     *refreshCall
+	startTime    time.Time
+	startOnce    sync.Once
+	stopOnce     sync.Once
+	stop         chan struct{}
+	shuttingDown atomic.Bool
+}
+
+var (
+	checkDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "health_check_duration_seconds",
+		Help:    "Time taken by each health check.",
+		Buckets: []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"check"})
+
+	checkStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_check_status",
+		Help: "Latest result of each health check: 1 healthy, 0.5 degraded, 0 unhealthy.",
+	}, []string{"check", "critical"})
+
+	checkResultsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "health_check_results_total",
+		Help: "Health check runs by check and resulting status.",
+	}, []string{"check", "status"})
+)
+
+// NewHealthCheckService creates a health check service with no checkers
+func NewHealthCheckService(config Config) *HealthCheckService {
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = 10 * time.Second
+	}
+	if config.HistorySize <= 0 {
+		config.HistorySize = 20
+	}
+
+	return &HealthCheckService{
+		config:    config,
+		checks:    make(map[string]registeredCheck),
+		cache:     make(map[string]HealthStatus),
+		history:   make(map[string][]HealthStatus),
+		startTime: time.Now(),
+		stop:      make(chan struct{}),
+	}
+}
+
+// RegisterChecker registers a non-critical health checker
+func (hcs *HealthCheckService) RegisterChecker(checker HealthChecker) {
+	hcs.RegisterCheckerWithOptions(checker, Options{})
+}
+
+// RegisterCriticalChecker registers a checker whose failure makes the service not ready
+func (hcs *HealthCheckService) RegisterCriticalChecker(checker HealthChecker) {
+	hcs.RegisterCheckerWithOptions(checker, Options{Critical: true})
+}
+
+// RegisterCheckerWithOptions registers a health checker with explicit criticality and timeout
+func (hcs *HealthCheckService) RegisterCheckerWithOptions(checker HealthChecker, options Options) {
+	if options.Timeout <= 0 {
+		options.Timeout = hcs.config.Timeout
+	}
+	hcs.mutex.Lock()
+	defer hcs.mutex.Unlock()
+	hcs.checks[checker.Name()] = registeredCheck{checker: checker, options: options}
+
+	// Results cached before this checker existed are incomplete
+	hcs.cacheMutex.Lock()
+	hcs.lastCheck = time.Time{}
+	hcs.cacheMutex.Unlock()
+}
+
+// RunHealthChecks returns the cached results, re-running the checks when the
+// cache has expired. ctx only bounds how long the caller waits: if it ends
+// first, the refresh carries on and the caller gets the previous results.
+func (hcs *HealthCheckService) RunHealthChecks(ctx context.Context) map[string]HealthStatus {
+	if results, ok := hcs.cachedResults(); ok {
+		return results
+	}
+
+	call := hcs.startRefresh()
+	select {
+	case <-call.done:
+		return copyResults(call.results)
+	case <-ctx.Done():
+		return hcs.unfinishedResults(ctx.Err())
+	}
+}
+
+// startRefresh - Join the refresh in progress or start one detached from any caller
+func (hcs *HealthCheckService) startRefresh() *refreshCall {
+	hcs.refreshMutex.Lock()
+	defer hcs.refreshMutex.Unlock()
+	if hcs.inflight != nil {
+		return hcs.inflight
+	}
+
+	call := &refreshCall{done: make(chan struct{})}
+	hcs.inflight = call
+	go func() {
+		call.results = hcs.refresh()
+		hcs.refreshMutex.Lock()
+		hcs.inflight = nil
+		hcs.refreshMutex.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// unfinishedResults - The last result of each check, or unhealthy for checks that never finished
+func (hcs *HealthCheckService) unfinishedResults(reason error) map[string]HealthStatus {
+	hcs.mutex.RLock()
+	defer hcs.mutex.RUnlock()
+	hcs.cacheMutex.RLock()
+	defer hcs.cacheMutex.RUnlock()
+
+	results := make(map[string]HealthStatus, len(hcs.checks))
+	for name, check := range hcs.checks {
+		if status, ok := hcs.cache[name]; ok {
+			results[name] = status
+			continue
+		}
+		results[name] = HealthStatus{
+			Status:    StatusUnhealthy,
+			Message:   fmt.Sprintf("Health check still running: %v", reason),
+			Timestamp: time.Now(),
+			Critical:  check.options.Critical,
+		}
+	}
+	return results
+}
+
+// cachedResults - A copy of the cached results if they are still fresh
+func (hcs *HealthCheckService) cachedResults() (map[string]HealthStatus, bool) {
+	hcs.cacheMutex.RLock()
+	defer hcs.cacheMutex.RUnlock()
+	if hcs.lastCheck.IsZero() || time.Since(hcs.lastCheck) > hcs.config.CacheTTL {
+		return nil, false
+	}
+	return copyResults(hcs.cache), true
+}
+
+func copyResults(results map[string]HealthStatus) map[string]HealthStatus {
+	copied := make(map[string]HealthStatus, len(results))
+	for name, status := range results {
+		copied[name] = status
+	}
+	return copied
+}
+
+// refresh - Run every check concurrently and replace the cache; only startRefresh calls it
+func (hcs *HealthCheckService) refresh() map[string]HealthStatus {
+	hcs.mutex.RLock()
+	checks := make([]registeredCheck, 0, len(hcs.checks))
+	for _, check := range hcs.checks {
+		checks = append(checks, check)
+	}
+	hcs.mutex.RUnlock()
+
+	results := make(map[string]HealthStatus, len(checks))
+	var resultsMutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check registeredCheck) {
+			defer wg.Done()
+			status := runCheck(context.Background(), check)
+			recordCheck(check.checker.Name(), status)
+			resultsMutex.Lock()
+			results[check.checker.Name()] = status
+			resultsMutex.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	hcs.cacheMutex.Lock()
+	hcs.lastCheck = time.Now()
+	hcs.cache = make(map[string]HealthStatus, len(results))
+	for name, status := range results {
+		hcs.cache[name] = status
+		history := append(hcs.history[name], status)
+		if len(history) > hcs.config.HistorySize {
+			history = history[len(history)-hcs.config.HistorySize:]
+		}
+		hcs.history[name] = history
+	}
+	hcs.cacheMutex.Unlock()
+
+	return results
+}
+
+// runCheck - Run one checker under its timeout; a checker that overruns is reported unhealthy
+func runCheck(ctx context.Context, check registeredCheck) HealthStatus {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, check.options.Timeout)
+	defer cancel()
+
+	done := make(chan HealthStatus, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- HealthStatus{
+					Status:  StatusUnhealthy,
+					Message: fmt.Sprintf("Health check panicked: %v", recovered),
+				}
+			}
+		}()
+		done <- check.checker.Check(ctx)
+	}()
+
+	var status HealthStatus
+	select {
+	case status = <-done:
+	case <-ctx.Done():
+		status = HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("Health check timed out after %s", check.options.Timeout),
+		}
+	}
+	if status.Timestamp.IsZero() {
+		status.Timestamp = time.Now()
+	}
+	if status.Duration == 0 {
+		status.Duration = time.Since(start)
+	}
+	status.Critical = check.options.Critical
+	return status
+}
+
+// recordCheck - Latency, latest status and status count of one check run
+func recordCheck(name string, status HealthStatus) {
+	value := 0.0
+	switch status.Status {
+	case StatusHealthy:
+		value = 1
+	case StatusDegraded:
+		value = 0.5
+	}
+	checkDuration.WithLabelValues(name).Observe(status.Duration.Seconds())
+	checkStatus.WithLabelValues(name, strconv.FormatBool(status.Critical)).Set(value)
+	checkResultsTotal.WithLabelValues(name, status.Status).Inc()
+}
+
+// Start refreshes the cache in the background every RefreshInterval; later calls do nothing
+func (hcs *HealthCheckService) Start() {
+	if hcs.config.RefreshInterval <= 0 {
+		return
+	}
+	hcs.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(hcs.config.RefreshInterval)
+			defer ticker.Stop()
+			for {
+				<-hcs.startRefresh().done
+
+				select {
+				case <-ticker.C:
+				case <-hcs.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop ends the background refresh; the channel is made once in the constructor
+// and closed once here, so Stop may be called repeatedly or before Start
+func (hcs *HealthCheckService) Stop() {
+	hcs.stopOnce.Do(func() { close(hcs.stop) })
+}
+
+// MarkShuttingDown makes the readiness probe fail so load balancers stop routing new requests
+func (hcs *HealthCheckService) MarkShuttingDown() {
+	hcs.shuttingDown.Store(true)
+}
+
+// History returns the most recent results of each check, oldest first
+func (hcs *HealthCheckService) History() map[string][]HealthStatus {
+	hcs.cacheMutex.RLock()
+	defer hcs.cacheMutex.RUnlock()
+	history := make(map[string][]HealthStatus, len(hcs.history))
+	for name, statuses := range hcs.history {
+		history[name] = append([]HealthStatus(nil), statuses...)
+	}
+	return history
+}
+
+// GetHealthSummary returns a summary of health check results
+func (hcs *HealthCheckService) GetHealthSummary(results map[string]HealthStatus) HealthSummary {
+	summary := HealthSummary{
+		Total: len(results),
+	}
+
+	for _, status := range results {
+		switch status.Status {
+		case StatusHealthy:
+			summary.Healthy++
+		case StatusDegraded:
+			summary.Degraded++
+		case StatusUnhealthy:
+			summary.Unhealthy++
+		}
+	}
+
+	return summary
+}
+
+// DetermineOverallStatus determines the overall health status; a failing
+// non-critical check only degrades the service
+func (hcs *HealthCheckService) DetermineOverallStatus(results map[string]HealthStatus) string {
+	hasUnhealthy := false
+	hasDegraded := false
+
+	for _, status := range results {
+		switch status.Status {
+		case StatusUnhealthy:
+			if status.Critical {
+				hasUnhealthy = true
+			} else {
+				hasDegraded = true
+			}
+		case StatusDegraded:
+			hasDegraded = true
+		}
+	}
+
+	if hasUnhealthy {
+		return StatusUnhealthy
+	}
+	if hasDegraded {
+		return StatusDegraded
+	}
+	return StatusHealthy
+}
+
+// ========================================
+// HTTP HANDLERS
+// ========================================
+
+// ComprehensiveHealthCheckHandler handles comprehensive health checks
+func (hcs *HealthCheckService) ComprehensiveHealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	results := hcs.RunHealthChecks(ctx)
+	overallStatus := hcs.DetermineOverallStatus(results)
+
+	response := HealthResponse{
+		Status:    overallStatus,
+		Timestamp: time.Now(),
+		Version:   hcs.config.Version,
+		Service:   hcs.config.Service,
+		Uptime:    time.Since(hcs.startTime).String(),
+		Checks:    results,
+		Summary:   hcs.GetHealthSummary(results),
+	}
+
+	statusCode := http.StatusOK
+	if overallStatus == StatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	writeJSON(w, statusCode, response)
+}
+
+// ReadinessHealthCheckHandler handles readiness probes
+func (hcs *HealthCheckService) ReadinessHealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if hcs.shuttingDown.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":    "shutting_down",
+			"timestamp": time.Now(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	results := hcs.RunHealthChecks(ctx)
+
+	// Only critical checks decide readiness
+	ready := true
+	for _, status := range results {
+		if status.Critical && status.Status == StatusUnhealthy {
+			ready = false
+			break
+		}
+	}
+
+	response := map[string]interface{}{
+		"status":    "ready",
+		"timestamp": time.Now(),
+		"checks":    results,
+	}
+	statusCode := http.StatusOK
+	if !ready {
+		response["status"] = "not_ready"
+		statusCode = http.StatusServiceUnavailable
+	}
+	writeJSON(w, statusCode, response)
+}
+
+// LivenessHealthCheckHandler handles liveness probes
+func (hcs *HealthCheckService) LivenessHealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	// Liveness checks are simpler - just verify the service is running
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "alive",
+		"timestamp": time.Now(),
+		"uptime":    time.Since(hcs.startTime).String(),
+	})
+}
+
+// DependencyHealthCheckHandler reports the critical dependencies
+func (hcs *HealthCheckService) DependencyHealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	dependencies := make(map[string]HealthStatus)
+	status := StatusHealthy
+	for name, result := range hcs.RunHealthChecks(ctx) {
+		if !result.Critical {
+			continue
+		}
+		dependencies[name] = result
+		if result.Status == StatusUnhealthy {
+			status = StatusUnhealthy
+		}
+	}
+
+	statusCode := http.StatusOK
+	if status == StatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	writeJSON(w, statusCode, map[string]interface{}{
+		"status":       status,
+		"timestamp":    time.Now(),
+		"dependencies": dependencies,
+	})
+}
+
+// MetricsHealthCheckHandler provides health metrics and recent results
+func (hcs *HealthCheckService) MetricsHealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	results := hcs.RunHealthChecks(ctx)
+	summary := hcs.GetHealthSummary(results)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"health_checks_total":     summary.Total,
+		"health_checks_healthy":   summary.Healthy,
+		"health_checks_degraded":  summary.Degraded,
+		"health_checks_unhealthy": summary.Unhealthy,
+		"overall_status":          hcs.DetermineOverallStatus(results),
+		"timestamp":               time.Now().Unix(),
+		"history":                 hcs.History(),
+	})
+}
+
+// RegisterRoutes mounts the health endpoints on r
+func (hcs *HealthCheckService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/health", hcs.ComprehensiveHealthCheckHandler).Methods("GET")
+	r.HandleFunc("/health/ready", hcs.ReadinessHealthCheckHandler).Methods("GET")
+	r.HandleFunc("/health/live", hcs.LivenessHealthCheckHandler).Methods("GET")
+	r.HandleFunc("/health/dependencies", hcs.DependencyHealthCheckHandler).Methods("GET")
+	r.HandleFunc("/health/metrics", hcs.MetricsHealthCheckHandler).Methods("GET")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,461 @@
+package main
+
+// Idempotency keys
+// POST, PUT, PATCH and DELETE requests may carry an Idempotency-Key header.
+// The first request with a key claims it and runs; its response is stored
+// with a fingerprint of the method, URI, body and the If-Match and
+// If-None-Match preconditions. Retries with the same key
+// and fingerprint get the stored response back, marked Idempotent-Replayed,
+// without running the handler again. Reusing a key for a different request
+// is a 409, as is a retry that arrives while the first attempt is still
+// running. Keys are scoped to the caller (access token, user or IP, as for
+// rate limiting) and kept for the configured TTL, 24 hours by default.
+//
+// 5xx responses are not stored, so the client can retry them, and neither are
+// 412 and 428: nothing changed, and the client should be able to retry with a
+// fresh ETag without picking a new key. A claim whose
+// request never finished (the process died) lapses after a few minutes.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Idempotency stores
+const (
+	IdempotencyStoreMemory   = "memory"
+	IdempotencyStorePostgres = "postgres"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodyBytes  = 32 << 20
+	maxStoredResponseBytes  = 1 << 20
+	// idempotencyClaimTimeout - How long an unfinished request holds its key
+	idempotencyClaimTimeout = 5 * time.Minute
+)
+
+var idempotencyRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "idempotency_requests_total",
+	Help: "Requests carrying an Idempotency-Key, by outcome (stored, replayed, mismatch, in_progress, not_stored).",
+}, []string{"outcome"})
+
+// IdempotencyConfig - Idempotency-Key handling
+type IdempotencyConfig struct {
+	Enabled bool
+	Store   string
+	TTL     time.Duration
+}
+
+// IdempotencyRecord - A claimed key and, once the request finished, its response
+type IdempotencyRecord struct {
+	Fingerprint string
+	Completed   bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// IdempotencyStore - Claims keys and keeps their responses
+type IdempotencyStore interface {
+	// Claim - Take key for a new request and return nil, or return the live record already holding it
+	Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	// Complete - Store the response of a claimed key
+	Complete(ctx context.Context, key string, record *IdempotencyRecord) error
+	// Release - Drop an unfinished claim so the key can be retried
+	Release(ctx context.Context, key string) error
+}
+
+var idempotencyConfig IdempotencyConfig
+
+var idempotencyStore IdempotencyStore
+
+// idempotencyFingerprint - What a retry must repeat exactly
+func idempotencyFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%q\n%q\n", r.Method, r.URL.RequestURI(),
+		r.Header.Values("If-Match"), r.Header.Values("If-None-Match"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotencyStoreKey - Key as stored: scoped to the caller so callers cannot see each other's responses
+func idempotencyStoreKey(r *http.Request, key string) string {
+	kind, id := rateLimitCaller(r)
+	sum := sha256.Sum256([]byte(kind + ":" + id + ":" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyRecorder - Passes the response through while keeping a copy to store
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (ir *idempotencyRecorder) WriteHeader(status int) {
+	if ir.status == 0 {
+		ir.status = status
+	}
+	ir.ResponseWriter.WriteHeader(status)
+}
+
+func (ir *idempotencyRecorder) Write(b []byte) (int, error) {
+	if ir.status == 0 {
+		ir.status = http.StatusOK
+	}
+	if !ir.overflow {
+		if ir.body.Len()+len(b) > maxStoredResponseBytes {
+			ir.overflow = true
+			ir.body.Reset()
+		} else {
+			ir.body.Write(b)
+		}
+	}
+	return ir.ResponseWriter.Write(b)
+}
+
+func (ir *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return ir.ResponseWriter
+}
+
+// handlerHeaders - Headers the handler added or changed, leaving out those set
+// by outer middleware (CORS, tracing, rate limits), which are fresh on every replay
+func handlerHeaders(before, after http.Header) http.Header {
+	added := make(http.Header)
+	for name, values := range after {
+		previous, existed := before[name]
+		if existed && slices.Equal(previous, values) {
+			continue
+		}
+		added[name] = append([]string(nil), values...)
+	}
+	return added
+}
+
+// idempotencyMiddleware - Run each keyed mutation once and replay its response to retries
+func idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if idempotencyStore == nil || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength), http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodyBytes+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxIdempotentBodyBytes {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		logger := requestLogger(r).With("idempotency")
+		storeKey := idempotencyStoreKey(r, key)
+		fingerprint := idempotencyFingerprint(r, body)
+		existing, err := idempotencyStore.Claim(r.Context(), storeKey, fingerprint, idempotencyConfig.TTL)
+		if err != nil {
+			// Better a possible duplicate than an outage
+			logger.Warn("Idempotency store failed; handling request without a key", map[string]interface{}{"error": err.Error()})
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				idempotencyRequestsTotal.WithLabelValues("mismatch").Inc()
+				http.Error(w, "Idempotency-Key was already used for a different request", http.StatusConflict)
+			case !existing.Completed:
+				idempotencyRequestsTotal.WithLabelValues("in_progress").Inc()
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+			default:
+				idempotencyRequestsTotal.WithLabelValues("replayed").Inc()
+				for name, values := range existing.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+			}
+			return
+		}
+
+		before := w.Header().Clone()
+		recorder := &idempotencyRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		// The client may be gone, which is exactly when its retry needs the stored response
+		ctx := context.WithoutCancel(r.Context())
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		if recorder.status >= 500 || recorder.overflow ||
+			recorder.status == http.StatusPreconditionFailed || recorder.status == http.StatusPreconditionRequired {
+			idempotencyRequestsTotal.WithLabelValues("not_stored").Inc()
+			if err := idempotencyStore.Release(ctx, storeKey); err != nil {
+				logger.Warn("Failed to release idempotency key", map[string]interface{}{"error": err.Error()})
+			}
+			return
+		}
+		record := &IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			Status:      recorder.status,
+			Header:      handlerHeaders(before, w.Header()),
+			Body:        recorder.body.Bytes(),
+		}
+		if err := idempotencyStore.Complete(ctx, storeKey, record); err != nil {
+			logger.Warn("Failed to store idempotent response", map[string]interface{}{"error": err.Error()})
+			return
+		}
+		idempotencyRequestsTotal.WithLabelValues("stored").Inc()
+	})
+}
+
+// initIdempotency - Choose the store; without the database, keys are kept in memory
+func initIdempotency(config IdempotencyConfig, db *sql.DB) {
+	if !config.Enabled {
+		componentLogger("idempotency").Warn("Idempotency keys disabled", nil)
+		return
+	}
+	store := config.Store
+	if store == IdempotencyStorePostgres {
+		postgres := NewPostgresIdempotencyStore(db)
+		if err := postgres.EnsureSchema(); err != nil {
+			componentLogger("idempotency").Warn("Idempotency keys kept in memory", map[string]interface{}{"error": err.Error()})
+			store = IdempotencyStoreMemory
+		} else {
+			idempotencyStore = postgres
+		}
+	}
+	if store == IdempotencyStoreMemory {
+		idempotencyStore = NewMemoryIdempotencyStore()
+	}
+	componentLogger("idempotency").Info("Idempotency keys honored", map[string]interface{}{"ttl": config.TTL.String(), "store": store})
+}
+
+// ========================================
+// MEMORY STORE
+// ========================================
+
+// MemoryIdempotencyStore - Keys of this process only
+type MemoryIdempotencyStore struct {
+	entries   map[string]*memoryIdempotencyEntry
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+type memoryIdempotencyEntry struct {
+	record       IdempotencyRecord
+	expiresAt    time.Time
+	claimExpires time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]*memoryIdempotencyEntry), lastSweep: time.Now()}
+}
+
+func (ms *MemoryIdempotencyStore) Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(ms.lastSweep) > time.Minute {
+		for id, entry := range ms.entries {
+			if entry.lapsed(now) {
+				delete(ms.entries, id)
+			}
+		}
+		ms.lastSweep = now
+	}
+
+	if entry, ok := ms.entries[key]; ok && !entry.lapsed(now) {
+		record := entry.record
+		return &record, nil
+	}
+	ms.entries[key] = &memoryIdempotencyEntry{
+		record:       IdempotencyRecord{Fingerprint: fingerprint},
+		expiresAt:    now.Add(ttl),
+		claimExpires: now.Add(idempotencyClaimTimeout),
+	}
+	return nil, nil
+}
+
+func (ms *MemoryIdempotencyStore) Complete(ctx context.Context, key string, record *IdempotencyRecord) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if entry, ok := ms.entries[key]; ok {
+		entry.record = *record
+	}
+	return nil
+}
+
+func (ms *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if entry, ok := ms.entries[key]; ok && !entry.record.Completed {
+		delete(ms.entries, key)
+	}
+	return nil
+}
+
+// lapsed - Expired, or claimed by a request that never finished
+func (e *memoryIdempotencyEntry) lapsed(now time.Time) bool {
+	return now.After(e.expiresAt) || (!e.record.Completed && now.After(e.claimExpires))
+}
+
+// ========================================
+// POSTGRES STORE
+// ========================================
+
+const idempotencySchema = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  key CHAR(64) PRIMARY KEY,
+  fingerprint CHAR(64) NOT NULL,
+  status INTEGER,
+  headers JSONB,
+  body BYTEA,
+  claimed_until TIMESTAMPTZ NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at);
+`
+
+// idempotencyClaimQuery - Insert a claim, or take over a key whose record
+// lapsed; returns no row when a live record holds the key.
+// $3 is the TTL and $4 the claim timeout, in seconds
+const idempotencyClaimQuery = `
+INSERT INTO idempotency_keys (key, fingerprint, claimed_until, expires_at)
+VALUES ($1, $2, clock_timestamp() + make_interval(secs => $4), clock_timestamp() + make_interval(secs => $3))
+ON CONFLICT (key) DO UPDATE SET
+  fingerprint = EXCLUDED.fingerprint,
+  status = NULL,
+  headers = NULL,
+  body = NULL,
+  claimed_until = EXCLUDED.claimed_until,
+  expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at < clock_timestamp()
+  OR (idempotency_keys.status IS NULL AND idempotency_keys.claimed_until < clock_timestamp())
+RETURNING key`
+
+// PostgresIdempotencyStore - Keys shared by every replica
+type PostgresIdempotencyStore struct {
+	db        *sql.DB
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+func NewPostgresIdempotencyStore(db *sql.DB) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{db: db, lastSweep: time.Now()}
+}
+
+// EnsureSchema - Create the key table if missing
+func (ps *PostgresIdempotencyStore) EnsureSchema() error {
+	if ps.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	_, err := ps.db.Exec(idempotencySchema)
+	return err
+}
+
+func (ps *PostgresIdempotencyStore) Claim(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	ps.sweep()
+
+	// A record that lapses between the two statements is simply claimed on the next pass
+	for attempt := 0; attempt < 3; attempt++ {
+		var claimed string
+		err := ps.db.QueryRowContext(ctx, idempotencyClaimQuery,
+			key, fingerprint, ttl.Seconds(), idempotencyClaimTimeout.Seconds()).Scan(&claimed)
+		if err == nil {
+			return nil, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		var record IdempotencyRecord
+		var status sql.NullInt64
+		var headers []byte
+		err = ps.db.QueryRowContext(ctx,
+			"SELECT fingerprint, status, headers, body FROM idempotency_keys WHERE key = $1",
+			key,
+		).Scan(&record.Fingerprint, &status, &headers, &record.Body)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if status.Valid {
+			record.Completed = true
+			record.Status = int(status.Int64)
+			if err := json.Unmarshal(headers, &record.Header); err != nil {
+				return nil, err
+			}
+		}
+		return &record, nil
+	}
+	return nil, fmt.Errorf("idempotency key %s keeps changing hands", key[:12])
+}
+
+func (ps *PostgresIdempotencyStore) Complete(ctx context.Context, key string, record *IdempotencyRecord) error {
+	headers, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	_, err = ps.db.ExecContext(ctx,
+		"UPDATE idempotency_keys SET status = $2, headers = $3, body = $4 WHERE key = $1 AND fingerprint = $5",
+		key, record.Status, headers, record.Body, record.Fingerprint)
+	return err
+}
+
+func (ps *PostgresIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := ps.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND status IS NULL", key)
+	return err
+}
+
+// sweep - Delete expired keys, at most every ten minutes
+func (ps *PostgresIdempotencyStore) sweep() {
+	ps.mutex.Lock()
+	if time.Since(ps.lastSweep) < 10*time.Minute {
+		ps.mutex.Unlock()
+		return
+	}
+	ps.lastSweep = time.Now()
+	ps.mutex.Unlock()
+
+	go func() {
+		if _, err := ps.db.Exec("DELETE FROM idempotency_keys WHERE expires_at < clock_timestamp()"); err != nil {
+			componentLogger("idempotency").Error(err, "Failed to prune idempotency keys", nil)
+		}
+	}()
+}
@@ -0,0 +1,820 @@
+package main
+
+// Inbound email
+// Mail sent to project+{id}@<domain> becomes a task in that project; mail sent
+// to task+{id}@<domain>, or whose subject carries [task:{id}], becomes a
+// comment on that task. Senders must be known users (matched by email).
+//
+// The From: header is only believed once the sender is verified, either by
+//   - an Authentication-Results header added by our own MTA (its authserv-id
+//     is inbound_email.authserv_id) with a DKIM, SPF or DMARC pass for the
+//     From: domain; the MTA must strip such headers arriving from outside, or
+//   - a reply token in the recipient, task+{id}+{token}@<domain>, which is an
+//     HMAC of the target and the user's email that only that user is given
+//     (GET /api/v1/me/inbound-address).
+//
+// Messages arrive through an InboundMailSource:
+//   - smtp / lmtp: a minimal listener meant to sit behind the real MTA
+//     (e.g. Postfix handing off with lmtp:inet:backend:2525); it has no TLS
+//     or AUTH and should not be exposed to the internet
+//   - maildir: polls <dir>/new and moves handled messages to <dir>/cur
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InboundEmailConfig - Which source to run and which addresses it accepts
+type InboundEmailConfig struct {
+	Mode       string // "smtp", "lmtp", "maildir" or empty to disable
+	ListenAddr string
+	Maildir    string
+	Domain     string // when set, only addresses at this domain are accepted
+	MaxSize    int64
+	AuthServID string // authserv-id of the MTA whose Authentication-Results are trusted
+	// ReplyTokenSecret signs per-user reply addresses; empty disables them
+	ReplyTokenSecret string
+}
+
+// InboundEnvelope - SMTP envelope of a message
+type InboundEnvelope struct {
+	From       string
+	Recipients []string
+}
+
+// InboundMailHandler - Processes one raw RFC 5322 message
+type InboundMailHandler func(envelope InboundEnvelope, raw []byte) error
+
+// InboundMailSource - Delivers raw messages to a handler until stopped
+type InboundMailSource interface {
+	Start(handler InboundMailHandler) error
+	Stop()
+}
+
+// InboundMailProcessor - Turns messages into tasks and comments through the task service
+type InboundMailProcessor struct {
+	tasks       *TaskService
+	domain      string
+	authServID  string
+	replySecret string
+}
+
+// errInboundRejected - Permanent failures; listeners answer 550 instead of 451
+type errInboundRejected struct {
+	reason string
+}
+
+func (e *errInboundRejected) Error() string {
+	return e.reason
+}
+
+var inboundMail InboundMailSource
+
+// inboundProcessor - The running processor, used to hand out reply addresses
+var inboundProcessor *InboundMailProcessor
+
+var (
+	inboundAddressPattern = regexp.MustCompile(`^(project|task)\+([A-Za-z0-9_-]+)(?:\+([0-9a-f]+))?$`)
+	inboundResultComments = regexp.MustCompile(`\([^)]*\)`)
+	inboundSubjectTask    = regexp.MustCompile(`\[task:([A-Za-z0-9_-]+)\]`)
+	inboundReplyPrefix    = regexp.MustCompile(`^(?i)((re|fwd?|aw|sv)\s*:\s*)+`)
+	inboundQuoteHeader    = regexp.MustCompile(`^On .+ wrote:$`)
+	inboundHTMLTags       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// inboundReplyTokenLength - Hex characters of the HMAC kept in a reply address
+const inboundReplyTokenLength = 16
+
+func NewInboundMailProcessor(tasks *TaskService, config InboundEmailConfig) *InboundMailProcessor {
+	return &InboundMailProcessor{
+		tasks:       tasks,
+		domain:      strings.ToLower(config.Domain),
+		authServID:  strings.ToLower(config.AuthServID),
+		replySecret: config.ReplyTokenSecret,
+	}
+}
+
+// newInboundMailSource - Build the configured source, or nil when inbound email is off
+func newInboundMailSource(config InboundEmailConfig) (InboundMailSource, error) {
+	switch config.Mode {
+	case "":
+		return nil, nil
+	case "smtp", "lmtp":
+		return NewSMTPInboundListener(config.ListenAddr, config.Mode == "lmtp", config.MaxSize), nil
+	case "maildir":
+		if config.Maildir == "" {
+			return nil, fmt.Errorf("INBOUND_MAILDIR is required for maildir mode")
+		}
+		return NewMaildirPoller(config.Maildir, 30*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown inbound email mode %q", config.Mode)
+	}
+}
+
+// inboundTarget - What a recipient address points at, with the reply token it carried
+type inboundTarget struct {
+	kind  string // "project" or "task"
+	id    string
+	token string
+}
+
+// parseInboundAddress - Target encoded in a recipient address
+func (ip *InboundMailProcessor) parseInboundAddress(address string) (inboundTarget, bool) {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	local, domain, found := strings.Cut(strings.Trim(address, "<> "), "@")
+	if !found {
+		return inboundTarget{}, false
+	}
+	if ip.domain != "" && strings.ToLower(domain) != ip.domain {
+		return inboundTarget{}, false
+	}
+	match := inboundAddressPattern.FindStringSubmatch(strings.ToLower(local))
+	if match == nil {
+		return inboundTarget{}, false
+	}
+	return inboundTarget{kind: match[1], id: match[2], token: match[3]}, true
+}
+
+// Accepts - Whether a recipient is one of ours; used to answer RCPT TO
+func (ip *InboundMailProcessor) Accepts(address string) bool {
+	_, ok := ip.parseInboundAddress(address)
+	return ok
+}
+
+// inboundReplyToken - Token that lets the owner of email write to one project or task
+func inboundReplyToken(secret, kind, id, email string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(kind + ":" + strings.ToLower(id) + ":" + strings.ToLower(email)))
+	return hex.EncodeToString(mac.Sum(nil))[:inboundReplyTokenLength]
+}
+
+// ReplyAddress - The address email should use to reach a project or task as that user
+func (ip *InboundMailProcessor) ReplyAddress(kind, id, email string) string {
+	local := kind + "+" + strings.ToLower(id)
+	if ip.replySecret != "" {
+		local += "+" + inboundReplyToken(ip.replySecret, kind, id, email)
+	}
+	return local + "@" + ip.domain
+}
+
+// senderVerified - Whether sender is vouched for by our MTA or by the target's reply token
+func (ip *InboundMailProcessor) senderVerified(header mail.Header, sender string, target inboundTarget) bool {
+	if ip.replySecret != "" && target.token != "" &&
+		hmac.Equal([]byte(target.token), []byte(inboundReplyToken(ip.replySecret, target.kind, target.id, sender))) {
+		return true
+	}
+	if ip.authServID == "" {
+		return false
+	}
+	_, senderDomain, found := strings.Cut(strings.ToLower(sender), "@")
+	if !found {
+		return false
+	}
+	for _, value := range header["Authentication-Results"] {
+		if authenticationResultsPass(value, ip.authServID, senderDomain) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticationResultsPass - Whether an RFC 8601 header from authServID reports a DKIM, SPF
+// or DMARC pass aligned with domain (the same domain, a parent or a subdomain of it)
+func authenticationResultsPass(value, authServID, domain string) bool {
+	parts := strings.Split(inboundResultComments.ReplaceAllString(strings.ToLower(value), ""), ";")
+	if fields := strings.Fields(parts[0]); len(fields) == 0 || fields[0] != authServID {
+		return false
+	}
+
+	aligned := func(candidate string) bool {
+		if _, after, found := strings.Cut(candidate, "@"); found {
+			candidate = after
+		}
+		return candidate != "" && (domain == candidate ||
+			strings.HasSuffix(domain, "."+candidate) || strings.HasSuffix(candidate, "."+domain))
+	}
+	for _, result := range parts[1:] {
+		fields := strings.Fields(result)
+		if len(fields) == 0 {
+			continue
+		}
+		method, outcome, _ := strings.Cut(fields[0], "=")
+		if outcome != "pass" {
+			continue
+		}
+		properties := make(map[string]string)
+		for _, field := range fields[1:] {
+			if key, value, found := strings.Cut(field, "="); found {
+				properties[key] = strings.Trim(value, `"`)
+			}
+		}
+		switch method {
+		case "dkim":
+			if aligned(properties["header.d"]) || aligned(properties["header.i"]) {
+				return true
+			}
+		case "spf":
+			if aligned(properties["smtp.mailfrom"]) {
+				return true
+			}
+		case "dmarc":
+			if properties["header.from"] == domain {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Handle - Create a task or comment from one message
+func (ip *InboundMailProcessor) Handle(envelope InboundEnvelope, raw []byte) (err error) {
+	ctx, span := tracer.Start(context.Background(), "inbound_email.handle", trace.WithSpanKind(trace.SpanKindConsumer))
+	defer func() { endSpan(span, err) }()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return &errInboundRejected{fmt.Sprintf("unparseable message: %v", err)}
+	}
+
+	senderAddress := envelope.From
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		senderAddress = from.Address
+	}
+
+	subject := decodeMIMEHeader(msg.Header.Get("Subject"))
+	recipients := append([]string{}, envelope.Recipients...)
+	for _, header := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		if list, err := msg.Header.AddressList(header); err == nil {
+			for _, address := range list {
+				recipients = append(recipients, address.Address)
+			}
+		} else if value := msg.Header.Get(header); value != "" {
+			recipients = append(recipients, value)
+		}
+	}
+
+	var project, task inboundTarget
+	for _, recipient := range recipients {
+		target, ok := ip.parseInboundAddress(recipient)
+		if !ok {
+			continue
+		}
+		if target.kind == "task" && task.id == "" {
+			task = target
+		}
+		if target.kind == "project" && project.id == "" {
+			project = target
+		}
+	}
+	if match := inboundSubjectTask.FindStringSubmatch(subject); match != nil && task.id == "" {
+		task = inboundTarget{kind: "task", id: match[1]}
+	}
+	taskID, projectID := task.id, project.id
+
+	// From: is whatever the sender typed until our MTA or a reply token vouches for it
+	target := project
+	if taskID != "" {
+		target = task
+	}
+	if !ip.senderVerified(msg.Header, senderAddress, target) {
+		return &errInboundRejected{fmt.Sprintf("sender %s is not authenticated", senderAddress)}
+	}
+	sender, err := ip.tasks.FindUserByEmail(ctx, senderAddress)
+	if err != nil {
+		return &errInboundRejected{fmt.Sprintf("unknown sender %s", senderAddress)}
+	}
+
+	body, err := extractTextBody(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return &errInboundRejected{fmt.Sprintf("unreadable body: %v", err)}
+	}
+
+	switch {
+	case taskID != "":
+		comment := &Comment{TaskID: taskID, UserID: sender.ID, Content: stripQuotedReply(body)}
+		if comment.Content == "" {
+			return &errInboundRejected{"empty reply"}
+		}
+		if _, err := ip.tasks.GetTask(ctx, taskID); err != nil {
+			return &errInboundRejected{fmt.Sprintf("unknown task %s", taskID)}
+		}
+		if err := ip.tasks.AddComment(ctx, comment); err != nil {
+			return err
+		}
+		componentLogger("inbound_email").Info("Inbound email added a comment", map[string]interface{}{"from": senderAddress, "comment_id": comment.ID, "task_id": taskID})
+
+	case projectID != "":
+		exists, err := ip.tasks.ProjectExists(ctx, projectID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return &errInboundRejected{fmt.Sprintf("unknown project %s", projectID)}
+		}
+
+		title := strings.TrimSpace(inboundReplyPrefix.ReplaceAllString(subject, ""))
+		if title == "" {
+			title = "(no subject)"
+		}
+		task := &Task{
+			Title:       title,
+			Description: strings.TrimSpace(body),
+			Status:      "todo",
+			Priority:    inboundPriority(msg.Header),
+			ProjectID:   projectID,
+		}
+		if err := ip.tasks.CreateTask(ctx, task, sender.ID); err != nil {
+			return err
+		}
+		componentLogger("inbound_email").Info("Inbound email created a task", map[string]interface{}{"from": senderAddress, "task_id": task.ID, "project_id": projectID})
+
+	default:
+		return &errInboundRejected{"no project+{id} or task+{id} recipient"}
+	}
+	return nil
+}
+
+// inboundPriority - Map X-Priority / Importance headers onto task priorities
+func inboundPriority(header mail.Header) string {
+	xPriority := strings.TrimSpace(header.Get("X-Priority"))
+	importance := strings.ToLower(header.Get("Importance"))
+	switch {
+	case strings.HasPrefix(xPriority, "1"), strings.HasPrefix(xPriority, "2"), importance == "high":
+		return "high"
+	case strings.HasPrefix(xPriority, "4"), strings.HasPrefix(xPriority, "5"), importance == "low":
+		return "low"
+	default:
+		return "medium"
+	}
+}
+
+func decodeMIMEHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// extractTextBody - Plain text of a message, preferring text/plain parts over HTML
+func extractTextBody(header textproto.MIMEHeader, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		var htmlFallback string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := extractTextBody(part.Header, part)
+			if err != nil {
+				return "", err
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if partType == "text/html" {
+				if htmlFallback == "" {
+					htmlFallback = text
+				}
+				continue
+			}
+			if text != "" && part.FileName() == "" {
+				return text, nil
+			}
+		}
+		return htmlFallback, nil
+	}
+
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "", nil
+	}
+
+	var decoded io.Reader = body
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		decoded = quotedprintable.NewReader(body)
+	case "base64":
+		decoded = base64.NewDecoder(base64.StdEncoding, &lineJoiner{r: body})
+	}
+	data, err := io.ReadAll(io.LimitReader(decoded, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	text := string(data)
+	if mediaType == "text/html" {
+		text = inboundHTMLTags.ReplaceAllString(text, "")
+	}
+	return strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n")), nil
+}
+
+// lineJoiner - Drops line breaks so wrapped base64 decodes
+type lineJoiner struct {
+	r io.Reader
+}
+
+func (lj *lineJoiner) Read(p []byte) (int, error) {
+	n, err := lj.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// stripQuotedReply - Keep only what the sender wrote above the quoted original
+func stripQuotedReply(body string) string {
+	var kept []string
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if inboundQuoteHeader.MatchString(trimmed) || trimmed == "-----Original Message-----" || trimmed == "-- " {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// ========================================
+// SMTP / LMTP LISTENER
+// ========================================
+
+// SMTPInboundListener - Minimal SMTP or LMTP server for MTA hand-off
+type SMTPInboundListener struct {
+	addr     string
+	lmtp     bool
+	maxSize  int64
+	hostname string
+	accepts  func(address string) bool
+	listener net.Listener
+	conns    sync.WaitGroup
+}
+
+func NewSMTPInboundListener(addr string, lmtp bool, maxSize int64) *SMTPInboundListener {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return &SMTPInboundListener{addr: addr, lmtp: lmtp, maxSize: maxSize, hostname: hostname}
+}
+
+// Start - Listen and serve connections in the background
+func (sl *SMTPInboundListener) Start(handler InboundMailHandler) error {
+	listener, err := net.Listen("tcp", sl.addr)
+	if err != nil {
+		return err
+	}
+	sl.listener = listener
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				componentLogger("inbound_email").Error(err, "Inbound mail accept failed", nil)
+				continue
+			}
+			sl.conns.Add(1)
+			go func() {
+				defer sl.conns.Done()
+				sl.serve(conn, handler)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Stop - Stop accepting and wait for open sessions to finish
+func (sl *SMTPInboundListener) Stop() {
+	if sl.listener != nil {
+		sl.listener.Close()
+	}
+	sl.conns.Wait()
+}
+
+// serve - One SMTP/LMTP session
+func (sl *SMTPInboundListener) serve(conn net.Conn, handler InboundMailHandler) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	protocol := "ESMTP"
+	if sl.lmtp {
+		protocol = "LMTP"
+	}
+
+	reply := func(code int, message string) bool {
+		conn.SetWriteDeadline(time.Now().Add(time.Minute))
+		return text.PrintfLine("%d %s", code, message) == nil
+	}
+	reply(220, sl.hostname+" "+protocol+" task inbound ready")
+
+	var envelope InboundEnvelope
+	greeted := false
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+
+		switch {
+		case verb == "LHLO" && sl.lmtp, (verb == "EHLO" || verb == "HELO") && !sl.lmtp:
+			greeted = true
+			envelope = InboundEnvelope{}
+			if verb == "HELO" {
+				reply(250, sl.hostname)
+			} else {
+				text.PrintfLine("250-%s", sl.hostname)
+				text.PrintfLine("250-8BITMIME")
+				reply(250, fmt.Sprintf("SIZE %d", sl.maxSize))
+			}
+		case verb == "MAIL" && greeted:
+			address, ok := smtpPathArgument(arg, "FROM:")
+			if !ok {
+				reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+			envelope = InboundEnvelope{From: address}
+			reply(250, "OK")
+		case verb == "RCPT" && greeted:
+			address, ok := smtpPathArgument(arg, "TO:")
+			if !ok {
+				reply(501, "Syntax: RCPT TO:<address>")
+				continue
+			}
+			if sl.accepts != nil && !sl.accepts(address) {
+				reply(550, "No such mailbox")
+				continue
+			}
+			envelope.Recipients = append(envelope.Recipients, address)
+			reply(250, "OK")
+		case verb == "DATA" && greeted:
+			if len(envelope.Recipients) == 0 {
+				reply(503, "No valid recipients")
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			raw, err := io.ReadAll(io.LimitReader(text.DotReader(), sl.maxSize+1))
+			if err != nil {
+				return
+			}
+
+			code, message := 250, "OK"
+			if int64(len(raw)) > sl.maxSize {
+				io.Copy(io.Discard, text.DotReader())
+				code, message = 552, "Message exceeds size limit"
+			} else if err := handler(envelope, raw); err != nil {
+				var rejected *errInboundRejected
+				if errors.As(err, &rejected) {
+					code, message = 550, rejected.reason
+				} else {
+					componentLogger("inbound_email").Error(err, "Inbound mail failed", map[string]interface{}{"from": envelope.From})
+					code, message = 451, "Temporary failure, try again later"
+				}
+			}
+
+			// LMTP answers once per recipient
+			count := 1
+			if sl.lmtp {
+				count = len(envelope.Recipients)
+			}
+			for i := 0; i < count; i++ {
+				reply(code, message)
+			}
+			envelope = InboundEnvelope{}
+		case verb == "RSET":
+			envelope = InboundEnvelope{}
+			reply(250, "OK")
+		case verb == "NOOP":
+			reply(250, "OK")
+		case verb == "VRFY":
+			reply(252, "Cannot verify")
+		case verb == "QUIT":
+			reply(221, "Bye")
+			return
+		case verb == "MAIL" || verb == "RCPT" || verb == "DATA":
+			reply(503, "Say hello first")
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// smtpPathArgument - Address from "FROM:<a@b> SIZE=..." style arguments
+func smtpPathArgument(arg, prefix string) (string, bool) {
+	if !strings.HasPrefix(strings.ToUpper(arg), prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	if i := strings.Index(path, ">"); strings.HasPrefix(path, "<") && i > 0 {
+		return path[1:i], true
+	}
+	fields := strings.Fields(path)
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fields[0], true
+}
+
+// ========================================
+// MAILDIR POLLER
+// ========================================
+
+// MaildirPoller - Picks up messages a local MTA drops into a maildir
+type MaildirPoller struct {
+	dir      string
+	interval time.Duration
+	stop     chan bool
+	done     chan bool
+}
+
+func NewMaildirPoller(dir string, interval time.Duration) *MaildirPoller {
+	return &MaildirPoller{dir: dir, interval: interval, stop: make(chan bool), done: make(chan bool)}
+}
+
+// Start - Poll <dir>/new until stopped
+func (mp *MaildirPoller) Start(handler InboundMailHandler) error {
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(mp.dir, sub), 0o750); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		defer close(mp.done)
+		ticker := time.NewTicker(mp.interval)
+		defer ticker.Stop()
+		for {
+			mp.poll(handler)
+			select {
+			case <-ticker.C:
+			case <-mp.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop - Finish the current poll and stop
+func (mp *MaildirPoller) Stop() {
+	close(mp.stop)
+	<-mp.done
+}
+
+// poll - Handle every new message; handled ones are flagged Seen, rejected ones Trashed
+func (mp *MaildirPoller) poll(handler InboundMailHandler) {
+	entries, err := os.ReadDir(filepath.Join(mp.dir, "new"))
+	if err != nil {
+		componentLogger("inbound_email").Error(err, "Failed to read maildir", map[string]interface{}{"dir": mp.dir})
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(mp.dir, "new", entry.Name())
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			componentLogger("inbound_email").Error(err, "Failed to read inbound mail", map[string]interface{}{"path": path})
+			continue
+		}
+
+		envelope := InboundEnvelope{}
+		if msg, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+			envelope.From = strings.Trim(msg.Header.Get("Return-Path"), "<>")
+		}
+
+		flag := "S"
+		if err := handler(envelope, raw); err != nil {
+			var rejected *errInboundRejected
+			if !errors.As(err, &rejected) {
+				// Leave it in new/ and retry on the next poll
+				componentLogger("inbound_email").Error(err, "Inbound mail failed, will retry", map[string]interface{}{"file": entry.Name()})
+				continue
+			}
+			componentLogger("inbound_email").Warn("Inbound mail rejected", map[string]interface{}{"file": entry.Name(), "reason": err.Error()})
+			flag = "T"
+		}
+
+		name := strings.SplitN(entry.Name(), ":", 2)[0]
+		if err := os.Rename(path, filepath.Join(mp.dir, "cur", name+":2,"+flag)); err != nil {
+			componentLogger("inbound_email").Error(err, "Failed to move inbound mail to cur", map[string]interface{}{"path": path})
+		}
+	}
+}
+
+// startInboundEmail - Start the configured inbound source, if any
+func startInboundEmail(config InboundEmailConfig, tasks *TaskService) InboundMailSource {
+	source, err := newInboundMailSource(config)
+	if err != nil {
+		componentLogger("inbound_email").Error(err, "Inbound email disabled", nil)
+		return nil
+	}
+	if source == nil {
+		return nil
+	}
+
+	processor := NewInboundMailProcessor(tasks, config)
+	if listener, ok := source.(*SMTPInboundListener); ok {
+		listener.accepts = processor.Accepts
+	}
+	if err := source.Start(processor.Handle); err != nil {
+		componentLogger("inbound_email").Error(err, "Inbound email disabled", nil)
+		return nil
+	}
+	inboundProcessor = processor
+	return source
+}
+
+// ========================================
+// INBOUND EMAIL HANDLERS
+// ========================================
+
+// getMyInboundAddressHandler - The caller's own address for mailing a task (task_id) or project (project_id)
+func getMyInboundAddressHandler(w http.ResponseWriter, r *http.Request) {
+	if inboundProcessor == nil {
+		http.Error(w, "Inbound email unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	userID := requestUserID(r)
+	if userID == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	kind, id := "task", r.URL.Query().Get("task_id")
+	if id == "" {
+		kind, id = "project", r.URL.Query().Get("project_id")
+	}
+	if id == "" {
+		http.Error(w, "task_id or project_id is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := taskService.FindUserByID(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	address := inboundProcessor.ReplyAddress(kind, id, user.Email)
+	if _, ok := inboundProcessor.parseInboundAddress(address); !ok {
+		http.Error(w, "Invalid "+kind+" ID", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{
+		"address": address,
+		"kind":    kind,
+		"id":      id,
+	})
+}
@@ -0,0 +1,359 @@
+package main
+
+// Log output: formats, levels, rotation and the in-memory ring
+// EnhancedLogger writes every entry to the current log file, to stdout and
+// to a ring of recent entries. Files rotate by size and age; rotated files
+// are gzipped and pruned by count and retention. Each component can have
+// its own minimum level, adjustable at runtime; SECURITY and AUDIT entries
+// are never filtered.
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output formats
+const (
+	LogFormatText   = "text"
+	LogFormatJSON   = "json"
+	LogFormatLogfmt = "logfmt"
+)
+
+const (
+	logFilePrefix = "task-management_"
+	logFileSuffix = ".log"
+)
+
+// LoggerConfig - Output, level and rotation settings for EnhancedLogger
+type LoggerConfig struct {
+	Dir             string
+	Format          string // "text", "json" or "logfmt"
+	Level           LogLevel
+	ComponentLevels map[string]LogLevel
+	MaxSizeMB       int           // rotate when the current file reaches this size; 0 disables
+	MaxAge          time.Duration // rotate when the current file is this old; 0 disables
+	Retention       time.Duration // delete rotated files older than this; 0 keeps them
+	MaxBackups      int           // keep at most this many rotated files; 0 keeps them all
+	Compress        bool
+	Color           bool
+	BufferSize      int           // recent entries kept in memory
+	ReportRetention time.Duration // delete downloadable reports and recorded scans older than this; 0 keeps them
+}
+
+var logLevelRank = map[LogLevel]int{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+	LogLevelError: 3,
+	LogLevelFatal: 4,
+}
+
+// parseLogLevel - Normalize a level name; SECURITY and AUDIT are not thresholds
+func parseLogLevel(value string) (LogLevel, error) {
+	level := LogLevel(strings.ToUpper(strings.TrimSpace(value)))
+	if level == "WARNING" {
+		level = LogLevelWarn
+	}
+	if _, ok := logLevelRank[level]; !ok {
+		return "", fmt.Errorf("unknown log level %q", value)
+	}
+	return level, nil
+}
+
+// parseComponentLevels - "http=WARN,notifications=DEBUG" into a map
+func parseComponentLevels(value string) (map[string]LogLevel, error) {
+	levels := make(map[string]LogLevel)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		component, name, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(component) == "" {
+			return nil, fmt.Errorf("invalid component level %q", pair)
+		}
+		level, err := parseLogLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+	return levels, nil
+}
+
+// Enabled - Whether an entry at level from component passes the thresholds
+func (el *EnhancedLogger) Enabled(component string, level LogLevel) bool {
+	rank, ok := logLevelRank[level]
+	if !ok {
+		return true // SECURITY, AUDIT
+	}
+
+	el.levelMutex.RLock()
+	defer el.levelMutex.RUnlock()
+	threshold, ok := el.componentLevels[component]
+	if !ok {
+		threshold = el.minLevel
+	}
+	return rank >= logLevelRank[threshold]
+}
+
+// Levels - Default level and per-component overrides
+func (el *EnhancedLogger) Levels() (LogLevel, map[string]LogLevel) {
+	el.levelMutex.RLock()
+	defer el.levelMutex.RUnlock()
+
+	components := make(map[string]LogLevel, len(el.componentLevels))
+	for component, level := range el.componentLevels {
+		components[component] = level
+	}
+	return el.minLevel, components
+}
+
+// SetLevels - Replace the default level (when set) and the per-component overrides
+func (el *EnhancedLogger) SetLevels(defaultLevel LogLevel, components map[string]LogLevel) {
+	el.levelMutex.Lock()
+	defer el.levelMutex.Unlock()
+
+	if defaultLevel != "" {
+		el.minLevel = defaultLevel
+	}
+	el.componentLevels = make(map[string]LogLevel, len(components))
+	for component, level := range components {
+		el.componentLevels[component] = level
+	}
+}
+
+// encodeLogEntry - One line in the configured format
+func (el *EnhancedLogger) encodeLogEntry(entry LogEntry) string {
+	switch el.config.Format {
+	case LogFormatJSON:
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return el.formatLogEntry(entry)
+		}
+		return string(data)
+	case LogFormatLogfmt:
+		return formatLogfmt(entry)
+	default:
+		return el.formatLogEntry(entry)
+	}
+}
+
+// formatLogfmt - key=value pairs, details flattened as detail.<key>
+func formatLogfmt(entry LogEntry) string {
+	var builder strings.Builder
+	pair := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(key)
+		builder.WriteByte('=')
+		if strings.ContainsAny(value, " =\"\t\n") {
+			builder.WriteString(strconv.Quote(value))
+		} else {
+			builder.WriteString(value)
+		}
+	}
+
+	pair("ts", entry.Timestamp.Format(time.RFC3339Nano))
+	pair("level", string(entry.Level))
+	pair("component", entry.Component)
+	pair("msg", entry.Message)
+	pair("error", entry.Error)
+	pair("trace_id", entry.TraceID)
+	pair("request_id", entry.RequestID)
+	pair("user_id", entry.UserID)
+	pair("ip", entry.IPAddress)
+
+	keys := make([]string, 0, len(entry.Details))
+	for key := range entry.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := entry.Details[key]
+		if text, ok := value.(string); ok {
+			pair("detail."+key, text)
+			continue
+		}
+		data, _ := json.Marshal(value)
+		pair("detail."+key, string(data))
+	}
+	return builder.String()
+}
+
+// shouldRotate - Whether writing n more bytes should go to a fresh file
+func (el *EnhancedLogger) shouldRotate(n int) bool {
+	if el.config.MaxSizeMB > 0 && el.currentSize+int64(n) > int64(el.config.MaxSizeMB)<<20 {
+		return true
+	}
+	return el.config.MaxAge > 0 && time.Since(el.openedAt) >= el.config.MaxAge
+}
+
+// compressLogFile - Replace path with path.gz
+func compressLogFile(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	tmp := path + ".gz.tmp"
+	target, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(target)
+	if _, err := io.Copy(writer, source); err != nil {
+		target.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		target.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := target.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// rotatedLogFile - A log file other than the one being written
+type rotatedLogFile struct {
+	Path    string
+	ModTime time.Time
+	Size    int64
+}
+
+// rotatedLogFiles - Rotated files, newest first
+func (el *EnhancedLogger) rotatedLogFiles() []rotatedLogFile {
+	el.writeMutex.Lock()
+	current := el.currentLogPath
+	el.writeMutex.Unlock()
+
+	matches, _ := filepath.Glob(filepath.Join(el.logDir, logFilePrefix+"*"+logFileSuffix+"*"))
+	var files []rotatedLogFile
+	for _, path := range matches {
+		if path == current || strings.HasSuffix(path, ".tmp") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		files = append(files, rotatedLogFile{Path: path, ModTime: info.ModTime(), Size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime.After(files[j].ModTime) })
+	return files
+}
+
+// pruneLogFiles - Enforce MaxBackups and Retention on rotated files
+func (el *EnhancedLogger) pruneLogFiles() {
+	for i, file := range el.rotatedLogFiles() {
+		expired := el.config.Retention > 0 && time.Since(file.ModTime) > el.config.Retention
+		excess := el.config.MaxBackups > 0 && i >= el.config.MaxBackups
+		if expired || excess {
+			if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Failed to remove old log file %s: %v\n", file.Path, err)
+			}
+		}
+	}
+}
+
+// startRotationTimer - Rotate by age even when nothing is being logged
+func (el *EnhancedLogger) startRotationTimer() {
+	if el.config.MaxAge <= 0 {
+		return
+	}
+	interval := el.config.MaxAge / 10
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			el.writeMutex.Lock()
+			if el.currentLogFile != nil && el.shouldRotate(0) {
+				if err := el.rotateLogFile(); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+				}
+			}
+			el.writeMutex.Unlock()
+		}
+	}()
+}
+
+// Flush - Sync the current log file to disk
+func (el *EnhancedLogger) Flush() error {
+	el.writeMutex.Lock()
+	defer el.writeMutex.Unlock()
+	if el.currentLogFile == nil {
+		return nil
+	}
+	return el.currentLogFile.Sync()
+}
+
+// Close - Flush and close the current log file
+func (el *EnhancedLogger) Close() error {
+	el.writeMutex.Lock()
+	defer el.writeMutex.Unlock()
+	if el.currentLogFile == nil {
+		return nil
+	}
+	el.currentLogFile.Sync()
+	err := el.currentLogFile.Close()
+	el.currentLogFile = nil
+	return err
+}
+
+// logRing - Fixed-size buffer of the most recent entries
+type logRing struct {
+	items []LogEntry
+	next  int
+	full  bool
+	mutex sync.RWMutex
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{items: make([]LogEntry, size)}
+}
+
+func (lr *logRing) add(entry LogEntry) {
+	lr.mutex.Lock()
+	defer lr.mutex.Unlock()
+	lr.items[lr.next] = entry
+	lr.next = (lr.next + 1) % len(lr.items)
+	if lr.next == 0 {
+		lr.full = true
+	}
+}
+
+// entries - Buffered entries, oldest first
+func (lr *logRing) entries() []LogEntry {
+	lr.mutex.RLock()
+	defer lr.mutex.RUnlock()
+	if !lr.full {
+		return append([]LogEntry(nil), lr.items[:lr.next]...)
+	}
+	result := make([]LogEntry, 0, len(lr.items))
+	result = append(result, lr.items[lr.next:]...)
+	return append(result, lr.items[:lr.next]...)
+}
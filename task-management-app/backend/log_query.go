@@ -0,0 +1,630 @@
+package main
+
+// Log query API
+// GET /api/v1/admin/logs searches the in-memory ring of recent entries and
+// the log files on disk - the current file and the rotated ones, gzipped or
+// not, in whichever of the text, json and logfmt formats they were written -
+// so nobody has to shell into a pod to grep them. Results are newest first
+// and paginated with an opaque cursor. Files are streamed a record at a time
+// and only the newest entries a page can still use are kept, so a query never
+// holds a whole rotated file in memory. With follow=true the response is a
+// Server-Sent Events stream that starts with the latest matching entries
+// from the ring and then tails new ones as they are written.
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Log query sources
+const (
+	LogSourceAll    = "all"    // the ring, then files for anything older
+	LogSourceBuffer = "buffer" // only the in-memory ring
+	LogSourceFiles  = "files"  // only the files on disk
+)
+
+const (
+	logQueryDefaultLimit = 100
+	logQueryMaxLimit     = 1000
+	logTailKeepalive     = 15 * time.Second
+	logTailBuffer        = 256
+)
+
+// textLogHeader - "[2006-01-02 15:04:05.000] [LEVEL] [component] " as written by formatLogEntry
+var textLogHeader = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3})\] \[([A-Z]+)\] \[([^\]]*)\] `)
+
+// LogQuery - Filters of a log search; zero values match everything
+type LogQuery struct {
+	Since      time.Time
+	Until      time.Time
+	Levels     map[LogLevel]bool
+	MinLevel   LogLevel
+	Components map[string]bool
+	UserID     string
+	TraceID    string
+	Text       string // case-insensitive substring of message, error or details
+}
+
+// logCursor - Position after the last entry of a page: entries newer than
+// Timestamp, and the first Skip entries at Timestamp, were already returned
+type logCursor struct {
+	Timestamp time.Time
+	Skip      int
+}
+
+// logSubscription - A live tail fed by writeLogEntry
+type logSubscription struct {
+	entries chan LogEntry
+	dropped atomic.Int64
+}
+
+// Matches - Whether entry passes every filter of q
+func (q *LogQuery) Matches(entry LogEntry) bool {
+	if !q.Since.IsZero() && entry.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && entry.Timestamp.After(q.Until) {
+		return false
+	}
+	if len(q.Levels) > 0 && !q.Levels[entry.Level] {
+		return false
+	}
+	if q.MinLevel != "" {
+		// SECURITY and AUDIT have no rank and always pass, as in Enabled
+		if rank, ok := logLevelRank[entry.Level]; ok && rank < logLevelRank[q.MinLevel] {
+			return false
+		}
+	}
+	if len(q.Components) > 0 && !q.Components[entry.Component] {
+		return false
+	}
+	if q.UserID != "" && entry.UserID != q.UserID {
+		return false
+	}
+	if q.TraceID != "" && entry.TraceID != q.TraceID {
+		return false
+	}
+	if q.Text != "" {
+		haystack := entry.Message + "\n" + entry.Error
+		if len(entry.Details) > 0 {
+			details, _ := json.Marshal(entry.Details)
+			haystack += "\n" + string(details)
+		}
+		if !strings.Contains(strings.ToLower(haystack), q.Text) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLogQuery - Filters from since, until, level, min_level, component, user_id, trace_id and q
+func parseLogQuery(values url.Values, now time.Time) (*LogQuery, error) {
+	query := &LogQuery{
+		UserID:  values.Get("user_id"),
+		TraceID: values.Get("trace_id"),
+		Text:    strings.ToLower(values.Get("q")),
+	}
+
+	var err error
+	if query.Since, err = parseLogTime(values.Get("since"), now); err != nil {
+		return nil, fmt.Errorf("since: %v", err)
+	}
+	if query.Until, err = parseLogTime(values.Get("until"), now); err != nil {
+		return nil, fmt.Errorf("until: %v", err)
+	}
+
+	for _, name := range splitList(values.Get("level")) {
+		level := LogLevel(strings.ToUpper(name))
+		if level != LogLevelSecurity && level != LogLevelAudit {
+			if level, err = parseLogLevel(name); err != nil {
+				return nil, fmt.Errorf("level: %v", err)
+			}
+		}
+		if query.Levels == nil {
+			query.Levels = make(map[LogLevel]bool)
+		}
+		query.Levels[level] = true
+	}
+	if minLevel := values.Get("min_level"); minLevel != "" {
+		if query.MinLevel, err = parseLogLevel(minLevel); err != nil {
+			return nil, fmt.Errorf("min_level: %v", err)
+		}
+	}
+	for _, component := range splitList(values.Get("component")) {
+		if query.Components == nil {
+			query.Components = make(map[string]bool)
+		}
+		query.Components[component] = true
+	}
+	return query, nil
+}
+
+// parseLogTime - An RFC 3339 time, or a duration such as "15m" meaning that long before now
+func parseLogTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	ago, err := time.ParseDuration(value)
+	if err != nil || ago < 0 {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 time or a duration, got %q", value)
+	}
+	return now.Add(-ago), nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func encodeLogCursor(cursor logCursor) string {
+	raw := fmt.Sprintf("%d:%d", cursor.Timestamp.UnixNano(), cursor.Skip)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeLogCursor(value string) (logCursor, error) {
+	if value == "" {
+		return logCursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		nanos, skip, found := strings.Cut(string(raw), ":")
+		n, errNanos := strconv.ParseInt(nanos, 10, 64)
+		s, errSkip := strconv.Atoi(skip)
+		if found && errNanos == nil && errSkip == nil && s >= 0 {
+			return logCursor{Timestamp: time.Unix(0, n), Skip: s}, nil
+		}
+	}
+	return logCursor{}, fmt.Errorf("invalid cursor")
+}
+
+// QueryLogs - One page of matching entries, newest first, and the cursor of the next page
+func (el *EnhancedLogger) QueryLogs(query *LogQuery, source string, cursor logCursor, limit int) ([]LogEntry, string) {
+	if limit < 1 {
+		return []LogEntry{}, ""
+	}
+	eligible := func(entry LogEntry) bool {
+		if !cursor.Timestamp.IsZero() && entry.Timestamp.After(cursor.Timestamp) {
+			return false
+		}
+		return query.Matches(entry)
+	}
+	want := cursor.Skip + limit + 1
+	matches := []LogEntry{}
+
+	// The ring holds the newest entries, so files only contribute older ones.
+	// Text files keep milliseconds, hence the truncated boundary.
+	var floor time.Time
+	if source != LogSourceFiles {
+		recent := el.recent.entries()
+		for i := len(recent) - 1; i >= 0; i-- {
+			if eligible(recent[i]) {
+				matches = append(matches, recent[i])
+			}
+		}
+		if len(recent) > 0 {
+			floor = recent[0].Timestamp.Truncate(time.Millisecond)
+		}
+	}
+
+	if source != LogSourceBuffer {
+		for _, file := range el.logFilesNewestFirst() {
+			if len(matches) >= want {
+				break
+			}
+			// Files are written one after another: older files only hold older entries
+			if !query.Since.IsZero() && file.ModTime.Before(query.Since) {
+				break
+			}
+			// Entries are appended in time order, so reading stops at the first one
+			// that is already in the ring or newer than the page, and only the
+			// newest matches the page still needs are kept
+			need := want - len(matches)
+			window := make([]LogEntry, 0, need)
+			err := scanLogFile(file.Path, func(entry LogEntry) bool {
+				if !floor.IsZero() && !entry.Timestamp.Before(floor) {
+					return false
+				}
+				if !cursor.Timestamp.IsZero() && entry.Timestamp.After(cursor.Timestamp) {
+					return false
+				}
+				if !query.Until.IsZero() && entry.Timestamp.After(query.Until) {
+					return false
+				}
+				if eligible(entry) {
+					if len(window) == need {
+						window = window[1:]
+					}
+					window = append(window, entry)
+				}
+				return true
+			})
+			if err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Failed to read log file %s: %v\n", file.Path, err)
+			}
+			for i := len(window) - 1; i >= 0; i-- {
+				matches = append(matches, window[i])
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Timestamp.After(matches[j].Timestamp) })
+
+	start := 0
+	for start < len(matches) && start < cursor.Skip && matches[start].Timestamp.Equal(cursor.Timestamp) {
+		start++
+	}
+	matches = matches[start:]
+	if len(matches) <= limit {
+		return matches, ""
+	}
+
+	matches = matches[:limit]
+	next := logCursor{Timestamp: matches[limit-1].Timestamp}
+	for _, entry := range matches {
+		if entry.Timestamp.Equal(next.Timestamp) {
+			next.Skip++
+		}
+	}
+	if next.Timestamp.Equal(cursor.Timestamp) {
+		next.Skip += cursor.Skip
+	}
+	return matches, encodeLogCursor(next)
+}
+
+// logFilesNewestFirst - The current log file followed by the rotated ones
+func (el *EnhancedLogger) logFilesNewestFirst() []rotatedLogFile {
+	el.writeMutex.Lock()
+	current := el.currentLogPath
+	el.writeMutex.Unlock()
+
+	files := []rotatedLogFile{}
+	if current != "" {
+		if info, err := os.Stat(current); err == nil {
+			files = append(files, rotatedLogFile{Path: current, ModTime: info.ModTime(), Size: info.Size()})
+		}
+	}
+	return append(files, el.rotatedLogFiles()...)
+}
+
+// scanLogFile - Pass each entry of a plain or gzipped log file to visit, oldest
+// first, until visit returns false
+func scanLogFile(path string, visit func(LogEntry) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	// Text-format messages may span lines; a record runs until the next line that starts one
+	stopped := false
+	var record strings.Builder
+	flush := func() {
+		if record.Len() == 0 {
+			return
+		}
+		if entry, ok := parseLogLine(record.String()); ok && !visit(entry) {
+			stopped = true
+		}
+		record.Reset()
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for !stopped && scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "{") || strings.HasPrefix(line, "ts=") || textLogHeader.MatchString(line) {
+			flush()
+		} else if record.Len() > 0 {
+			record.WriteByte('\n')
+		}
+		record.WriteString(line)
+	}
+	if !stopped {
+		flush()
+	}
+	return scanner.Err()
+}
+
+// parseLogLine - Decode one record written in any of the output formats
+func parseLogLine(line string) (LogEntry, bool) {
+	switch {
+	case strings.HasPrefix(line, "{"):
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return LogEntry{}, false
+		}
+		return entry, !entry.Timestamp.IsZero()
+	case strings.HasPrefix(line, "ts="):
+		return parseLogfmtLine(line)
+	default:
+		return parseTextLogLine(line)
+	}
+}
+
+// parseTextLogLine - Reverse of formatLogEntry; the optional fields are peeled off the end
+func parseTextLogLine(line string) (LogEntry, bool) {
+	header := textLogHeader.FindStringSubmatch(line)
+	if header == nil {
+		return LogEntry{}, false
+	}
+	timestamp, err := time.ParseInLocation("2006-01-02 15:04:05.000", header[1], time.Local)
+	if err != nil {
+		return LogEntry{}, false
+	}
+	entry := LogEntry{Timestamp: timestamp, Level: LogLevel(header[2]), Component: header[3]}
+
+	rest := line[len(header[0]):]
+	suffix := func(key string) string {
+		marker := " [" + key + "="
+		index := strings.LastIndex(rest, marker)
+		if index < 0 || !strings.HasSuffix(rest, "]") {
+			return ""
+		}
+		value := rest[index+len(marker) : len(rest)-1]
+		rest = rest[:index]
+		return value
+	}
+	if details := suffix("details"); details != "" {
+		json.Unmarshal([]byte(details), &entry.Details)
+	}
+	entry.Error = suffix("error")
+	entry.RequestID = suffix("request_id")
+	entry.UserID = suffix("user_id")
+	entry.TraceID = suffix("trace_id")
+	entry.Message = rest
+	return entry, true
+}
+
+// parseLogfmtLine - Reverse of formatLogfmt
+func parseLogfmtLine(line string) (LogEntry, bool) {
+	entry := LogEntry{}
+	rest := line
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		key, after, found := strings.Cut(rest, "=")
+		if !found {
+			break
+		}
+		var value string
+		if strings.HasPrefix(after, `"`) {
+			quoted, err := strconv.QuotedPrefix(after)
+			if err != nil {
+				return LogEntry{}, false
+			}
+			value, _ = strconv.Unquote(quoted)
+			rest = after[len(quoted):]
+		} else {
+			value, rest, _ = strings.Cut(after, " ")
+		}
+
+		switch key {
+		case "ts":
+			entry.Timestamp, _ = time.Parse(time.RFC3339Nano, value)
+		case "level":
+			entry.Level = LogLevel(value)
+		case "component":
+			entry.Component = value
+		case "msg":
+			entry.Message = value
+		case "error":
+			entry.Error = value
+		case "trace_id":
+			entry.TraceID = value
+		case "request_id":
+			entry.RequestID = value
+		case "user_id":
+			entry.UserID = value
+		case "ip":
+			entry.IPAddress = value
+		default:
+			if name, ok := strings.CutPrefix(key, "detail."); ok {
+				if entry.Details == nil {
+					entry.Details = make(map[string]interface{})
+				}
+				// Non-string details were written as JSON
+				var decoded interface{}
+				if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+					entry.Details[name] = decoded
+				} else {
+					entry.Details[name] = value
+				}
+			}
+		}
+	}
+	return entry, !entry.Timestamp.IsZero()
+}
+
+// Subscribe - Receive every entry written from now on until Unsubscribe;
+// entries are dropped (and counted) while the subscriber falls behind
+func (el *EnhancedLogger) Subscribe() *logSubscription {
+	subscription := &logSubscription{entries: make(chan LogEntry, logTailBuffer)}
+	el.subscriberMutex.Lock()
+	el.subscribers[subscription] = struct{}{}
+	el.subscriberMutex.Unlock()
+	return subscription
+}
+
+// Unsubscribe - Stop and close a subscription
+func (el *EnhancedLogger) Unsubscribe(subscription *logSubscription) {
+	el.subscriberMutex.Lock()
+	defer el.subscriberMutex.Unlock()
+	if _, ok := el.subscribers[subscription]; ok {
+		delete(el.subscribers, subscription)
+		close(subscription.entries)
+	}
+}
+
+// CloseSubscriptions - End every live tail, e.g. so shutdown is not held up by open streams
+func (el *EnhancedLogger) CloseSubscriptions() {
+	el.subscriberMutex.Lock()
+	defer el.subscriberMutex.Unlock()
+	for subscription := range el.subscribers {
+		delete(el.subscribers, subscription)
+		close(subscription.entries)
+	}
+}
+
+// publish - Hand entry to every subscriber without blocking the writer
+func (el *EnhancedLogger) publish(entry LogEntry) {
+	el.subscriberMutex.Lock()
+	defer el.subscriberMutex.Unlock()
+	for subscription := range el.subscribers {
+		select {
+		case subscription.entries <- entry:
+		default:
+			subscription.dropped.Add(1)
+		}
+	}
+}
+
+// ========================================
+// LOG QUERY HANDLERS
+// ========================================
+
+// getLogsHandler - GET /admin/logs: search log entries, or tail them over SSE with follow=true
+func getLogsHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	values := r.URL.Query()
+	query, err := parseLogQuery(values, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(values.Get("limit"))
+	if limit < 1 || limit > logQueryMaxLimit {
+		limit = logQueryDefaultLimit
+	}
+
+	appLogger.LogAudit("logs", "Queried logs", requestUserID(r), map[string]interface{}{
+		"query": values.Encode(),
+	})
+
+	if follow, _ := strconv.ParseBool(values.Get("follow")); follow {
+		streamLogs(w, r, query, limit)
+		return
+	}
+
+	source := values.Get("source")
+	switch source {
+	case "":
+		source = LogSourceAll
+	case LogSourceAll, LogSourceBuffer, LogSourceFiles:
+	default:
+		http.Error(w, "source must be all, buffer or files", http.StatusBadRequest)
+		return
+	}
+	cursor, err := decodeLogCursor(values.Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, next := appLogger.QueryLogs(query, source, cursor, limit)
+	response := map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	}
+	if next != "" {
+		response["next_cursor"] = next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// streamLogs - The latest limit matching entries from the ring, then new ones as "log" events
+func streamLogs(w http.ResponseWriter, r *http.Request, query *LogQuery, limit int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading the backlog so nothing written in between is lost
+	subscription := appLogger.Subscribe()
+	defer appLogger.Unsubscribe(subscription)
+	backlog, _ := appLogger.QueryLogs(query, LogSourceBuffer, logCursor{}, limit)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var lastSent time.Time
+	for i := len(backlog) - 1; i >= 0; i-- {
+		writeLogEvent(w, backlog[i])
+		lastSent = backlog[i].Timestamp
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(logTailKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case entry, open := <-subscription.entries:
+			if !open {
+				fmt.Fprint(w, "event: close\ndata: {\"reason\":\"server_shutdown\"}\n\n")
+				flusher.Flush()
+				return
+			}
+			if dropped := subscription.dropped.Swap(0); dropped > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", dropped)
+			}
+			if !entry.Timestamp.After(lastSent) || !query.Matches(entry) {
+				continue
+			}
+			writeLogEvent(w, entry)
+		}
+		flusher.Flush()
+	}
+}
+
+func writeLogEvent(w io.Writer, entry LogEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", entry.Timestamp.UnixNano(), data)
+}
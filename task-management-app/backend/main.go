@@ -22,12 +22,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -46,14 +47,17 @@ var (
 	collaborationEngine *CollaborationEngine
 	aiEngine          *AIEngine
 	aiHandler         *SimpleAIHandler
-	notificationSystem *NotificationSystem
+	notificationPipeline *NotificationPipeline
 	prioritizationEngine *SimplePrioritizationEngine
 	timeTrackingEngine *SimpleTimeTrackingEngine
 	analyticsEngine   *SimpleAnalyticsEngine
+	sprintTracker     *SprintTracker
 	upgrader          = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true // Allow all origins in development
 		},
+		// Echoed back instead of the "bearer.<JWT>" entry a browser offers
+		Subprotocols: []string{websocketProtocol},
 	}
 )
 
@@ -67,11 +71,13 @@ type Task struct {
 	AssigneeID  string     `json:"assignee_id"`
 	ProjectID   string     `json:"project_id"`
 	DueDate     *time.Time `json:"due_date,omitempty"`
+	StoryPoints *int       `json:"story_points,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	Type        string     `json:"type"`
 	Dependencies []string  `json:"dependencies,omitempty"`
 	Tags        []string   `json:"tags,omitempty"`
+	Version     int        `json:"version"`
 }
 
 // User represents a user in the system
@@ -80,9 +86,13 @@ type User struct {
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
 	Role      string    `json:"role"`
+	Locale    string    `json:"locale,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// defaultUserRole - Role of users created without one, as in the users table default
+const defaultUserRole = "user"
+
 // Project represents a project in the system
 type Project struct {
 	ID          string    `json:"id"`
@@ -93,6 +103,7 @@ type Project struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Type        string    `json:"type"`
+	Version     int       `json:"version"`
 }
 
 // Comment represents a comment on a task
@@ -159,6 +170,7 @@ type Hub struct {
 	unregister      chan *Client
 	userPresence    map[string]*UserPresence
 	pendingAcks     map[string]WSMessage
+	ping            chan chan struct{}
 	mutex           sync.RWMutex
 	presenceMutex   sync.RWMutex
 }
@@ -189,40 +201,98 @@ type CouchDBConfig struct {
 
 var couchConfig CouchDBConfig
 
+var notificationConfig NotificationPipelineConfig
+
+var inboundEmailConfig InboundEmailConfig
+
+var tracingConfig TracingConfig
+
+var healthCheckConfig HealthCheckConfig
+
 func main() {
 	// Initialize configuration
 	initConfig()
 
+	// Route all logging through the structured application logger
+	if err := initAppLogger(loggerConfig); err != nil {
+		componentLogger("app").Error(err, "Structured logging unavailable, using standard logger", nil)
+	}
+
+	// Initialize tracing before anything opens connections
+	if err := initTracing(tracingConfig); err != nil {
+		componentLogger("tracing").Error(err, "Tracing disabled", nil)
+	} else if tracingConfig.Exporter != "" && tracingConfig.Exporter != "none" {
+		componentLogger("tracing").Info("Tracing enabled", map[string]interface{}{"exporter": tracingConfig.Exporter})
+	}
+
 	// Initialize database connection
 	initDB()
 
 	// Initialize CouchDB connection
 	initCouchDB()
 
+	// Task and comment writes shared by REST, inbound email and chat commands
+	taskService = NewTaskService(db)
+	if err := taskService.EnsureSchema(); err != nil {
+		componentLogger("database").Error(err, "Failed to update the core schema", nil)
+	}
+
+	// Turn inbound email into tasks and comments
+	inboundMail = startInboundEmail(inboundEmailConfig, taskService)
+	if inboundMail != nil {
+		componentLogger("inbound_email").Info("Inbound email enabled", map[string]interface{}{"mode": inboundEmailConfig.Mode})
+	}
+
 	// Initialize AI Intelligence Engine
 	aiEngine = NewAIEngine()
 	aiHandler = NewSimpleAIHandler()
-	log.Println("🧠 AI Intelligence Engine initialized")
+	componentLogger("ai").Info("AI Intelligence Engine initialized", nil)
+
+	// Initialize Notification Pipeline with its durable outbox
+	notificationPipeline = NewNotificationPipeline(db, notificationConfig)
+	componentLogger("notifications").Info("Notification Pipeline initialized", map[string]interface{}{"channels": notificationPipeline.ConfiguredChannels()})
 
-	// Initialize Notification System
-	notificationSystem = NewNotificationSystem()
-	log.Println("📢 Notification System initialized")
+	// Initialize outgoing webhook subscriptions and their delivery workers
+	webhookDispatcher = NewWebhookDispatcher(db, 4)
+	if err := webhookDispatcher.EnsureSchema(); err != nil {
+		componentLogger("webhooks").Error(err, "Webhook subscriptions unavailable", nil)
+		webhookDispatcher = nil
+	} else {
+		webhookDispatcher.Start()
+		componentLogger("webhooks").Info("Webhook Dispatcher initialized", nil)
+	}
 
 	// Initialize Real-time Collaboration Engine
 	collaborationEngine = NewCollaborationEngine()
-	log.Println("🤝 Real-time Collaboration Engine initialized")
+	componentLogger("collaboration").Info("Collaboration Engine initialized", nil)
 
 	// Initialize Enhanced AI Prioritization Engine
 	prioritizationEngine = NewSimplePrioritizationEngine()
-	log.Println("🎯 Enhanced AI Prioritization Engine initialized")
+	componentLogger("ai").Info("Prioritization Engine initialized", nil)
 
 	// Initialize Time Tracking Engine
 	timeTrackingEngine = NewSimpleTimeTrackingEngine()
-	log.Println("⏱️ Time Tracking Engine initialized")
+	if shutdownConfig.TimerStateFile != "" {
+		if restored, err := timeTrackingEngine.RestoreActiveTimers(shutdownConfig.TimerStateFile); err != nil {
+			componentLogger("time_tracking").Error(err, "Failed to restore running timers", nil)
+		} else if restored > 0 {
+			componentLogger("time_tracking").Info("Resumed running timers", map[string]interface{}{"count": restored})
+		}
+	}
+	componentLogger("time_tracking").Info("Time Tracking Engine initialized", nil)
+
+	// Initialize Sprint Tracker
+	sprintTracker = NewSprintTracker(db)
+	if err := sprintTracker.EnsureSchema(); err != nil {
+		componentLogger("sprints").Error(err, "Failed to prepare sprint tables", nil)
+	} else {
+		go sprintTracker.StartSnapshotRecorder(time.Hour)
+	}
+	componentLogger("sprints").Info("Sprint Tracker initialized", nil)
 
 	// Initialize Project Analytics Engine
-	analyticsEngine = NewSimpleAnalyticsEngine()
-	log.Println("📊 Project Analytics Engine initialized")
+	analyticsEngine = NewSimpleAnalyticsEngine(db, sprintTracker)
+	componentLogger("analytics").Info("Project Analytics Engine initialized", nil)
 
 	// Initialize Enhanced WebSocket hub for real-time collaboration
 	hub = &Hub{
@@ -233,16 +303,57 @@ func main() {
 		unregister:   make(chan *Client, 256),
 		userPresence: make(map[string]*UserPresence),
 		pendingAcks:  make(map[string]WSMessage),
+		ping:         make(chan chan struct{}),
 	}
 	go hub.run()
-	log.Println("🔗 Enhanced WebSocket Hub initialized")
+	componentLogger("websocket").Info("WebSocket Hub initialized", nil)
 
 	// Initialize Comprehensive Health Check Service
-	initHealthCheckService(db, hub)
-	log.Println("🏥 Comprehensive Health Check Service initialized")
+	initHealthCheckService(db, hub, healthCheckConfig)
+
+	// Expose hub, timer and DB pool state to Prometheus
+	registerRuntimeMetrics(db, hub, timeTrackingEngine)
+
+	// Personal access tokens and project service accounts for automation
+	accessTokens = NewAccessTokenStore(db)
+	if err := accessTokens.EnsureSchema(); err != nil {
+		componentLogger("auth").Error(err, "Access tokens unavailable", nil)
+		accessTokens = nil
+	} else {
+		componentLogger("auth").Info("Access tokens initialized", nil)
+	}
+
+	// Links between chat identities and users for slash commands
+	chatAccounts = NewChatAccountStore(db)
+	if err := chatAccounts.EnsureSchema(); err != nil {
+		componentLogger("slash_commands").Error(err, "Chat account links unavailable", nil)
+		chatAccounts = nil
+	}
+
+	if authConfig.JWTSecret == "" {
+		componentLogger("auth").Warn("JWT_SECRET not set; session tokens cannot be verified", nil)
+	}
+
+	// Per-caller request budgets, shared through Postgres when configured
+	initRateLimiter(rateLimitConfig, db)
+
+	// Replay stored responses to retried mutations
+	initIdempotency(idempotencyConfig, db)
 
 	// Create router
 	r := mux.NewRouter()
+	r.Use(tracingMiddleware)
+	r.Use(requestLoggingMiddleware)
+	r.Use(metricsMiddleware)
+	r.Use(sessionAuthMiddleware)
+	r.Use(accessTokenMiddleware)
+	r.Use(rateLimitMiddleware)
+	r.Use(idempotencyMiddleware)
+	// Middleware only wraps matched routes; count misses under the "unmatched" route label
+	r.NotFoundHandler = metricsMiddleware(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = metricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}))
 
 	// API routes
 	api := r.PathPrefix("/api/v1").Subrouter()
@@ -252,18 +363,47 @@ func main() {
 	api.HandleFunc("/tasks", createTask).Methods("POST")
 	api.HandleFunc("/tasks/{id}", getTask).Methods("GET")
 	api.HandleFunc("/tasks/{id}", updateTask).Methods("PUT")
+	api.HandleFunc("/tasks/{id}", patchTask).Methods("PATCH")
 	api.HandleFunc("/tasks/{id}", deleteTask).Methods("DELETE")
 
 	// User routes
 	api.HandleFunc("/users", getUsers).Methods("GET")
 	api.HandleFunc("/users", createUser).Methods("POST")
 	api.HandleFunc("/users/{id}", getUser).Methods("GET")
+	api.HandleFunc("/users/{id}", updateUser).Methods("PUT")
+	api.HandleFunc("/users/{id}/notification-preferences", getNotificationPreferencesHandler).Methods("GET")
+	api.HandleFunc("/users/{id}/notification-preferences", updateNotificationPreferencesHandler).Methods("PUT")
+	api.HandleFunc("/users/{id}/notification-preferences/held", getHeldNotificationsHandler).Methods("GET")
+
+	// In-app notification inbox for the calling user
+	api.HandleFunc("/me/notifications", getMyNotificationsHandler).Methods("GET")
+	api.HandleFunc("/me/notifications/unread-count", getMyUnreadCountHandler).Methods("GET")
+	api.HandleFunc("/me/notifications/read-all", markAllMyNotificationsReadHandler).Methods("POST")
+	api.HandleFunc("/me/notifications/{id}/read", inboxStatusHandler(InboxRead)).Methods("POST")
+	api.HandleFunc("/me/notifications/{id}/unread", inboxStatusHandler(InboxUnread)).Methods("POST")
+	api.HandleFunc("/me/notifications/{id}/archive", inboxStatusHandler(InboxArchived)).Methods("POST")
+	api.HandleFunc("/me/inbound-address", getMyInboundAddressHandler).Methods("GET")
+
+	// Personal access token routes
+	api.HandleFunc("/me/tokens", listMyAccessTokensHandler).Methods("GET")
+	api.HandleFunc("/me/tokens", createMyAccessTokenHandler).Methods("POST")
+	api.HandleFunc("/me/tokens/{tokenID}", revokeMyAccessTokenHandler).Methods("DELETE")
+	api.HandleFunc("/me/chat-link-codes", createChatLinkCodeHandler).Methods("POST")
+	api.HandleFunc("/me/chat-accounts", listMyChatAccountsHandler).Methods("GET")
+	api.HandleFunc("/me/chat-accounts/{platform}/{teamID}/{chatUserID}", unlinkMyChatAccountHandler).Methods("DELETE")
 
 	// Project routes
 	api.HandleFunc("/projects", getProjects).Methods("GET")
 	api.HandleFunc("/projects", createProject).Methods("POST")
 	api.HandleFunc("/projects/{id}", getProject).Methods("GET")
 	api.HandleFunc("/projects/{id}", updateProject).Methods("PUT")
+	api.HandleFunc("/projects/{id}", patchProject).Methods("PATCH")
+	api.HandleFunc("/projects/{id}/service-accounts", listServiceAccountsHandler).Methods("GET")
+	api.HandleFunc("/projects/{id}/service-accounts", createServiceAccountHandler).Methods("POST")
+	api.HandleFunc("/projects/{id}/service-accounts/{accountID}", disableServiceAccountHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{id}/service-accounts/{accountID}/tokens", listServiceAccountTokensHandler).Methods("GET")
+	api.HandleFunc("/projects/{id}/service-accounts/{accountID}/tokens", createServiceAccountTokenHandler).Methods("POST")
+	api.HandleFunc("/projects/{id}/service-accounts/{accountID}/tokens/{tokenID}", revokeServiceAccountTokenHandler).Methods("DELETE")
 
 	// Comment routes
 	api.HandleFunc("/tasks/{id}/comments", getTaskComments).Methods("GET")
@@ -295,8 +435,56 @@ func main() {
 	api.HandleFunc("/analytics/reports", generateAnalyticsReportHandler).Methods("POST")
 	api.HandleFunc("/analytics/realtime/{projectID}", getRealtimeMetricsHandler).Methods("GET")
 
+	// Sprint routes
+	api.HandleFunc("/sprints", createSprintHandler).Methods("POST")
+	api.HandleFunc("/sprints/{id}", getSprintHandler).Methods("GET")
+	api.HandleFunc("/sprints/{id}/tasks", commitSprintTasksHandler).Methods("POST")
+	api.HandleFunc("/sprints/{id}/tasks/{taskID}", removeSprintTaskHandler).Methods("DELETE")
+	api.HandleFunc("/sprints/{id}/start", startSprintHandler).Methods("POST")
+	api.HandleFunc("/sprints/{id}/complete", completeSprintHandler).Methods("POST")
+	api.HandleFunc("/sprints/{id}/burndown", getSprintBurndownHandler).Methods("GET")
+	api.HandleFunc("/projects/{id}/sprints", getProjectSprintsHandler).Methods("GET")
+	api.HandleFunc("/projects/{id}/velocity", getProjectVelocityHandler).Methods("GET")
+
 	// Notification routes
 	api.HandleFunc("/notifications", sendNotification).Methods("POST")
+	api.HandleFunc("/notifications/dead-letters", listDeadLettersHandler).Methods("GET")
+	api.HandleFunc("/notifications/dead-letters/replay", replayDeadLettersHandler).Methods("POST")
+	api.HandleFunc("/notifications/rules", getNotificationRulesHandler).Methods("GET")
+	api.HandleFunc("/notifications/rules/reload", reloadNotificationRulesHandler).Methods("POST")
+	api.HandleFunc("/notifications/templates", listNotificationTemplatesHandler).Methods("GET")
+	api.HandleFunc("/notifications/templates/{name}/preview", previewNotificationTemplateHandler).Methods("POST")
+	api.HandleFunc("/notifications/{id}", getNotificationStatusHandler).Methods("GET")
+	api.HandleFunc("/notifications/{id}/replay", replayDeadLettersHandler).Methods("POST")
+	api.HandleFunc("/notifications/{id}/ack", acknowledgeNotificationHandler).Methods("POST")
+
+	// Webhook subscription routes
+	api.HandleFunc("/webhooks", listWebhookSubscriptionsHandler).Methods("GET")
+	api.HandleFunc("/webhooks", createWebhookSubscriptionHandler).Methods("POST")
+	api.HandleFunc("/webhooks/{id}", getWebhookSubscriptionHandler).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", updateWebhookSubscriptionHandler).Methods("PUT")
+	api.HandleFunc("/webhooks/{id}", deleteWebhookSubscriptionHandler).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/deliveries", listWebhookDeliveriesHandler).Methods("GET")
+	api.HandleFunc("/webhooks/{id}/deliveries/{deliveryID}/redeliver", redeliverWebhookHandler).Methods("POST")
+
+	// Chat slash commands
+	api.HandleFunc("/integrations/slack/commands", slackCommandHandler).Methods("POST")
+	api.HandleFunc("/integrations/mattermost/commands", mattermostCommandHandler).Methods("POST")
+
+	// Admin: configuration and logging
+	api.HandleFunc("/admin/config", getConfigHandler).Methods("GET")
+	api.HandleFunc("/admin/logging/levels", getLogLevelsHandler).Methods("GET")
+	api.HandleFunc("/admin/logging/levels", updateLogLevelsHandler).Methods("PUT")
+	api.HandleFunc("/admin/logs", getLogsHandler).Methods("GET")
+
+	// Admin: security scans and downloadable reports
+	api.HandleFunc("/admin/security/scans", importSecurityScanHandler).Methods("POST")
+	api.HandleFunc("/admin/security/scans", listSecurityScansHandler).Methods("GET")
+	api.HandleFunc("/admin/security/scans/{id}/compare", compareSecurityScansHandler).Methods("GET")
+	api.HandleFunc("/admin/security/scans/{id}", deleteSecurityScanHandler).Methods("DELETE")
+	api.HandleFunc("/admin/reports", listReportsHandler).Methods("GET")
+	api.HandleFunc("/admin/reports/{id}", downloadReportHandler).Methods("GET")
+	api.HandleFunc("/admin/reports/{id}", deleteReportHandler).Methods("DELETE")
 
 	// Dashboard
 	api.HandleFunc("/dashboard/stats", getDashboardStats).Methods("GET")
@@ -312,94 +500,140 @@ func main() {
 
 	// CORS middleware
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:5173"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedOrigins:   appConfig.Server.CORSOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"ETag"},
 		AllowCredentials: true,
 	})
 
 	handler := c.Handler(r)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	port := appConfig.Server.Port
 
-	log.Printf("🚀 AI-Powered Task Management API starting on port %s", port)
-	log.Printf("📊 Dashboard available at http://localhost:%s/api/v1/dashboard/stats", port)
-	log.Printf("🔗 WebSocket: ws://localhost:%s/api/v1/ws", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+	componentLogger("app").Info("Task Management API starting", map[string]interface{}{
+		"port":      port,
+		"dashboard": "/api/v1/dashboard/stats",
+		"websocket": "/api/v1/ws",
+	})
+	serve(&http.Server{Addr: ":" + port, Handler: handler})
 }
 
 func initConfig() {
-	// Initialize CouchDB config
-	couchConfig = CouchDBConfig{
-		Host:     getEnv("COUCHDB_HOST", "localhost"),
-		Port:     getEnv("COUCHDB_PORT", "5984"),
-		Username: getEnv("COUCHDB_USER", "admin"),
-		Password: getEnv("COUCHDB_PASS", "password"),
-		Database: getEnv("COUCHDB_DB", "taskmanagement"),
+	config, err := LoadConfig(os.Args[1:])
+	if isHelpRequest(err) {
+		os.Exit(0)
+	}
+	if err != nil {
+		componentLogger("config").Error(err, "Invalid configuration", nil)
+		os.Exit(1)
 	}
+	appConfig = config
+
+	authConfig = config.Auth
+	trustedProxies, _ = parseTrustedProxies(config.Server.TrustedProxies)
+	couchConfig = config.CouchDB
+	notificationConfig = config.Notifications
+	loggerConfig = config.Logging
+	tracingConfig = config.Tracing
+	shutdownConfig = config.Shutdown
+	healthCheckConfig = config.Health
+	inboundEmailConfig = config.InboundEmail
+	slashCommandConfig = config.SlashCommands
+	rateLimitConfig = config.RateLimit
+	idempotencyConfig = config.Idempotency
 }
 
 func initCouchDB() {
-	log.Println("✅ CouchDB configuration initialized")
+	componentLogger("couchdb").Info("CouchDB configuration initialized", nil)
 }
 
 func initDB() {
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		// Use environment variables for container compatibility
-		dbHost := os.Getenv("DB_HOST")
-		if dbHost == "" {
-			dbHost = "localhost"
-		}
-		dbPort := os.Getenv("DB_PORT")
-		if dbPort == "" {
-			dbPort = "5432"
-		}
-		dbUser := os.Getenv("DB_USER")
-		if dbUser == "" {
-			dbUser = "taskuser"
-		}
-		dbPassword := os.Getenv("DB_PASSWORD")
-		if dbPassword == "" {
-			dbPassword = "taskpass"
-		}
-		dbName := os.Getenv("DB_NAME")
-		if dbName == "" {
-			dbName = "taskmanagement"
-		}
-		databaseURL = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", dbUser, dbPassword, dbHost, dbPort, dbName)
-	}
+	databaseURL := appConfig.Database.DSN()
 
 	var err error
-	db, err = sql.Open("postgres", databaseURL)
+	db, err = openTracedDB("postgres", databaseURL)
 	if err != nil {
-		log.Printf("⚠️  Warning: Failed to connect to database: %v", err)
-		log.Println("📝 Database functionality will be limited. Some endpoints may not work.")
+		componentLogger("database").Error(err, "Failed to connect to database; database endpoints will be unavailable", nil)
 		return
 	}
 
 	if err = db.Ping(); err != nil {
-		log.Printf("⚠️  Warning: Failed to ping database: %v", err)
-		log.Println("📝 Database functionality will be limited. Some endpoints may not work.")
+		componentLogger("database").Error(err, "Failed to ping database; database endpoints will be unavailable", nil)
 		return
 	}
 
-	log.Println("✅ Connected to PostgreSQL database")
+	componentLogger("database").Info("Connected to PostgreSQL database", nil)
+}
+
+// requestUserID identifies the caller from a verified session or access token; "" when anonymous
+func requestUserID(r *http.Request) string {
+	if principal := requestPrincipal(r); principal != nil {
+		return principal.UserID
+	}
+	return ""
+}
+
+// requireAdmin writes 401/403 unless the caller is a user with the admin role
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	userID := requestUserID(r)
+	if userID == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+	}
+	if db == nil {
+		http.Error(w, "Database not available", http.StatusServiceUnavailable)
+		return false
+	}
+
+	var role string
+	err := db.QueryRowContext(r.Context(), "SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	if err == sql.ErrNoRows || (err == nil && role != "admin") {
+		http.Error(w, "Admin role required", http.StatusForbidden)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// requireSelfOrAdmin writes 401/403 unless the caller is userID or an admin
+func requireSelfOrAdmin(w http.ResponseWriter, r *http.Request, userID string) bool {
+	callerID := requestUserID(r)
+	if callerID == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+	}
+	if callerID == userID {
+		return true
+	}
+	return requireAdmin(w, r)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// parseHeaderList parses "Name: value, Other: value" into a header map
+func parseHeaderList(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		name, val, found := strings.Cut(pair, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(val)
 	}
-	return defaultValue
+	return headers
 }
 
 // Task handlers
 func getTasks(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, title, description, status, priority, assignee_id, created_at, updated_at FROM tasks ORDER BY created_at DESC")
+	query := "SELECT id, title, description, status, priority, assignee_id, story_points, created_at, updated_at, version FROM tasks ORDER BY created_at DESC"
+	var args []interface{}
+	if principal := tokenPrincipal(r); principal != nil && principal.ProjectID != "" {
+		query = "SELECT id, title, description, status, priority, assignee_id, story_points, created_at, updated_at, version FROM tasks WHERE project_id = $1 ORDER BY created_at DESC"
+		args = append(args, principal.ProjectID)
+	}
+	rows, err := db.QueryContext(r.Context(), query, args...)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -409,7 +643,7 @@ func getTasks(w http.ResponseWriter, r *http.Request) {
 	var tasks []Task
 	for rows.Next() {
 		var task Task
-		err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.CreatedAt, &task.UpdatedAt)
+		err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.StoryPoints, &task.CreatedAt, &task.UpdatedAt, &task.Version)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -427,60 +661,27 @@ func createTask(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Validate required fields
-	if task.Title == "" || task.Status == "" || task.Priority == "" {
-		http.Error(w, "Title, status, and priority are required", http.StatusBadRequest)
+	if !scopeTaskProject(r, &task) {
+		http.Error(w, "Access token cannot reach this project", http.StatusForbidden)
 		return
 	}
 
-	task.ID = uuid.New().String()
-	task.CreatedAt = time.Now()
-	task.UpdatedAt = time.Now()
-
-	_, err := db.Exec(
-		"INSERT INTO tasks (id, title, description, status, priority, assignee_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
-		task.ID, task.Title, task.Description, task.Status, task.Priority, task.AssigneeID, task.CreatedAt, task.UpdatedAt,
-	)
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := taskService.CreateTask(r.Context(), &task, requestUserID(r)); err != nil {
+		http.Error(w, err.Error(), taskServiceStatus(err))
 		return
 	}
 
-	// Send WebSocket notification for task creation
-	wsMessage := WSMessage{
-		ID:        generateID(),
-		Type:      WSMsgTaskCreated,
-		Data:      task,
-		UserID:    "system", // Could be extracted from auth context
-		Username:  "System",
-		Room:      "general", // Could be project-specific
-		Timestamp: time.Now().Unix(),
-	}
-	
-	select {
-	case hub.broadcast <- wsMessage:
-	default:
-		// Channel full, notification not sent
-		log.Printf("WebSocket channel full, task creation notification not sent")
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(task)
+	writeVersioned(w, http.StatusCreated, task.Version, task)
 }
 
 func getTask(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if !requireTokenTaskAccess(w, r, id) {
+		return
+	}
 
-	var task Task
-	err := db.QueryRow(
-		"SELECT id, title, description, status, priority, assignee_id, created_at, updated_at FROM tasks WHERE id = $1",
-		id,
-	).Scan(&task.ID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.CreatedAt, &task.UpdatedAt)
-
+	task, err := taskService.GetTask(r.Context(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Task not found", http.StatusNotFound)
@@ -489,81 +690,130 @@ func getTask(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if notModified(w, r, task.Version) {
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+	writeVersioned(w, http.StatusOK, task.Version, task)
 }
 
+// updateTask - Replace a task; If-Match must name its current ETag
 func updateTask(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if !requireTaskEditor(w, r, id) {
+		return
+	}
+
+	current, err := taskService.GetTask(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Task not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if !checkIfMatch(w, r, current.Version, current, true) {
+		return
+	}
 
 	var task Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	task.Version = current.Version
+	if !tokenAllowsProject(r, task.ProjectID) {
+		http.Error(w, "Access token cannot reach this project", http.StatusForbidden)
+		return
+	}
 
-	task.UpdatedAt = time.Now()
+	if err := taskService.UpdateTask(r.Context(), id, &task, requestUserID(r)); err != nil {
+		writeTaskUpdateError(w, r, id, err)
+		return
+	}
 
-	_, err := db.Exec(
-		"UPDATE tasks SET title = $1, description = $2, status = $3, priority = $4, assignee_id = $5, updated_at = $6 WHERE id = $7",
-		task.Title, task.Description, task.Status, task.Priority, task.AssigneeID, task.UpdatedAt, id,
-	)
+	writeVersioned(w, http.StatusOK, task.Version, task)
+}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// patchTask - Apply a JSON Merge Patch to the latest version of a task
+func patchTask(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if !requireTaskEditor(w, r, id) {
+		return
+	}
+	patch, ok := readMergePatch(w, r, taskServerMembers)
+	if !ok {
 		return
 	}
 
-	task.ID = id
+	for attempt := 0; attempt < mergePatchAttempts; attempt++ {
+		current, err := taskService.GetTask(r.Context(), id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Task not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		if !checkIfMatch(w, r, current.Version, current, false) {
+			return
+		}
 
-	// Send WebSocket notification for task update
-	wsMessage := WSMessage{
-		ID:        generateID(),
-		Type:      WSMsgTaskUpdated,
-		Data:      task,
-		UserID:    "system", // Could be extracted from auth context
-		Username:  "System",
-		Room:      "general", // Could be project-specific
-		Timestamp: time.Now().Unix(),
-	}
-	
-	select {
-	case hub.broadcast <- wsMessage:
-	default:
-		log.Printf("WebSocket channel full, task update notification not sent")
+		var task Task
+		if err := applyMergePatch(current, patch, &task); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		task.Version = current.Version
+		if !tokenAllowsProject(r, task.ProjectID) {
+			http.Error(w, "Access token cannot reach this project", http.StatusForbidden)
+			return
+		}
+
+		err = taskService.UpdateTask(r.Context(), id, &task, requestUserID(r))
+		if err == errVersionConflict {
+			// Reapply to the newer version, or fail If-Match against it
+			continue
+		}
+		if err != nil {
+			writeTaskUpdateError(w, r, id, err)
+			return
+		}
+		writeVersioned(w, http.StatusOK, task.Version, task)
+		return
 	}
+	http.Error(w, "Task is changing too quickly; retry", http.StatusConflict)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+// writeTaskUpdateError - 412 with the current task when a concurrent write won
+func writeTaskUpdateError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	if err == errVersionConflict {
+		if current, loadErr := taskService.GetTask(r.Context(), id); loadErr == nil {
+			writeVersioned(w, http.StatusPreconditionFailed, current.Version, current)
+			return
+		}
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), taskServiceStatus(err))
 }
 
 func deleteTask(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-
-	_, err := db.Exec("DELETE FROM tasks WHERE id = $1", id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !requireTokenTaskAccess(w, r, id) {
 		return
 	}
 
-	// Send WebSocket notification for task deletion
-	wsMessage := WSMessage{
-		ID:        generateID(),
-		Type:      WSMsgTaskDeleted,
-		Data:      map[string]string{"id": id},
-		UserID:    "system", // Could be extracted from auth context
-		Username:  "System",
-		Room:      "general", // Could be project-specific
-		Timestamp: time.Now().Unix(),
-	}
-	
-	select {
-	case hub.broadcast <- wsMessage:
-	default:
-		log.Printf("WebSocket channel full, task deletion notification not sent")
+	if err := taskService.DeleteTask(r.Context(), id, requestUserID(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -571,7 +821,7 @@ func deleteTask(w http.ResponseWriter, r *http.Request) {
 
 // User handlers
 func getUsers(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, username, email, role, created_at FROM users ORDER BY username")
+	rows, err := db.QueryContext(r.Context(), "SELECT id, username, email, role, COALESCE(locale, ''), created_at FROM users ORDER BY username")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -581,7 +831,7 @@ func getUsers(w http.ResponseWriter, r *http.Request) {
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt)
+		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Locale, &user.CreatedAt)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -599,13 +849,20 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	// Only admins hand out roles; everyone else signs up as a plain user
+	if user.Role == "" {
+		user.Role = defaultUserRole
+	}
+	if user.Role != defaultUserRole && !requireAdmin(w, r) {
+		return
+	}
 
 	user.ID = uuid.New().String()
 	user.CreatedAt = time.Now()
 
-	_, err := db.Exec(
-		"INSERT INTO users (id, username, email, role, created_at) VALUES ($1, $2, $3, $4, $5)",
-		user.ID, user.Username, user.Email, user.Role, user.CreatedAt,
+	_, err := db.ExecContext(r.Context(),
+		"INSERT INTO users (id, username, email, role, locale, created_at) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)",
+		user.ID, user.Username, user.Email, user.Role, user.Locale, user.CreatedAt,
 	)
 
 	if err != nil {
@@ -623,10 +880,70 @@ func getUser(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 
 	var user User
-	err := db.QueryRow(
-		"SELECT id, username, email, role, created_at FROM users WHERE id = $1",
+	err := db.QueryRowContext(r.Context(),
+		"SELECT id, username, email, role, COALESCE(locale, ''), created_at FROM users WHERE id = $1",
 		id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Locale, &user.CreatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// updateUser - Users edit their own username and locale; email and role, which
+// inbound mail, notifications and requireAdmin trust, only change through an admin
+func updateUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if !requireSelfOrAdmin(w, r, id) {
+		return
+	}
+
+	var user User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var current User
+	err := db.QueryRowContext(r.Context(), "SELECT username, email, role FROM users WHERE id = $1", id).
+		Scan(&current.Username, &current.Email, &current.Role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Omitted fields keep their value
+	if user.Username == "" {
+		user.Username = current.Username
+	}
+	if user.Email == "" {
+		user.Email = current.Email
+	}
+	if user.Role == "" {
+		user.Role = current.Role
+	}
+	// A user editing themselves got past requireSelfOrAdmin without being an admin
+	if (user.Email != current.Email || user.Role != current.Role) && requestUserID(r) == id && current.Role != "admin" {
+		http.Error(w, "Only an admin can change email or role", http.StatusForbidden)
+		return
+	}
+
+	err = db.QueryRowContext(r.Context(),
+		"UPDATE users SET username = $1, email = $2, role = $3, locale = NULLIF($4, ''), updated_at = $5 WHERE id = $6 RETURNING created_at",
+		user.Username, user.Email, user.Role, user.Locale, time.Now(), id,
+	).Scan(&user.CreatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -637,13 +954,14 @@ func getUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.ID = id
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
 // Project handlers
 func getProjects(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, name, description, status, owner_id, created_at, updated_at FROM projects ORDER BY created_at DESC")
+	rows, err := db.QueryContext(r.Context(), "SELECT id, name, description, status, owner_id, created_at, updated_at, version FROM projects ORDER BY created_at DESC")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -653,7 +971,7 @@ func getProjects(w http.ResponseWriter, r *http.Request) {
 	var projects []Project
 	for rows.Next() {
 		var project Project
-		err := rows.Scan(&project.ID, &project.Name, &project.Description, &project.Status, &project.OwnerID, &project.CreatedAt, &project.UpdatedAt)
+		err := rows.Scan(&project.ID, &project.Name, &project.Description, &project.Status, &project.OwnerID, &project.CreatedAt, &project.UpdatedAt, &project.Version)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -666,6 +984,17 @@ func getProjects(w http.ResponseWriter, r *http.Request) {
 }
 
 func createProject(w http.ResponseWriter, r *http.Request) {
+	// The creator owns the project, whatever owner_id the body names
+	userID := requestUserID(r)
+	if userID == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if !tokenAllowsProject(r, "") {
+		http.Error(w, "Service accounts cannot create projects", http.StatusForbidden)
+		return
+	}
+
 	var project Project
 	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -673,10 +1002,12 @@ func createProject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	project.ID = uuid.New().String()
+	project.OwnerID = userID
 	project.CreatedAt = time.Now()
 	project.UpdatedAt = time.Now()
+	project.Version = 1
 
-	_, err := db.Exec(
+	_, err := db.ExecContext(r.Context(),
 		"INSERT INTO projects (id, name, description, status, owner_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
 		project.ID, project.Name, project.Description, project.Status, project.OwnerID, project.CreatedAt, project.UpdatedAt,
 	)
@@ -686,21 +1017,49 @@ func createProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(project)
+	writeVersioned(w, http.StatusCreated, project.Version, project)
+}
+
+// loadProject - Load a project; sql.ErrNoRows when it does not exist
+func loadProject(ctx context.Context, id string) (*Project, error) {
+	var project Project
+	err := db.QueryRowContext(ctx,
+		"SELECT id, name, description, status, owner_id, created_at, updated_at, version FROM projects WHERE id = $1",
+		id,
+	).Scan(&project.ID, &project.Name, &project.Description, &project.Status, &project.OwnerID, &project.CreatedAt, &project.UpdatedAt, &project.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// saveProject - Write a project's editable fields if it is still at project.Version, then
+// bump the version; sql.ErrNoRows when it does not exist, errVersionConflict when it moved on
+func saveProject(ctx context.Context, id string, project *Project) error {
+	project.ID = id
+	project.UpdatedAt = time.Now()
+
+	err := db.QueryRowContext(ctx,
+		"UPDATE projects SET name = $1, description = $2, status = $3, owner_id = $4, updated_at = $5, version = version + 1 WHERE id = $6 AND version = $7 RETURNING created_at, version",
+		project.Name, project.Description, project.Status, project.OwnerID, project.UpdatedAt, id, project.Version,
+	).Scan(&project.CreatedAt, &project.Version)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM projects WHERE id = $1)", id).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return errVersionConflict
+		}
+	}
+	return err
 }
 
 func getProject(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var project Project
-	err := db.QueryRow(
-		"SELECT id, name, description, status, owner_id, created_at, updated_at FROM projects WHERE id = $1",
-		id,
-	).Scan(&project.ID, &project.Name, &project.Description, &project.Status, &project.OwnerID, &project.CreatedAt, &project.UpdatedAt)
-
+	project, err := loadProject(r.Context(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Project not found", http.StatusNotFound)
@@ -709,44 +1068,147 @@ func getProject(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if notModified(w, r, project.Version) {
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(project)
+	writeVersioned(w, http.StatusOK, project.Version, project)
 }
 
+// updateProject - Replace a project; If-Match must name its current ETag. Only the owner
+// or an admin may edit it, and an omitted owner_id keeps the current owner
 func updateProject(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if !requireProjectEditor(w, r, id) {
+		return
+	}
+
+	current, err := loadProject(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if !checkIfMatch(w, r, current.Version, current, true) {
+		return
+	}
 
 	var project Project
 	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	project.Version = current.Version
+	if !checkProjectOwner(w, r, current, &project) {
+		return
+	}
 
-	project.UpdatedAt = time.Now()
+	if err := saveProject(r.Context(), id, &project); err != nil {
+		writeProjectUpdateError(w, r, id, err)
+		return
+	}
 
-	_, err := db.Exec(
-		"UPDATE projects SET name = $1, description = $2, status = $3, owner_id = $4, updated_at = $5 WHERE id = $6",
-		project.Name, project.Description, project.Status, project.OwnerID, project.UpdatedAt, id,
-	)
+	writeVersioned(w, http.StatusOK, project.Version, project)
+}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// patchProject - Apply a JSON Merge Patch to the latest version of a project
+func patchProject(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if !requireProjectEditor(w, r, id) {
+		return
+	}
+	patch, ok := readMergePatch(w, r, projectServerMembers)
+	if !ok {
 		return
 	}
 
-	project.ID = id
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(project)
+	for attempt := 0; attempt < mergePatchAttempts; attempt++ {
+		current, err := loadProject(r.Context(), id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Project not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		if !checkIfMatch(w, r, current.Version, current, false) {
+			return
+		}
+
+		var project Project
+		if err := applyMergePatch(current, patch, &project); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		project.Version = current.Version
+		if !checkProjectOwner(w, r, current, &project) {
+			return
+		}
+
+		err = saveProject(r.Context(), id, &project)
+		if err == errVersionConflict {
+			// Reapply to the newer version, or fail If-Match against it
+			continue
+		}
+		if err != nil {
+			writeProjectUpdateError(w, r, id, err)
+			return
+		}
+		writeVersioned(w, http.StatusOK, project.Version, project)
+		return
+	}
+	http.Error(w, "Project is changing too quickly; retry", http.StatusConflict)
+}
+
+// checkProjectOwner - Keep the current owner when none is given; a new owner must be a known user
+func checkProjectOwner(w http.ResponseWriter, r *http.Request, current, project *Project) bool {
+	if project.OwnerID == "" {
+		project.OwnerID = current.OwnerID
+	}
+	if project.OwnerID == current.OwnerID {
+		return true
+	}
+	if _, err := taskService.FindUserByID(r.Context(), project.OwnerID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "New project owner not found", http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return false
+	}
+	return true
+}
+
+// writeProjectUpdateError - 412 with the current project when a concurrent write won
+func writeProjectUpdateError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	if err == errVersionConflict {
+		if current, loadErr := loadProject(r.Context(), id); loadErr == nil {
+			writeVersioned(w, http.StatusPreconditionFailed, current.Version, current)
+			return
+		}
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
 }
 
 // Comment handlers
 func getTaskComments(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	taskID := vars["id"]
+	if !requireTokenTaskAccess(w, r, taskID) {
+		return
+	}
 
-	rows, err := db.Query("SELECT id, task_id, user_id, content, created_at FROM comments WHERE task_id = $1 ORDER BY created_at DESC", taskID)
+	rows, err := db.QueryContext(r.Context(), "SELECT id, task_id, user_id, content, created_at FROM comments WHERE task_id = $1 ORDER BY created_at DESC", taskID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -771,6 +1233,9 @@ func getTaskComments(w http.ResponseWriter, r *http.Request) {
 func createComment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	taskID := vars["id"]
+	if !requireTokenTaskAccess(w, r, taskID) {
+		return
+	}
 
 	var comment Comment
 	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
@@ -778,17 +1243,9 @@ func createComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comment.ID = uuid.New().String()
 	comment.TaskID = taskID
-	comment.CreatedAt = time.Now()
-
-	_, err := db.Exec(
-		"INSERT INTO comments (id, task_id, user_id, content, created_at) VALUES ($1, $2, $3, $4, $5)",
-		comment.ID, comment.TaskID, comment.UserID, comment.Content, comment.CreatedAt,
-	)
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := taskService.AddComment(r.Context(), &comment); err != nil {
+		http.Error(w, err.Error(), taskServiceStatus(err))
 		return
 	}
 
@@ -802,26 +1259,26 @@ func getDashboardStats(w http.ResponseWriter, r *http.Request) {
 	var totalTasks, completedTasks, activeUsers, totalProjects int
 
 	// Get task counts
-	err := db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&totalTasks)
+	err := db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM tasks").Scan(&totalTasks)
 	if err != nil {
-		log.Printf("Error getting total tasks: %v", err)
+		requestLogger(r).Error(err, "Error getting total tasks", nil)
 	}
 
-	err = db.QueryRow("SELECT COUNT(*) FROM tasks WHERE status = 'completed'").Scan(&completedTasks)
+	err = db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM tasks WHERE status = 'completed'").Scan(&completedTasks)
 	if err != nil {
-		log.Printf("Error getting completed tasks: %v", err)
+		requestLogger(r).Error(err, "Error getting completed tasks", nil)
 	}
 
 	// Get user count
-	err = db.QueryRow("SELECT COUNT(*) FROM users").Scan(&activeUsers)
+	err = db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM users").Scan(&activeUsers)
 	if err != nil {
-		log.Printf("Error getting active users: %v", err)
+		requestLogger(r).Error(err, "Error getting active users", nil)
 	}
 
 	// Get project count
-	err = db.QueryRow("SELECT COUNT(*) FROM projects").Scan(&totalProjects)
+	err = db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM projects").Scan(&totalProjects)
 	if err != nil {
-		log.Printf("Error getting total projects: %v", err)
+		requestLogger(r).Error(err, "Error getting total projects", nil)
 	}
 
 	stats := map[string]interface{}{
@@ -837,21 +1294,26 @@ func getDashboardStats(w http.ResponseWriter, r *http.Request) {
 
 // Enhanced WebSocket handler with authentication and structured messaging
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// The user comes from the verified principal, never from the query string
+	var userID, username string
+	if principal := requestPrincipal(r); principal != nil {
+		userID, username = principal.UserID, principal.UserID
+		if taskService != nil {
+			if user, err := taskService.FindUserByID(r.Context(), userID); err == nil {
+				username = user.Username
+			}
+		}
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		requestLogger(r).With("websocket").Error(err, "WebSocket upgrade failed", nil)
 		return
 	}
 
-	// Extract user info from query parameters or headers
-	userID := r.URL.Query().Get("user_id")
-	username := r.URL.Query().Get("username")
-	
-	// Use defaults if not provided
-	if userID == "" {
+	authenticated := userID != ""
+	if !authenticated {
 		userID = "anonymous_" + generateID()
-	}
-	if username == "" {
 		username = "Anonymous User"
 	}
 
@@ -870,8 +1332,11 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Register client
 	hub.register <- client
 
-	// Join general room by default
+	// Join general room by default, plus the user's own room for inbox pushes
 	hub.addToRoom(client, "general")
+	if authenticated {
+		hub.addToRoom(client, "user:"+userID)
+	}
 
 	// Start goroutines for reading and writing
 	go client.writePump()
@@ -897,7 +1362,7 @@ func (c *Client) readPump() {
 		_, messageBytes, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				componentLogger("websocket").Warn("WebSocket closed unexpectedly", map[string]interface{}{"user_id": c.userID, "error": err.Error()})
 			}
 			break
 		}
@@ -905,7 +1370,7 @@ func (c *Client) readPump() {
 		// Parse incoming message
 		var incomingMsg WSMessage
 		if err := json.Unmarshal(messageBytes, &incomingMsg); err != nil {
-			log.Printf("Error parsing WebSocket message: %v", err)
+			componentLogger("websocket").Warn("Invalid WebSocket message", map[string]interface{}{"user_id": c.userID, "error": err.Error()})
 			// Send error response
 			errorMsg := WSMessage{
 				ID:        generateID(),
@@ -951,12 +1416,12 @@ func (c *Client) writePump() {
 
 			messageBytes, err := json.Marshal(message)
 			if err != nil {
-				log.Printf("Error marshaling message: %v", err)
+				componentLogger("websocket").Error(err, "Failed to encode WebSocket message", map[string]interface{}{"type": message.Type})
 				continue
 			}
 
 			if err := c.conn.WriteMessage(websocket.TextMessage, messageBytes); err != nil {
-				log.Printf("WebSocket write error: %v", err)
+				componentLogger("websocket").Warn("WebSocket write failed", map[string]interface{}{"user_id": c.userID, "error": err.Error()})
 				return
 			}
 
@@ -1017,6 +1482,10 @@ func (c *Client) handleCursorPosition(message WSMessage) {
 func (c *Client) handleRoomJoin(message WSMessage) {
 	if roomData, ok := message.Data.(map[string]interface{}); ok {
 		if roomID, exists := roomData["room_id"].(string); exists {
+			// Personal rooms are joined on connect, and only by a verified owner
+			if strings.HasPrefix(roomID, "user:") {
+				return
+			}
 			c.hub.addToRoom(c, roomID)
 			
 			// Send confirmation
@@ -1103,7 +1572,7 @@ func (h *Hub) run() {
 			}
 			h.presenceMutex.Unlock()
 			
-			log.Printf("Client connected: %s (%s). Total clients: %d", client.username, client.userID, len(h.clients))
+			componentLogger("websocket").Info("Client connected", map[string]interface{}{"user_id": client.userID, "username": client.username, "clients": len(h.clients)})
 			
 			// Notify others of user joining
 			h.broadcastToRoom("general", WSMessage{
@@ -1136,7 +1605,7 @@ func (h *Hub) run() {
 			}
 			h.presenceMutex.Unlock()
 			
-			log.Printf("Client disconnected: %s (%s). Total clients: %d", client.username, client.userID, len(h.clients))
+			componentLogger("websocket").Info("Client disconnected", map[string]interface{}{"user_id": client.userID, "username": client.username, "clients": len(h.clients)})
 			
 			// Notify others of user leaving
 			h.broadcastToRoom("general", WSMessage{
@@ -1155,6 +1624,9 @@ func (h *Hub) run() {
 				h.broadcastToAll(message)
 			}
 
+		case reply := <-h.ping:
+			close(reply)
+
 		case <-ticker.C:
 			// Send heartbeat to all connected clients
 			heartbeat := WSMessage{
@@ -1168,6 +1640,57 @@ func (h *Hub) run() {
 	}
 }
 
+// Ping - Wait for the run loop to answer; fails if it is stuck or not running
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CloseAll - Send every client a "service restart" close frame with a reconnect hint,
+// wait for them to disconnect and drop whoever is left when ctx ends
+func (h *Hub) CloseAll(ctx context.Context, reconnectAfter time.Duration) int {
+	reason := fmt.Sprintf(`{"reason":"server_restart","reconnect_after_ms":%d}`, reconnectAfter.Milliseconds())
+	frame := websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason)
+
+	h.mutex.RLock()
+	conns := make([]*websocket.Conn, 0, len(h.clients))
+	for conn := range h.clients {
+		conns = append(conns, conn)
+	}
+	h.mutex.RUnlock()
+
+	for _, conn := range conns {
+		conn.WriteControl(websocket.CloseMessage, frame, time.Now().Add(time.Second))
+	}
+
+	// Clients answer the close frame; their read pumps then unregister them
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if clients, _ := h.Counts(); clients == 0 {
+			return len(conns)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return len(conns)
+		}
+	}
+}
+
 // Broadcast message to all clients
 func (h *Hub) broadcastToAll(message WSMessage) {
 	h.mutex.RLock()
@@ -1177,6 +1700,7 @@ func (h *Hub) broadcastToAll(message WSMessage) {
 		select {
 		case client.send <- message:
 		default:
+			recordWSDrop(WSDropSlowClient)
 			close(client.send)
 			delete(h.clients, conn)
 		}
@@ -1193,6 +1717,7 @@ func (h *Hub) broadcastToRoom(roomID string, message WSMessage) {
 			select {
 			case client.send <- message:
 			default:
+				recordWSDrop(WSDropSlowClient)
 				close(client.send)
 				delete(h.clients, client.conn)
 				delete(room, client)
@@ -1201,6 +1726,13 @@ func (h *Hub) broadcastToRoom(roomID string, message WSMessage) {
 	}
 }
 
+// Counts - Connected clients and non-empty rooms
+func (h *Hub) Counts() (int, int) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients), len(h.rooms)
+}
+
 // Add client to room
 func (h *Hub) addToRoom(client *Client, roomID string) {
 	h.mutex.Lock()
@@ -1215,7 +1747,7 @@ func (h *Hub) addToRoom(client *Client, roomID string) {
 	client.rooms[roomID] = true
 	client.mutex.Unlock()
 	
-	log.Printf("Client %s joined room %s", client.username, roomID)
+	componentLogger("websocket").Debug("Client joined room", map[string]interface{}{"user_id": client.userID, "room": roomID})
 }
 
 // Remove client from room
@@ -1231,80 +1763,7 @@ func (h *Hub) removeFromRoom(client *Client, roomID string) {
 	delete(client.rooms, roomID)
 	client.mutex.Unlock()
 	
-	log.Printf("Client %s left room %s", client.username, roomID)
-}
-
-// Notification system
-type NotificationSystem struct {
-	slackWebhookURL string
-	emailServer     string
-	mutex           sync.RWMutex
-}
-
-// Notification represents a notification
-type Notification struct {
-	ID        string    `json:"id"`
-	Type      string    `json:"type"`
-	Title     string    `json:"title"`
-	Message   string    `json:"message"`
-	Priority  string    `json:"priority"`
-	Recipient string    `json:"recipient"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// NewNotificationSystem creates a new notification system
-func NewNotificationSystem() *NotificationSystem {
-	return &NotificationSystem{}
-}
-
-// SendNotification sends a notification
-func (ns *NotificationSystem) SendNotification(notification Notification) error {
-	log.Printf("📢 Sending %s notification: %s", notification.Type, notification.Title)
-
-	// For now, just log the notification
-	// In production, this would integrate with actual notification services
-	switch notification.Type {
-	case "slack":
-		return ns.sendSlackNotification(notification)
-	case "email":
-		return ns.sendEmailNotification(notification)
-	case "webhook":
-		return ns.sendWebhookNotification(notification)
-	default:
-		log.Printf("Unknown notification type: %s", notification.Type)
-		return nil
-	}
-}
-
-// sendSlackNotification sends a notification to Slack
-func (ns *NotificationSystem) sendSlackNotification(notification Notification) error {
-	if ns.slackWebhookURL == "" {
-		log.Printf("Slack webhook not configured, skipping notification")
-		return nil
-	}
-
-	// This would implement actual Slack webhook call
-	log.Printf("Would send Slack notification: %s", notification.Message)
-	return nil
-}
-
-// sendEmailNotification sends an email notification
-func (ns *NotificationSystem) sendEmailNotification(notification Notification) error {
-	if ns.emailServer == "" {
-		log.Printf("Email server not configured, skipping notification")
-		return nil
-	}
-
-	// This would implement actual email sending
-	log.Printf("Would send email notification to %s: %s", notification.Recipient, notification.Message)
-	return nil
-}
-
-// sendWebhookNotification sends a webhook notification
-func (ns *NotificationSystem) sendWebhookNotification(notification Notification) error {
-	// This would implement actual webhook call
-	log.Printf("Would send webhook notification: %s", notification.Message)
-	return nil
+	componentLogger("websocket").Debug("Client left room", map[string]interface{}{"user_id": client.userID, "room": roomID})
 }
 
 func healthCheck(w http.ResponseWriter, r *http.Request) {
@@ -1313,27 +1772,52 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/api/v1/health", http.StatusMovedPermanently)
 }
 
-// Notification handler
+// Notification handler - queue a NotificationMessage and report per-channel results
 func sendNotification(w http.ResponseWriter, r *http.Request) {
-	var notification Notification
-	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+	var msg NotificationMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	notification.ID = uuid.New().String()
-	notification.CreatedAt = time.Now()
+	if msg.Title == "" && msg.Message == "" && msg.Template == "" {
+		http.Error(w, "title, message or template is required", http.StatusBadRequest)
+		return
+	}
+	if msg.Type == "" {
+		msg.Type = NotificationTypeInfo
+	}
+	if msg.Priority == "" {
+		msg.Priority = PriorityNormal
+	}
+	if len(msg.Channels) == 0 {
+		msg.Channels = notificationPipeline.ConfiguredChannels()
+	}
 
-	if err := notificationSystem.SendNotification(notification); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	msg.ID = uuid.New().String()
+	msg.CreatedAt = time.Now()
+
+	results, err := notificationPipeline.SendNotification(r.Context(), &msg)
+	if err != nil {
+		if results == nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    err.Error(),
+			"channels": results,
+		})
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Notification sent successfully",
-		"id":      notification.ID,
+		"id":       msg.ID,
+		"status":   msg.Status,
+		"channels": results,
 	})
 }
 
@@ -1455,12 +1939,16 @@ func startTimeTrackingHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !requireTokenUser(w, r, &request.UserID) {
+		return
+	}
 
 	entry, err := timeTrackingEngine.StartTimeEntry(request.UserID, request.TaskID, request.ActivityType, request.Description)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	publishWebhookEvent(WebhookTimeEntryStarted, entry)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1482,12 +1970,16 @@ func stopTimeTrackingHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !requireTokenUser(w, r, &request.UserID) {
+		return
+	}
 
 	entry, err := timeTrackingEngine.StopTimeEntry(request.UserID, request.EntryID, request.Notes)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	publishWebhookEvent(WebhookTimeEntryStopped, entry)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1501,6 +1993,9 @@ func stopTimeTrackingHandler(w http.ResponseWriter, r *http.Request) {
 // getTimeEntriesHandler - Get time entries
 func getTimeEntriesHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
+	if !requireTokenUser(w, r, &userID) {
+		return
+	}
 	taskID := r.URL.Query().Get("task_id")
 	
 	entries, err := timeTrackingEngine.GetTimeEntries(userID, taskID)
@@ -1521,6 +2016,9 @@ func getTimeEntriesHandler(w http.ResponseWriter, r *http.Request) {
 func getUserTimeEntriesHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userID"]
+	if !requireTokenUser(w, r, &userID) {
+		return
+	}
 
 	entries, err := timeTrackingEngine.GetTimeEntries(userID, "")
 	if err != nil {
@@ -1540,6 +2038,9 @@ func getUserTimeEntriesHandler(w http.ResponseWriter, r *http.Request) {
 // getTimeAnalyticsHandler - Get time analytics
 func getTimeAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
+	if !requireTokenUser(w, r, &userID) {
+		return
+	}
 	period := r.URL.Query().Get("period") // "day", "week", "month"
 	
 	if period == "" {
@@ -1565,6 +2066,9 @@ func getTimeAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 func getProductivityAnalysisHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userID"]
+	if !requireTokenUser(w, r, &userID) {
+		return
+	}
 
 	analysis, err := timeTrackingEngine.GetProductivityAnalysis(userID)
 	if err != nil {
@@ -1584,6 +2088,9 @@ func getProductivityAnalysisHandler(w http.ResponseWriter, r *http.Request) {
 func detectActivityHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userID"]
+	if !requireTokenUser(w, r, &userID) {
+		return
+	}
 
 	var request struct {
 		Context map[string]interface{} `json:"context"`
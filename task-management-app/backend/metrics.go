@@ -0,0 +1,212 @@
+package main
+
+// Prometheus instrumentation
+// Everything here is registered on the default registry and served by
+// promhttp.Handler() at /api/v1/metrics. HTTP metrics are labeled with the mux
+// route template (e.g. /api/v1/tasks/{id}) rather than the raw path so that IDs
+// do not explode label cardinality. Gauges that mirror in-memory state (hub
+// clients, active timers, DB pool) are read at scrape time.
+
+import (
+	"bufio"
+	"database/sql"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons a WebSocket message was dropped
+const (
+	WSDropSlowClient = "slow_client" // client send buffer full; the client is disconnected
+	WSDropHubFull    = "hub_full"    // hub broadcast queue full
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	websocketMessagesDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_messages_dropped_total",
+		Help: "WebSocket messages that could not be queued.",
+	}, []string{"reason"})
+
+	notificationsSentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifications_sent_total",
+		Help: "Notifications delivered per channel.",
+	}, []string{"channel"})
+
+	notificationsFailedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifications_failed_total",
+		Help: "Notification delivery attempts that failed per channel.",
+	}, []string{"channel"})
+
+	notificationDeliveryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "notification_delivery_duration_seconds",
+		Help:    "Time spent rendering and sending a notification per channel and result.",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"channel", "result"})
+)
+
+// recordWSDrop - Count a dropped WebSocket message
+func recordWSDrop(reason string) {
+	websocketMessagesDroppedTotal.WithLabelValues(reason).Inc()
+}
+
+// registerRuntimeMetrics - Gauges read from the hub, time tracker and DB pool at scrape time
+func registerRuntimeMetrics(db *sql.DB, hub *Hub, timeTracker *SimpleTimeTrackingEngine) {
+	if hub != nil {
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "websocket_clients",
+			Help: "Connected WebSocket clients.",
+		}, func() float64 {
+			clients, _ := hub.Counts()
+			return float64(clients)
+		}))
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "websocket_rooms",
+			Help: "WebSocket rooms with at least one member.",
+		}, func() float64 {
+			_, rooms := hub.Counts()
+			return float64(rooms)
+		}))
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "websocket_broadcast_queue_length",
+			Help: "Messages waiting in the hub broadcast queue.",
+		}, func() float64 {
+			return float64(len(hub.broadcast))
+		}))
+	}
+
+	if timeTracker != nil {
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "time_tracking_active_timers",
+			Help: "Time entries currently running.",
+		}, func() float64 {
+			return float64(timeTracker.ActiveTimerCount())
+		}))
+	}
+
+	if db != nil {
+		prometheus.MustRegister(&dbStatsCollector{db: db})
+	}
+}
+
+// dbStatsCollector - Exposes sql.DBStats from getDBStats
+type dbStatsCollector struct {
+	db *sql.DB
+}
+
+var (
+	dbMaxOpenDesc      = prometheus.NewDesc("db_pool_max_open_connections", "Maximum number of open connections to the database.", nil, nil)
+	dbOpenDesc         = prometheus.NewDesc("db_pool_open_connections", "Established connections, in use and idle.", nil, nil)
+	dbInUseDesc        = prometheus.NewDesc("db_pool_in_use_connections", "Connections currently in use.", nil, nil)
+	dbIdleDesc         = prometheus.NewDesc("db_pool_idle_connections", "Idle connections.", nil, nil)
+	dbWaitCountDesc    = prometheus.NewDesc("db_pool_wait_count_total", "Connections waited for.", nil, nil)
+	dbWaitDurationDesc = prometheus.NewDesc("db_pool_wait_duration_seconds_total", "Time blocked waiting for a new connection.", nil, nil)
+	dbClosedDesc       = prometheus.NewDesc("db_pool_closed_connections_total", "Connections closed, by reason.", []string{"reason"}, nil)
+)
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxOpenDesc
+	ch <- dbOpenDesc
+	ch <- dbInUseDesc
+	ch <- dbIdleDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+	ch <- dbClosedDesc
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := getDBStats(c.db)
+	ch <- prometheus.MustNewConstMetric(dbMaxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUseDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdleDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleClosed), "max_idle")
+	ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), "max_idle_time")
+	ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), "max_lifetime")
+}
+
+// ========================================
+// HTTP MIDDLEWARE
+// ========================================
+
+// statusRecorder - Captures the status code while staying usable for WebSocket upgrades and SSE
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	if sr.status == 0 {
+		sr.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// metricsMiddleware - Count and time every routed request
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := []string{route, r.Method, strconv.Itoa(status)}
+		httpRequestsTotal.WithLabelValues(labels...).Inc()
+		httpRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,411 @@
+package main
+
+// In-app notification inbox
+// The in_app channel stores notifications per user with read/unread/archived
+// state and pushes each new item to the user's "user:{id}" WebSocket room.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+type InboxStatus string
+
+const (
+	InboxUnread   InboxStatus = "unread"
+	InboxRead     InboxStatus = "read"
+	InboxArchived InboxStatus = "archived"
+)
+
+// InboxItem - One notification in a user's in-app inbox
+type InboxItem struct {
+	ID             string                 `json:"id"`
+	NotificationID string                 `json:"notification_id"`
+	UserID         string                 `json:"user_id"`
+	Type           NotificationType       `json:"type"`
+	Priority       NotificationPriority   `json:"priority"`
+	Title          string                 `json:"title"`
+	Message        string                 `json:"message"`
+	Details        map[string]interface{} `json:"details,omitempty"`
+	Status         InboxStatus            `json:"status"`
+	CreatedAt      time.Time              `json:"created_at"`
+	ReadAt         *time.Time             `json:"read_at,omitempty"`
+	ArchivedAt     *time.Time             `json:"archived_at,omitempty"`
+}
+
+// InboxPage - A page of inbox items with counts
+type InboxPage struct {
+	Notifications []InboxItem `json:"notifications"`
+	UnreadCount   int         `json:"unread_count"`
+	TotalCount    int         `json:"total_count"`
+	Page          int         `json:"page"`
+	PerPage       int         `json:"per_page"`
+}
+
+// InAppNotifier - Stores notifications in user inboxes and pushes them over WebSocket
+type InAppNotifier struct {
+	db *sql.DB
+}
+
+const notificationInboxSchema = `
+CREATE TABLE IF NOT EXISTS notification_inbox (
+  id VARCHAR(50) PRIMARY KEY,
+  notification_id VARCHAR(50) NOT NULL,
+  user_id VARCHAR(50) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  type VARCHAR(50) NOT NULL,
+  priority VARCHAR(20) NOT NULL,
+  title TEXT NOT NULL,
+  message TEXT NOT NULL,
+  details JSONB,
+  status VARCHAR(20) NOT NULL DEFAULT 'unread',
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  read_at TIMESTAMP,
+  archived_at TIMESTAMP,
+  UNIQUE (notification_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_inbox_user ON notification_inbox(user_id, status, created_at DESC);
+`
+
+func NewInAppNotifier() *InAppNotifier {
+	return &InAppNotifier{}
+}
+
+func (in *InAppNotifier) IsConfigured() bool {
+	return in.db != nil
+}
+
+// Configure - Attach the inbox database and create its table
+func (in *InAppNotifier) Configure(db *sql.DB) error {
+	if db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	if _, err := db.Exec(notificationInboxSchema); err != nil {
+		return err
+	}
+	in.db = db
+	return nil
+}
+
+// In-app implementation
+func (in *InAppNotifier) Send(ctx context.Context, msg *NotificationMessage) error {
+	if in.db == nil {
+		return fmt.Errorf("in-app inbox not configured")
+	}
+
+	candidates := msg.Recipients
+	if msg.Context != nil && msg.Context.UserID != "" && len(candidates) == 0 {
+		candidates = []string{msg.Context.UserID}
+	}
+
+	// Recipients may be user IDs or emails; anything else has no inbox
+	rows, err := in.db.QueryContext(ctx, "SELECT id FROM users WHERE id = ANY($1) OR email = ANY($1)", pq.Array(candidates))
+	if err != nil {
+		return err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+
+	if len(userIDs) == 0 {
+		return fmt.Errorf("no in-app recipients among %v", candidates)
+	}
+
+	var details []byte
+	if len(msg.Details) > 0 {
+		if details, err = json.Marshal(msg.Details); err != nil {
+			return fmt.Errorf("failed to marshal details: %v", err)
+		}
+	}
+
+	for _, userID := range userIDs {
+		item := InboxItem{
+			ID:             uuid.New().String(),
+			NotificationID: msg.ID,
+			UserID:         userID,
+			Type:           msg.Type,
+			Priority:       msg.Priority,
+			Title:          msg.Title,
+			Message:        msg.Message,
+			Details:        msg.Details,
+			Status:         InboxUnread,
+			CreatedAt:      time.Now(),
+		}
+
+		// Redelivery of the same notification must not duplicate inbox items
+		result, err := in.db.ExecContext(ctx, `
+			INSERT INTO notification_inbox (id, notification_id, user_id, type, priority, title, message, details, status, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (notification_id, user_id) DO NOTHING`,
+			item.ID, item.NotificationID, item.UserID, string(item.Type), string(item.Priority),
+			item.Title, item.Message, details, string(item.Status), item.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store in-app notification for %s: %v", userID, err)
+		}
+		if inserted, _ := result.RowsAffected(); inserted == 0 {
+			continue
+		}
+
+		in.push(userID, "created", &item)
+	}
+	return nil
+}
+
+// push - Send an inbox event with the current unread count to the user's room
+func (in *InAppNotifier) push(userID, event string, item *InboxItem) {
+	if hub == nil {
+		return
+	}
+
+	data := map[string]interface{}{"event": event}
+	if item != nil {
+		data["notification"] = item
+	}
+	if unread, err := in.UnreadCount(userID); err == nil {
+		data["unread_count"] = unread
+	}
+
+	room := "user:" + userID
+	hub.broadcastToRoom(room, WSMessage{
+		ID:        generateID(),
+		Type:      WSMsgNotification,
+		Data:      data,
+		UserID:    userID,
+		Room:      room,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+const inboxColumns = "id, notification_id, user_id, type, priority, title, message, details, status, created_at, read_at, archived_at"
+
+func scanInboxItem(row interface{ Scan(...interface{}) error }) (*InboxItem, error) {
+	var item InboxItem
+	var notificationType, priority, status string
+	var details []byte
+	if err := row.Scan(&item.ID, &item.NotificationID, &item.UserID, &notificationType, &priority,
+		&item.Title, &item.Message, &details, &status, &item.CreatedAt, &item.ReadAt, &item.ArchivedAt); err != nil {
+		return nil, err
+	}
+	item.Type = NotificationType(notificationType)
+	item.Priority = NotificationPriority(priority)
+	item.Status = InboxStatus(status)
+	if details != nil {
+		if err := json.Unmarshal(details, &item.Details); err != nil {
+			return nil, err
+		}
+	}
+	return &item, nil
+}
+
+// List - A page of a user's inbox; an empty status lists everything not archived
+func (in *InAppNotifier) List(userID string, status InboxStatus, page, perPage int) (*InboxPage, error) {
+	filter := "status <> 'archived'"
+	args := []interface{}{userID}
+	if status != "" {
+		filter = "status = $2"
+		args = append(args, string(status))
+	}
+
+	result := &InboxPage{Notifications: []InboxItem{}, Page: page, PerPage: perPage}
+	if err := in.db.QueryRow(
+		"SELECT COUNT(*) FROM notification_inbox WHERE user_id = $1 AND "+filter, args...,
+	).Scan(&result.TotalCount); err != nil {
+		return nil, err
+	}
+
+	args = append(args, perPage, (page-1)*perPage)
+	rows, err := in.db.Query(fmt.Sprintf(
+		"SELECT %s FROM notification_inbox WHERE user_id = $1 AND %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d",
+		inboxColumns, filter, len(args)-1, len(args),
+	), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanInboxItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Notifications = append(result.Notifications, *item)
+	}
+
+	if result.UnreadCount, err = in.UnreadCount(userID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UnreadCount - Number of unread items in a user's inbox
+func (in *InAppNotifier) UnreadCount(userID string) (int, error) {
+	var count int
+	err := in.db.QueryRow(
+		"SELECT COUNT(*) FROM notification_inbox WHERE user_id = $1 AND status = 'unread'", userID,
+	).Scan(&count)
+	return count, err
+}
+
+// SetStatus - Move one of a user's items to read, unread or archived
+func (in *InAppNotifier) SetStatus(userID, itemID string, status InboxStatus) (*InboxItem, error) {
+	item, err := scanInboxItem(in.db.QueryRow(`
+		UPDATE notification_inbox SET status = $1,
+		  read_at = CASE WHEN $1 = 'unread' THEN NULL ELSE COALESCE(read_at, NOW()) END,
+		  archived_at = CASE WHEN $1 = 'archived' THEN COALESCE(archived_at, NOW()) ELSE NULL END
+		WHERE id = $2 AND user_id = $3
+		RETURNING `+inboxColumns,
+		string(status), itemID, userID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	in.push(userID, string(status), item)
+	return item, nil
+}
+
+// MarkAllRead - Mark every unread item in a user's inbox as read
+func (in *InAppNotifier) MarkAllRead(userID string) (int64, error) {
+	result, err := in.db.Exec(
+		"UPDATE notification_inbox SET status = 'read', read_at = NOW() WHERE user_id = $1 AND status = 'unread'", userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	updated, _ := result.RowsAffected()
+	in.push(userID, "read_all", nil)
+	return updated, nil
+}
+
+// ========================================
+// IN-APP INBOX HANDLERS
+// ========================================
+
+// requireInbox - Resolve the calling user and make sure the inbox is available
+func requireInbox(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if notificationPipeline.inAppClient.db == nil {
+		http.Error(w, "In-app notifications unavailable", http.StatusServiceUnavailable)
+		return "", false
+	}
+
+	userID := requestUserID(r)
+	if userID == "" {
+		http.Error(w, "User identity required", http.StatusUnauthorized)
+		return "", false
+	}
+	return userID, true
+}
+
+// getMyNotificationsHandler - Page through the caller's inbox
+func getMyNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireInbox(w, r)
+	if !ok {
+		return
+	}
+
+	status := InboxStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", InboxUnread, InboxRead, InboxArchived:
+	default:
+		http.Error(w, "status must be unread, read or archived", http.StatusBadRequest)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+
+	result, err := notificationPipeline.inAppClient.List(userID, status, page, perPage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// getMyUnreadCountHandler - Number of unread notifications for the caller
+func getMyUnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireInbox(w, r)
+	if !ok {
+		return
+	}
+
+	unread, err := notificationPipeline.inAppClient.UnreadCount(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"unread_count": unread,
+	})
+}
+
+// inboxStatusHandler - Build a handler that moves an inbox item to the given state
+func inboxStatusHandler(status InboxStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requireInbox(w, r)
+		if !ok {
+			return
+		}
+
+		item, err := notificationPipeline.inAppClient.SetStatus(userID, mux.Vars(r)["id"], status)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Notification not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+// markAllMyNotificationsReadHandler - Mark the caller's whole inbox as read
+func markAllMyNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireInbox(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := notificationPipeline.inAppClient.MarkAllRead(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"updated":      updated,
+		"unread_count": 0,
+	})
+}
@@ -0,0 +1,463 @@
+package main
+
+// Additional notification channels: Microsoft Teams, Discord and SMS
+// Each notifier only needs a URL to talk to, so it can be pointed at a local
+// httptest server. SMS goes through an SMSProvider; HTTPSMSProvider covers
+// gateways that accept a JSON POST per message.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TeamsNotifier - Microsoft Teams incoming webhook client posting Adaptive Cards
+type TeamsNotifier struct {
+	webhookURL string
+	baseURL    string
+	client     *http.Client
+	timeout    time.Duration
+}
+
+// TeamsMessage - Webhook envelope carrying one Adaptive Card attachment
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+type TeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	ContentURL  *string      `json:"contentUrl"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+// AdaptiveCard - The subset of the Adaptive Card 1.4 schema used for notifications
+type AdaptiveCard struct {
+	Schema  string                   `json:"$schema"`
+	Type    string                   `json:"type"`
+	Version string                   `json:"version"`
+	Body    []map[string]interface{} `json:"body"`
+	Actions []map[string]interface{} `json:"actions,omitempty"`
+	MSTeams map[string]interface{}   `json:"msteams,omitempty"`
+}
+
+// DiscordNotifier - Discord webhook client posting embeds
+type DiscordNotifier struct {
+	webhookURL string
+	baseURL    string
+	username   string
+	client     *http.Client
+	timeout    time.Duration
+}
+
+type DiscordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Content  string         `json:"content,omitempty"`
+	Embeds   []DiscordEmbed `json:"embeds"`
+}
+
+type DiscordEmbed struct {
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// PartialDeliveryError - Some recipients were reached; a retry should only go to the others
+type PartialDeliveryError struct {
+	Delivered []string
+	Err       error
+}
+
+func (pe *PartialDeliveryError) Error() string {
+	return pe.Err.Error()
+}
+
+func (pe *PartialDeliveryError) Unwrap() error {
+	return pe.Err
+}
+
+// SMSProvider - Adapter for an SMS gateway
+type SMSProvider interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+// SMSNotifier - Sends notifications as text messages through an SMSProvider
+type SMSNotifier struct {
+	provider SMSProvider
+	maxBody  int
+}
+
+// HTTPSMSProvider - Generic SMS gateway accepting {"to", "from", "body"} as JSON
+type HTTPSMSProvider struct {
+	url     string
+	from    string
+	headers map[string]string
+	client  *http.Client
+}
+
+// Discord limits on embed content
+const (
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+	discordFieldLimit       = 25
+	discordFieldValueLimit  = 1024
+)
+
+// E.164 phone numbers, the only recipients SMS can reach
+var phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+func NewTeamsNotifier() *TeamsNotifier {
+	return &TeamsNotifier{
+		timeout: 30 * time.Second,
+	}
+}
+
+func NewDiscordNotifier() *DiscordNotifier {
+	return &DiscordNotifier{
+		username: "Task Management",
+		timeout:  30 * time.Second,
+	}
+}
+
+func NewSMSNotifier() *SMSNotifier {
+	return &SMSNotifier{
+		maxBody: 459, // three concatenated GSM-7 segments
+	}
+}
+
+func NewHTTPSMSProvider(url, from string, headers map[string]string) *HTTPSMSProvider {
+	return &HTTPSMSProvider{
+		url:     url,
+		from:    from,
+		headers: headers,
+		client:  newTracedHTTPClient(15 * time.Second),
+	}
+}
+
+func (tn *TeamsNotifier) Configure(webhookURL, baseURL string) {
+	tn.webhookURL = webhookURL
+	tn.baseURL = baseURL
+	tn.client = newTracedHTTPClient(tn.timeout)
+}
+
+func (dn *DiscordNotifier) Configure(webhookURL, baseURL string) {
+	dn.webhookURL = webhookURL
+	dn.baseURL = baseURL
+	dn.client = newTracedHTTPClient(dn.timeout)
+}
+
+func (sn *SMSNotifier) Configure(provider SMSProvider) {
+	sn.provider = provider
+}
+
+func (tn *TeamsNotifier) IsConfigured() bool {
+	return tn.webhookURL != ""
+}
+
+func (dn *DiscordNotifier) IsConfigured() bool {
+	return dn.webhookURL != ""
+}
+
+func (sn *SMSNotifier) IsConfigured() bool {
+	return sn.provider != nil
+}
+
+// postJSON - POST a JSON payload and treat any 2xx as success
+func postJSON(ctx context.Context, client *http.Client, url string, payload []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			return fmt.Errorf("status %d (retry after %s): %s", resp.StatusCode, retryAfter, strings.TrimSpace(string(body)))
+		}
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sortedDetailKeys - Detail keys in a stable order for cards and embeds
+func sortedDetailKeys(details map[string]interface{}) []string {
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// truncateText - Cut text to at most limit runes, marking the cut with an ellipsis
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// Teams implementation
+func (tn *TeamsNotifier) Send(ctx context.Context, msg *NotificationMessage) error {
+	if tn.webhookURL == "" {
+		return fmt.Errorf("teams webhook URL not configured")
+	}
+
+	// Templates may supply the complete webhook payload
+	var jsonData []byte
+	if msg.rendered != nil && len(msg.rendered.Teams) > 0 {
+		jsonData = msg.rendered.Teams
+	} else {
+		var err error
+		jsonData, err = json.Marshal(tn.convertToTeamsMessage(msg))
+		if err != nil {
+			return fmt.Errorf("failed to marshal teams message: %v", err)
+		}
+	}
+
+	if err := postJSON(ctx, tn.client, tn.webhookURL, jsonData, nil); err != nil {
+		return fmt.Errorf("failed to send teams message: %v", err)
+	}
+	return nil
+}
+
+func (tn *TeamsNotifier) convertToTeamsMessage(msg *NotificationMessage) *TeamsMessage {
+	card := AdaptiveCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		MSTeams: map[string]interface{}{"width": "Full"},
+	}
+
+	card.Body = append(card.Body,
+		map[string]interface{}{
+			"type":   "TextBlock",
+			"text":   msg.Title,
+			"weight": "Bolder",
+			"size":   "Medium",
+			"color":  tn.getColorForPriority(msg.Priority),
+			"wrap":   true,
+		},
+		map[string]interface{}{
+			"type": "TextBlock",
+			"text": msg.Message,
+			"wrap": true,
+		},
+	)
+
+	facts := []map[string]string{
+		{"title": "Type", "value": string(msg.Type)},
+		{"title": "Priority", "value": string(msg.Priority)},
+	}
+	for _, key := range sortedDetailKeys(msg.Details) {
+		facts = append(facts, map[string]string{"title": key, "value": fmt.Sprintf("%v", msg.Details[key])})
+	}
+	card.Body = append(card.Body, map[string]interface{}{
+		"type":  "FactSet",
+		"facts": facts,
+	})
+
+	if link := notificationLink(msg, tn.baseURL); link != "" {
+		card.Actions = append(card.Actions, map[string]interface{}{
+			"type":  "Action.OpenUrl",
+			"title": "Open",
+			"url":   link,
+		})
+	}
+
+	return &TeamsMessage{
+		Type: "message",
+		Attachments: []TeamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     card,
+		}},
+	}
+}
+
+// Adaptive Card text colors
+func (tn *TeamsNotifier) getColorForPriority(priority NotificationPriority) string {
+	switch priority {
+	case PriorityCritical:
+		return "Attention"
+	case PriorityHigh:
+		return "Warning"
+	case PriorityLow:
+		return "Good"
+	default:
+		return "Default"
+	}
+}
+
+// Discord implementation
+func (dn *DiscordNotifier) Send(ctx context.Context, msg *NotificationMessage) error {
+	if dn.webhookURL == "" {
+		return fmt.Errorf("discord webhook URL not configured")
+	}
+
+	var jsonData []byte
+	if msg.rendered != nil && len(msg.rendered.Discord) > 0 {
+		jsonData = msg.rendered.Discord
+	} else {
+		var err error
+		jsonData, err = json.Marshal(dn.convertToDiscordMessage(msg))
+		if err != nil {
+			return fmt.Errorf("failed to marshal discord message: %v", err)
+		}
+	}
+
+	if err := postJSON(ctx, dn.client, dn.webhookURL, jsonData, nil); err != nil {
+		return fmt.Errorf("failed to send discord message: %v", err)
+	}
+	return nil
+}
+
+func (dn *DiscordNotifier) convertToDiscordMessage(msg *NotificationMessage) *DiscordMessage {
+	embed := DiscordEmbed{
+		Title:       truncateText(msg.Title, discordTitleLimit),
+		Description: truncateText(msg.Message, discordDescriptionLimit),
+		URL:         notificationLink(msg, dn.baseURL),
+		Color:       dn.getColorForPriority(msg.Priority),
+		Footer:      &DiscordEmbedFooter{Text: fmt.Sprintf("%s · %s", msg.Type, msg.Priority)},
+		Timestamp:   msg.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	for _, key := range sortedDetailKeys(msg.Details) {
+		if len(embed.Fields) == discordFieldLimit {
+			break
+		}
+		embed.Fields = append(embed.Fields, DiscordEmbedField{
+			Name:   truncateText(key, discordTitleLimit),
+			Value:  truncateText(fmt.Sprintf("%v", msg.Details[key]), discordFieldValueLimit),
+			Inline: true,
+		})
+	}
+
+	return &DiscordMessage{
+		Username: dn.username,
+		Embeds:   []DiscordEmbed{embed},
+	}
+}
+
+// Discord colors are RGB integers
+func (dn *DiscordNotifier) getColorForPriority(priority NotificationPriority) int {
+	switch priority {
+	case PriorityCritical:
+		return 0xFF0000
+	case PriorityHigh:
+		return 0xFF9900
+	case PriorityNormal:
+		return 0x36A64F
+	default:
+		return 0x808080
+	}
+}
+
+// SMS implementation
+func (sn *SMSNotifier) Send(ctx context.Context, msg *NotificationMessage) error {
+	if sn.provider == nil {
+		return fmt.Errorf("sms provider not configured")
+	}
+
+	var numbers []string
+	for _, recipient := range msg.Recipients {
+		if phoneNumberPattern.MatchString(recipient) {
+			numbers = append(numbers, recipient)
+		}
+	}
+	if len(numbers) == 0 {
+		return fmt.Errorf("no E.164 phone numbers among recipients")
+	}
+
+	body := sn.formatBody(msg)
+	var delivered, failed []string
+	for _, number := range numbers {
+		if err := sn.provider.SendSMS(ctx, number, body); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", number, err))
+			continue
+		}
+		delivered = append(delivered, number)
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("failed to send sms to %d of %d recipients: %s", len(failed), len(numbers), strings.Join(failed, "; "))
+	if len(delivered) > 0 {
+		return &PartialDeliveryError{Delivered: delivered, Err: err}
+	}
+	return err
+}
+
+// formatBody - Plain text body, preferring a template's sms variant
+func (sn *SMSNotifier) formatBody(msg *NotificationMessage) string {
+	if msg.rendered != nil && msg.rendered.SMS != "" {
+		return truncateText(msg.rendered.SMS, sn.maxBody)
+	}
+
+	body := msg.Title
+	if msg.Message != "" {
+		body += ": " + msg.Message
+	}
+	if msg.Priority == PriorityCritical || msg.Priority == PriorityHigh {
+		body = "[" + strings.ToUpper(string(msg.Priority)) + "] " + body
+	}
+	return truncateText(body, sn.maxBody)
+}
+
+// Generic HTTP SMS gateway
+func (hp *HTTPSMSProvider) SendSMS(ctx context.Context, to, body string) error {
+	payload, err := json.Marshal(map[string]string{
+		"to":   to,
+		"from": hp.from,
+		"body": body,
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, hp.client, hp.url, payload, hp.headers)
+}
+
+// notificationLink - Deep link for the task or project a message is about
+func notificationLink(msg *NotificationMessage, baseURL string) string {
+	if baseURL == "" {
+		return ""
+	}
+	if taskID, ok := msg.Details["task_id"].(string); ok && taskID != "" {
+		return baseURL + "/tasks/" + taskID
+	}
+	if msg.Context != nil && msg.Context.ProjectID != "" {
+		return baseURL + "/projects/" + msg.Context.ProjectID
+	}
+	return ""
+}
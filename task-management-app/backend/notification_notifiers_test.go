@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureServer - Records the JSON bodies POSTed to it and answers with status
+type captureServer struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func newCaptureServer(t *testing.T, status func(body map[string]interface{}) int) *captureServer {
+	t.Helper()
+	cs := &captureServer{}
+	cs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("body is not a JSON object: %v: %s", err, data)
+		}
+		cs.mutex.Lock()
+		cs.bodies = append(cs.bodies, body)
+		cs.mutex.Unlock()
+		w.WriteHeader(status(body))
+	}))
+	t.Cleanup(cs.Close)
+	return cs
+}
+
+func alwaysOK(map[string]interface{}) int { return http.StatusOK }
+
+func testNotification() *NotificationMessage {
+	return &NotificationMessage{
+		ID:        "n-1",
+		Type:      NotificationTypeDeployment,
+		Priority:  PriorityHigh,
+		Title:     "Deploy finished",
+		Message:   "v1.2.3 is live",
+		Details:   map[string]interface{}{"version": "v1.2.3", "task_id": "task-7"},
+		CreatedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// jsonPath - Walk decoded JSON by object keys and array indexes
+func jsonPath(t *testing.T, value interface{}, steps ...interface{}) interface{} {
+	t.Helper()
+	for _, step := range steps {
+		switch key := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				t.Fatalf("expected an object before %q, got %T", key, value)
+			}
+			value = object[key]
+		case int:
+			array, ok := value.([]interface{})
+			if !ok || key >= len(array) {
+				t.Fatalf("expected an array with index %d, got %v", key, value)
+			}
+			value = array[key]
+		}
+	}
+	return value
+}
+
+func TestTeamsNotifierPostsAdaptiveCard(t *testing.T) {
+	server := newCaptureServer(t, alwaysOK)
+	notifier := NewTeamsNotifier()
+	notifier.Configure(server.URL, "https://tasks.example.com")
+
+	if err := notifier.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(server.bodies) != 1 {
+		t.Fatalf("got %d requests, want 1", len(server.bodies))
+	}
+	body := server.bodies[0]
+
+	checks := []struct {
+		steps []interface{}
+		want  interface{}
+	}{
+		{[]interface{}{"type"}, "message"},
+		{[]interface{}{"attachments", 0, "contentType"}, "application/vnd.microsoft.card.adaptive"},
+		{[]interface{}{"attachments", 0, "content", "type"}, "AdaptiveCard"},
+		{[]interface{}{"attachments", 0, "content", "version"}, "1.4"},
+		{[]interface{}{"attachments", 0, "content", "body", 0, "text"}, "Deploy finished"},
+		{[]interface{}{"attachments", 0, "content", "body", 0, "color"}, "Warning"},
+		{[]interface{}{"attachments", 0, "content", "body", 1, "text"}, "v1.2.3 is live"},
+		{[]interface{}{"attachments", 0, "content", "body", 2, "type"}, "FactSet"},
+		{[]interface{}{"attachments", 0, "content", "body", 2, "facts", 2, "title"}, "task_id"},
+		{[]interface{}{"attachments", 0, "content", "actions", 0, "type"}, "Action.OpenUrl"},
+		{[]interface{}{"attachments", 0, "content", "actions", 0, "url"}, "https://tasks.example.com/tasks/task-7"},
+	}
+	for _, check := range checks {
+		if got := jsonPath(t, body, check.steps...); got != check.want {
+			t.Errorf("%v = %v, want %v", check.steps, got, check.want)
+		}
+	}
+}
+
+func TestDiscordNotifierPostsEmbed(t *testing.T) {
+	server := newCaptureServer(t, alwaysOK)
+	notifier := NewDiscordNotifier()
+	notifier.Configure(server.URL, "https://tasks.example.com")
+
+	msg := testNotification()
+	msg.Title = strings.Repeat("t", discordTitleLimit+10)
+	if err := notifier.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(server.bodies) != 1 {
+		t.Fatalf("got %d requests, want 1", len(server.bodies))
+	}
+	body := server.bodies[0]
+
+	checks := []struct {
+		steps []interface{}
+		want  interface{}
+	}{
+		{[]interface{}{"username"}, "Task Management"},
+		{[]interface{}{"embeds", 0, "description"}, "v1.2.3 is live"},
+		{[]interface{}{"embeds", 0, "url"}, "https://tasks.example.com/tasks/task-7"},
+		{[]interface{}{"embeds", 0, "color"}, float64(0xFF9900)},
+		{[]interface{}{"embeds", 0, "timestamp"}, "2026-03-01T12:00:00Z"},
+		{[]interface{}{"embeds", 0, "footer", "text"}, "deployment · high"},
+		{[]interface{}{"embeds", 0, "fields", 0, "name"}, "task_id"},
+		{[]interface{}{"embeds", 0, "fields", 1, "value"}, "v1.2.3"},
+	}
+	for _, check := range checks {
+		if got := jsonPath(t, body, check.steps...); got != check.want {
+			t.Errorf("%v = %v, want %v", check.steps, got, check.want)
+		}
+	}
+	if title := jsonPath(t, body, "embeds", 0, "title").(string); len([]rune(title)) != discordTitleLimit {
+		t.Errorf("title has %d runes, want it cut to %d", len([]rune(title)), discordTitleLimit)
+	}
+}
+
+func TestTemplatePayloadReplacesDefault(t *testing.T) {
+	server := newCaptureServer(t, alwaysOK)
+	notifier := NewTeamsNotifier()
+	notifier.Configure(server.URL, "")
+
+	msg := testNotification()
+	msg.rendered = &RenderedNotification{Teams: json.RawMessage(`{"type":"message","attachments":[],"custom":true}`)}
+	if err := notifier.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := jsonPath(t, server.bodies[0], "custom"); got != true {
+		t.Errorf("template payload was not sent as is: %v", server.bodies[0])
+	}
+}
+
+func TestSMSNotifierPostsOneMessagePerNumber(t *testing.T) {
+	server := newCaptureServer(t, alwaysOK)
+	notifier := NewSMSNotifier()
+	notifier.Configure(NewHTTPSMSProvider(server.URL, "+15550000000", nil))
+
+	msg := testNotification()
+	msg.Recipients = []string{"+15551112222", "ops@example.com", "+447700900123"}
+	if err := notifier.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	want := []map[string]interface{}{
+		{"to": "+15551112222", "from": "+15550000000", "body": "[HIGH] Deploy finished: v1.2.3 is live"},
+		{"to": "+447700900123", "from": "+15550000000", "body": "[HIGH] Deploy finished: v1.2.3 is live"},
+	}
+	if len(server.bodies) != len(want) {
+		t.Fatalf("got %d requests, want %d: %v", len(server.bodies), len(want), server.bodies)
+	}
+	for i, body := range server.bodies {
+		for key, value := range want[i] {
+			if body[key] != value {
+				t.Errorf("request %d: %s = %v, want %v", i, key, body[key], value)
+			}
+		}
+	}
+}
+
+func TestSMSNotifierReportsPartialDelivery(t *testing.T) {
+	server := newCaptureServer(t, func(body map[string]interface{}) int {
+		if body["to"] == "+447700900123" {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+	notifier := NewSMSNotifier()
+	notifier.Configure(NewHTTPSMSProvider(server.URL, "", nil))
+
+	msg := testNotification()
+	msg.Recipients = []string{"+15551112222", "+447700900123"}
+	err := notifier.Send(context.Background(), msg)
+
+	var partial *PartialDeliveryError
+	if !errors.As(err, &partial) {
+		t.Fatalf("Send error = %v, want a PartialDeliveryError", err)
+	}
+	if len(partial.Delivered) != 1 || partial.Delivered[0] != "+15551112222" {
+		t.Errorf("Delivered = %v, want [+15551112222]", partial.Delivered)
+	}
+
+	// A retry leaves out the number that was already reached
+	withoutDelivered(msg, ChannelSMS, partial.Delivered)
+	server.bodies = nil
+	notifier.Send(context.Background(), msg)
+	if len(server.bodies) != 1 || server.bodies[0]["to"] != "+447700900123" {
+		t.Errorf("retry sent %v, want only +447700900123", server.bodies)
+	}
+}
+
+func TestSMSNotifierRejectsMessagesWithoutNumbers(t *testing.T) {
+	notifier := NewSMSNotifier()
+	notifier.Configure(NewHTTPSMSProvider("http://127.0.0.1:0", "", nil))
+
+	msg := testNotification()
+	msg.Recipients = []string{"ops@example.com"}
+	if err := notifier.Send(context.Background(), msg); err == nil {
+		t.Error("Send succeeded without any phone number")
+	}
+}
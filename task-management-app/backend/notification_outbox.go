@@ -0,0 +1,539 @@
+package main
+
+// Durable notification outbox
+// Notifications are written to PostgreSQL with one delivery row per channel.
+// Workers claim due deliveries with SKIP LOCKED, retry failures with exponential
+// backoff and jitter, and park deliveries in a dead-letter state after the
+// maximum number of attempts so operators can inspect and replay them.
+// Recipients a partly failed attempt did reach are recorded on the delivery and
+// left out of its retries, so an SMS to three numbers never repeats to the two
+// that already got it.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	StatusDeadLetter NotificationStatus = "dead_letter"
+	StatusInFlight   NotificationStatus = "in_flight"
+)
+
+// NotificationOutbox - PostgreSQL-backed queue of per-channel deliveries
+type NotificationOutbox struct {
+	db           *sql.DB
+	workers      int
+	batchSize    int
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	lease        time.Duration
+	pollInterval time.Duration
+	stop         chan bool
+	running      sync.WaitGroup
+}
+
+// NotificationDelivery - Delivery state of one notification on one channel
+type NotificationDelivery struct {
+	NotificationID string              `json:"notification_id"`
+	Channel        NotificationChannel `json:"channel"`
+	Status         NotificationStatus  `json:"status"`
+	Attempts       int                 `json:"attempts"`
+	DeliveredTo    []string            `json:"delivered_to,omitempty"`
+	NextAttemptAt  *time.Time          `json:"next_attempt_at,omitempty"`
+	LastError      string              `json:"last_error,omitempty"`
+	SentAt         *time.Time          `json:"sent_at,omitempty"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+}
+
+// OutboxRecord - A stored notification together with its deliveries
+type OutboxRecord struct {
+	Message    *NotificationMessage   `json:"message"`
+	Status     NotificationStatus     `json:"status"`
+	Deliveries []NotificationDelivery `json:"deliveries"`
+}
+
+const notificationOutboxSchema = `
+CREATE TABLE IF NOT EXISTS notification_outbox (
+  id VARCHAR(50) PRIMARY KEY,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS trace_context JSONB;
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+  notification_id VARCHAR(50) REFERENCES notification_outbox(id) ON DELETE CASCADE,
+  channel VARCHAR(50) NOT NULL,
+  status VARCHAR(50) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP,
+  last_error TEXT,
+  sent_at TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (notification_id, channel)
+);
+
+ALTER TABLE notification_deliveries ADD COLUMN IF NOT EXISTS delivered_to TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_due ON notification_deliveries(status, next_attempt_at);
+`
+
+// NewNotificationOutbox - Create an outbox with the given number of delivery workers
+func NewNotificationOutbox(db *sql.DB, workers int) *NotificationOutbox {
+	return &NotificationOutbox{
+		db:           db,
+		workers:      workers,
+		batchSize:    10,
+		maxAttempts:  5,
+		baseBackoff:  30 * time.Second,
+		maxBackoff:   time.Hour,
+		lease:        5 * time.Minute,
+		pollInterval: 2 * time.Second,
+		stop:         make(chan bool),
+	}
+}
+
+// EnsureSchema - Create outbox tables if missing
+func (no *NotificationOutbox) EnsureSchema() error {
+	if no.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	_, err := no.db.Exec(notificationOutboxSchema)
+	return err
+}
+
+// Enqueue - Persist a notification and one pending delivery per channel
+func (no *NotificationOutbox) Enqueue(ctx context.Context, msg *NotificationMessage) error {
+	if no.db == nil {
+		return fmt.Errorf("notification outbox database not configured")
+	}
+	if len(msg.Channels) == 0 {
+		return fmt.Errorf("notification has no channels")
+	}
+
+	msg.Status = StatusPending
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %v", err)
+	}
+
+	// Deliveries happen later on a worker; keep the caller's trace so they join it
+	var traceContext []byte
+	if carrier := injectTraceContext(ctx); carrier != nil {
+		traceContext, _ = json.Marshal(carrier)
+	}
+
+	tx, err := no.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO notification_outbox (id, payload, trace_context, created_at) VALUES ($1, $2, $3, $4)",
+		msg.ID, payload, traceContext, msg.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, channel := range msg.Channels {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO notification_deliveries (notification_id, channel, status, next_attempt_at, updated_at) VALUES ($1, $2, $3, $4, $4) ON CONFLICT DO NOTHING",
+			msg.ID, string(channel), string(StatusPending), now,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Start - Launch delivery workers that poll for due deliveries
+func (no *NotificationOutbox) Start(pipeline *NotificationPipeline) {
+	for i := 0; i < no.workers; i++ {
+		no.running.Add(1)
+		go func() {
+			defer no.running.Done()
+			ticker := time.NewTicker(no.pollInterval)
+			defer ticker.Stop()
+			for {
+				// Keep draining while there is work, then wait for the next tick
+				for no.processBatch(pipeline) > 0 {
+					select {
+					case <-no.stop:
+						return
+					default:
+					}
+				}
+				select {
+				case <-ticker.C:
+				case <-no.stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop - Stop delivery workers and wait for in-progress deliveries to finish
+func (no *NotificationOutbox) Stop() {
+	close(no.stop)
+	no.running.Wait()
+}
+
+type claimedDelivery struct {
+	notificationID string
+	channel        NotificationChannel
+	attempts       int
+	deliveredTo    []string
+}
+
+// claim - Lease a batch of due deliveries; expired leases of crashed workers are reclaimed
+func (no *NotificationOutbox) claim() ([]claimedDelivery, error) {
+	rows, err := no.db.Query(`
+		UPDATE notification_deliveries d
+		SET status = $1, next_attempt_at = $2, updated_at = NOW()
+		FROM (
+		  SELECT notification_id, channel FROM notification_deliveries
+		  WHERE status IN ($3, $4, $1) AND next_attempt_at <= NOW()
+		  ORDER BY next_attempt_at
+		  LIMIT $5
+		  FOR UPDATE SKIP LOCKED
+		) due
+		WHERE d.notification_id = due.notification_id AND d.channel = due.channel
+		RETURNING d.notification_id, d.channel, d.attempts, d.delivered_to`,
+		string(StatusInFlight), time.Now().Add(no.lease), string(StatusPending), string(StatusRetrying), no.batchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []claimedDelivery
+	for rows.Next() {
+		var c claimedDelivery
+		var channel string
+		if err := rows.Scan(&c.notificationID, &channel, &c.attempts, pq.Array(&c.deliveredTo)); err != nil {
+			return nil, err
+		}
+		c.channel = NotificationChannel(channel)
+		claimed = append(claimed, c)
+	}
+	return claimed, nil
+}
+
+// processBatch - Deliver one claimed batch and return how many deliveries were handled
+func (no *NotificationOutbox) processBatch(pipeline *NotificationPipeline) int {
+	claimed, err := no.claim()
+	if err != nil {
+		componentLogger("notifications").Error(err, "Failed to claim notification deliveries", nil)
+		return 0
+	}
+
+	for _, c := range claimed {
+		msg, ctx, err := no.loadDelivery(c.notificationID)
+		if err != nil {
+			componentLogger("notifications").Error(err, "Failed to load notification", map[string]interface{}{"notification_id": c.notificationID})
+			no.recordFailure(c, err)
+			continue
+		}
+		withoutDelivered(msg, c.channel, c.deliveredTo)
+
+		ctx, span := tracer.Start(ctx, "notification.deliver", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+			attribute.String("notification.id", c.notificationID),
+			attribute.String("notification.channel", string(c.channel)),
+			attribute.Int("notification.attempt", c.attempts+1),
+		))
+		err = pipeline.deliver(ctx, msg, c.channel)
+		endSpan(span, err)
+		if err != nil {
+			componentLogger("notifications").WithContext(ctx).Warn("Notification delivery failed", map[string]interface{}{"notification_id": c.notificationID, "channel": c.channel, "attempt": c.attempts + 1, "error": err.Error()})
+			no.recordFailure(c, err)
+			continue
+		}
+		no.recordSuccess(c)
+	}
+	return len(claimed)
+}
+
+// withoutDelivered - Drop the recipients an earlier attempt already reached on channel
+func withoutDelivered(msg *NotificationMessage, channel NotificationChannel, delivered []string) {
+	if len(delivered) == 0 {
+		return
+	}
+	reached := make(map[string]bool, len(delivered))
+	for _, recipient := range delivered {
+		reached[recipient] = true
+	}
+	remaining := func(recipients []string) []string {
+		kept := make([]string, 0, len(recipients))
+		for _, recipient := range recipients {
+			if !reached[recipient] {
+				kept = append(kept, recipient)
+			}
+		}
+		return kept
+	}
+	if recipients, ok := msg.ChannelRecipients[channel]; ok {
+		msg.ChannelRecipients[channel] = remaining(recipients)
+	}
+	msg.Recipients = remaining(msg.Recipients)
+}
+
+func (no *NotificationOutbox) loadMessage(notificationID string) (*NotificationMessage, error) {
+	msg, _, err := no.loadDelivery(notificationID)
+	return msg, err
+}
+
+// loadDelivery - Load a notification and the trace context it was enqueued under
+func (no *NotificationOutbox) loadDelivery(notificationID string) (*NotificationMessage, context.Context, error) {
+	var payload, traceContext []byte
+	err := no.db.QueryRow("SELECT payload, trace_context FROM notification_outbox WHERE id = $1", notificationID).Scan(&payload, &traceContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	var msg NotificationMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, nil, err
+	}
+
+	carrier := map[string]string{}
+	if len(traceContext) > 0 {
+		json.Unmarshal(traceContext, &carrier)
+	}
+	return &msg, extractTraceContext(carrier), nil
+}
+
+func (no *NotificationOutbox) recordSuccess(c claimedDelivery) {
+	_, err := no.db.Exec(
+		"UPDATE notification_deliveries SET status = $1, attempts = attempts + 1, sent_at = NOW(), next_attempt_at = NULL, last_error = NULL, updated_at = NOW() WHERE notification_id = $2 AND channel = $3",
+		string(StatusSent), c.notificationID, string(c.channel),
+	)
+	if err != nil {
+		componentLogger("notifications").Error(err, "Failed to record notification delivery", map[string]interface{}{"notification_id": c.notificationID, "channel": c.channel})
+	}
+}
+
+func (no *NotificationOutbox) recordFailure(c claimedDelivery, deliveryErr error) {
+	attempts := c.attempts + 1
+	status := StatusRetrying
+	var nextAttempt *time.Time
+	if attempts >= no.maxAttempts {
+		status = StatusDeadLetter
+	} else {
+		next := time.Now().Add(no.backoff(attempts))
+		nextAttempt = &next
+	}
+
+	var delivered []string
+	var partial *PartialDeliveryError
+	if errors.As(deliveryErr, &partial) {
+		delivered = partial.Delivered
+	}
+
+	_, err := no.db.Exec(
+		"UPDATE notification_deliveries SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, delivered_to = delivered_to || $7, updated_at = NOW() WHERE notification_id = $5 AND channel = $6",
+		string(status), attempts, nextAttempt, deliveryErr.Error(), c.notificationID, string(c.channel), pq.Array(delivered),
+	)
+	if err != nil {
+		componentLogger("notifications").Error(err, "Failed to record notification delivery failure", map[string]interface{}{"notification_id": c.notificationID, "channel": c.channel})
+	}
+}
+
+// backoff - Delay before the given attempt
+func (no *NotificationOutbox) backoff(attempt int) time.Duration {
+	return jitteredBackoff(no.baseBackoff, no.maxBackoff, attempt)
+}
+
+// jitteredBackoff - Exponential delay for the given attempt, capped at max, with jitter in
+// [delay/2, delay] so deliveries that failed together do not retry together
+func jitteredBackoff(base, max time.Duration, attempt int) time.Duration {
+	delay := base << uint(attempt-1)
+	if delay <= 0 || delay > max {
+		delay = max
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// GetRecord - Load a notification with its per-channel delivery state
+func (no *NotificationOutbox) GetRecord(notificationID string) (*OutboxRecord, error) {
+	msg, err := no.loadMessage(notificationID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := no.db.Query(
+		"SELECT notification_id, channel, status, attempts, delivered_to, next_attempt_at, COALESCE(last_error, ''), sent_at, updated_at FROM notification_deliveries WHERE notification_id = $1 ORDER BY channel",
+		notificationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	record := &OutboxRecord{Message: msg, Deliveries: []NotificationDelivery{}}
+	for rows.Next() {
+		var d NotificationDelivery
+		var channel, status string
+		if err := rows.Scan(&d.NotificationID, &channel, &status, &d.Attempts, pq.Array(&d.DeliveredTo), &d.NextAttemptAt, &d.LastError, &d.SentAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		d.Channel = NotificationChannel(channel)
+		d.Status = NotificationStatus(status)
+		record.Deliveries = append(record.Deliveries, d)
+	}
+
+	record.Status = overallDeliveryStatus(record.Deliveries)
+	record.Message.Status = record.Status
+	return record, nil
+}
+
+// overallDeliveryStatus - Sent once every channel is sent, failed once none can still succeed
+func overallDeliveryStatus(deliveries []NotificationDelivery) NotificationStatus {
+	sent, dead := 0, 0
+	for _, d := range deliveries {
+		switch d.Status {
+		case StatusSent:
+			sent++
+		case StatusDeadLetter:
+			dead++
+		case StatusRetrying:
+			return StatusRetrying
+		}
+	}
+	switch {
+	case len(deliveries) > 0 && sent == len(deliveries):
+		return StatusSent
+	case dead > 0 && sent+dead == len(deliveries):
+		return StatusFailed
+	default:
+		return StatusPending
+	}
+}
+
+// ListDeadLetters - Dead-lettered deliveries, most recent first
+func (no *NotificationOutbox) ListDeadLetters(limit int) ([]NotificationDelivery, error) {
+	rows, err := no.db.Query(
+		"SELECT notification_id, channel, status, attempts, COALESCE(last_error, ''), updated_at FROM notification_deliveries WHERE status = $1 ORDER BY updated_at DESC LIMIT $2",
+		string(StatusDeadLetter), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []NotificationDelivery{}
+	for rows.Next() {
+		var d NotificationDelivery
+		var channel, status string
+		if err := rows.Scan(&d.NotificationID, &channel, &status, &d.Attempts, &d.LastError, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		d.Channel = NotificationChannel(channel)
+		d.Status = NotificationStatus(status)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// PendingCount - Deliveries waiting to be sent or retried, including in-flight ones
+func (no *NotificationOutbox) PendingCount(ctx context.Context) (int, error) {
+	var count int
+	err := no.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM notification_deliveries WHERE status IN ($1, $2, $3)",
+		string(StatusPending), string(StatusRetrying), string(StatusInFlight),
+	).Scan(&count)
+	return count, err
+}
+
+// ReplayDeadLetters - Reset dead-lettered deliveries to pending; an empty ID replays all of them
+func (no *NotificationOutbox) ReplayDeadLetters(notificationID string) (int64, error) {
+	query := "UPDATE notification_deliveries SET status = $1, attempts = 0, next_attempt_at = NOW(), updated_at = NOW() WHERE status = $2"
+	args := []interface{}{string(StatusPending), string(StatusDeadLetter)}
+	if notificationID != "" {
+		query += " AND notification_id = $3"
+		args = append(args, notificationID)
+	}
+
+	result, err := no.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ========================================
+// NOTIFICATION OUTBOX HANDLERS
+// ========================================
+
+// getNotificationStatusHandler - Delivery status of a notification per channel
+func getNotificationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	record, err := notificationPipeline.outbox.GetRecord(mux.Vars(r)["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// listDeadLettersHandler - List dead-lettered deliveries; admins only, since they include payloads
+func listDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	deliveries, err := notificationPipeline.outbox.ListDeadLetters(100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dead_letters": deliveries,
+		"total_count":  len(deliveries),
+		"timestamp":    time.Now(),
+	})
+}
+
+// replayDeadLettersHandler - Requeue dead-lettered deliveries, optionally for a single notification; admins only
+func replayDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	notificationID := mux.Vars(r)["id"]
+
+	replayed, err := notificationPipeline.outbox.ReplayDeadLetters(notificationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         "Dead-lettered deliveries requeued",
+		"notification_id": notificationID,
+		"replayed":        replayed,
+		"timestamp":       time.Now(),
+	})
+}
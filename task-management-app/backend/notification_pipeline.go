@@ -9,10 +9,11 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
-	"log"
+	"net"
 	"net/http"
 	"net/smtp"
 	"strings"
@@ -20,18 +21,29 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // NotificationPipeline - Main notification pipeline
 type NotificationPipeline struct {
-	slackClient     *SlackNotifier
-	mattermostClient *MattermostNotifier
-	smtpClient      *SMTPNotifier
-	webhookClient   *WebhookNotifier
+	notifiers       map[NotificationChannel]Notifier
+	channelOrder    []NotificationChannel
+	inAppClient     *InAppNotifier
 	templateEngine  *NotificationTemplateEngine
 	router          *NotificationRouter
 	analytics       *NotificationAnalytics
-	queue           *NotificationQueue
+	throttle        *NotificationThrottle
+	outbox          *NotificationOutbox
+	preferences     *NotificationPreferenceStore
+	escalations     *NotificationEscalationStore
+}
+
+// Notifier - A delivery channel; implementations are registered by channel name
+type Notifier interface {
+	// Send delivers msg; ctx carries the delivery's trace and cancellation
+	Send(ctx context.Context, msg *NotificationMessage) error
+	IsConfigured() bool
 }
 
 // NotificationMessage - Universal notification message structure
@@ -44,13 +56,21 @@ type NotificationMessage struct {
 	Details     map[string]interface{} `json:"details,omitempty"`
 	Recipients  []string               `json:"recipients"`
 	Channels    []NotificationChannel  `json:"channels"`
+	// Per-channel recipients resolved from user preferences; channels not
+	// listed here deliver to Recipients
+	ChannelRecipients map[NotificationChannel][]string `json:"channel_recipients,omitempty"`
 	Template    string                 `json:"template,omitempty"`
 	Context     *NotificationContext   `json:"context,omitempty"`
+	Locale      string                 `json:"locale,omitempty"`
+	// Fingerprint identifies repeats of the same alert; derived when empty
+	Fingerprint string                 `json:"fingerprint,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 	SentAt      *time.Time             `json:"sent_at,omitempty"`
 	Status      NotificationStatus     `json:"status"`
 	RetryCount  int                    `json:"retry_count"`
 	Error       string                 `json:"error,omitempty"`
+	rendered    *RenderedNotification
+	summary     bool // burst summaries bypass dedup and burst grouping
 }
 
 type NotificationType string
@@ -83,6 +103,9 @@ const (
 	ChannelEmail      NotificationChannel = "email"
 	ChannelWebhook    NotificationChannel = "webhook"
 	ChannelSMS        NotificationChannel = "sms"
+	ChannelTeams      NotificationChannel = "teams"
+	ChannelDiscord    NotificationChannel = "discord"
+	ChannelInApp      NotificationChannel = "in_app"
 )
 
 type NotificationStatus string
@@ -94,6 +117,41 @@ const (
 	StatusRetrying  NotificationStatus = "retrying"
 )
 
+// ChannelResult - Outcome of submitting a notification to one channel
+type ChannelResult struct {
+	Channel   NotificationChannel `json:"channel,omitempty"`
+	Recipient string              `json:"recipient,omitempty"`
+	Status    NotificationStatus  `json:"status"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// ErrNoDeliverableChannels is returned when every requested channel was rejected
+var ErrNoDeliverableChannels = errors.New("no deliverable channels for notification")
+
+// NotificationPipelineConfig - Delivery settings for the built-in notifiers
+type NotificationPipelineConfig struct {
+	SlackWebhookURL      string
+	MattermostWebhookURL string
+	SMTPHost             string
+	SMTPPort             int
+	SMTPUsername         string
+	SMTPPassword         string
+	SMTPFrom             string
+	SMTPTLS              bool
+	WebhookURL           string
+	WebhookHeaders       map[string]string
+	TeamsWebhookURL      string
+	DiscordWebhookURL    string
+	SMSProviderURL       string
+	SMSProviderHeaders   map[string]string
+	SMSFrom              string
+	RulesFile            string
+	TemplatesDir         string
+	DefaultLocale        string
+	BaseURL              string
+	Throttle             NotificationThrottleConfig
+}
+
 // NotificationContext - Contextual information for smart routing
 type NotificationContext struct {
 	UserID      string            `json:"user_id,omitempty"`
@@ -215,38 +273,30 @@ type WebhookNotifier struct {
 	timeout time.Duration
 }
 
-// NotificationTemplateEngine - Template engine for notifications
-type NotificationTemplateEngine struct {
-	templates map[string]*template.Template
-	mutex     sync.RWMutex
-}
-
 // NotificationRouter - Intelligent routing engine
 type NotificationRouter struct {
 	rules    []RoutingRule
-	escalationRules []EscalationRule
+	escalationRules []EscalationPolicyConfig
+	config        *NotificationRulesConfig
+	configPath    string
+	configModTime time.Time
 	mutex    sync.RWMutex
 }
 
 type RoutingRule struct {
+	Name       string
 	Condition  func(*NotificationMessage) bool
 	Channels   []NotificationChannel
 	Priority   NotificationPriority
 	Recipients []string
 }
 
-// NotificationQueue - Queue for processing notifications
-type NotificationQueue struct {
-	queue   chan *NotificationMessage
-	workers int
-	stop    chan bool
-}
-
 // NotificationAnalytics - Analytics for notification performance
 type NotificationAnalytics struct {
 	sentCount     int64
 	failedCount   int64
 	avgLatency    time.Duration
+	suppressed    map[string]int64 // by reason
 	channelStats  map[NotificationChannel]*ChannelStats
 	mutex         sync.RWMutex
 }
@@ -254,31 +304,119 @@ type NotificationAnalytics struct {
 type ChannelStats struct {
 	SentCount   int64
 	FailedCount int64
+	SuppressedCount int64
 	AvgLatency  time.Duration
 	LastUsed    time.Time
 }
 
 // Initialize the notification pipeline
-func NewNotificationPipeline() *NotificationPipeline {
+func NewNotificationPipeline(db *sql.DB, config NotificationPipelineConfig) *NotificationPipeline {
 	pipeline := &NotificationPipeline{
-		slackClient:     NewSlackNotifier(),
-		mattermostClient: NewMattermostNotifier(),
-		smtpClient:      NewSMTPNotifier(),
-		webhookClient:   NewWebhookNotifier(),
+		notifiers:       make(map[NotificationChannel]Notifier),
+		inAppClient:     NewInAppNotifier(),
 		templateEngine:  NewNotificationTemplateEngine(),
 		router:          NewNotificationRouter(),
 		analytics:       NewNotificationAnalytics(),
-		queue:           NewNotificationQueue(10), // 10 workers
+		throttle:        NewNotificationThrottle(config.Throttle),
+		outbox:          NewNotificationOutbox(db, 10), // 10 workers
+		preferences:     NewNotificationPreferenceStore(db),
+		escalations:     NewNotificationEscalationStore(db),
+	}
+
+	// Configure notifiers that have settings; the rest reject deliveries
+	slack := NewSlackNotifier()
+	if config.SlackWebhookURL != "" {
+		slack.Configure(config.SlackWebhookURL)
+	}
+	mattermost := NewMattermostNotifier()
+	if config.MattermostWebhookURL != "" {
+		mattermost.Configure(config.MattermostWebhookURL)
+	}
+	smtp := NewSMTPNotifier()
+	if config.SMTPHost != "" {
+		smtp.Configure(config.SMTPHost, config.SMTPPort, config.SMTPUsername,
+			config.SMTPPassword, config.SMTPFrom, config.SMTPTLS)
+	}
+	webhook := NewWebhookNotifier()
+	if config.WebhookURL != "" {
+		webhook.Configure(config.WebhookURL, config.WebhookHeaders)
+	}
+	teams := NewTeamsNotifier()
+	if config.TeamsWebhookURL != "" {
+		teams.Configure(config.TeamsWebhookURL, config.BaseURL)
+	}
+	discord := NewDiscordNotifier()
+	if config.DiscordWebhookURL != "" {
+		discord.Configure(config.DiscordWebhookURL, config.BaseURL)
+	}
+	sms := NewSMSNotifier()
+	if config.SMSProviderURL != "" {
+		sms.Configure(NewHTTPSMSProvider(config.SMSProviderURL, config.SMSFrom, config.SMSProviderHeaders))
+	}
+	if err := pipeline.inAppClient.Configure(db); err != nil {
+		componentLogger("notifications").Error(err, "In-app notifications unavailable", nil)
 	}
 
-	// Start queue processing
-	go pipeline.queue.Start(pipeline)
+	pipeline.RegisterNotifier(ChannelSlack, slack)
+	pipeline.RegisterNotifier(ChannelMattermost, mattermost)
+	pipeline.RegisterNotifier(ChannelEmail, smtp)
+	pipeline.RegisterNotifier(ChannelWebhook, webhook)
+	pipeline.RegisterNotifier(ChannelTeams, teams)
+	pipeline.RegisterNotifier(ChannelDiscord, discord)
+	pipeline.RegisterNotifier(ChannelSMS, sms)
+	pipeline.RegisterNotifier(ChannelInApp, pipeline.inAppClient)
+
+	// File-based templates, reloaded when the directory changes
+	if err := pipeline.templateEngine.Configure(config.TemplatesDir, config.DefaultLocale, config.BaseURL); err != nil {
+		componentLogger("notifications").Error(err, "Failed to load notification templates", nil)
+	}
+	if config.TemplatesDir != "" {
+		go pipeline.templateEngine.WatchTemplates(10 * time.Second)
+	}
+
+	// Declarative routing and escalation rules, reloaded when the file changes
+	if config.RulesFile != "" {
+		if err := pipeline.router.LoadRules(config.RulesFile); err != nil {
+			componentLogger("notifications").Error(err, "Failed to load notification rules", nil)
+		}
+		go pipeline.router.WatchRules(30 * time.Second)
+	}
+
+	// Start outbox processing once its tables are in place
+	if err := pipeline.outbox.EnsureSchema(); err != nil {
+		componentLogger("notifications").Error(err, "Notification outbox unavailable", nil)
+		pipeline.escalations = nil
+	} else {
+		pipeline.outbox.Start(pipeline)
+
+		if err := pipeline.escalations.EnsureSchema(); err != nil {
+			componentLogger("notifications").Error(err, "Notification escalations unavailable", nil)
+			pipeline.escalations = nil
+		} else {
+			go pipeline.StartEscalationScheduler(30 * time.Second)
+		}
+	}
+
+	// Burst summaries go out once their grouping window closes
+	if config.Throttle.BurstWindow > 0 {
+		go pipeline.StartBurstSummaries(10 * time.Second)
+	}
+
+	// Per-user preferences; without them messages go out exactly as requested
+	if err := pipeline.preferences.EnsureSchema(); err != nil {
+		componentLogger("notifications").Error(err, "Notification preferences unavailable", nil)
+		pipeline.preferences = nil
+	} else {
+		go pipeline.StartDigestScheduler(5 * time.Minute)
+	}
 
 	return pipeline
 }
 
 // SendNotification - Main method to send notifications
-func (np *NotificationPipeline) SendNotification(ctx context.Context, msg *NotificationMessage) error {
+// Channels that cannot accept the message are reported as failed and skipped;
+// the rest are queued in the outbox and reported as pending.
+func (np *NotificationPipeline) SendNotification(ctx context.Context, msg *NotificationMessage) ([]ChannelResult, error) {
 	// Set message ID if not provided
 	if msg.ID == "" {
 		msg.ID = uuid.New().String()
@@ -289,82 +427,161 @@ func (np *NotificationPipeline) SendNotification(ctx context.Context, msg *Notif
 		msg.CreatedAt = time.Now()
 	}
 
-	// Apply intelligent routing
+	// Drop repeats and hold back bursts before doing any work
+	now := time.Now()
+	if !msg.summary {
+		if reason := np.throttle.Admit(msg, now); reason != "" {
+			np.analytics.RecordSuppressed(reason, "")
+			msg.Status = StatusSuppressed
+			return []ChannelResult{{Status: StatusSuppressed, Error: reason}}, nil
+		}
+	}
+
+	// Apply intelligent routing, then recipients' own preferences and rate limits
 	routedMsg := np.router.RouteNotification(msg)
+	preferenceResults := np.applyPreferences(routedMsg)
+	preferenceResults = append(preferenceResults, np.applyThrottle(routedMsg, now)...)
+	if routedMsg.Locale == "" {
+		routedMsg.Locale = np.resolveLocale(routedMsg)
+	}
+
+	results := make([]ChannelResult, 0, len(routedMsg.Channels)+len(preferenceResults))
+	accepted := make([]NotificationChannel, 0, len(routedMsg.Channels))
+	seen := make(map[NotificationChannel]bool)
+	for _, channel := range routedMsg.Channels {
+		if seen[channel] {
+			continue
+		}
+		seen[channel] = true
 
-	// Queue for processing
-	select {
-	case np.queue.queue <- routedMsg:
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
-		return fmt.Errorf("notification queue is full")
+		if err := np.validateChannel(routedMsg, channel); err != nil {
+			results = append(results, ChannelResult{Channel: channel, Status: StatusFailed, Error: err.Error()})
+			continue
+		}
+		accepted = append(accepted, channel)
+		results = append(results, ChannelResult{Channel: channel, Status: StatusPending})
 	}
-}
 
-// Process notification from queue
-func (np *NotificationPipeline) processNotification(msg *NotificationMessage) {
-	start := time.Now()
+	results = append(results, preferenceResults...)
 
-	// Apply template if specified
-	if msg.Template != "" {
-		if err := np.templateEngine.ApplyTemplate(msg); err != nil {
-			log.Printf("Failed to apply template %s: %v", msg.Template, err)
-			np.updateNotificationStatus(msg, StatusFailed, err.Error())
-			return
+	if len(accepted) == 0 {
+		// Everyone opted out or is in quiet hours; nothing to deliver right now
+		if len(preferenceResults) > 0 && len(results) == len(preferenceResults) {
+			msg.Status = StatusSuppressed
+			for _, result := range preferenceResults {
+				if result.Status == StatusHeld {
+					msg.Status = StatusHeld
+				}
+			}
+			return results, nil
 		}
+		return results, ErrNoDeliverableChannels
 	}
+	routedMsg.Channels = accepted
 
-	// Send to all specified channels
-	var lastError error
-	sentCount := 0
+	// Persist to the outbox; delivery workers pick it up from there
+	if err := np.outbox.Enqueue(ctx, routedMsg); err != nil {
+		return nil, err
+	}
+	np.trackEscalation(routedMsg)
 
-	for _, channel := range msg.Channels {
-		if err := np.sendToChannel(msg, channel); err != nil {
-			log.Printf("Failed to send to %s: %v", channel, err)
-			lastError = err
-			msg.RetryCount++
-		} else {
-			sentCount++
+	msg.Status = routedMsg.Status
+	return results, nil
+}
+
+// Check that a channel is configured and the message can be delivered on it
+func (np *NotificationPipeline) validateChannel(msg *NotificationMessage, channel NotificationChannel) error {
+	if msg.Template != "" && !np.templateEngine.HasTemplate(msg.Template) {
+		return fmt.Errorf("template %s not found", msg.Template)
+	}
+	if !np.IsChannelConfigured(channel) {
+		return fmt.Errorf("channel %s is not configured", channel)
+	}
+	if channel == ChannelEmail && len(msg.Recipients) == 0 {
+		return fmt.Errorf("email requires at least one recipient")
+	}
+	if channel == ChannelInApp && len(msg.Recipients) == 0 && (msg.Context == nil || msg.Context.UserID == "") {
+		return fmt.Errorf("in_app requires at least one recipient")
+	}
+	if channel == ChannelSMS {
+		for _, recipient := range msg.Recipients {
+			if phoneNumberPattern.MatchString(recipient) {
+				return nil
+			}
 		}
+		return fmt.Errorf("sms requires at least one E.164 phone number recipient")
 	}
+	return nil
+}
 
-	// Update status
-	if sentCount > 0 {
-		msg.Status = StatusSent
-		msg.SentAt = &start
-		np.analytics.RecordSuccess(msg.Channels, time.Since(start))
-	} else {
-		msg.Status = StatusFailed
-		if lastError != nil {
-			msg.Error = lastError.Error()
+// RegisterNotifier - Plug a notifier in under a channel name, replacing any existing one
+func (np *NotificationPipeline) RegisterNotifier(channel NotificationChannel, notifier Notifier) {
+	if _, exists := np.notifiers[channel]; !exists {
+		np.channelOrder = append(np.channelOrder, channel)
+	}
+	np.notifiers[channel] = notifier
+}
+
+// IsChannelConfigured - Whether deliveries on a channel can succeed
+func (np *NotificationPipeline) IsChannelConfigured(channel NotificationChannel) bool {
+	notifier, ok := np.notifiers[channel]
+	return ok && notifier.IsConfigured()
+}
+
+// ConfiguredChannels - Channels with delivery settings, used when a message names none
+func (np *NotificationPipeline) ConfiguredChannels() []NotificationChannel {
+	channels := make([]NotificationChannel, 0, len(np.channelOrder))
+	for _, channel := range np.channelOrder {
+		if np.IsChannelConfigured(channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// Deliver a stored notification to a single channel
+func (np *NotificationPipeline) deliver(ctx context.Context, msg *NotificationMessage, channel NotificationChannel) error {
+	start := time.Now()
+
+	// Narrow recipients to the ones resolved for this channel
+	if recipients, ok := msg.ChannelRecipients[channel]; ok {
+		channelMsg := *msg
+		channelMsg.Recipients = recipients
+		msg = &channelMsg
+	}
+
+	// Apply template if specified
+	if msg.Template != "" {
+		if err := np.templateEngine.ApplyTemplate(msg); err != nil {
+			np.analytics.RecordFailure([]NotificationChannel{channel}, time.Since(start))
+			return fmt.Errorf("failed to apply template %s: %v", msg.Template, err)
 		}
-		np.analytics.RecordFailure(msg.Channels)
 	}
 
-	// Handle retries for failed messages
-	if msg.Status == StatusFailed && msg.RetryCount < 3 {
-		msg.Status = StatusRetrying
-		time.Sleep(time.Duration(msg.RetryCount) * time.Minute)
-		np.queue.queue <- msg
+	if err := np.sendToChannel(ctx, msg, channel); err != nil {
+		np.analytics.RecordFailure([]NotificationChannel{channel}, time.Since(start))
+		return err
 	}
+
+	np.analytics.RecordSuccess([]NotificationChannel{channel}, time.Since(start))
+	return nil
 }
 
 // Send to specific channel
-func (np *NotificationPipeline) sendToChannel(msg *NotificationMessage, channel NotificationChannel) error {
-	switch channel {
-	case ChannelSlack:
-		return np.slackClient.Send(msg)
-	case ChannelMattermost:
-		return np.mattermostClient.Send(msg)
-	case ChannelEmail:
-		return np.smtpClient.Send(msg)
-	case ChannelWebhook:
-		return np.webhookClient.Send(msg)
-	default:
+func (np *NotificationPipeline) sendToChannel(ctx context.Context, msg *NotificationMessage, channel NotificationChannel) error {
+	notifier, ok := np.notifiers[channel]
+	if !ok {
 		return fmt.Errorf("unsupported channel: %s", channel)
 	}
+
+	ctx, span := tracer.Start(ctx, "notifier.Send", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("notification.channel", string(channel)),
+		attribute.String("notification.type", string(msg.Type)),
+		attribute.Int("notification.recipients", len(msg.Recipients)),
+	))
+	err := notifier.Send(ctx, msg)
+	endSpan(span, err)
+	return err
 }
 
 // Update notification status
@@ -376,26 +593,30 @@ func (np *NotificationPipeline) updateNotificationStatus(msg *NotificationMessag
 }
 
 // Slack implementation
-func (sn *SlackNotifier) Send(msg *NotificationMessage) error {
+func (sn *SlackNotifier) Send(ctx context.Context, msg *NotificationMessage) error {
 	if sn.webhookURL == "" {
 		return fmt.Errorf("slack webhook URL not configured")
 	}
 
-	slackMsg := sn.convertToSlackMessage(msg)
-
-	jsonData, err := json.Marshal(slackMsg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal slack message: %v", err)
+	// Templates may supply a complete payload with blocks
+	var jsonData []byte
+	if msg.rendered != nil && len(msg.rendered.Slack) > 0 {
+		jsonData = msg.rendered.Slack
+	} else {
+		var err error
+		jsonData, err = json.Marshal(sn.convertToSlackMessage(msg))
+		if err != nil {
+			return fmt.Errorf("failed to marshal slack message: %v", err)
+		}
 	}
 
-	req, err := http.NewRequest("POST", sn.webhookURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", sn.webhookURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: sn.timeout}
-	resp, err := client.Do(req)
+	resp, err := sn.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send slack message: %v", err)
 	}
@@ -457,26 +678,28 @@ func (sn *SlackNotifier) convertDetailsToFields(details map[string]interface{})
 }
 
 // Mattermost implementation
-func (mn *MattermostNotifier) Send(msg *NotificationMessage) error {
+func (mn *MattermostNotifier) Send(ctx context.Context, msg *NotificationMessage) error {
 	if mn.webhookURL == "" {
 		return fmt.Errorf("mattermost webhook URL not configured")
 	}
 
-	mattermostMsg := mn.convertToMattermostMessage(msg)
+	mattermostMsg, err := mn.convertToMattermostMessage(msg)
+	if err != nil {
+		return err
+	}
 
 	jsonData, err := json.Marshal(mattermostMsg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal mattermost message: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", mn.webhookURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", mn.webhookURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: mn.timeout}
-	resp, err := client.Do(req)
+	resp, err := mn.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send mattermost message: %v", err)
 	}
@@ -489,7 +712,7 @@ func (mn *MattermostNotifier) Send(msg *NotificationMessage) error {
 	return nil
 }
 
-func (mn *MattermostNotifier) convertToMattermostMessage(msg *NotificationMessage) *MattermostMessage {
+func (mn *MattermostNotifier) convertToMattermostMessage(msg *NotificationMessage) (*MattermostMessage, error) {
 	color := mn.getColorForPriority(msg.Priority)
 
 	attachment := MattermostAttachment{
@@ -501,11 +724,18 @@ func (mn *MattermostNotifier) convertToMattermostMessage(msg *NotificationMessag
 		Footer:   "Task Management AI System",
 	}
 
+	// Templates may supply the attachment; unset fields keep the defaults above
+	if msg.rendered != nil && len(msg.rendered.Mattermost) > 0 {
+		if err := json.Unmarshal(msg.rendered.Mattermost, &attachment); err != nil {
+			return nil, fmt.Errorf("invalid mattermost attachment template: %v", err)
+		}
+	}
+
 	return &MattermostMessage{
 		Text:        fmt.Sprintf("**%s**", msg.Title),
 		Username:    "Task Management AI",
 		Attachments: []MattermostAttachment{attachment},
-	}
+	}, nil
 }
 
 func (mn *MattermostNotifier) getColorForPriority(priority NotificationPriority) string {
@@ -536,14 +766,14 @@ func (mn *MattermostNotifier) convertDetailsToFields(details map[string]interfac
 }
 
 // SMTP implementation
-func (sn *SMTPNotifier) Send(msg *NotificationMessage) error {
+func (sn *SMTPNotifier) Send(ctx context.Context, msg *NotificationMessage) error {
 	if sn.host == "" {
 		return fmt.Errorf("SMTP host not configured")
 	}
 
 	emailMsg := sn.convertToEmailMessage(msg)
 
-	return sn.sendEmail(emailMsg)
+	return sn.sendEmail(ctx, emailMsg)
 }
 
 func (sn *SMTPNotifier) convertToEmailMessage(msg *NotificationMessage) *EmailMessage {
@@ -584,6 +814,18 @@ Sent at: %s
 		msg.CreatedAt.Format(time.RFC3339),
 	)
 
+	if rendered := msg.rendered; rendered != nil {
+		if rendered.EmailSubject != "" {
+			subject = rendered.EmailSubject
+		}
+		if rendered.EmailText != "" {
+			body = rendered.EmailText
+		}
+		if rendered.EmailHTML != "" {
+			htmlBody = rendered.EmailHTML
+		}
+	}
+
 	return &EmailMessage{
 		To:       msg.Recipients,
 		Subject:  subject,
@@ -616,14 +858,22 @@ func (sn *SMTPNotifier) formatDetailsHTML(details map[string]interface{}) string
 	return "<ul>" + strings.Join(lines, "") + "</ul>"
 }
 
-func (sn *SMTPNotifier) sendEmail(msg *EmailMessage) error {
+func (sn *SMTPNotifier) sendEmail(ctx context.Context, msg *EmailMessage) error {
 	// Set up authentication
 	auth := smtp.PlainAuth("", sn.username, sn.password, sn.host)
 
-	// Connect to the server
+	// Connect to the server; the session is bounded by the delivery's context
 	addr := fmt.Sprintf("%s:%d", sn.host, sn.port)
-	client, err := smtp.Dial(addr)
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, sn.host)
 	if err != nil {
+		conn.Close()
 		return fmt.Errorf("failed to connect to SMTP server: %v", err)
 	}
 	defer client.Close()
@@ -713,17 +963,24 @@ func (sn *SMTPNotifier) buildEmailMessage(msg *EmailMessage) string {
 }
 
 // Webhook implementation
-func (wn *WebhookNotifier) Send(msg *NotificationMessage) error {
+func (wn *WebhookNotifier) Send(ctx context.Context, msg *NotificationMessage) error {
 	if wn.url == "" {
 		return fmt.Errorf("webhook URL not configured")
 	}
 
-	jsonData, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal webhook message: %v", err)
+	// Templates may supply the JSON body; otherwise the message itself is sent
+	var jsonData []byte
+	if msg.rendered != nil && len(msg.rendered.Webhook) > 0 {
+		jsonData = msg.rendered.Webhook
+	} else {
+		var err error
+		jsonData, err = json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal webhook message: %v", err)
+		}
 	}
 
-	req, err := http.NewRequest("POST", wn.url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", wn.url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create webhook request: %v", err)
 	}
@@ -733,8 +990,7 @@ func (wn *WebhookNotifier) Send(msg *NotificationMessage) error {
 		req.Header.Set(key, value)
 	}
 
-	client := &http.Client{Timeout: wn.timeout}
-	resp, err := client.Do(req)
+	resp, err := wn.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send webhook: %v", err)
 	}
@@ -747,29 +1003,13 @@ func (wn *WebhookNotifier) Send(msg *NotificationMessage) error {
 	return nil
 }
 
-// Template engine implementation
-func (nte *NotificationTemplateEngine) ApplyTemplate(msg *NotificationMessage) error {
-	nte.mutex.RLock()
-	tmpl, exists := nte.templates[msg.Template]
-	nte.mutex.RUnlock()
-
-	if !exists {
-		return fmt.Errorf("template %s not found", msg.Template)
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, msg); err != nil {
-		return fmt.Errorf("failed to execute template: %v", err)
-	}
-
-	msg.Message = buf.String()
-	return nil
-}
-
 // Router implementation
 func (nr *NotificationRouter) RouteNotification(msg *NotificationMessage) *NotificationMessage {
 	routedMsg := *msg // Create a copy
 
+	nr.mutex.RLock()
+	defer nr.mutex.RUnlock()
+
 	for _, rule := range nr.rules {
 		if rule.Condition(msg) {
 			// Add channels if not already present
@@ -810,48 +1050,21 @@ func (nr *NotificationRouter) RouteNotification(msg *NotificationMessage) *Notif
 	return &routedMsg
 }
 
-func (nr *NotificationRouter) comparePriority(p1, p2 NotificationPriority) int {
-	priorityOrder := map[NotificationPriority]int{
-		PriorityLow:      0,
-		PriorityNormal:   1,
-		PriorityHigh:     2,
-		PriorityCritical: 3,
-	}
-
-	return priorityOrder[p1] - priorityOrder[p2]
-}
-
-// Queue implementation
-func NewNotificationQueue(workers int) *NotificationQueue {
-	return &NotificationQueue{
-		queue:   make(chan *NotificationMessage, 1000),
-		workers: workers,
-		stop:    make(chan bool),
-	}
+var notificationPriorityOrder = map[NotificationPriority]int{
+	PriorityLow:      0,
+	PriorityNormal:   1,
+	PriorityHigh:     2,
+	PriorityCritical: 3,
 }
 
-func (nq *NotificationQueue) Start(pipeline *NotificationPipeline) {
-	for i := 0; i < nq.workers; i++ {
-		go func() {
-			for {
-				select {
-				case msg := <-nq.queue:
-					pipeline.processNotification(msg)
-				case <-nq.stop:
-					return
-				}
-			}
-		}()
-	}
-}
-
-func (nq *NotificationQueue) Stop() {
-	close(nq.stop)
+func (nr *NotificationRouter) comparePriority(p1, p2 NotificationPriority) int {
+	return notificationPriorityOrder[p1] - notificationPriorityOrder[p2]
 }
 
 // Analytics implementation
 func NewNotificationAnalytics() *NotificationAnalytics {
 	return &NotificationAnalytics{
+		suppressed:   make(map[string]int64),
 		channelStats: make(map[NotificationChannel]*ChannelStats),
 	}
 }
@@ -862,6 +1075,8 @@ func (na *NotificationAnalytics) RecordSuccess(channels []NotificationChannel, l
 
 	na.sentCount++
 	for _, channel := range channels {
+		notificationsSentTotal.WithLabelValues(string(channel)).Inc()
+		notificationDeliveryDuration.WithLabelValues(string(channel), "sent").Observe(latency.Seconds())
 		if stats, exists := na.channelStats[channel]; exists {
 			stats.SentCount++
 			stats.LastUsed = time.Now()
@@ -881,12 +1096,14 @@ func (na *NotificationAnalytics) RecordSuccess(channels []NotificationChannel, l
 	}
 }
 
-func (na *NotificationAnalytics) RecordFailure(channels []NotificationChannel) {
+func (na *NotificationAnalytics) RecordFailure(channels []NotificationChannel, latency time.Duration) {
 	na.mutex.Lock()
 	defer na.mutex.Unlock()
 
 	na.failedCount++
 	for _, channel := range channels {
+		notificationsFailedTotal.WithLabelValues(string(channel)).Inc()
+		notificationDeliveryDuration.WithLabelValues(string(channel), "failed").Observe(latency.Seconds())
 		if stats, exists := na.channelStats[channel]; exists {
 			stats.FailedCount++
 		} else {
@@ -898,6 +1115,22 @@ func (na *NotificationAnalytics) RecordFailure(channels []NotificationChannel) {
 	}
 }
 
+// RecordSuppressed - Count a suppression; channel is empty when the whole message was dropped
+func (na *NotificationAnalytics) RecordSuppressed(reason string, channel NotificationChannel) {
+	na.mutex.Lock()
+	defer na.mutex.Unlock()
+
+	na.suppressed[reason]++
+	if channel != "" {
+		if stats, exists := na.channelStats[channel]; exists {
+			stats.SuppressedCount++
+		} else {
+			na.channelStats[channel] = &ChannelStats{SuppressedCount: 1}
+		}
+	}
+	notificationsSuppressedTotal.WithLabelValues(reason, string(channel)).Inc()
+}
+
 // Constructor functions
 func NewSlackNotifier() *SlackNotifier {
 	return &SlackNotifier{
@@ -925,28 +1158,22 @@ func NewWebhookNotifier() *WebhookNotifier {
 	}
 }
 
-func NewNotificationTemplateEngine() *NotificationTemplateEngine {
-	return &NotificationTemplateEngine{
-		templates: make(map[string]*template.Template),
-	}
-}
-
 func NewNotificationRouter() *NotificationRouter {
 	return &NotificationRouter{
 		rules:          make([]RoutingRule, 0),
-		escalationRules: make([]EscalationRule, 0),
+		escalationRules: make([]EscalationPolicyConfig, 0),
 	}
 }
 
 // Configuration methods
 func (sn *SlackNotifier) Configure(webhookURL string) {
 	sn.webhookURL = webhookURL
-	sn.client = &http.Client{Timeout: sn.timeout}
+	sn.client = newTracedHTTPClient(sn.timeout)
 }
 
 func (mn *MattermostNotifier) Configure(webhookURL string) {
 	mn.webhookURL = webhookURL
-	mn.client = &http.Client{Timeout: mn.timeout}
+	mn.client = newTracedHTTPClient(mn.timeout)
 }
 
 func (sn *SMTPNotifier) Configure(host string, port int, username, password, from string, tls bool) {
@@ -961,7 +1188,23 @@ func (sn *SMTPNotifier) Configure(host string, port int, username, password, fro
 func (wn *WebhookNotifier) Configure(url string, headers map[string]string) {
 	wn.url = url
 	wn.headers = headers
-	wn.client = &http.Client{Timeout: wn.timeout}
+	wn.client = newTracedHTTPClient(wn.timeout)
+}
+
+func (sn *SlackNotifier) IsConfigured() bool {
+	return sn.webhookURL != ""
+}
+
+func (mn *MattermostNotifier) IsConfigured() bool {
+	return mn.webhookURL != ""
+}
+
+func (sn *SMTPNotifier) IsConfigured() bool {
+	return sn.host != ""
+}
+
+func (wn *WebhookNotifier) IsConfigured() bool {
+	return wn.url != ""
 }
 
 // This notification pipeline provides comprehensive multi-channel notification support
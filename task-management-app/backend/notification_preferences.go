@@ -0,0 +1,702 @@
+package main
+
+// Per-user notification preferences
+// Users choose channels per notification type, a minimum priority and quiet
+// hours in their own timezone. Non-critical messages arriving during quiet
+// hours are held in PostgreSQL and delivered later as an hourly or daily
+// digest email. Critical messages always go out immediately. Only the user
+// themselves or an admin can read or change a user's preferences and held
+// messages.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	StatusHeld       NotificationStatus = "held"
+	StatusSuppressed NotificationStatus = "suppressed"
+)
+
+type DigestFrequency string
+
+const (
+	DigestHourly DigestFrequency = "hourly"
+	DigestDaily  DigestFrequency = "daily"
+)
+
+// NotificationPreferenceStore - PostgreSQL-backed per-user notification preferences
+type NotificationPreferenceStore struct {
+	db *sql.DB
+}
+
+// UserNotificationPreferences - How and when a user wants to be notified
+type UserNotificationPreferences struct {
+	UserID          string                                     `json:"user_id"`
+	Channels        map[NotificationType][]NotificationChannel `json:"channels"`
+	MinPriority     NotificationPriority                       `json:"min_priority"`
+	TimeZone        string                                     `json:"timezone"`
+	QuietHours      *DoNotDisturbSettings                      `json:"quiet_hours,omitempty"`
+	DigestFrequency DigestFrequency                            `json:"digest_frequency"`
+	DigestHour      int                                        `json:"digest_hour"`
+	UpdatedAt       *time.Time                                 `json:"updated_at,omitempty"`
+}
+
+// HeldNotification - A message held back during quiet hours, awaiting a digest
+type HeldNotification struct {
+	ID      int64                `json:"id"`
+	UserID  string               `json:"user_id"`
+	Message *NotificationMessage `json:"message"`
+	HeldAt  time.Time            `json:"held_at"`
+}
+
+const notificationPreferencesSchema = `
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  user_id VARCHAR(50) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  channels JSONB NOT NULL DEFAULT '{}',
+  min_priority VARCHAR(20) NOT NULL DEFAULT 'low',
+  timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+  quiet_hours JSONB,
+  digest_frequency VARCHAR(10) NOT NULL DEFAULT 'hourly',
+  digest_hour INTEGER NOT NULL DEFAULT 8,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS notification_held (
+  id SERIAL PRIMARY KEY,
+  user_id VARCHAR(50) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  payload JSONB NOT NULL,
+  held_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  digest_id VARCHAR(50)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_held_pending ON notification_held(user_id, held_at) WHERE digest_id IS NULL;
+`
+
+// NewNotificationPreferenceStore - Create a preference store backed by PostgreSQL
+func NewNotificationPreferenceStore(db *sql.DB) *NotificationPreferenceStore {
+	return &NotificationPreferenceStore{db: db}
+}
+
+// EnsureSchema - Create preference and held-message tables if missing
+func (ps *NotificationPreferenceStore) EnsureSchema() error {
+	if ps.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	_, err := ps.db.Exec(notificationPreferencesSchema)
+	return err
+}
+
+// defaultNotificationPreferences - Preferences for users who never saved any
+func defaultNotificationPreferences(userID string) *UserNotificationPreferences {
+	return &UserNotificationPreferences{
+		UserID:          userID,
+		Channels:        map[NotificationType][]NotificationChannel{},
+		MinPriority:     PriorityLow,
+		TimeZone:        "UTC",
+		DigestFrequency: DigestHourly,
+		DigestHour:      8,
+	}
+}
+
+// Get - Load a user's preferences, falling back to defaults; sql.ErrNoRows if the user does not exist
+func (ps *NotificationPreferenceStore) Get(userID string) (*UserNotificationPreferences, error) {
+	prefs := defaultNotificationPreferences(userID)
+	var channels, quietHours []byte
+	var minPriority, digestFrequency string
+
+	err := ps.db.QueryRow(`
+		SELECT COALESCE(p.channels, '{}'), COALESCE(p.min_priority, 'low'), COALESCE(p.timezone, 'UTC'),
+		       p.quiet_hours, COALESCE(p.digest_frequency, 'hourly'), COALESCE(p.digest_hour, 8), p.updated_at
+		FROM users u LEFT JOIN notification_preferences p ON p.user_id = u.id
+		WHERE u.id = $1`,
+		userID,
+	).Scan(&channels, &minPriority, &prefs.TimeZone, &quietHours, &digestFrequency, &prefs.DigestHour, &prefs.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs.MinPriority = NotificationPriority(minPriority)
+	prefs.DigestFrequency = DigestFrequency(digestFrequency)
+	if err := json.Unmarshal(channels, &prefs.Channels); err != nil {
+		return nil, fmt.Errorf("invalid stored channels: %v", err)
+	}
+	if quietHours != nil {
+		prefs.QuietHours = &DoNotDisturbSettings{}
+		if err := json.Unmarshal(quietHours, prefs.QuietHours); err != nil {
+			return nil, fmt.Errorf("invalid stored quiet hours: %v", err)
+		}
+	}
+	return prefs, nil
+}
+
+// Save - Upsert a user's preferences; call Validate first
+func (ps *NotificationPreferenceStore) Save(prefs *UserNotificationPreferences) error {
+	channels, err := json.Marshal(prefs.Channels)
+	if err != nil {
+		return err
+	}
+	var quietHours []byte
+	if prefs.QuietHours != nil {
+		if quietHours, err = json.Marshal(prefs.QuietHours); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	_, err = ps.db.Exec(`
+		INSERT INTO notification_preferences (user_id, channels, min_priority, timezone, quiet_hours, digest_frequency, digest_hour, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE SET
+		  channels = EXCLUDED.channels, min_priority = EXCLUDED.min_priority, timezone = EXCLUDED.timezone,
+		  quiet_hours = EXCLUDED.quiet_hours, digest_frequency = EXCLUDED.digest_frequency,
+		  digest_hour = EXCLUDED.digest_hour, updated_at = EXCLUDED.updated_at`,
+		prefs.UserID, channels, string(prefs.MinPriority), prefs.TimeZone, quietHours,
+		string(prefs.DigestFrequency), prefs.DigestHour, now,
+	)
+	if err != nil {
+		return err
+	}
+	prefs.UpdatedAt = &now
+	return nil
+}
+
+// ResolveUsers - Map recipients that are user IDs or user emails to their users
+func (ps *NotificationPreferenceStore) ResolveUsers(recipients []string) (map[string]*User, error) {
+	rows, err := ps.db.Query(
+		"SELECT id, username, email, role, created_at FROM users WHERE id = ANY($1) OR email = ANY($1)",
+		pq.Array(recipients),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[string]*User)
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users[user.ID] = &user
+		users[user.Email] = &user
+	}
+	return users, nil
+}
+
+// LookupLocale - Profile locale of the first candidate (user ID or email) that has one
+func (ps *NotificationPreferenceStore) LookupLocale(candidates []string) (string, error) {
+	rows, err := ps.db.Query(
+		"SELECT id, email, locale FROM users WHERE (id = ANY($1) OR email = ANY($1)) AND COALESCE(locale, '') <> ''",
+		pq.Array(candidates),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	locales := make(map[string]string)
+	for rows.Next() {
+		var id, email, locale string
+		if err := rows.Scan(&id, &email, &locale); err != nil {
+			return "", err
+		}
+		locales[id] = locale
+		locales[email] = locale
+	}
+
+	for _, candidate := range candidates {
+		if locale, ok := locales[candidate]; ok {
+			return locale, nil
+		}
+	}
+	return "", nil
+}
+
+// Hold - Park a message for a user until their next digest
+func (ps *NotificationPreferenceStore) Hold(userID string, msg *NotificationMessage) error {
+	msg.Status = StatusHeld
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %v", err)
+	}
+	_, err = ps.db.Exec(
+		"INSERT INTO notification_held (user_id, payload, held_at) VALUES ($1, $2, $3)",
+		userID, payload, time.Now(),
+	)
+	return err
+}
+
+// ListHeld - Messages held for a user that have not been included in a digest yet
+func (ps *NotificationPreferenceStore) ListHeld(userID string) ([]HeldNotification, error) {
+	rows, err := ps.db.Query(
+		"SELECT id, user_id, payload, held_at FROM notification_held WHERE user_id = $1 AND digest_id IS NULL ORDER BY held_at",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	held := []HeldNotification{}
+	for rows.Next() {
+		var h HeldNotification
+		var payload []byte
+		if err := rows.Scan(&h.ID, &h.UserID, &payload, &h.HeldAt); err != nil {
+			return nil, err
+		}
+		h.Message = &NotificationMessage{}
+		if err := json.Unmarshal(payload, h.Message); err != nil {
+			return nil, err
+		}
+		held = append(held, h)
+	}
+	return held, nil
+}
+
+// oldestHeld - Earliest pending held message per user
+func (ps *NotificationPreferenceStore) oldestHeld() (map[string]time.Time, error) {
+	rows, err := ps.db.Query("SELECT user_id, MIN(held_at) FROM notification_held WHERE digest_id IS NULL GROUP BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	oldest := make(map[string]time.Time)
+	for rows.Next() {
+		var userID string
+		var heldAt time.Time
+		if err := rows.Scan(&userID, &heldAt); err != nil {
+			return nil, err
+		}
+		oldest[userID] = heldAt
+	}
+	return oldest, nil
+}
+
+// markDigested - Attach held messages to the digest that delivered them
+func (ps *NotificationPreferenceStore) markDigested(ids []int64, digestID string) error {
+	_, err := ps.db.Exec(
+		"UPDATE notification_held SET digest_id = $1 WHERE id = ANY($2)",
+		digestID, pq.Array(ids),
+	)
+	return err
+}
+
+// Validate - Check preference values before saving
+func (p *UserNotificationPreferences) Validate() error {
+	if _, ok := notificationPriorityOrder[p.MinPriority]; !ok {
+		return fmt.Errorf("invalid min_priority: %s", p.MinPriority)
+	}
+	if _, err := time.LoadLocation(p.TimeZone); err != nil {
+		return fmt.Errorf("invalid timezone: %s", p.TimeZone)
+	}
+	if p.DigestFrequency != DigestHourly && p.DigestFrequency != DigestDaily {
+		return fmt.Errorf("invalid digest_frequency: %s", p.DigestFrequency)
+	}
+	if p.DigestHour < 0 || p.DigestHour > 23 {
+		return fmt.Errorf("digest_hour must be between 0 and 23")
+	}
+	if p.QuietHours != nil {
+		if _, err := time.Parse("15:04", p.QuietHours.StartTime); err != nil {
+			return fmt.Errorf("invalid quiet_hours start_time: %s", p.QuietHours.StartTime)
+		}
+		if _, err := time.Parse("15:04", p.QuietHours.EndTime); err != nil {
+			return fmt.Errorf("invalid quiet_hours end_time: %s", p.QuietHours.EndTime)
+		}
+	}
+	return nil
+}
+
+func (p *UserNotificationPreferences) location() *time.Location {
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Allows - Whether a message of this priority should reach the user at all
+func (p *UserNotificationPreferences) Allows(priority NotificationPriority) bool {
+	if priority == PriorityCritical || p.MinPriority == "" {
+		return true
+	}
+	return notificationPriorityOrder[priority] >= notificationPriorityOrder[p.MinPriority]
+}
+
+// ChannelsFor - The user's channels for a notification type, or the fallback if unset
+func (p *UserNotificationPreferences) ChannelsFor(notificationType NotificationType, fallback []NotificationChannel) []NotificationChannel {
+	if channels, ok := p.Channels[notificationType]; ok {
+		return channels
+	}
+	return fallback
+}
+
+// InQuietHours - Whether quiet hours apply to a message of this type at the given instant
+func (p *UserNotificationPreferences) InQuietHours(now time.Time, notificationType NotificationType) bool {
+	q := p.QuietHours
+	if q == nil || !q.Enabled {
+		return false
+	}
+	if q.OverrideUntil != nil && now.Before(*q.OverrideUntil) {
+		return false
+	}
+	for _, exception := range q.Exceptions {
+		if exception == string(notificationType) {
+			return false
+		}
+	}
+
+	start, err := time.Parse("15:04", q.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", q.EndTime)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(p.location())
+	minute := local.Hour()*60 + local.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	// Windows that cross midnight belong to the day they started on
+	day := local
+	var quiet bool
+	if startMinute <= endMinute {
+		quiet = minute >= startMinute && minute < endMinute
+	} else {
+		quiet = minute >= startMinute || minute < endMinute
+		if minute < endMinute {
+			day = local.AddDate(0, 0, -1)
+		}
+	}
+	if !quiet || len(q.DaysOfWeek) == 0 {
+		return quiet
+	}
+
+	weekday := day.Weekday().String()
+	for _, d := range q.DaysOfWeek {
+		if strings.EqualFold(d, weekday) || strings.EqualFold(d, weekday[:3]) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastDigestBoundary - Most recent instant at which a digest was due for this user
+func (p *UserNotificationPreferences) lastDigestBoundary(now time.Time) time.Time {
+	loc := p.location()
+	local := now.In(loc)
+	if p.DigestFrequency == DigestDaily {
+		boundary := time.Date(local.Year(), local.Month(), local.Day(), p.DigestHour, 0, 0, 0, loc)
+		if local.Before(boundary) {
+			boundary = boundary.AddDate(0, 0, -1)
+		}
+		return boundary
+	}
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+}
+
+// applyPreferences - Narrow a message to what its user recipients want right now.
+// Recipients that are not users keep the message's own channels. Returns
+// per-recipient results for messages that were held or suppressed.
+func (np *NotificationPipeline) applyPreferences(msg *NotificationMessage) []ChannelResult {
+	if np.preferences == nil || len(msg.Recipients) == 0 {
+		return nil
+	}
+
+	users, err := np.preferences.ResolveUsers(msg.Recipients)
+	if err != nil {
+		componentLogger("notifications").Error(err, "Notification preferences unavailable, sending as requested", nil)
+		return nil
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var results []ChannelResult
+	var channels []NotificationChannel
+	var recipients []string
+	addChannel := func(channel NotificationChannel) {
+		for _, existing := range channels {
+			if existing == channel {
+				return
+			}
+		}
+		channels = append(channels, channel)
+	}
+	addRecipient := func(recipient string) {
+		for _, existing := range recipients {
+			if existing == recipient {
+				return
+			}
+		}
+		recipients = append(recipients, recipient)
+	}
+	channelRecipients := make(map[NotificationChannel][]string)
+	addChannelRecipient := func(channel NotificationChannel, recipient string) {
+		for _, existing := range channelRecipients[channel] {
+			if existing == recipient {
+				return
+			}
+		}
+		channelRecipients[channel] = append(channelRecipients[channel], recipient)
+	}
+
+	seenUsers := make(map[string]bool)
+	for _, recipient := range msg.Recipients {
+		user, ok := users[recipient]
+		if !ok {
+			addRecipient(recipient)
+			for _, channel := range msg.Channels {
+				addChannel(channel)
+				addChannelRecipient(channel, recipient)
+			}
+			continue
+		}
+		if seenUsers[user.ID] {
+			continue
+		}
+		seenUsers[user.ID] = true
+
+		prefs, err := np.preferences.Get(user.ID)
+		if err != nil {
+			componentLogger("notifications").Error(err, "Failed to load notification preferences", map[string]interface{}{"user_id": user.ID})
+			prefs = defaultNotificationPreferences(user.ID)
+		}
+
+		if !prefs.Allows(msg.Priority) {
+			results = append(results, ChannelResult{Recipient: user.ID, Status: StatusSuppressed, Error: "below minimum priority"})
+			continue
+		}
+
+		if msg.Priority != PriorityCritical && prefs.InQuietHours(now, msg.Type) {
+			held := *msg
+			held.Recipients = []string{user.ID}
+			if err := np.preferences.Hold(user.ID, &held); err != nil {
+				componentLogger("notifications").Error(err, "Failed to hold notification, sending now", map[string]interface{}{"user_id": user.ID})
+			} else {
+				results = append(results, ChannelResult{Channel: ChannelEmail, Recipient: user.ID, Status: StatusHeld})
+				continue
+			}
+		}
+
+		userChannels := prefs.ChannelsFor(msg.Type, msg.Channels)
+		if len(userChannels) == 0 {
+			results = append(results, ChannelResult{Recipient: user.ID, Status: StatusSuppressed, Error: "no channels enabled for " + string(msg.Type)})
+			continue
+		}
+		for _, channel := range userChannels {
+			addChannel(channel)
+			switch channel {
+			case ChannelEmail:
+				addRecipient(user.Email)
+				addChannelRecipient(channel, user.Email)
+			case ChannelInApp:
+				addRecipient(user.ID)
+				addChannelRecipient(channel, user.ID)
+			}
+		}
+	}
+
+	msg.Channels = channels
+	msg.Recipients = recipients
+	msg.ChannelRecipients = channelRecipients
+	return results
+}
+
+// StartDigestScheduler - Periodically send digests of held messages that have come due
+func (np *NotificationPipeline) StartDigestScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		np.sendDueDigests()
+	}
+}
+
+func (np *NotificationPipeline) sendDueDigests() {
+	oldest, err := np.preferences.oldestHeld()
+	if err != nil {
+		componentLogger("notifications").Error(err, "Failed to list held notifications", nil)
+		return
+	}
+
+	now := time.Now()
+	for userID, heldAt := range oldest {
+		prefs, err := np.preferences.Get(userID)
+		if err != nil {
+			componentLogger("notifications").Error(err, "Failed to load notification preferences", map[string]interface{}{"user_id": userID})
+			continue
+		}
+		if !heldAt.Before(prefs.lastDigestBoundary(now)) {
+			continue
+		}
+		// Still due on the first tick after the window ends
+		if prefs.InQuietHours(now, NotificationTypeInfo) {
+			continue
+		}
+		if err := np.sendDigest(userID); err != nil {
+			componentLogger("notifications").Error(err, "Failed to send notification digest", map[string]interface{}{"user_id": userID})
+		}
+	}
+}
+
+// sendDigest - Queue one email summarizing everything held for a user
+func (np *NotificationPipeline) sendDigest(userID string) error {
+	if !np.IsChannelConfigured(ChannelEmail) {
+		return fmt.Errorf("email channel not configured")
+	}
+
+	var email string
+	if err := np.preferences.db.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+		return err
+	}
+
+	held, err := np.preferences.ListHeld(userID)
+	if err != nil || len(held) == 0 {
+		return err
+	}
+
+	ids := make([]int64, 0, len(held))
+	lines := make([]string, 0, len(held))
+	for _, h := range held {
+		ids = append(ids, h.ID)
+		if h.Message.Template != "" && np.templateEngine.HasTemplate(h.Message.Template) {
+			np.templateEngine.ApplyTemplate(h.Message)
+		}
+		lines = append(lines, fmt.Sprintf("- [%s] %s: %s (%s)",
+			strings.ToUpper(string(h.Message.Priority)), h.Message.Title, h.Message.Message,
+			h.HeldAt.Format("2006-01-02 15:04")))
+	}
+
+	digest := &NotificationMessage{
+		ID:         uuid.New().String(),
+		Type:       NotificationTypeInfo,
+		Priority:   PriorityNormal,
+		Title:      fmt.Sprintf("%d notifications while you were away", len(held)),
+		Message:    strings.Join(lines, "\n"),
+		Details:    map[string]interface{}{"held_count": len(held)},
+		Recipients: []string{email},
+		Channels:   []NotificationChannel{ChannelEmail},
+		Context:    &NotificationContext{UserID: userID},
+		CreatedAt:  time.Now(),
+	}
+
+	// Digests bypass preferences and go straight to the outbox
+	if err := np.outbox.Enqueue(context.Background(), digest); err != nil {
+		return err
+	}
+	return np.preferences.markDigested(ids, digest.ID)
+}
+
+// ========================================
+// NOTIFICATION PREFERENCE HANDLERS
+// ========================================
+
+// getNotificationPreferencesHandler - Get a user's notification preferences
+func getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	if notificationPipeline.preferences == nil {
+		http.Error(w, "Notification preferences unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	userID := mux.Vars(r)["id"]
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+	prefs, err := notificationPipeline.preferences.Get(userID)
+	if err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// updateNotificationPreferencesHandler - Replace a user's notification preferences
+func updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	if notificationPipeline.preferences == nil {
+		http.Error(w, "Notification preferences unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	userID := mux.Vars(r)["id"]
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+	if _, err := notificationPipeline.preferences.Get(userID); err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+
+	prefs := defaultNotificationPreferences(userID)
+	if err := json.NewDecoder(r.Body).Decode(prefs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefs.UserID = userID
+	if prefs.Channels == nil {
+		prefs.Channels = map[NotificationType][]NotificationChannel{}
+	}
+
+	if err := prefs.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := notificationPipeline.preferences.Save(prefs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// getHeldNotificationsHandler - Messages held for a user's next digest
+func getHeldNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if notificationPipeline.preferences == nil {
+		http.Error(w, "Notification preferences unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	userID := mux.Vars(r)["id"]
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+	if _, err := notificationPipeline.preferences.Get(userID); err != nil {
+		writeUserLookupError(w, err)
+		return
+	}
+
+	held, err := notificationPipeline.preferences.ListHeld(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"held":        held,
+		"total_count": len(held),
+		"timestamp":   time.Now(),
+	})
+}
+
+func writeUserLookupError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
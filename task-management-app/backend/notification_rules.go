@@ -0,0 +1,580 @@
+package main
+
+// Declarative notification routing and escalation
+// Routing and escalation rules live in a YAML (or JSON) file so operators can
+// change them without a redeploy. The file is re-read when it changes on disk,
+// on SIGHUP, or through the reload endpoint. Escalation is time-based: when a
+// matching notification is not acknowledged within a step's delay, that
+// step's recipients are paged.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+)
+
+// NotificationRulesConfig - Contents of the routing rules file
+type NotificationRulesConfig struct {
+	Routes      []RouteRuleConfig        `yaml:"routes" json:"routes"`
+	Escalations []EscalationPolicyConfig `yaml:"escalations" json:"escalations"`
+}
+
+// NotificationMatcher - Conditions a message must meet; empty fields match anything
+type NotificationMatcher struct {
+	Types        []NotificationType     `yaml:"types" json:"types,omitempty"`
+	Priorities   []NotificationPriority `yaml:"priorities" json:"priorities,omitempty"`
+	MinPriority  NotificationPriority   `yaml:"min_priority" json:"min_priority,omitempty"`
+	Projects     []string               `yaml:"projects" json:"projects,omitempty"`
+	Environments []string               `yaml:"environments" json:"environments,omitempty"`
+	Components   []string               `yaml:"components" json:"components,omitempty"`
+	Tags         []string               `yaml:"tags" json:"tags,omitempty"` // any tag matches
+}
+
+// RouteRuleConfig - Adds channels and recipients to matching messages
+type RouteRuleConfig struct {
+	Name       string                `yaml:"name" json:"name"`
+	Match      NotificationMatcher   `yaml:"match" json:"match"`
+	Channels   []NotificationChannel `yaml:"channels" json:"channels,omitempty"`
+	Recipients []string              `yaml:"recipients" json:"recipients,omitempty"`
+	Priority   NotificationPriority  `yaml:"priority" json:"priority,omitempty"`
+}
+
+// EscalationPolicyConfig - Pages further recipients while a message stays unacknowledged
+type EscalationPolicyConfig struct {
+	Name  string              `yaml:"name" json:"name"`
+	Match NotificationMatcher `yaml:"match" json:"match"`
+	Steps []EscalationStep    `yaml:"steps" json:"steps"`
+}
+
+// EscalationStep - Who to page once a delay has passed since the original message
+type EscalationStep struct {
+	After      string                `yaml:"after" json:"after"`
+	Recipients []string              `yaml:"recipients" json:"recipients"`
+	Channels   []NotificationChannel `yaml:"channels" json:"channels,omitempty"`
+	Priority   NotificationPriority  `yaml:"priority" json:"priority,omitempty"`
+	delay      time.Duration
+}
+
+// NotificationEscalation - Escalation state of one notification
+type NotificationEscalation struct {
+	NotificationID   string     `json:"notification_id"`
+	Policy           string     `json:"policy"`
+	NextStep         int        `json:"next_step"`
+	NextEscalationAt *time.Time `json:"next_escalation_at,omitempty"`
+	PageIDs          []string   `json:"page_ids"`
+	AcknowledgedAt   *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy   string     `json:"acknowledged_by,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// NotificationEscalationStore - PostgreSQL-backed escalation state
+type NotificationEscalationStore struct {
+	db    *sql.DB
+	lease time.Duration
+}
+
+const notificationEscalationSchema = `
+CREATE TABLE IF NOT EXISTS notification_escalations (
+  notification_id VARCHAR(50) PRIMARY KEY REFERENCES notification_outbox(id) ON DELETE CASCADE,
+  policy VARCHAR(100) NOT NULL,
+  next_step INTEGER NOT NULL DEFAULT 0,
+  next_escalation_at TIMESTAMP,
+  page_ids TEXT[] NOT NULL DEFAULT '{}',
+  acknowledged_at TIMESTAMP,
+  acknowledged_by VARCHAR(50),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_escalations_due ON notification_escalations(next_escalation_at) WHERE acknowledged_at IS NULL;
+`
+
+// LoadNotificationRules - Parse and validate a rules file
+func LoadNotificationRules(path string) (*NotificationRulesConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config NotificationRulesConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid rules in %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+func (c *NotificationRulesConfig) validate() error {
+	for i, route := range c.Routes {
+		if err := route.Match.validate(); err != nil {
+			return fmt.Errorf("route %d (%s): %v", i, route.Name, err)
+		}
+		if route.Priority != "" && !isKnownPriority(route.Priority) {
+			return fmt.Errorf("route %d (%s): unknown priority %s", i, route.Name, route.Priority)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Escalations {
+		policy := &c.Escalations[i]
+		if policy.Name == "" {
+			return fmt.Errorf("escalation %d: name is required", i)
+		}
+		if names[policy.Name] {
+			return fmt.Errorf("escalation %s: duplicate name", policy.Name)
+		}
+		names[policy.Name] = true
+
+		if err := policy.Match.validate(); err != nil {
+			return fmt.Errorf("escalation %s: %v", policy.Name, err)
+		}
+		if len(policy.Steps) == 0 {
+			return fmt.Errorf("escalation %s: at least one step is required", policy.Name)
+		}
+
+		var previous time.Duration
+		for j := range policy.Steps {
+			step := &policy.Steps[j]
+			delay, err := time.ParseDuration(step.After)
+			if err != nil || delay <= 0 {
+				return fmt.Errorf("escalation %s step %d: invalid after %q", policy.Name, j+1, step.After)
+			}
+			if delay <= previous {
+				return fmt.Errorf("escalation %s step %d: steps must be in increasing order", policy.Name, j+1)
+			}
+			if len(step.Recipients) == 0 {
+				return fmt.Errorf("escalation %s step %d: recipients are required", policy.Name, j+1)
+			}
+			if step.Priority != "" && !isKnownPriority(step.Priority) {
+				return fmt.Errorf("escalation %s step %d: unknown priority %s", policy.Name, j+1, step.Priority)
+			}
+			step.delay = delay
+			previous = delay
+		}
+	}
+	return nil
+}
+
+func (m *NotificationMatcher) validate() error {
+	if m.MinPriority != "" && !isKnownPriority(m.MinPriority) {
+		return fmt.Errorf("unknown min_priority %s", m.MinPriority)
+	}
+	for _, priority := range m.Priorities {
+		if !isKnownPriority(priority) {
+			return fmt.Errorf("unknown priority %s", priority)
+		}
+	}
+	return nil
+}
+
+func isKnownPriority(priority NotificationPriority) bool {
+	_, ok := notificationPriorityOrder[priority]
+	return ok
+}
+
+// Matches - Whether a message meets every condition of the matcher
+func (m *NotificationMatcher) Matches(msg *NotificationMessage) bool {
+	if len(m.Types) > 0 && !containsValue(m.Types, msg.Type) {
+		return false
+	}
+	if len(m.Priorities) > 0 && !containsValue(m.Priorities, msg.Priority) {
+		return false
+	}
+	if m.MinPriority != "" && notificationPriorityOrder[msg.Priority] < notificationPriorityOrder[m.MinPriority] {
+		return false
+	}
+
+	ctx := msg.Context
+	if ctx == nil {
+		ctx = &NotificationContext{}
+	}
+	if len(m.Projects) > 0 && !containsValue(m.Projects, ctx.ProjectID) {
+		return false
+	}
+	if len(m.Environments) > 0 && !containsValue(m.Environments, ctx.Environment) {
+		return false
+	}
+	if len(m.Components) > 0 && !containsValue(m.Components, ctx.Component) {
+		return false
+	}
+	if len(m.Tags) > 0 {
+		for _, tag := range ctx.Tags {
+			if containsValue(m.Tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsValue[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRules - Replace routing and escalation rules with the contents of a file
+func (nr *NotificationRouter) LoadRules(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	config, err := LoadNotificationRules(path)
+	if err != nil {
+		return err
+	}
+
+	rules := make([]RoutingRule, 0, len(config.Routes))
+	for _, route := range config.Routes {
+		match := route.Match
+		rules = append(rules, RoutingRule{
+			Name:       route.Name,
+			Condition:  match.Matches,
+			Channels:   route.Channels,
+			Priority:   route.Priority,
+			Recipients: route.Recipients,
+		})
+	}
+
+	nr.mutex.Lock()
+	nr.rules = rules
+	nr.escalationRules = config.Escalations
+	nr.config = config
+	nr.configPath = path
+	nr.configModTime = info.ModTime()
+	nr.mutex.Unlock()
+
+	componentLogger("notifications").Info("Loaded notification rules", map[string]interface{}{"routes": len(config.Routes), "escalations": len(config.Escalations), "path": path})
+	return nil
+}
+
+// Reload - Re-read the rules file; the current rules stay in place if it is invalid
+func (nr *NotificationRouter) Reload() error {
+	nr.mutex.RLock()
+	path := nr.configPath
+	nr.mutex.RUnlock()
+
+	if path == "" {
+		return fmt.Errorf("no notification rules file configured")
+	}
+	return nr.LoadRules(path)
+}
+
+// WatchRules - Reload rules when the file changes or the process receives SIGHUP
+func (nr *NotificationRouter) WatchRules(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for {
+		select {
+		case <-hangup:
+		case <-ticker.C:
+			nr.mutex.RLock()
+			path, modTime := nr.configPath, nr.configModTime
+			nr.mutex.RUnlock()
+
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().After(modTime) {
+				continue
+			}
+		}
+
+		if err := nr.Reload(); err != nil {
+			componentLogger("notifications").Error(err, "Keeping previous notification rules", nil)
+		}
+	}
+}
+
+// Rules - The currently loaded rules file contents
+func (nr *NotificationRouter) Rules() *NotificationRulesConfig {
+	nr.mutex.RLock()
+	defer nr.mutex.RUnlock()
+
+	if nr.config == nil {
+		return &NotificationRulesConfig{Routes: []RouteRuleConfig{}, Escalations: []EscalationPolicyConfig{}}
+	}
+	return nr.config
+}
+
+// MatchEscalation - First escalation policy matching a message, if any
+func (nr *NotificationRouter) MatchEscalation(msg *NotificationMessage) *EscalationPolicyConfig {
+	nr.mutex.RLock()
+	defer nr.mutex.RUnlock()
+
+	for i := range nr.escalationRules {
+		if nr.escalationRules[i].Match.Matches(msg) {
+			return &nr.escalationRules[i]
+		}
+	}
+	return nil
+}
+
+// EscalationPolicy - Look up a loaded escalation policy by name
+func (nr *NotificationRouter) EscalationPolicy(name string) *EscalationPolicyConfig {
+	nr.mutex.RLock()
+	defer nr.mutex.RUnlock()
+
+	for i := range nr.escalationRules {
+		if nr.escalationRules[i].Name == name {
+			return &nr.escalationRules[i]
+		}
+	}
+	return nil
+}
+
+// NewNotificationEscalationStore - Create an escalation store backed by PostgreSQL
+func NewNotificationEscalationStore(db *sql.DB) *NotificationEscalationStore {
+	return &NotificationEscalationStore{db: db, lease: 2 * time.Minute}
+}
+
+// EnsureSchema - Create the escalation table if missing
+func (es *NotificationEscalationStore) EnsureSchema() error {
+	if es.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	_, err := es.db.Exec(notificationEscalationSchema)
+	return err
+}
+
+// Track - Start escalating a notification under a policy
+func (es *NotificationEscalationStore) Track(notificationID, policy string, createdAt, firstAt time.Time) error {
+	_, err := es.db.Exec(
+		"INSERT INTO notification_escalations (notification_id, policy, next_escalation_at, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		notificationID, policy, firstAt, createdAt,
+	)
+	return err
+}
+
+const escalationColumns = "notification_id, policy, next_step, next_escalation_at, page_ids, acknowledged_at, COALESCE(acknowledged_by, ''), created_at"
+
+func scanEscalation(row interface{ Scan(...interface{}) error }) (*NotificationEscalation, error) {
+	var e NotificationEscalation
+	if err := row.Scan(&e.NotificationID, &e.Policy, &e.NextStep, &e.NextEscalationAt, pq.Array(&e.PageIDs),
+		&e.AcknowledgedAt, &e.AcknowledgedBy, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Get - Escalation state for a notification or one of its pages
+func (es *NotificationEscalationStore) Get(notificationID string) (*NotificationEscalation, error) {
+	return scanEscalation(es.db.QueryRow(
+		"SELECT "+escalationColumns+" FROM notification_escalations WHERE notification_id = $1 OR $1 = ANY(page_ids)",
+		notificationID,
+	))
+}
+
+// claimDue - Lease escalations whose next step is due so only one instance pages
+func (es *NotificationEscalationStore) claimDue(limit int) ([]*NotificationEscalation, error) {
+	rows, err := es.db.Query(`
+		UPDATE notification_escalations e
+		SET next_escalation_at = $1
+		FROM (
+		  SELECT notification_id FROM notification_escalations
+		  WHERE acknowledged_at IS NULL AND next_escalation_at <= NOW()
+		  ORDER BY next_escalation_at
+		  LIMIT $2
+		  FOR UPDATE SKIP LOCKED
+		) due
+		WHERE e.notification_id = due.notification_id
+		RETURNING e.notification_id, e.policy, e.next_step, e.next_escalation_at, e.page_ids,
+		          e.acknowledged_at, COALESCE(e.acknowledged_by, ''), e.created_at`,
+		time.Now().Add(es.lease), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []*NotificationEscalation
+	for rows.Next() {
+		e, err := scanEscalation(rows)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, e)
+	}
+	return due, nil
+}
+
+// advance - Record a page and schedule the next step, or finish when nextAt is nil
+func (es *NotificationEscalationStore) advance(notificationID string, nextStep int, nextAt *time.Time, pageID string) error {
+	_, err := es.db.Exec(
+		"UPDATE notification_escalations SET next_step = $1, next_escalation_at = $2, page_ids = CASE WHEN $3 = '' THEN page_ids ELSE array_append(page_ids, $3) END WHERE notification_id = $4",
+		nextStep, nextAt, pageID, notificationID,
+	)
+	return err
+}
+
+// Acknowledge - Stop escalating; accepts the original notification ID or any page ID
+func (es *NotificationEscalationStore) Acknowledge(notificationID, userID string) (*NotificationEscalation, error) {
+	escalation, err := scanEscalation(es.db.QueryRow(
+		"UPDATE notification_escalations SET acknowledged_at = NOW(), acknowledged_by = NULLIF($2, ''), next_escalation_at = NULL "+
+			"WHERE (notification_id = $1 OR $1 = ANY(page_ids)) AND acknowledged_at IS NULL RETURNING "+escalationColumns,
+		notificationID, userID,
+	))
+	if err == sql.ErrNoRows {
+		// Already acknowledged acks are idempotent; unknown IDs stay ErrNoRows
+		return es.Get(notificationID)
+	}
+	return escalation, err
+}
+
+// trackEscalation - Start the first matching escalation policy for a queued message
+func (np *NotificationPipeline) trackEscalation(msg *NotificationMessage) {
+	if np.escalations == nil {
+		return
+	}
+	policy := np.router.MatchEscalation(msg)
+	if policy == nil {
+		return
+	}
+	if err := np.escalations.Track(msg.ID, policy.Name, msg.CreatedAt, msg.CreatedAt.Add(policy.Steps[0].delay)); err != nil {
+		componentLogger("notifications").Error(err, "Failed to track escalation", map[string]interface{}{"notification_id": msg.ID})
+	}
+}
+
+// StartEscalationScheduler - Periodically page the next step of unacknowledged escalations
+func (np *NotificationPipeline) StartEscalationScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		np.escalateDue()
+	}
+}
+
+func (np *NotificationPipeline) escalateDue() {
+	due, err := np.escalations.claimDue(20)
+	if err != nil {
+		componentLogger("notifications").Error(err, "Failed to claim due escalations", nil)
+		return
+	}
+
+	for _, escalation := range due {
+		policy := np.router.EscalationPolicy(escalation.Policy)
+		if policy == nil || escalation.NextStep >= len(policy.Steps) {
+			// Policy was removed or shortened by a reload; nothing left to page
+			if err := np.escalations.advance(escalation.NotificationID, escalation.NextStep, nil, ""); err != nil {
+				componentLogger("notifications").Error(err, "Failed to finish escalation", map[string]interface{}{"notification_id": escalation.NotificationID})
+			}
+			continue
+		}
+
+		original, err := np.outbox.loadMessage(escalation.NotificationID)
+		if err != nil {
+			componentLogger("notifications").Error(err, "Failed to load escalated notification", map[string]interface{}{"notification_id": escalation.NotificationID})
+			continue
+		}
+
+		step := policy.Steps[escalation.NextStep]
+		page := escalationPage(original, step, escalation.NextStep+1)
+		if err := np.outbox.Enqueue(context.Background(), page); err != nil {
+			componentLogger("notifications").Error(err, "Failed to page escalation step", map[string]interface{}{"notification_id": escalation.NotificationID, "step": escalation.NextStep + 1})
+			continue
+		}
+
+		var nextAt *time.Time
+		if next := escalation.NextStep + 1; next < len(policy.Steps) {
+			at := escalation.CreatedAt.Add(policy.Steps[next].delay)
+			nextAt = &at
+		}
+		if err := np.escalations.advance(escalation.NotificationID, escalation.NextStep+1, nextAt, page.ID); err != nil {
+			componentLogger("notifications").Error(err, "Failed to advance escalation", map[string]interface{}{"notification_id": escalation.NotificationID})
+		}
+		componentLogger("notifications").Info("Escalated notification", map[string]interface{}{"notification_id": escalation.NotificationID, "step": escalation.NextStep + 1, "recipients": step.Recipients})
+	}
+}
+
+// escalationPage - Copy of the original message addressed to an escalation step
+func escalationPage(original *NotificationMessage, step EscalationStep, stepNumber int) *NotificationMessage {
+	page := *original
+	page.ID = uuid.New().String()
+	page.Title = fmt.Sprintf("[Escalation %d] %s", stepNumber, original.Title)
+	page.Recipients = step.Recipients
+	if len(step.Channels) > 0 {
+		page.Channels = step.Channels
+	}
+	if step.Priority != "" {
+		page.Priority = step.Priority
+	}
+	page.Details = make(map[string]interface{}, len(original.Details)+2)
+	for key, value := range original.Details {
+		page.Details[key] = value
+	}
+	page.Details["escalated_from"] = original.ID
+	page.Details["escalation_step"] = stepNumber
+	page.CreatedAt = time.Now()
+	page.SentAt = nil
+	page.Error = ""
+	return &page
+}
+
+// ========================================
+// NOTIFICATION RULE HANDLERS
+// ========================================
+
+// getNotificationRulesHandler - Currently loaded routing and escalation rules
+func getNotificationRulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notificationPipeline.router.Rules())
+}
+
+// reloadNotificationRulesHandler - Re-read the rules file; admins only
+func reloadNotificationRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if err := notificationPipeline.router.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notificationPipeline.router.Rules())
+}
+
+// acknowledgeNotificationHandler - Acknowledge a notification as the caller and stop its escalation
+func acknowledgeNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if notificationPipeline.escalations == nil {
+		http.Error(w, "Escalations unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	userID := requestUserID(r)
+	if userID == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	escalation, err := notificationPipeline.escalations.Acknowledge(mux.Vars(r)["id"], userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "No escalation for notification", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(escalation)
+}
@@ -0,0 +1,748 @@
+package main
+
+// File-based, localized notification templates
+// Templates live in a directory laid out as <name>/<locale>/<variant>, e.g.
+//
+//	templates/notifications/task_assigned/en/title.txt
+//	templates/notifications/task_assigned/en/message.txt
+//	templates/notifications/task_assigned/en/slack.json
+//	templates/notifications/task_assigned/fr/email.html
+//
+// Variants: title.txt, message.txt, slack.json (full payload with blocks),
+// mattermost.json (one attachment), email_subject.txt, email.txt, email.html
+// webhook.json, teams.json (full payload with an Adaptive Card), discord.json
+// (full payload with embeds) and sms.txt. A variant missing in a locale is taken from the language
+// and then the default locale (de-AT -> de -> en); variants missing everywhere fall back to the
+// default rendering of the title and message. The directory is reloaded when files change.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// NotificationTemplateEngine - Template engine for notifications
+type NotificationTemplateEngine struct {
+	templates     map[string]map[string]*LocalizedTemplate // name -> locale -> template
+	builtins      map[string]map[string]*LocalizedTemplate
+	dir           string
+	defaultLocale string
+	baseURL       string
+	signature     string
+	mutex         sync.RWMutex
+}
+
+// LocalizedTemplate - All channel variants of a template in one locale
+type LocalizedTemplate struct {
+	Name         string
+	Locale       string
+	title        *texttemplate.Template
+	message      *texttemplate.Template
+	slack        *texttemplate.Template
+	mattermost   *texttemplate.Template
+	emailSubject *texttemplate.Template
+	emailText    *texttemplate.Template
+	emailHTML    *htmltemplate.Template
+	webhook      *texttemplate.Template
+	teams        *texttemplate.Template
+	discord      *texttemplate.Template
+	sms          *texttemplate.Template
+}
+
+// RenderedNotification - Output of a template for every channel
+type RenderedNotification struct {
+	Template     string          `json:"template"`
+	Locale       string          `json:"locale"`
+	Title        string          `json:"title,omitempty"`
+	Message      string          `json:"message,omitempty"`
+	Slack        json.RawMessage `json:"slack,omitempty"`
+	Mattermost   json.RawMessage `json:"mattermost,omitempty"`
+	EmailSubject string          `json:"email_subject,omitempty"`
+	EmailText    string          `json:"email_text,omitempty"`
+	EmailHTML    string          `json:"email_html,omitempty"`
+	Webhook      json.RawMessage `json:"webhook,omitempty"`
+	Teams        json.RawMessage `json:"teams,omitempty"`
+	Discord      json.RawMessage `json:"discord,omitempty"`
+	SMS          string          `json:"sms,omitempty"`
+}
+
+// TemplateSummary - A loaded template and the variants available per locale
+type TemplateSummary struct {
+	Name    string              `json:"name"`
+	Locales map[string][]string `json:"locales"`
+}
+
+// notificationTemplateData - Value templates are executed against
+type notificationTemplateData struct {
+	*NotificationMessage
+	Locale  string
+	BaseURL string
+}
+
+var templateVariantFiles = []string{
+	"title.txt", "message.txt", "slack.json", "mattermost.json",
+	"email_subject.txt", "email.txt", "email.html", "webhook.json",
+	"teams.json", "discord.json", "sms.txt",
+}
+
+// Locale-specific default layouts for the date helper
+var localeDateLayouts = map[string]string{
+	"en": "Jan 2, 2006 15:04",
+	"de": "02.01.2006 15:04",
+	"fr": "02/01/2006 15:04",
+	"es": "02/01/2006 15:04",
+	"pt": "02/01/2006 15:04",
+}
+
+func NewNotificationTemplateEngine() *NotificationTemplateEngine {
+	engine := &NotificationTemplateEngine{
+		templates:     make(map[string]map[string]*LocalizedTemplate),
+		builtins:      make(map[string]map[string]*LocalizedTemplate),
+		defaultLocale: "en",
+	}
+
+	// Built-in templates; message details supply the values. Files with the same name replace them.
+	builtins := map[string]string{
+		"task_assigned": `Task "{{detail "task_title"}}" has been assigned to {{detail "assignee"}}.`,
+		"task_due":      `Task "{{detail "task_title"}}" is due {{date (detail "due_date")}}.`,
+		"deployment":    `Deployment {{detail "version"}}{{if .Context}} to {{.Context.Environment}}{{end}} finished with status {{detail "status"}}.`,
+	}
+	for name, text := range builtins {
+		if err := engine.RegisterTemplate(name, text); err != nil {
+			componentLogger("notifications").Error(err, "Failed to register built-in template", map[string]interface{}{"template": name})
+		}
+	}
+
+	return engine
+}
+
+// Configure - Set the template directory, default locale and base URL for links, then load
+func (nte *NotificationTemplateEngine) Configure(dir, defaultLocale, baseURL string) error {
+	nte.mutex.Lock()
+	nte.dir = dir
+	if defaultLocale != "" {
+		nte.defaultLocale = normalizeLocale(defaultLocale)
+	}
+	nte.baseURL = strings.TrimRight(baseURL, "/")
+	nte.mutex.Unlock()
+
+	if dir == "" {
+		return nil
+	}
+	return nte.Reload()
+}
+
+// RegisterTemplate - Register a message-only template in the default locale
+func (nte *NotificationTemplateEngine) RegisterTemplate(name, text string) error {
+	tmpl, err := texttemplate.New(name).Funcs(nte.funcMap(nte.defaultLocale, nil)).Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %v", name, err)
+	}
+
+	nte.mutex.Lock()
+	defer nte.mutex.Unlock()
+	locales := map[string]*LocalizedTemplate{
+		nte.defaultLocale: {Name: name, Locale: nte.defaultLocale, message: tmpl},
+	}
+	nte.builtins[name] = locales
+	if _, exists := nte.templates[name]; !exists {
+		nte.templates[name] = locales
+	}
+	return nil
+}
+
+func (nte *NotificationTemplateEngine) HasTemplate(name string) bool {
+	nte.mutex.RLock()
+	defer nte.mutex.RUnlock()
+	_, exists := nte.templates[name]
+	return exists
+}
+
+// Reload - Parse every template in the directory; the previous set stays if any file is invalid
+func (nte *NotificationTemplateEngine) Reload() error {
+	nte.mutex.RLock()
+	dir := nte.dir
+	nte.mutex.RUnlock()
+
+	loaded, err := nte.loadDir(dir)
+	if err != nil {
+		return err
+	}
+	signature, err := templateDirSignature(dir)
+	if err != nil {
+		return err
+	}
+
+	nte.mutex.Lock()
+	defer nte.mutex.Unlock()
+	// Keep built-ins that the directory does not override
+	for name, locales := range nte.builtins {
+		if _, exists := loaded[name]; !exists {
+			loaded[name] = locales
+		}
+	}
+	nte.templates = loaded
+	nte.signature = signature
+
+	componentLogger("notifications").Info("Loaded notification templates", map[string]interface{}{"count": len(loaded), "dir": dir})
+	return nil
+}
+
+// WatchTemplates - Reload templates when files in the directory change
+func (nte *NotificationTemplateEngine) WatchTemplates(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		nte.mutex.RLock()
+		dir, current := nte.dir, nte.signature
+		nte.mutex.RUnlock()
+
+		signature, err := templateDirSignature(dir)
+		if err != nil || signature == current {
+			continue
+		}
+		if err := nte.Reload(); err != nil {
+			componentLogger("notifications").Error(err, "Keeping previous notification templates", nil)
+		}
+	}
+}
+
+func (nte *NotificationTemplateEngine) loadDir(dir string) (map[string]map[string]*LocalizedTemplate, error) {
+	names, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]map[string]*LocalizedTemplate)
+	for _, nameEntry := range names {
+		if !nameEntry.IsDir() {
+			continue
+		}
+		name := nameEntry.Name()
+		locales, err := os.ReadDir(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		for _, localeEntry := range locales {
+			if !localeEntry.IsDir() {
+				continue
+			}
+			locale := normalizeLocale(localeEntry.Name())
+			tmpl, err := nte.loadTemplate(filepath.Join(dir, name, localeEntry.Name()), name, locale)
+			if err != nil {
+				return nil, err
+			}
+			if loaded[name] == nil {
+				loaded[name] = make(map[string]*LocalizedTemplate)
+			}
+			loaded[name][locale] = tmpl
+		}
+	}
+	return loaded, nil
+}
+
+func (nte *NotificationTemplateEngine) loadTemplate(path, name, locale string) (*LocalizedTemplate, error) {
+	tmpl := &LocalizedTemplate{Name: name, Locale: locale}
+	funcs := nte.funcMap(locale, nil)
+
+	for _, file := range templateVariantFiles {
+		data, err := os.ReadFile(filepath.Join(path, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		id := name + "/" + locale + "/" + file
+		if file == "email.html" {
+			parsed, err := htmltemplate.New(id).Funcs(htmltemplate.FuncMap(funcs)).Parse(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", id, err)
+			}
+			tmpl.emailHTML = parsed
+			continue
+		}
+
+		parsed, err := texttemplate.New(id).Funcs(funcs).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", id, err)
+		}
+		switch file {
+		case "title.txt":
+			tmpl.title = parsed
+		case "message.txt":
+			tmpl.message = parsed
+		case "slack.json":
+			tmpl.slack = parsed
+		case "mattermost.json":
+			tmpl.mattermost = parsed
+		case "email_subject.txt":
+			tmpl.emailSubject = parsed
+		case "email.txt":
+			tmpl.emailText = parsed
+		case "webhook.json":
+			tmpl.webhook = parsed
+		case "teams.json":
+			tmpl.teams = parsed
+		case "discord.json":
+			tmpl.discord = parsed
+		case "sms.txt":
+			tmpl.sms = parsed
+		}
+	}
+	return tmpl, nil
+}
+
+// templateDirSignature - Cheap fingerprint of the directory used to detect changes
+func templateDirSignature(dir string) (string, error) {
+	var parts []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			parts = append(parts, fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano()))
+		}
+		return nil
+	})
+	sort.Strings(parts)
+	return strings.Join(parts, "|"), err
+}
+
+// lookup - Template for a locale, taking each variant from the most specific locale that has it:
+// exact (de-AT), then language (de), then the default locale (en)
+func (nte *NotificationTemplateEngine) lookup(name, locale string) (*LocalizedTemplate, error) {
+	nte.mutex.RLock()
+	defer nte.mutex.RUnlock()
+
+	locales, exists := nte.templates[name]
+	if !exists {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+
+	locale = normalizeLocale(locale)
+	candidates := []string{locale}
+	if language, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, language)
+	}
+	candidates = append(candidates, nte.defaultLocale)
+
+	var merged *LocalizedTemplate
+	for _, candidate := range candidates {
+		tmpl, ok := locales[candidate]
+		if !ok {
+			continue
+		}
+		if merged == nil {
+			copied := *tmpl
+			merged = &copied
+			continue
+		}
+		merged.fillMissing(tmpl)
+	}
+	if merged != nil {
+		return merged, nil
+	}
+	// A template that exists in a single locale is used for everyone
+	if len(locales) == 1 {
+		for _, tmpl := range locales {
+			return tmpl, nil
+		}
+	}
+	return nil, fmt.Errorf("template %s has no %s or %s variant", name, locale, nte.defaultLocale)
+}
+
+// fillMissing - Take the variants this template lacks from a fallback locale
+func (lt *LocalizedTemplate) fillMissing(fallback *LocalizedTemplate) {
+	texts := []struct{ dst, src **texttemplate.Template }{
+		{&lt.title, &fallback.title},
+		{&lt.message, &fallback.message},
+		{&lt.slack, &fallback.slack},
+		{&lt.mattermost, &fallback.mattermost},
+		{&lt.emailSubject, &fallback.emailSubject},
+		{&lt.emailText, &fallback.emailText},
+		{&lt.webhook, &fallback.webhook},
+		{&lt.teams, &fallback.teams},
+		{&lt.discord, &fallback.discord},
+		{&lt.sms, &fallback.sms},
+	}
+	for _, t := range texts {
+		if *t.dst == nil {
+			*t.dst = *t.src
+		}
+	}
+	if lt.emailHTML == nil {
+		lt.emailHTML = fallback.emailHTML
+	}
+}
+
+// Render - Execute every variant of a message's template in the given locale
+func (nte *NotificationTemplateEngine) Render(msg *NotificationMessage, locale string) (*RenderedNotification, error) {
+	tmpl, err := nte.lookup(msg.Template, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	nte.mutex.RLock()
+	data := &notificationTemplateData{NotificationMessage: msg, Locale: tmpl.Locale, BaseURL: nte.baseURL}
+	nte.mutex.RUnlock()
+	funcs := nte.funcMap(tmpl.Locale, msg)
+
+	rendered := &RenderedNotification{Template: tmpl.Name, Locale: tmpl.Locale}
+	texts := []struct {
+		tmpl *texttemplate.Template
+		out  *string
+	}{
+		{tmpl.title, &rendered.Title},
+		{tmpl.message, &rendered.Message},
+		{tmpl.emailSubject, &rendered.EmailSubject},
+		{tmpl.emailText, &rendered.EmailText},
+		{tmpl.sms, &rendered.SMS},
+	}
+	for _, t := range texts {
+		if t.tmpl == nil {
+			continue
+		}
+		out, err := executeText(t.tmpl, funcs, data)
+		if err != nil {
+			return nil, err
+		}
+		*t.out = strings.TrimSpace(out)
+	}
+
+	payloads := []struct {
+		tmpl *texttemplate.Template
+		out  *json.RawMessage
+	}{
+		{tmpl.slack, &rendered.Slack},
+		{tmpl.mattermost, &rendered.Mattermost},
+		{tmpl.webhook, &rendered.Webhook},
+		{tmpl.teams, &rendered.Teams},
+		{tmpl.discord, &rendered.Discord},
+	}
+	for _, p := range payloads {
+		if p.tmpl == nil {
+			continue
+		}
+		out, err := executeText(p.tmpl, funcs, data)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid([]byte(out)) {
+			return nil, fmt.Errorf("template %s did not produce valid JSON", p.tmpl.Name())
+		}
+		*p.out = json.RawMessage(out)
+	}
+
+	if tmpl.emailHTML != nil {
+		var buf bytes.Buffer
+		clone, err := tmpl.emailHTML.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if err := clone.Funcs(htmltemplate.FuncMap(funcs)).Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to execute template %s: %v", tmpl.emailHTML.Name(), err)
+		}
+		rendered.EmailHTML = buf.String()
+	}
+
+	return rendered, nil
+}
+
+func executeText(tmpl *texttemplate.Template, funcs texttemplate.FuncMap, data interface{}) (string, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := clone.Funcs(funcs).Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template %s: %v", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// ApplyTemplate - Render a message's template and fold the title and message back into it
+func (nte *NotificationTemplateEngine) ApplyTemplate(msg *NotificationMessage) error {
+	rendered, err := nte.Render(msg, msg.Locale)
+	if err != nil {
+		return err
+	}
+
+	msg.rendered = rendered
+	if rendered.Title != "" {
+		msg.Title = rendered.Title
+	}
+	if rendered.Message != "" {
+		msg.Message = rendered.Message
+	}
+	return nil
+}
+
+// Summaries - Loaded templates with their locales and variants
+func (nte *NotificationTemplateEngine) Summaries() []TemplateSummary {
+	nte.mutex.RLock()
+	defer nte.mutex.RUnlock()
+
+	summaries := make([]TemplateSummary, 0, len(nte.templates))
+	for name, locales := range nte.templates {
+		summary := TemplateSummary{Name: name, Locales: make(map[string][]string)}
+		for locale, tmpl := range locales {
+			summary.Locales[locale] = tmpl.variants()
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+func (nt *LocalizedTemplate) variants() []string {
+	var variants []string
+	present := []struct {
+		name string
+		ok   bool
+	}{
+		{"title", nt.title != nil},
+		{"message", nt.message != nil},
+		{"slack", nt.slack != nil},
+		{"mattermost", nt.mattermost != nil},
+		{"email_subject", nt.emailSubject != nil},
+		{"email_text", nt.emailText != nil},
+		{"email_html", nt.emailHTML != nil},
+		{"webhook", nt.webhook != nil},
+		{"teams", nt.teams != nil},
+		{"discord", nt.discord != nil},
+		{"sms", nt.sms != nil},
+	}
+	for _, p := range present {
+		if p.ok {
+			variants = append(variants, p.name)
+		}
+	}
+	return variants
+}
+
+// funcMap - Template helpers; msg is nil at parse time and set when rendering
+func (nte *NotificationTemplateEngine) funcMap(locale string, msg *NotificationMessage) texttemplate.FuncMap {
+	nte.mutex.RLock()
+	baseURL := nte.baseURL
+	nte.mutex.RUnlock()
+
+	return texttemplate.FuncMap{
+		"detail": func(key string) interface{} {
+			if msg == nil || msg.Details == nil {
+				return ""
+			}
+			if value, ok := msg.Details[key]; ok {
+				return value
+			}
+			return ""
+		},
+		"date": func(value interface{}) string {
+			t, ok := templateTime(value)
+			if !ok {
+				return fmt.Sprintf("%v", value)
+			}
+			layout, exists := localeDateLayouts[strings.SplitN(locale, "-", 2)[0]]
+			if !exists {
+				layout = localeDateLayouts["en"]
+			}
+			return t.Format(layout)
+		},
+		"dateFormat": func(layout string, value interface{}) string {
+			t, ok := templateTime(value)
+			if !ok {
+				return fmt.Sprintf("%v", value)
+			}
+			return t.Format(layout)
+		},
+		"relativeTime": func(value interface{}) string {
+			t, ok := templateTime(value)
+			if !ok {
+				return fmt.Sprintf("%v", value)
+			}
+			return relativeTime(t, time.Now())
+		},
+		"taskLink": func(taskID interface{}) string {
+			return fmt.Sprintf("%s/tasks/%v", baseURL, taskID)
+		},
+		"projectLink": func(projectID interface{}) string {
+			return fmt.Sprintf("%s/projects/%v", baseURL, projectID)
+		},
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+}
+
+// templateTime - Accept time values as well as RFC 3339 strings from message details
+func templateTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, false
+		}
+		return *v, true
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+func relativeTime(t, now time.Time) string {
+	diff := t.Sub(now)
+	future := diff > 0
+	if !future {
+		diff = -diff
+	}
+
+	var amount string
+	switch {
+	case diff < time.Minute:
+		return "just now"
+	case diff < time.Hour:
+		amount = pluralize(int(diff.Minutes()), "minute")
+	case diff < 24*time.Hour:
+		amount = pluralize(int(diff.Hours()), "hour")
+	default:
+		amount = pluralize(int(diff.Hours()/24), "day")
+	}
+	if future {
+		return "in " + amount
+	}
+	return amount + " ago"
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+func normalizeLocale(locale string) string {
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	if language, region, found := strings.Cut(locale, "-"); found {
+		return strings.ToLower(language) + "-" + strings.ToUpper(region)
+	}
+	return strings.ToLower(locale)
+}
+
+// resolveLocale - Locale for a message: its context user's profile, then its first user recipient
+func (np *NotificationPipeline) resolveLocale(msg *NotificationMessage) string {
+	if np.preferences == nil {
+		return ""
+	}
+
+	candidates := msg.Recipients
+	if msg.Context != nil && msg.Context.UserID != "" {
+		candidates = append([]string{msg.Context.UserID}, msg.Recipients...)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	locale, err := np.preferences.LookupLocale(candidates)
+	if err != nil {
+		componentLogger("notifications").Warn("Failed to look up recipient locale", map[string]interface{}{"error": err.Error()})
+		return ""
+	}
+	return locale
+}
+
+// sampleTemplateMessage - Data used by the preview endpoint when none is supplied
+func sampleTemplateMessage(name string) *NotificationMessage {
+	due := time.Now().Add(48 * time.Hour).Format(time.RFC3339)
+	return &NotificationMessage{
+		ID:       "preview",
+		Type:     NotificationTypeInfo,
+		Priority: PriorityNormal,
+		Title:    "Sample notification",
+		Message:  "This is a preview of the " + name + " template.",
+		Template: name,
+		Details: map[string]interface{}{
+			"task_id":    "123",
+			"task_title": "Write release notes",
+			"assignee":   "alex",
+			"due_date":   due,
+			"version":    "v1.2.3",
+			"status":     "succeeded",
+		},
+		Context: &NotificationContext{
+			ProjectID:   "demo",
+			Environment: "staging",
+			Component:   "api",
+		},
+		CreatedAt: time.Now(),
+	}
+}
+
+// ========================================
+// NOTIFICATION TEMPLATE HANDLERS
+// ========================================
+
+// listNotificationTemplatesHandler - Loaded templates with locales and variants
+func listNotificationTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"templates": notificationPipeline.templateEngine.Summaries(),
+		"timestamp": time.Now(),
+	})
+}
+
+// previewNotificationTemplateHandler - Render a template against sample or supplied data
+func previewNotificationTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !notificationPipeline.templateEngine.HasTemplate(name) {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	var request struct {
+		Locale  string               `json:"locale"`
+		Message *NotificationMessage `json:"message"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	msg := request.Message
+	if msg == nil {
+		msg = sampleTemplateMessage(name)
+	}
+	msg.Template = name
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+
+	rendered, err := notificationPipeline.templateEngine.Render(msg, request.Locale)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rendered)
+}
@@ -0,0 +1,332 @@
+package main
+
+// Notification deduplication, rate limiting and storm suppression
+// Every message gets a fingerprint (explicit, or derived from its type, title,
+// template and context). Repeats of a fingerprint within the dedup window are
+// dropped. Messages that look alike (same type, priority, template and
+// context) pass until a burst threshold is reached; the rest of the burst is
+// held back and summarized in one "N similar alerts" message when the burst
+// window closes. Per-recipient and per-channel limits cap what remains.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons a notification, channel or recipient was suppressed
+const (
+	SuppressedDuplicate          = "duplicate"
+	SuppressedBurst              = "burst"
+	SuppressedRecipientRateLimit = "recipient_rate_limit"
+	SuppressedChannelRateLimit   = "channel_rate_limit"
+)
+
+var notificationsSuppressedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "notifications_suppressed_total",
+	Help: "Notifications, channels or recipients dropped by deduplication, burst grouping or rate limits.",
+}, []string{"reason", "channel"})
+
+// NotificationThrottleConfig - Windows and limits; zero values disable a mechanism
+type NotificationThrottleConfig struct {
+	DedupWindow        time.Duration
+	BurstWindow        time.Duration
+	BurstThreshold     int
+	RecipientRateLimit int // messages per recipient per minute
+	ChannelRateLimit   int // messages per channel per minute
+}
+
+// NotificationThrottle - In-memory dedup, burst and rate-limit state
+type NotificationThrottle struct {
+	config     NotificationThrottleConfig
+	seen       map[string]time.Time // fingerprint -> first seen in the current window
+	bursts     map[string]*notificationBurst
+	recipients map[string]*rateWindow
+	channels   map[NotificationChannel]*rateWindow
+	nextPrune  time.Time
+	mutex      sync.Mutex
+}
+
+// throttlePruneInterval - How often Admit drops expired dedup and rate-limit state
+const throttlePruneInterval = time.Minute
+
+// notificationBurst - Similar messages seen since a burst window opened
+type notificationBurst struct {
+	started    time.Time
+	lastSeen   time.Time
+	passed     int
+	suppressed int
+	titles     []string
+	sample     *NotificationMessage
+}
+
+// rateWindow - Fixed one-minute counter
+type rateWindow struct {
+	started time.Time
+	count   int
+}
+
+func NewNotificationThrottle(config NotificationThrottleConfig) *NotificationThrottle {
+	return &NotificationThrottle{
+		config:     config,
+		seen:       make(map[string]time.Time),
+		bursts:     make(map[string]*notificationBurst),
+		recipients: make(map[string]*rateWindow),
+		channels:   make(map[NotificationChannel]*rateWindow),
+	}
+}
+
+// notificationFingerprint - Explicit fingerprint, or a hash of what identifies an alert
+func notificationFingerprint(msg *NotificationMessage) string {
+	if msg.Fingerprint != "" {
+		return msg.Fingerprint
+	}
+	parts := []string{string(msg.Type), msg.Title, msg.Message, msg.Template}
+	if msg.Context != nil {
+		parts = append(parts, msg.Context.ProjectID, msg.Context.Environment, msg.Context.Component)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:12])
+}
+
+// notificationGroupKey - Messages with the same key are "similar" for burst grouping
+func notificationGroupKey(msg *NotificationMessage) string {
+	parts := []string{string(msg.Type), string(msg.Priority), msg.Template}
+	if msg.Context != nil {
+		parts = append(parts, msg.Context.ProjectID, msg.Context.Environment, msg.Context.Component)
+	}
+	return strings.Join(parts, "|")
+}
+
+// Admit - Decide whether a whole message may proceed; returns the suppression reason otherwise
+func (nt *NotificationThrottle) Admit(msg *NotificationMessage, now time.Time) string {
+	nt.mutex.Lock()
+	defer nt.mutex.Unlock()
+
+	// Expired state is dropped here too, so it cannot pile up when burst summaries are off
+	if !now.Before(nt.nextPrune) {
+		nt.prune(now)
+	}
+
+	var burst *notificationBurst
+	if nt.config.BurstWindow > 0 && nt.config.BurstThreshold > 0 {
+		key := notificationGroupKey(msg)
+		burst = nt.bursts[key]
+		if burst == nil {
+			burst = &notificationBurst{started: now}
+			nt.bursts[key] = burst
+		}
+		burst.lastSeen = now
+	}
+
+	if nt.config.DedupWindow > 0 {
+		fingerprint := notificationFingerprint(msg)
+		if first, ok := nt.seen[fingerprint]; ok && now.Sub(first) < nt.config.DedupWindow {
+			nt.holdForSummary(burst, msg)
+			return SuppressedDuplicate
+		}
+		nt.seen[fingerprint] = now
+	}
+
+	if burst != nil {
+		if burst.passed >= nt.config.BurstThreshold {
+			nt.holdForSummary(burst, msg)
+			return SuppressedBurst
+		}
+		burst.passed++
+	}
+	return ""
+}
+
+func (nt *NotificationThrottle) holdForSummary(burst *notificationBurst, msg *NotificationMessage) {
+	if burst == nil {
+		return
+	}
+	burst.suppressed++
+	if burst.sample == nil {
+		sample := *msg
+		burst.sample = &sample
+	}
+	if len(burst.titles) < 5 && !containsValue(burst.titles, msg.Title) {
+		burst.titles = append(burst.titles, msg.Title)
+	}
+}
+
+// AllowChannel - Count a message against a channel's per-minute limit
+func (nt *NotificationThrottle) AllowChannel(channel NotificationChannel, now time.Time) bool {
+	if nt.config.ChannelRateLimit <= 0 {
+		return true
+	}
+	nt.mutex.Lock()
+	defer nt.mutex.Unlock()
+
+	window := nt.channels[channel]
+	if window == nil {
+		window = &rateWindow{}
+		nt.channels[channel] = window
+	}
+	return window.allow(now, nt.config.ChannelRateLimit)
+}
+
+// AllowRecipient - Count a message against a recipient's per-minute limit
+func (nt *NotificationThrottle) AllowRecipient(recipient string, now time.Time) bool {
+	if nt.config.RecipientRateLimit <= 0 {
+		return true
+	}
+	nt.mutex.Lock()
+	defer nt.mutex.Unlock()
+
+	window := nt.recipients[recipient]
+	if window == nil {
+		window = &rateWindow{}
+		nt.recipients[recipient] = window
+	}
+	return window.allow(now, nt.config.RecipientRateLimit)
+}
+
+func (rw *rateWindow) allow(now time.Time, limit int) bool {
+	if now.Sub(rw.started) >= time.Minute {
+		rw.started = now
+		rw.count = 0
+	}
+	if rw.count >= limit {
+		return false
+	}
+	rw.count++
+	return true
+}
+
+// DueSummaries - Summaries for bursts whose window closed, and cleanup of expired state
+func (nt *NotificationThrottle) DueSummaries(now time.Time) []*NotificationMessage {
+	nt.mutex.Lock()
+	defer nt.mutex.Unlock()
+
+	var summaries []*NotificationMessage
+	for key, burst := range nt.bursts {
+		if now.Sub(burst.started) < nt.config.BurstWindow {
+			continue
+		}
+		if burst.suppressed > 0 {
+			summaries = append(summaries, burst.summary())
+		}
+		delete(nt.bursts, key)
+	}
+
+	nt.prune(now)
+	return summaries
+}
+
+// prune - Drop fingerprints older than the dedup window and idle recipient counters; caller holds the mutex
+func (nt *NotificationThrottle) prune(now time.Time) {
+	for fingerprint, first := range nt.seen {
+		if now.Sub(first) >= nt.config.DedupWindow {
+			delete(nt.seen, fingerprint)
+		}
+	}
+	for recipient, window := range nt.recipients {
+		if now.Sub(window.started) >= time.Minute {
+			delete(nt.recipients, recipient)
+		}
+	}
+	nt.nextPrune = now.Add(throttlePruneInterval)
+}
+
+// summary - One message standing in for everything held back during a burst
+func (nb *notificationBurst) summary() *NotificationMessage {
+	msg := *nb.sample
+	msg.ID = ""
+	msg.CreatedAt = time.Time{}
+	msg.Fingerprint = ""
+	msg.Template = ""
+	msg.Status = ""
+	msg.rendered = nil
+
+	noun := "alerts"
+	if msg.Type != NotificationTypeAlert {
+		noun = string(msg.Type) + " notifications"
+	}
+	subject := nb.sample.Title
+	if subject == "" {
+		subject = nb.sample.Template
+	}
+	msg.Title = fmt.Sprintf("%d similar %s: %s", nb.suppressed, noun, subject)
+	msg.Message = fmt.Sprintf("%d similar %s were suppressed between %s and %s.\n\nExamples:\n- %s",
+		nb.suppressed, noun, nb.started.Format(time.RFC3339), nb.lastSeen.Format(time.RFC3339),
+		strings.Join(nb.titles, "\n- "))
+
+	details := make(map[string]interface{}, len(msg.Details)+3)
+	for key, value := range msg.Details {
+		details[key] = value
+	}
+	details["suppressed_count"] = nb.suppressed
+	details["burst_started"] = nb.started
+	details["burst_last_seen"] = nb.lastSeen
+	msg.Details = details
+	msg.summary = true
+	return &msg
+}
+
+// applyThrottle - Drop rate-limited channels and recipients from a routed message
+func (np *NotificationPipeline) applyThrottle(msg *NotificationMessage, now time.Time) []ChannelResult {
+	var results []ChannelResult
+
+	channels := msg.Channels[:0:0]
+	for _, channel := range msg.Channels {
+		if !np.throttle.AllowChannel(channel, now) {
+			np.analytics.RecordSuppressed(SuppressedChannelRateLimit, channel)
+			results = append(results, ChannelResult{Channel: channel, Status: StatusSuppressed, Error: "channel rate limit exceeded"})
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	msg.Channels = channels
+
+	limited := make(map[string]bool)
+	recipients := msg.Recipients[:0:0]
+	for _, recipient := range msg.Recipients {
+		if !np.throttle.AllowRecipient(recipient, now) {
+			limited[recipient] = true
+			np.analytics.RecordSuppressed(SuppressedRecipientRateLimit, "")
+			results = append(results, ChannelResult{Recipient: recipient, Status: StatusSuppressed, Error: "recipient rate limit exceeded"})
+			continue
+		}
+		recipients = append(recipients, recipient)
+	}
+	msg.Recipients = recipients
+
+	if len(limited) > 0 && msg.ChannelRecipients != nil {
+		channelRecipients := make(map[NotificationChannel][]string, len(msg.ChannelRecipients))
+		for channel, list := range msg.ChannelRecipients {
+			kept := list[:0:0]
+			for _, recipient := range list {
+				if !limited[recipient] {
+					kept = append(kept, recipient)
+				}
+			}
+			channelRecipients[channel] = kept
+		}
+		msg.ChannelRecipients = channelRecipients
+	}
+	return results
+}
+
+// StartBurstSummaries - Periodically send summaries of bursts whose window closed
+func (np *NotificationPipeline) StartBurstSummaries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, summary := range np.throttle.DueSummaries(time.Now()) {
+			if _, err := np.SendNotification(context.Background(), summary); err != nil {
+				componentLogger("notifications").Error(err, "Failed to send burst summary", map[string]interface{}{"title": summary.Title})
+			}
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+// Rate limiting
+// Every API request takes a token from a bucket identified by its route group
+// and caller: the verified access token, else the verified session user, else
+// the client IP (see clientIP for when X-Forwarded-For counts). Buckets refill
+// continuously at Requests per Period and hold at most Burst tokens. Responses
+// carry RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy; rejected requests get 429 with Retry-After. The memory
+// store suits a single replica; the Postgres store keeps one shared row per
+// bucket, updated atomically on the database clock, so all replicas draw from
+// the same budget. When the shared store fails, requests are let through
+// rather than turned away.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Rate limit stores
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+// defaultRateLimitGroup - Limit applied to routes outside every named group
+const defaultRateLimitGroup = "default"
+
+// rateLimitGroups - Named route groups by path prefix; first match wins
+var rateLimitGroups = []struct {
+	Name   string
+	Prefix string
+}{
+	{"ai", "/api/v1/ai/"},
+	{"analytics", "/api/v1/analytics/"},
+	{"admin", "/api/v1/admin/"},
+}
+
+// rateLimitExempt - Probes and scrapes are never limited
+var rateLimitExempt = []string{"/api/v1/health", "/api/v1/metrics"}
+
+var rateLimitRejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limit_rejected_total",
+	Help: "Requests rejected with 429 per route group and caller kind (token, user or ip).",
+}, []string{"group", "caller"})
+
+// RateLimit - Token bucket: Requests per Period, at most Burst at once
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// RateLimitConfig - Which store to use and the limit of each route group
+type RateLimitConfig struct {
+	Enabled bool
+	Store   string               // "memory" or "postgres"
+	Groups  map[string]RateLimit // route group -> limit; "default" covers the other routes
+}
+
+// RateLimitDecision - Outcome of taking a token
+type RateLimitDecision struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, when not allowed
+}
+
+// RateLimitStore - Where buckets live
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitDecision, error)
+}
+
+// RateLimiter - Chooses the bucket of a request and applies its limit
+type RateLimiter struct {
+	config RateLimitConfig
+	store  RateLimitStore
+}
+
+var rateLimitConfig RateLimitConfig
+
+var rateLimiter *RateLimiter
+
+// ratePerSecond - Refill rate of the bucket
+func (rl RateLimit) ratePerSecond() float64 {
+	return float64(rl.Requests) / rl.Period.Seconds()
+}
+
+// capacity - Burst, defaulting to Requests
+func (rl RateLimit) capacity() int {
+	if rl.Burst > 0 {
+		return rl.Burst
+	}
+	return rl.Requests
+}
+
+// decide - Decision for a bucket holding tokens after the take
+func (rl RateLimit) decide(allowed bool, tokens float64) RateLimitDecision {
+	rate := rl.ratePerSecond()
+	decision := RateLimitDecision{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(rl.capacity()) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		decision.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return decision
+}
+
+// String - The form accepted by parseRateLimit, e.g. "20/1m0s:40"
+func (rl RateLimit) String() string {
+	if rl.Requests == 0 {
+		return "0"
+	}
+	text := fmt.Sprintf("%d/%s", rl.Requests, rl.Period)
+	if rl.Burst > 0 {
+		text += fmt.Sprintf(":%d", rl.Burst)
+	}
+	return text
+}
+
+// parseRateLimit - "<requests>/<period>[:<burst>]", e.g. "20/1m", "5/s:10"; "0" means unlimited
+func parseRateLimit(value string) (RateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "0" {
+		return RateLimit{}, nil
+	}
+	spec, burstText, hasBurst := strings.Cut(value, ":")
+	requestsText, periodText, found := strings.Cut(spec, "/")
+	if !found {
+		return RateLimit{}, fmt.Errorf("expected <requests>/<period>[:<burst>], got %q", value)
+	}
+
+	var limit RateLimit
+	var err error
+	if limit.Requests, err = strconv.Atoi(strings.TrimSpace(requestsText)); err != nil || limit.Requests < 1 {
+		return RateLimit{}, fmt.Errorf("invalid request count in %q", value)
+	}
+	periodText = strings.TrimSpace(periodText)
+	if periodText != "" && !strings.ContainsAny(periodText[:1], "0123456789") {
+		periodText = "1" + periodText // "m" means "1m"
+	}
+	if limit.Period, err = time.ParseDuration(periodText); err != nil || limit.Period <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid period in %q", value)
+	}
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(strings.TrimSpace(burstText)); err != nil || limit.Burst < 1 {
+			return RateLimit{}, fmt.Errorf("invalid burst in %q", value)
+		}
+	}
+	return limit, nil
+}
+
+// parseRateLimitGroups - "ai=20/1m,default=600/1m" (YAML maps arrive as "ai: 20/1m")
+func parseRateLimitGroups(value string) (map[string]RateLimit, error) {
+	groups := make(map[string]RateLimit)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		separator := "="
+		if !strings.Contains(pair, "=") {
+			separator = ":"
+		}
+		name, spec, found := strings.Cut(pair, separator)
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid rate limit %q", pair)
+		}
+		limit, err := parseRateLimit(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		groups[name] = limit
+	}
+	return groups, nil
+}
+
+// formatRateLimitGroups - The form accepted by parseRateLimitGroups
+func formatRateLimitGroups(groups map[string]RateLimit) string {
+	pairs := make([]string, 0, len(groups))
+	for name, limit := range groups {
+		pairs = append(pairs, name+"="+limit.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// validRateLimitGroup - Whether name is a route group that can be configured
+func validRateLimitGroup(name string) bool {
+	if name == defaultRateLimitGroup {
+		return true
+	}
+	for _, group := range rateLimitGroups {
+		if group.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRateLimiter - Limiter over the configured store; Postgres needs db
+func NewRateLimiter(config RateLimitConfig, db *sql.DB) (*RateLimiter, error) {
+	var store RateLimitStore
+	switch config.Store {
+	case RateLimitStorePostgres:
+		postgres := NewPostgresRateLimitStore(db, config.Groups)
+		if err := postgres.EnsureSchema(); err != nil {
+			return nil, err
+		}
+		store = postgres
+	default:
+		store = NewMemoryRateLimitStore()
+	}
+	return &RateLimiter{config: config, store: store}, nil
+}
+
+// groupOf - Route group of a request path, or "" when the path is exempt
+func (rl *RateLimiter) groupOf(path string) string {
+	for _, exempt := range rateLimitExempt {
+		if path == exempt || strings.HasPrefix(path, exempt+"/") {
+			return ""
+		}
+	}
+	for _, group := range rateLimitGroups {
+		if strings.HasPrefix(path, group.Prefix) {
+			return group.Name
+		}
+	}
+	return defaultRateLimitGroup
+}
+
+// rateLimitCaller - Who a request is charged to: its verified access token,
+// its verified session user, or else its client IP. Unverified headers are
+// never used, so a caller cannot pick a fresh bucket for each request.
+func rateLimitCaller(r *http.Request) (kind, id string) {
+	if token := tokenPrincipal(r); token != nil {
+		return "token", token.TokenID
+	}
+	if principal := requestPrincipal(r); principal != nil && principal.Method == PrincipalSession {
+		return "user", principal.UserID
+	}
+	return "ip", clientIP(r)
+}
+
+// rateLimitMiddleware - Charge each API request to its bucket and reject it when empty
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimiter == nil || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		group := rateLimiter.groupOf(r.URL.Path)
+		limit, limited := rateLimiter.config.Groups[group]
+		if group == "" || !limited || limit.Requests == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		kind, id := rateLimitCaller(r)
+		decision, err := rateLimiter.store.Take(r.Context(), group+":"+kind+":"+id, limit)
+		if err != nil {
+			requestLogger(r).With("ratelimit").Warn("Rate limit store unavailable, request allowed", map[string]interface{}{
+				"group": group,
+				"error": err.Error(),
+			})
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, int(limit.Period.Seconds()), limit.capacity()))
+		header.Set("RateLimit-Limit", strconv.Itoa(limit.capacity()))
+		header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(decision.Reset.Seconds()))))
+		if !decision.Allowed {
+			retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			header.Set("Retry-After", strconv.Itoa(retryAfter))
+			rateLimitRejectedTotal.WithLabelValues(group, kind).Inc()
+			http.Error(w, fmt.Sprintf("Rate limit exceeded for %s requests, retry in %ds", group, retryAfter), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// initRateLimiter - Set up rateLimiter; without it requests are not limited
+func initRateLimiter(config RateLimitConfig, db *sql.DB) {
+	if !config.Enabled {
+		componentLogger("rate_limit").Warn("Rate limiting disabled", nil)
+		return
+	}
+	limiter, err := NewRateLimiter(config, db)
+	if err != nil {
+		componentLogger("rate_limit").Error(err, "Rate limiting unavailable", nil)
+		return
+	}
+	rateLimiter = limiter
+	componentLogger("rate_limit").Info("Rate limiting enabled", map[string]interface{}{"store": config.Store, "groups": formatRateLimitGroups(config.Groups)})
+}
+
+// ========================================
+// MEMORY STORE
+// ========================================
+
+// MemoryRateLimitStore - Buckets of this process only
+type MemoryRateLimitStore struct {
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket refills completely; afterwards it can be forgotten
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket), lastSweep: time.Now()}
+}
+
+func (ms *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitDecision, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	now := time.Now()
+	capacity := float64(limit.capacity())
+	rate := limit.ratePerSecond()
+
+	bucket, exists := ms.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		ms.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	decision := limit.decide(allowed, bucket.tokens)
+	bucket.full = now.Add(decision.Reset)
+
+	// Full buckets behave like missing ones, so drop them now and then
+	if now.Sub(ms.lastSweep) > time.Minute {
+		for id, b := range ms.buckets {
+			if now.After(b.full) {
+				delete(ms.buckets, id)
+			}
+		}
+		ms.lastSweep = now
+	}
+	return decision, nil
+}
+
+// ========================================
+// POSTGRES STORE
+// ========================================
+
+const rateLimitSchema = `
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+  key VARCHAR(255) PRIMARY KEY,
+  tokens DOUBLE PRECISION NOT NULL,
+  allowed BOOLEAN NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated ON rate_limit_buckets(updated_at);
+`
+
+// rateLimitTakeQuery - Refill, then take a token if there is one, in a single
+// row-locking upsert; $2 is the capacity and $3 the refill rate per second
+const rateLimitTakeQuery = `
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES ($1, $2::float8 - 1, TRUE, clock_timestamp())
+ON CONFLICT (key) DO UPDATE SET
+  allowed = LEAST($2::float8, rate_limit_buckets.tokens
+    + EXTRACT(EPOCH FROM clock_timestamp() - rate_limit_buckets.updated_at) * $3::float8) >= 1,
+  tokens = LEAST($2::float8, rate_limit_buckets.tokens
+    + EXTRACT(EPOCH FROM clock_timestamp() - rate_limit_buckets.updated_at) * $3::float8)
+    - CASE WHEN LEAST($2::float8, rate_limit_buckets.tokens
+      + EXTRACT(EPOCH FROM clock_timestamp() - rate_limit_buckets.updated_at) * $3::float8) >= 1
+      THEN 1 ELSE 0 END,
+  updated_at = clock_timestamp()
+RETURNING tokens, allowed`
+
+// PostgresRateLimitStore - Buckets shared by every replica
+type PostgresRateLimitStore struct {
+	db        *sql.DB
+	idleAfter time.Duration // longest time any bucket needs to refill
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+func NewPostgresRateLimitStore(db *sql.DB, groups map[string]RateLimit) *PostgresRateLimitStore {
+	idleAfter := time.Hour
+	for _, limit := range groups {
+		if limit.Requests > 0 {
+			fill := time.Duration(float64(limit.capacity()) / limit.ratePerSecond() * float64(time.Second))
+			if fill > idleAfter {
+				idleAfter = fill
+			}
+		}
+	}
+	return &PostgresRateLimitStore{db: db, idleAfter: idleAfter, lastSweep: time.Now()}
+}
+
+// EnsureSchema - Create the bucket table if missing
+func (ps *PostgresRateLimitStore) EnsureSchema() error {
+	if ps.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	_, err := ps.db.Exec(rateLimitSchema)
+	return err
+}
+
+func (ps *PostgresRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitDecision, error) {
+	var tokens float64
+	var allowed bool
+	err := ps.db.QueryRowContext(ctx, rateLimitTakeQuery, key, limit.capacity(), limit.ratePerSecond()).Scan(&tokens, &allowed)
+	if err != nil {
+		return RateLimitDecision{}, err
+	}
+	ps.sweep()
+	return limit.decide(allowed, tokens), nil
+}
+
+// sweep - Delete buckets idle long enough to be full, at most every ten minutes
+func (ps *PostgresRateLimitStore) sweep() {
+	ps.mutex.Lock()
+	if time.Since(ps.lastSweep) < 10*time.Minute {
+		ps.mutex.Unlock()
+		return
+	}
+	ps.lastSweep = time.Now()
+	ps.mutex.Unlock()
+
+	go func() {
+		_, err := ps.db.Exec(`DELETE FROM rate_limit_buckets WHERE updated_at < clock_timestamp() - make_interval(secs => $1)`,
+			ps.idleAfter.Seconds())
+		if err != nil {
+			componentLogger("rate_limit").Error(err, "Failed to prune rate limit buckets", nil)
+		}
+	}()
+}
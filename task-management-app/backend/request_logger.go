@@ -0,0 +1,324 @@
+package main
+
+// Application logging
+// appLogger (an EnhancedLogger) is the process-wide logger. The standard
+// library logger is routed into it, so older log.Printf calls become info
+// entries of the "app" component. New code logs with an explicit level:
+// handlers use requestLogger(r), which stamps every entry with the request's
+// user ID, request ID, trace ID and client IP, and background work uses
+// componentLogger.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var appLogger *EnhancedLogger
+
+var loggerConfig LoggerConfig
+
+type requestLoggerKey struct{}
+
+// initAppLogger - Create appLogger and route the standard logger through it
+func initAppLogger(config LoggerConfig) error {
+	logger, err := NewEnhancedLogger(config)
+	if err != nil {
+		return err
+	}
+	appLogger = logger
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{logger: logger})
+	return nil
+}
+
+// stdLogWriter - Adapts log.Printf output to EnhancedLogger entries
+type stdLogWriter struct {
+	logger *EnhancedLogger
+}
+
+func (w stdLogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimRight(string(p), "\n")
+	w.logger.Log(LogLevelInfo, "app", message, nil)
+	return len(p), nil
+}
+
+// RequestLogger - Logger bound to one request's identity and trace
+type RequestLogger struct {
+	ctx       context.Context
+	component string
+	userID    string
+	ipAddress string
+	userAgent string
+}
+
+// requestLogger - The request's logger, or one built from the request if the middleware did not run
+func requestLogger(r *http.Request) *RequestLogger {
+	if logger, ok := r.Context().Value(requestLoggerKey{}).(*RequestLogger); ok {
+		return logger
+	}
+	return newRequestLogger(r)
+}
+
+// componentLogger - Logger for work that does not belong to a request
+func componentLogger(component string) *RequestLogger {
+	return &RequestLogger{ctx: context.Background(), component: component}
+}
+
+func newRequestLogger(r *http.Request) *RequestLogger {
+	return &RequestLogger{
+		ctx:       r.Context(),
+		component: "http",
+		userID:    requestUserID(r),
+		ipAddress: clientIP(r),
+		userAgent: r.UserAgent(),
+	}
+}
+
+// With - Same request, different component
+func (rl *RequestLogger) With(component string) *RequestLogger {
+	copy := *rl
+	copy.component = component
+	return &copy
+}
+
+// WithContext - Same logger, correlated with the trace active in ctx
+func (rl *RequestLogger) WithContext(ctx context.Context) *RequestLogger {
+	copy := *rl
+	copy.ctx = ctx
+	return &copy
+}
+
+func (rl *RequestLogger) Debug(message string, details map[string]interface{}) {
+	rl.log(LogLevelDebug, message, nil, details)
+}
+
+func (rl *RequestLogger) Info(message string, details map[string]interface{}) {
+	rl.log(LogLevelInfo, message, nil, details)
+}
+
+func (rl *RequestLogger) Warn(message string, details map[string]interface{}) {
+	rl.log(LogLevelWarn, message, nil, details)
+}
+
+func (rl *RequestLogger) Error(err error, message string, details map[string]interface{}) {
+	rl.log(LogLevelError, message, err, details)
+}
+
+// Audit - Record who did what; never filtered by level
+func (rl *RequestLogger) Audit(action string, details map[string]interface{}) {
+	rl.log(LogLevelAudit, action, nil, details)
+}
+
+func (rl *RequestLogger) log(level LogLevel, message string, err error, details map[string]interface{}) {
+	if appLogger == nil {
+		if err != nil {
+			message += ": " + err.Error()
+		}
+		log.Printf("[%s] %s", level, message)
+		return
+	}
+
+	entry := LogEntry{
+		Timestamp: time.Now(),
+		Level:     level,
+		Component: rl.component,
+		Message:   message,
+		Details:   details,
+		UserID:    rl.userID,
+		IPAddress: rl.ipAddress,
+		UserAgent: rl.userAgent,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	entry.TraceID, entry.RequestID = traceIDs(rl.ctx)
+	appLogger.writeLogEntry(entry)
+}
+
+// trustedProxies - Peers whose X-Forwarded-For is believed; from server.trusted_proxies
+var trustedProxies []*net.IPNet
+
+// parseTrustedProxies - IP addresses and CIDR ranges as networks
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP - The connection address or, when that is a trusted proxy, the
+// nearest X-Forwarded-For hop that is not. Headers from any other peer, and
+// X-Real-IP, are ignored: clients can set them to anything.
+func clientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+
+	// Each proxy appends the address it received from, so walk back from the right
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		client = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return client
+}
+
+// requestLoggingMiddleware - Attach a request logger and write one access entry per request
+func requestLoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logger := newRequestLogger(r)
+		ctx := context.WithValue(r.Context(), requestLoggerKey{}, logger)
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		level := LogLevelInfo
+		switch {
+		case status >= 500:
+			level = LogLevelError
+		case status >= 400:
+			level = LogLevelWarn
+		case strings.HasSuffix(route, "/metrics") || strings.Contains(route, "/health") || strings.HasSuffix(route, "/ready"):
+			level = LogLevelDebug
+		}
+		logger.log(level, fmt.Sprintf("%s %s %d", r.Method, route, status), nil, map[string]interface{}{
+			"path":        r.URL.Path,
+			"status":      status,
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+	})
+}
+
+// ========================================
+// LOGGING ADMIN HANDLERS
+// ========================================
+
+// logLevelsResponse - Body of GET and PUT /admin/logging/levels
+type logLevelsResponse struct {
+	Default    LogLevel            `json:"default"`
+	Components map[string]LogLevel `json:"components"`
+}
+
+// getLogLevelsHandler - Current default and per-component minimum levels
+func getLogLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	defaultLevel, components := appLogger.Levels()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevelsResponse{Default: defaultLevel, Components: components})
+}
+
+// updateLogLevelsHandler - Replace the per-component levels (and optionally the default)
+func updateLogLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var request struct {
+		Default    string            `json:"default"`
+		Components map[string]string `json:"components"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var defaultLevel LogLevel
+	if request.Default != "" {
+		level, err := parseLogLevel(request.Default)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defaultLevel = level
+	}
+	components := make(map[string]LogLevel, len(request.Components))
+	for component, name := range request.Components {
+		level, err := parseLogLevel(name)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", component, err), http.StatusBadRequest)
+			return
+		}
+		components[component] = level
+	}
+
+	appLogger.SetLevels(defaultLevel, components)
+	requestLogger(r).With("logger").Audit("Log levels changed", map[string]interface{}{
+		"default":    defaultLevel,
+		"components": components,
+	})
+
+	current, currentComponents := appLogger.Levels()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevelsResponse{Default: current, Components: currentComponents})
+}
@@ -0,0 +1,833 @@
+package main
+
+// Security scan reports
+// A recorded scan is saved as JSON under <log dir>/scans and exported as
+// SARIF 2.1.0 (for code-scanning tools), JSON, CSV and a self-contained HTML
+// page. Every downloadable report - these exports and the text log reports -
+// is stored under <log dir>/reports as its content plus a metadata file, so
+// the list survives restarts. The scanner's raw output is never written to
+// disk: Trivy and Gitleaks reports quote the secrets they found. Two scans
+// are compared by fingerprint (CVE or rule ID, package and file, but not the
+// line, which moves with unrelated edits) into new, fixed and unchanged
+// findings.
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Report formats
+const (
+	ReportFormatSARIF = "sarif"
+	ReportFormatJSON  = "json"
+	ReportFormatCSV   = "csv"
+	ReportFormatHTML  = "html"
+)
+
+const (
+	reportMetadataSuffix  = ".meta.json"
+	maxSecurityScanUpload = 32 << 20
+	sarifSchemaURI        = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// securityReportFormats - Every format a recorded scan is exported in
+var securityReportFormats = []struct {
+	Format      string
+	ContentType string
+	Render      func(*SecurityScanResults) ([]byte, error)
+}{
+	{ReportFormatSARIF, "application/sarif+json", renderSecurityScanSARIF},
+	{ReportFormatJSON, "application/json", renderSecurityScanJSON},
+	{ReportFormatCSV, "text/csv; charset=utf-8", renderSecurityScanCSV},
+	{ReportFormatHTML, "text/html; charset=utf-8", renderSecurityScanHTML},
+}
+
+// SecurityScanComparison - Findings of head relative to base
+type SecurityScanComparison struct {
+	Base      SecurityScanResults `json:"base"`
+	Head      SecurityScanResults `json:"head"`
+	New       []Vulnerability     `json:"new"`
+	Fixed     []Vulnerability     `json:"fixed"`
+	Unchanged []Vulnerability     `json:"unchanged"`
+	Counts    struct {
+		New       int `json:"new"`
+		Fixed     int `json:"fixed"`
+		Unchanged int `json:"unchanged"`
+	} `json:"counts"`
+}
+
+func (r *DownloadableReport) expired(now time.Time) bool {
+	return r.ExpiresAt != nil && now.After(*r.ExpiresAt)
+}
+
+func reportHasTag(report *DownloadableReport, tag string) bool {
+	for _, t := range report.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (el *EnhancedLogger) reportsDir() string {
+	return filepath.Join(el.logDir, "reports")
+}
+
+func (el *EnhancedLogger) scansDir() string {
+	return filepath.Join(el.logDir, "scans")
+}
+
+func (el *EnhancedLogger) reportContentPath(report *DownloadableReport) string {
+	return filepath.Join(el.reportsDir(), report.ID+filepath.Ext(report.Filename))
+}
+
+func (el *EnhancedLogger) reportMetadataPath(reportID string) string {
+	return filepath.Join(el.reportsDir(), reportID+reportMetadataSuffix)
+}
+
+func (el *EnhancedLogger) scanPath(scanID string) string {
+	return filepath.Join(el.scansDir(), scanID+".json")
+}
+
+// removeReportFiles - Delete the content and metadata of report; caller holds reportMutex
+func (el *EnhancedLogger) removeReportFiles(report *DownloadableReport) {
+	for _, path := range []string{el.reportContentPath(report), el.reportMetadataPath(report.ID)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to remove report file %s: %v\n", path, err)
+		}
+	}
+}
+
+// writeFileAtomic - Replace path so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadReports - Index the reports and scans saved by earlier runs
+func (el *EnhancedLogger) loadReports() error {
+	for _, dir := range []string{el.reportsDir(), el.scansDir()} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return err
+		}
+	}
+
+	metadataFiles, _ := filepath.Glob(filepath.Join(el.reportsDir(), "*"+reportMetadataSuffix))
+	for _, path := range metadataFiles {
+		var report DownloadableReport
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &report)
+		}
+		if err != nil || report.ID == "" {
+			fmt.Fprintf(os.Stderr, "Skipping unreadable report metadata %s: %v\n", path, err)
+			continue
+		}
+		el.downloadableReports[report.ID] = &report
+	}
+
+	scanFiles, _ := filepath.Glob(filepath.Join(el.scansDir(), "*.json"))
+	latest := SecurityScanResults{}
+	for _, path := range scanFiles {
+		var scan SecurityScanResults
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &scan)
+		}
+		if err != nil || scan.ScanID == "" {
+			fmt.Fprintf(os.Stderr, "Skipping unreadable security scan %s: %v\n", path, err)
+			continue
+		}
+		scan.Vulnerabilities = nil
+		el.scanIndex[scan.ScanID] = scan
+		if scan.Timestamp.After(latest.Timestamp) {
+			latest = scan
+		}
+	}
+	if latest.ScanID != "" {
+		el.scanResults = &latest
+	}
+	return nil
+}
+
+// saveSecurityScan - Persist scan with its findings; caller holds mutex
+func (el *EnhancedLogger) saveSecurityScan(scan *SecurityScanResults) error {
+	data, err := json.Marshal(scan)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(el.scanPath(scan.ScanID), data); err != nil {
+		return err
+	}
+	header := *scan
+	header.Vulnerabilities = nil
+	el.scanIndex[scan.ScanID] = header
+	return nil
+}
+
+// createSecurityScanReports - Export scan in every report format
+func (el *EnhancedLogger) createSecurityScanReports(scan *SecurityScanResults) []*DownloadableReport {
+	reports := []*DownloadableReport{}
+	for _, format := range securityReportFormats {
+		content, err := format.Render(scan)
+		if err != nil {
+			el.LogError("security-scan", err, "Failed to render security report", map[string]interface{}{
+				"scan_id": scan.ScanID,
+				"format":  format.Format,
+			})
+			continue
+		}
+		report := &DownloadableReport{
+			ID:          uuid.New().String(),
+			Name:        fmt.Sprintf("Security Scan Report (%s)", strings.ToUpper(format.Format)),
+			Description: fmt.Sprintf("%s scan results for %s", scan.ScanType, scan.Target),
+			Filename:    fmt.Sprintf("security-scan-%s.%s", scan.ScanID[:8], format.Format),
+			Format:      format.Format,
+			ScanID:      scan.ScanID,
+			ContentType: format.ContentType,
+			Tags:        []string{"security", "scan", "vulnerabilities", scan.ScanType, format.Format},
+		}
+		if el.storeDownloadableReport(report, content) == nil {
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+// ListSecurityScans - Recorded scans without their findings, newest first
+func (el *EnhancedLogger) ListSecurityScans() []SecurityScanResults {
+	el.mutex.RLock()
+	defer el.mutex.RUnlock()
+
+	scans := make([]SecurityScanResults, 0, len(el.scanIndex))
+	for _, scan := range el.scanIndex {
+		scans = append(scans, scan)
+	}
+	sort.Slice(scans, func(i, j int) bool { return scans[i].Timestamp.After(scans[j].Timestamp) })
+	return scans
+}
+
+// LoadSecurityScan - A recorded scan with its findings
+func (el *EnhancedLogger) LoadSecurityScan(scanID string) (*SecurityScanResults, error) {
+	el.mutex.RLock()
+	_, exists := el.scanIndex[scanID]
+	el.mutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("scan not found")
+	}
+
+	data, err := os.ReadFile(el.scanPath(scanID))
+	if err != nil {
+		return nil, err
+	}
+	var scan SecurityScanResults
+	if err := json.Unmarshal(data, &scan); err != nil {
+		return nil, err
+	}
+	return &scan, nil
+}
+
+// PreviousSecurityScan - The latest scan of the same type and target recorded before scan
+func (el *EnhancedLogger) PreviousSecurityScan(scan SecurityScanResults) *SecurityScanResults {
+	el.mutex.RLock()
+	defer el.mutex.RUnlock()
+
+	var previous *SecurityScanResults
+	for _, candidate := range el.scanIndex {
+		if candidate.ScanType != scan.ScanType || candidate.Target != scan.Target ||
+			!candidate.Timestamp.Before(scan.Timestamp) {
+			continue
+		}
+		if previous == nil || candidate.Timestamp.After(previous.Timestamp) {
+			candidate := candidate
+			previous = &candidate
+		}
+	}
+	return previous
+}
+
+// DeleteSecurityScan - Remove a scan and every report exported from it
+func (el *EnhancedLogger) DeleteSecurityScan(scanID string) error {
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+
+	if _, exists := el.scanIndex[scanID]; !exists {
+		return fmt.Errorf("scan not found")
+	}
+	delete(el.scanIndex, scanID)
+	if err := os.Remove(el.scanPath(scanID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	el.reportMutex.Lock()
+	defer el.reportMutex.Unlock()
+	for id, report := range el.downloadableReports {
+		if report.ScanID == scanID {
+			delete(el.downloadableReports, id)
+			el.removeReportFiles(report)
+		}
+	}
+	return nil
+}
+
+// CompareSecurityScans - New, fixed and unchanged findings of head relative to base
+func (el *EnhancedLogger) CompareSecurityScans(baseID, headID string) (*SecurityScanComparison, error) {
+	base, err := el.LoadSecurityScan(baseID)
+	if err != nil {
+		return nil, fmt.Errorf("base %v", err)
+	}
+	head, err := el.LoadSecurityScan(headID)
+	if err != nil {
+		return nil, fmt.Errorf("head %v", err)
+	}
+
+	comparison := &SecurityScanComparison{
+		New:       []Vulnerability{},
+		Fixed:     []Vulnerability{},
+		Unchanged: []Vulnerability{},
+	}
+
+	// Matched as multisets: two findings with one fingerprint need two in base to be unchanged
+	remaining := make(map[string][]Vulnerability)
+	for _, vuln := range base.Vulnerabilities {
+		key := vulnerabilityFingerprint(vuln)
+		remaining[key] = append(remaining[key], vuln)
+	}
+	for _, vuln := range head.Vulnerabilities {
+		key := vulnerabilityFingerprint(vuln)
+		if len(remaining[key]) > 0 {
+			remaining[key] = remaining[key][1:]
+			comparison.Unchanged = append(comparison.Unchanged, vuln)
+		} else {
+			comparison.New = append(comparison.New, vuln)
+		}
+	}
+	for _, vuln := range base.Vulnerabilities {
+		key := vulnerabilityFingerprint(vuln)
+		if len(remaining[key]) > 0 {
+			remaining[key] = remaining[key][1:]
+			comparison.Fixed = append(comparison.Fixed, vuln)
+		}
+	}
+
+	el.sortVulnerabilitiesBySeverity(comparison.New)
+	el.sortVulnerabilitiesBySeverity(comparison.Fixed)
+	el.sortVulnerabilitiesBySeverity(comparison.Unchanged)
+	comparison.Counts.New = len(comparison.New)
+	comparison.Counts.Fixed = len(comparison.Fixed)
+	comparison.Counts.Unchanged = len(comparison.Unchanged)
+
+	base.Vulnerabilities, head.Vulnerabilities = nil, nil
+	comparison.Base, comparison.Head = *base, *head
+	return comparison, nil
+}
+
+// vulnerabilityFingerprint - Identity of a finding across scans
+func vulnerabilityFingerprint(v Vulnerability) string {
+	id := v.CVE
+	if id == "" {
+		id = v.ID
+	}
+	if id == "" {
+		id = v.Title
+	}
+	return strings.ToLower(strings.Join([]string{id, v.Package, v.Location}, "|"))
+}
+
+// ========================================
+// EXPORT FORMATS
+// ========================================
+
+func renderSecurityScanJSON(scan *SecurityScanResults) ([]byte, error) {
+	return json.MarshalIndent(scan, "", "  ")
+}
+
+type sarifExportLog struct {
+	Schema  string           `json:"$schema"`
+	Version string           `json:"version"`
+	Runs    []sarifExportRun `json:"runs"`
+}
+
+type sarifExportRun struct {
+	Tool struct {
+		Driver struct {
+			Name  string            `json:"name"`
+			Rules []sarifExportRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	AutomationDetails struct {
+		ID string `json:"id"`
+	} `json:"automationDetails"`
+	Results []sarifExportResult `json:"results"`
+}
+
+type sarifExportRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	HelpURI              string       `json:"helpUri,omitempty"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+	Properties sarifExportProperties `json:"properties"`
+}
+
+type sarifExportProperties struct {
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+}
+
+type sarifExportResult struct {
+	RuleID              string                `json:"ruleId"`
+	RuleIndex           int                   `json:"ruleIndex"`
+	Level               string                `json:"level"`
+	Message             sarifMessage          `json:"message"`
+	Locations           []sarifExportLocation `json:"locations,omitempty"`
+	PartialFingerprints map[string]string     `json:"partialFingerprints"`
+	Properties          sarifExportProperties `json:"properties"`
+}
+
+type sarifExportLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *struct {
+			StartLine int `json:"startLine"`
+		} `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+// sarifLevel - SARIF result level; parseSARIF maps it back to the same severity
+func sarifLevel(severity VulnerabilitySeverity) string {
+	switch severity {
+	case SeverityCritical, SeverityHigh:
+		return "error"
+	case SeverityLow:
+		return "note"
+	case SeverityInfo:
+		return "none"
+	default:
+		return "warning"
+	}
+}
+
+// sarifSecuritySeverity - GitHub's security-severity score: the CVSS score when it
+// agrees with the severity, otherwise a score inside the severity's band
+func sarifSecuritySeverity(v Vulnerability) string {
+	if v.CVSS > 0 && severityFromCVSS(v.CVSS) == v.Severity {
+		return fmt.Sprintf("%.1f", v.CVSS)
+	}
+	switch v.Severity {
+	case SeverityCritical:
+		return "9.5"
+	case SeverityHigh:
+		return "8.0"
+	case SeverityMedium:
+		return "5.5"
+	case SeverityLow:
+		return "2.0"
+	default:
+		return ""
+	}
+}
+
+func renderSecurityScanSARIF(scan *SecurityScanResults) ([]byte, error) {
+	run := sarifExportRun{Results: []sarifExportResult{}}
+	run.Tool.Driver.Name = scan.ScanType
+	run.Tool.Driver.Rules = []sarifExportRule{}
+	run.AutomationDetails.ID = fmt.Sprintf("%s/%s/%s", scan.ScanType, scan.Target, scan.ScanID)
+
+	ruleIndex := make(map[string]int)
+	for _, v := range scan.Vulnerabilities {
+		ruleID := v.ID
+		if ruleID == "" {
+			ruleID = v.CVE
+		}
+		index, exists := ruleIndex[ruleID]
+		if !exists {
+			rule := sarifExportRule{ID: ruleID, ShortDescription: sarifMessage{Text: v.Title}}
+			if len(v.References) > 0 {
+				rule.HelpURI = v.References[0]
+			}
+			rule.DefaultConfiguration.Level = sarifLevel(v.Severity)
+			rule.Properties.SecuritySeverity = sarifSecuritySeverity(v)
+			rule.Properties.Tags = []string{"security"}
+			if v.CVE != "" && v.CVE != ruleID {
+				rule.Properties.Tags = append(rule.Properties.Tags, v.CVE)
+			}
+			index = len(run.Tool.Driver.Rules)
+			ruleIndex[ruleID] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+		}
+
+		message := v.Description
+		if message == "" {
+			message = v.Title
+		}
+		if v.Package != "" {
+			message += fmt.Sprintf("\n\nPackage: %s %s", v.Package, v.Version)
+			if v.FixedVersion != "" {
+				message += fmt.Sprintf(" (fixed in %s)", v.FixedVersion)
+			}
+		}
+
+		result := sarifExportResult{
+			RuleID:              ruleID,
+			RuleIndex:           index,
+			Level:               sarifLevel(v.Severity),
+			Message:             sarifMessage{Text: strings.TrimSpace(message)},
+			PartialFingerprints: map[string]string{"taskManagementFinding/v1": vulnerabilityFingerprint(v)},
+			Properties:          sarifExportProperties{SecuritySeverity: sarifSecuritySeverity(v)},
+		}
+		uri := v.Location
+		if uri == "" {
+			uri = v.Package
+		}
+		if uri != "" {
+			var location sarifExportLocation
+			location.PhysicalLocation.ArtifactLocation.URI = uri
+			if v.LineNumber > 0 {
+				location.PhysicalLocation.Region = &struct {
+					StartLine int `json:"startLine"`
+				}{StartLine: v.LineNumber}
+			}
+			result.Locations = []sarifExportLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	return json.MarshalIndent(sarifExportLog{
+		Schema:  sarifSchemaURI,
+		Version: "2.1.0",
+		Runs:    []sarifExportRun{run},
+	}, "", "  ")
+}
+
+// csvCell - Neutralize values a spreadsheet would evaluate as a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func renderSecurityScanCSV(scan *SecurityScanResults) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write([]string{"severity", "id", "cve", "cvss", "title", "package", "version",
+		"fixed_version", "location", "line", "description", "references"})
+
+	for _, v := range scan.Vulnerabilities {
+		cvss, line := "", ""
+		if v.CVSS > 0 {
+			cvss = fmt.Sprintf("%.1f", v.CVSS)
+		}
+		if v.LineNumber > 0 {
+			line = fmt.Sprintf("%d", v.LineNumber)
+		}
+		record := []string{string(v.Severity), v.ID, v.CVE, cvss, v.Title, v.Package, v.Version,
+			v.FixedVersion, v.Location, line, v.Description, strings.Join(v.References, " ")}
+		for i := range record {
+			record[i] = csvCell(record[i])
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+var securityReportTemplate = template.Must(template.New("security-report").Funcs(template.FuncMap{
+	"lower": func(severity VulnerabilitySeverity) string { return strings.ToLower(string(severity)) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Security Scan Report - {{.Scan.Target}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem; color: #1f2328; }
+h1 { font-size: 1.5rem; margin-bottom: 0.25rem; }
+.meta { color: #59636e; margin-bottom: 1.5rem; }
+.summary { display: flex; gap: 0.75rem; margin-bottom: 1.5rem; }
+.summary div { border-radius: 6px; padding: 0.5rem 1rem; text-align: center; min-width: 5rem; }
+.summary strong { display: block; font-size: 1.5rem; }
+table { border-collapse: collapse; width: 100%; font-size: 0.875rem; }
+th, td { border-bottom: 1px solid #d1d9e0; padding: 0.5rem; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+details summary { cursor: pointer; }
+pre { white-space: pre-wrap; margin: 0.5rem 0 0; }
+.sev { font-weight: 600; border-radius: 4px; padding: 0.1rem 0.4rem; }
+.critical { background: #ffebe9; color: #82071e; }
+.high { background: #fff1e5; color: #953800; }
+.medium { background: #fff8c5; color: #7d4e00; }
+.low { background: #ddf4ff; color: #0550ae; }
+.info, .unknown { background: #f6f8fa; color: #59636e; }
+</style>
+</head>
+<body>
+<h1>Security Scan Report</h1>
+<div class="meta">{{.Scan.ScanType}} scan of <strong>{{.Scan.Target}}</strong> at {{.Scan.Timestamp.Format "2006-01-02 15:04:05 MST"}} &middot; scan {{.Scan.ScanID}}</div>
+<div class="summary">
+<div class="critical"><strong>{{.Scan.Summary.CriticalCount}}</strong>Critical</div>
+<div class="high"><strong>{{.Scan.Summary.HighCount}}</strong>High</div>
+<div class="medium"><strong>{{.Scan.Summary.MediumCount}}</strong>Medium</div>
+<div class="low"><strong>{{.Scan.Summary.LowCount}}</strong>Low</div>
+<div class="info"><strong>{{.Scan.Summary.InfoCount}}</strong>Info</div>
+</div>
+{{if .Scan.Summary.Recommendations}}<ul>{{range .Scan.Summary.Recommendations}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Scan.Vulnerabilities}}
+<table>
+<thead><tr><th>Severity</th><th>Finding</th><th>Package</th><th>Location</th></tr></thead>
+<tbody>
+{{range .Scan.Vulnerabilities}}<tr>
+<td><span class="sev {{lower .Severity}}">{{.Severity}}</span>{{if .CVSS}}<br>CVSS {{printf "%.1f" .CVSS}}{{end}}</td>
+<td><details><summary><strong>{{.ID}}</strong> {{.Title}}</summary>{{if .Description}}<pre>{{.Description}}</pre>{{end}}{{range .References}}<div><a href="{{.}}" rel="noreferrer">{{.}}</a></div>{{end}}</details></td>
+<td>{{.Package}}{{if .Version}} {{.Version}}{{end}}{{if .FixedVersion}}<br>fixed in {{.FixedVersion}}{{end}}</td>
+<td>{{.Location}}{{if .LineNumber}}:{{.LineNumber}}{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{else}}<p>No vulnerabilities found.</p>{{end}}
+<p class="meta">Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}</p>
+</body>
+</html>
+`))
+
+func renderSecurityScanHTML(scan *SecurityScanResults) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := securityReportTemplate.Execute(&buffer, struct {
+		Scan      *SecurityScanResults
+		Generated time.Time
+	}{scan, time.Now()})
+	return buffer.Bytes(), err
+}
+
+// ========================================
+// SECURITY REPORT HANDLERS
+// ========================================
+
+// importSecurityScanHandler - POST /admin/security/scans?scanner=trivy&target=backend with the scanner's JSON report as body
+func importSecurityScanHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	scanner := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("scanner")))
+	target := strings.TrimSpace(r.URL.Query().Get("target"))
+	if scanner == "" || target == "" {
+		http.Error(w, "scanner and target are required", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSecurityScanUpload))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Report larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vulnerabilities, err := ParseSecurityScanOutput(scanner, string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scan, reports := appLogger.RecordSecurityScan(scanner, target, string(body), vulnerabilities)
+	header := *scan
+	header.Vulnerabilities = nil
+	response := map[string]interface{}{
+		"scan":    header,
+		"reports": reports,
+	}
+	if previous := appLogger.PreviousSecurityScan(header); previous != nil {
+		if comparison, err := appLogger.CompareSecurityScans(previous.ScanID, scan.ScanID); err == nil {
+			response["comparison"] = comparison
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// listSecurityScansHandler - GET /admin/security/scans, optionally filtered by scan_type and target
+func listSecurityScansHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	scanType := r.URL.Query().Get("scan_type")
+	target := r.URL.Query().Get("target")
+	scans := []SecurityScanResults{}
+	for _, scan := range appLogger.ListSecurityScans() {
+		if (scanType == "" || scan.ScanType == scanType) && (target == "" || scan.Target == target) {
+			scans = append(scans, scan)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scans)
+}
+
+// compareSecurityScansHandler - GET /admin/security/scans/{id}/compare?base=; base defaults to the previous scan of the same target
+func compareSecurityScansHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	headID := mux.Vars(r)["id"]
+	baseID := r.URL.Query().Get("base")
+	if baseID == "" {
+		var head *SecurityScanResults
+		for _, scan := range appLogger.ListSecurityScans() {
+			if scan.ScanID == headID {
+				head = &scan
+				break
+			}
+		}
+		if head == nil {
+			http.Error(w, "scan not found", http.StatusNotFound)
+			return
+		}
+		previous := appLogger.PreviousSecurityScan(*head)
+		if previous == nil {
+			http.Error(w, "No earlier scan of this target to compare with", http.StatusNotFound)
+			return
+		}
+		baseID = previous.ScanID
+	}
+
+	comparison, err := appLogger.CompareSecurityScans(baseID, headID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparison)
+}
+
+// deleteSecurityScanHandler - DELETE /admin/security/scans/{id}, together with its reports
+func deleteSecurityScanHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	if err := appLogger.DeleteSecurityScan(mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listReportsHandler - GET /admin/reports, optionally filtered by scan_id, format and tag
+func listReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	scanID, format, tag := query.Get("scan_id"), query.Get("format"), query.Get("tag")
+	reports := []*DownloadableReport{}
+	for _, report := range appLogger.ListDownloadableReports() {
+		if scanID != "" && report.ScanID != scanID {
+			continue
+		}
+		if format != "" && report.Format != format {
+			continue
+		}
+		if tag != "" && !reportHasTag(report, tag) {
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// downloadReportHandler - GET /admin/reports/{id}: the report as an attachment
+func downloadReportHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	report, err := appLogger.GetDownloadableReport(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	content, err := appLogger.ReadReportContent(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", report.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// HTML reports carry their own styles and nothing else
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Write(content)
+}
+
+// deleteReportHandler - DELETE /admin/reports/{id}
+func deleteReportHandler(w http.ResponseWriter, r *http.Request) {
+	if appLogger == nil {
+		http.Error(w, "Logger not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	if err := appLogger.DeleteDownloadableReport(mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
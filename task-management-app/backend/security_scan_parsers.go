@@ -0,0 +1,617 @@
+package main
+
+// Security scanner output parsers
+// Decodes the JSON reports of Trivy (filesystem/image, schema 2 and the older
+// bare array), Gosec, Nancy (`nancy sleuth -o json`) and Gitleaks (v8, with
+// v7 field names as fallback), plus any SARIF 2.1.0 log, into Vulnerability.
+// Secrets found by Trivy or Gitleaks are never copied into the result.
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var cvePattern = regexp.MustCompile(`CVE-\d{4}-\d{4,}`)
+
+// ParseSecurityScanOutput - Decode a scanner's JSON report; scanner is trivy, gosec, nancy, gitleaks or sarif
+func ParseSecurityScanOutput(scanner, output string) ([]Vulnerability, error) {
+	switch strings.ToLower(scanner) {
+	case "trivy":
+		return parseTrivyJSON([]byte(output))
+	case "gosec":
+		return parseGosecJSON([]byte(output))
+	case "nancy":
+		return parseNancyJSON([]byte(output))
+	case "gitleaks":
+		return parseGitleaksJSON([]byte(output))
+	case "sarif":
+		return parseSARIF([]byte(output))
+	default:
+		return nil, fmt.Errorf("unknown scanner type %q", scanner)
+	}
+}
+
+// severityFromName - Scanner severity words onto VulnerabilitySeverity
+func severityFromName(name string) VulnerabilitySeverity {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "CRITICAL":
+		return SeverityCritical
+	case "HIGH", "ERROR":
+		return SeverityHigh
+	case "MEDIUM", "MODERATE", "WARNING":
+		return SeverityMedium
+	case "LOW", "NOTE":
+		return SeverityLow
+	case "INFO", "NONE", "NEGLIGIBLE":
+		return SeverityInfo
+	default:
+		return SeverityUnknown
+	}
+}
+
+// severityFromCVSS - CVSS v3 qualitative rating
+func severityFromCVSS(score float64) VulnerabilitySeverity {
+	switch {
+	case score >= 9:
+		return SeverityCritical
+	case score >= 7:
+		return SeverityHigh
+	case score >= 4:
+		return SeverityMedium
+	case score > 0:
+		return SeverityLow
+	default:
+		return SeverityUnknown
+	}
+}
+
+// firstCVE - A CVE identifier found in any of the values
+func firstCVE(values ...string) string {
+	for _, value := range values {
+		if match := cvePattern.FindString(value); match != "" {
+			return match
+		}
+	}
+	return ""
+}
+
+// appendReference - Add a URL once
+func appendReference(references []string, url string) []string {
+	if url == "" {
+		return references
+	}
+	for _, existing := range references {
+		if existing == url {
+			return references
+		}
+	}
+	return append(references, url)
+}
+
+// ========================================
+// TRIVY
+// ========================================
+
+type trivyReport struct {
+	SchemaVersion int           `json:"SchemaVersion"`
+	ArtifactName  string        `json:"ArtifactName"`
+	Results       []trivyResult `json:"Results"`
+}
+
+type trivyResult struct {
+	Target            string                  `json:"Target"`
+	Class             string                  `json:"Class"`
+	Type              string                  `json:"Type"`
+	Vulnerabilities   []trivyVulnerability    `json:"Vulnerabilities"`
+	Misconfigurations []trivyMisconfiguration `json:"Misconfigurations"`
+	Secrets           []trivySecret           `json:"Secrets"`
+}
+
+type trivyVulnerability struct {
+	VulnerabilityID  string                    `json:"VulnerabilityID"`
+	PkgName          string                    `json:"PkgName"`
+	PkgPath          string                    `json:"PkgPath"`
+	InstalledVersion string                    `json:"InstalledVersion"`
+	FixedVersion     string                    `json:"FixedVersion"`
+	Title            string                    `json:"Title"`
+	Description      string                    `json:"Description"`
+	Severity         string                    `json:"Severity"`
+	PrimaryURL       string                    `json:"PrimaryURL"`
+	References       []string                  `json:"References"`
+	CVSS             map[string]trivyCVSSScore `json:"CVSS"`
+}
+
+type trivyCVSSScore struct {
+	V2Score float64 `json:"V2Score"`
+	V3Score float64 `json:"V3Score"`
+}
+
+type trivyMisconfiguration struct {
+	ID            string   `json:"ID"`
+	AVDID         string   `json:"AVDID"`
+	Title         string   `json:"Title"`
+	Description   string   `json:"Description"`
+	Message       string   `json:"Message"`
+	Resolution    string   `json:"Resolution"`
+	Severity      string   `json:"Severity"`
+	Status        string   `json:"Status"`
+	PrimaryURL    string   `json:"PrimaryURL"`
+	References    []string `json:"References"`
+	CauseMetadata struct {
+		StartLine int `json:"StartLine"`
+	} `json:"CauseMetadata"`
+}
+
+type trivySecret struct {
+	RuleID    string `json:"RuleID"`
+	Category  string `json:"Category"`
+	Severity  string `json:"Severity"`
+	Title     string `json:"Title"`
+	StartLine int    `json:"StartLine"`
+}
+
+// trivyCVSS - NVD v3 score when present, otherwise the highest vendor score
+func trivyCVSS(scores map[string]trivyCVSSScore) float64 {
+	if nvd, ok := scores["nvd"]; ok && nvd.V3Score > 0 {
+		return nvd.V3Score
+	}
+	var best, bestV2 float64
+	for _, score := range scores {
+		if score.V3Score > best {
+			best = score.V3Score
+		}
+		if score.V2Score > bestV2 {
+			bestV2 = score.V2Score
+		}
+	}
+	if best > 0 {
+		return best
+	}
+	return bestV2
+}
+
+func parseTrivyJSON(data []byte) ([]Vulnerability, error) {
+	var results []trivyResult
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		// Reports before schema 2 are a bare array of results
+		if err := json.Unmarshal(data, &results); err != nil {
+			return nil, fmt.Errorf("invalid trivy report: %v", err)
+		}
+	} else {
+		var report trivyReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("invalid trivy report: %v", err)
+		}
+		results = report.Results
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, result := range results {
+		for _, v := range result.Vulnerabilities {
+			location := v.PkgPath
+			if location == "" {
+				location = result.Target
+			}
+			references := appendReference(nil, v.PrimaryURL)
+			for _, ref := range v.References {
+				references = appendReference(references, ref)
+			}
+			title := v.Title
+			if title == "" {
+				title = fmt.Sprintf("%s in %s", v.VulnerabilityID, v.PkgName)
+			}
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:           v.VulnerabilityID,
+				Title:        title,
+				Description:  v.Description,
+				Severity:     severityFromName(v.Severity),
+				CVE:          firstCVE(v.VulnerabilityID),
+				CVSS:         trivyCVSS(v.CVSS),
+				Package:      v.PkgName,
+				Version:      v.InstalledVersion,
+				FixedVersion: v.FixedVersion,
+				Location:     location,
+				References:   references,
+			})
+		}
+
+		for _, m := range result.Misconfigurations {
+			if m.Status == "PASS" {
+				continue
+			}
+			id := m.AVDID
+			if id == "" {
+				id = m.ID
+			}
+			description := m.Description
+			if m.Message != "" {
+				description = m.Message + "\n\n" + description
+			}
+			if m.Resolution != "" {
+				description += "\n\nResolution: " + m.Resolution
+			}
+			references := appendReference(nil, m.PrimaryURL)
+			for _, ref := range m.References {
+				references = appendReference(references, ref)
+			}
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:          id,
+				Title:       m.Title,
+				Description: strings.TrimSpace(description),
+				Severity:    severityFromName(m.Severity),
+				Location:    result.Target,
+				LineNumber:  m.CauseMetadata.StartLine,
+				References:  references,
+			})
+		}
+
+		for _, s := range result.Secrets {
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:          s.RuleID,
+				Title:       s.Title,
+				Description: fmt.Sprintf("%s secret detected (%s)", s.Category, s.RuleID),
+				Severity:    severityFromName(s.Severity),
+				Location:    result.Target,
+				LineNumber:  s.StartLine,
+			})
+		}
+	}
+	return vulnerabilities, nil
+}
+
+// ========================================
+// GOSEC
+// ========================================
+
+type gosecReport struct {
+	Issues []gosecIssue `json:"Issues"`
+}
+
+type gosecIssue struct {
+	Severity   string `json:"severity"`
+	Confidence string `json:"confidence"`
+	CWE        struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	} `json:"cwe"`
+	RuleID  string `json:"rule_id"`
+	Details string `json:"details"`
+	File    string `json:"file"`
+	Code    string `json:"code"` // not copied: G101 findings quote the credential
+	Line    string `json:"line"` // "42" or a range such as "42-44"
+	NoSec   bool   `json:"nosec"`
+}
+
+func parseGosecJSON(data []byte) ([]Vulnerability, error) {
+	var report gosecReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid gosec report: %v", err)
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, issue := range report.Issues {
+		if issue.NoSec {
+			continue
+		}
+		line, _ := strconv.Atoi(strings.SplitN(issue.Line, "-", 2)[0])
+		description := issue.Details
+		if issue.Confidence != "" {
+			description += fmt.Sprintf(" (confidence: %s)", strings.ToLower(issue.Confidence))
+		}
+		var references []string
+		references = appendReference(references, issue.CWE.URL)
+
+		title := issue.Details
+		if issue.CWE.ID != "" {
+			title = fmt.Sprintf("%s (CWE-%s)", issue.Details, issue.CWE.ID)
+		}
+		vulnerabilities = append(vulnerabilities, Vulnerability{
+			ID:          issue.RuleID,
+			Title:       title,
+			Description: description,
+			Severity:    severityFromName(issue.Severity),
+			Location:    issue.File,
+			LineNumber:  line,
+			References:  references,
+		})
+	}
+	return vulnerabilities, nil
+}
+
+// ========================================
+// NANCY
+// ========================================
+
+type nancyReport struct {
+	Audited    []nancyCoordinate `json:"audited"`
+	Vulnerable []nancyCoordinate `json:"vulnerable"`
+}
+
+type nancyCoordinate struct {
+	Coordinates     string               `json:"Coordinates"`
+	Reference       string               `json:"Reference"`
+	Vulnerabilities []nancyVulnerability `json:"Vulnerabilities"`
+}
+
+type nancyVulnerability struct {
+	ID          string      `json:"ID"`
+	Title       string      `json:"Title"`
+	Description string      `json:"Description"`
+	CvssScore   json.Number `json:"CvssScore"`
+	CvssVector  string      `json:"CvssVector"`
+	Cve         string      `json:"Cve"`
+	Reference   string      `json:"Reference"`
+	Excluded    bool        `json:"Excluded"`
+}
+
+// parsePackageURL - "pkg:golang/github.com/x/y@v1.2.3" into name and version
+func parsePackageURL(purl string) (string, string) {
+	purl = strings.TrimPrefix(purl, "pkg:")
+	if _, rest, found := strings.Cut(purl, "/"); found {
+		purl = rest
+	}
+	name, version, _ := strings.Cut(purl, "@")
+	return name, version
+}
+
+func parseNancyJSON(data []byte) ([]Vulnerability, error) {
+	var report nancyReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid nancy report: %v", err)
+	}
+
+	coordinates := report.Vulnerable
+	if len(coordinates) == 0 {
+		coordinates = report.Audited
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, coordinate := range coordinates {
+		name, version := parsePackageURL(coordinate.Coordinates)
+		for _, v := range coordinate.Vulnerabilities {
+			if v.Excluded {
+				continue
+			}
+			score, _ := v.CvssScore.Float64()
+			description := v.Description
+			if v.CvssVector != "" {
+				description += "\n\nCVSS vector: " + v.CvssVector
+			}
+			references := appendReference(nil, v.Reference)
+			references = appendReference(references, coordinate.Reference)
+
+			id := v.Cve
+			if id == "" {
+				id = v.ID
+			}
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:          id,
+				Title:       v.Title,
+				Description: description,
+				Severity:    severityFromCVSS(score),
+				CVE:         firstCVE(v.Cve, v.Title),
+				CVSS:        score,
+				Package:     name,
+				Version:     version,
+				Location:    coordinate.Coordinates,
+				References:  references,
+			})
+		}
+	}
+	return vulnerabilities, nil
+}
+
+// ========================================
+// GITLEAKS
+// ========================================
+
+type gitleaksFinding struct {
+	Description string          `json:"Description"`
+	RuleID      string          `json:"RuleID"`
+	File        string          `json:"File"`
+	StartLine   int             `json:"StartLine"`
+	Commit      string          `json:"Commit"`
+	Author      string          `json:"Author"`
+	Date        string          `json:"Date"`
+	Tags        json.RawMessage `json:"Tags"` // an array in v8, a comma-separated string in v7
+	Fingerprint string          `json:"Fingerprint"`
+
+	// v7 field names
+	Rule       string `json:"rule"`
+	FileV7     string `json:"file"`
+	LineNumber int    `json:"lineNumber"`
+	CommitV7   string `json:"commit"`
+}
+
+func parseGitleaksJSON(data []byte) ([]Vulnerability, error) {
+	var findings []gitleaksFinding
+	if err := json.Unmarshal(data, &findings); err != nil {
+		return nil, fmt.Errorf("invalid gitleaks report: %v", err)
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, f := range findings {
+		rule, file, line, commit := f.RuleID, f.File, f.StartLine, f.Commit
+		if rule == "" {
+			rule = f.Rule
+		}
+		if file == "" {
+			file = f.FileV7
+		}
+		if line == 0 {
+			line = f.LineNumber
+		}
+		if commit == "" {
+			commit = f.CommitV7
+		}
+
+		title := f.Description
+		if title == "" {
+			title = rule
+		}
+		description := fmt.Sprintf("Secret matching rule %s", rule)
+		if commit != "" {
+			description += fmt.Sprintf(" committed in %s", commit)
+			if f.Author != "" {
+				description += fmt.Sprintf(" by %s", f.Author)
+			}
+			if f.Date != "" {
+				description += fmt.Sprintf(" on %s", f.Date)
+			}
+		}
+		vulnerabilities = append(vulnerabilities, Vulnerability{
+			ID:          rule,
+			Title:       title,
+			Description: description,
+			Severity:    SeverityCritical,
+			Location:    file,
+			LineNumber:  line,
+		})
+	}
+	return vulnerabilities, nil
+}
+
+// ========================================
+// SARIF 2.1.0
+// ========================================
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name  string      `json:"name"`
+			Rules []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+	Help             sarifMessage `json:"help"`
+	HelpURI          string       `json:"helpUri"`
+	Properties       struct {
+		SecuritySeverity string   `json:"security-severity"`
+		Tags             []string `json:"tags"`
+	} `json:"properties"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifMessage struct {
+	Text     string `json:"text"`
+	Markdown string `json:"markdown,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	RuleIndex  *int            `json:"ruleIndex"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations"`
+	Properties struct {
+		SecuritySeverity string `json:"security-severity"`
+	} `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine int `json:"startLine"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+func parseSARIF(data []byte) ([]Vulnerability, error) {
+	var sarif sarifLog
+	if err := json.Unmarshal(data, &sarif); err != nil {
+		return nil, fmt.Errorf("invalid SARIF log: %v", err)
+	}
+	if sarif.Version != "" && sarif.Version != "2.1.0" {
+		return nil, fmt.Errorf("unsupported SARIF version %s", sarif.Version)
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, run := range sarif.Runs {
+		rules := make(map[string]sarifRule, len(run.Tool.Driver.Rules))
+		for _, rule := range run.Tool.Driver.Rules {
+			rules[rule.ID] = rule
+		}
+
+		for _, result := range run.Results {
+			rule, ok := rules[result.RuleID]
+			if !ok && result.RuleIndex != nil && *result.RuleIndex < len(run.Tool.Driver.Rules) {
+				rule = run.Tool.Driver.Rules[*result.RuleIndex]
+			}
+			ruleID := result.RuleID
+			if ruleID == "" {
+				ruleID = rule.ID
+			}
+
+			// GitHub's security-severity carries a CVSS-like score; otherwise fall back to the level
+			scoreText := result.Properties.SecuritySeverity
+			if scoreText == "" {
+				scoreText = rule.Properties.SecuritySeverity
+			}
+			score, _ := strconv.ParseFloat(scoreText, 64)
+			severity := severityFromCVSS(score)
+			if score == 0 {
+				level := result.Level
+				if level == "" {
+					level = rule.DefaultConfiguration.Level
+				}
+				if level == "" {
+					level = "warning" // SARIF default
+				}
+				severity = severityFromName(level)
+			}
+
+			title := rule.ShortDescription.Text
+			if title == "" {
+				title = rule.Name
+			}
+			if title == "" {
+				title = result.Message.Text
+			}
+			description := result.Message.Text
+			if rule.FullDescription.Text != "" && rule.FullDescription.Text != description {
+				description += "\n\n" + rule.FullDescription.Text
+			}
+
+			vulnerability := Vulnerability{
+				ID:          ruleID,
+				Title:       title,
+				Description: strings.TrimSpace(description),
+				Severity:    severity,
+				CVE:         firstCVE(append([]string{ruleID, title}, rule.Properties.Tags...)...),
+				CVSS:        score,
+				References:  appendReference(nil, rule.HelpURI),
+			}
+			if len(result.Locations) > 0 {
+				location := result.Locations[0].PhysicalLocation
+				vulnerability.Location = location.ArtifactLocation.URI
+				vulnerability.LineNumber = location.Region.StartLine
+			}
+			if run.Tool.Driver.Name != "" {
+				vulnerability.Description = strings.TrimSpace(vulnerability.Description + "\n\nReported by " + run.Tool.Driver.Name)
+			}
+			vulnerabilities = append(vulnerabilities, vulnerability)
+		}
+	}
+	return vulnerabilities, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+// Session authentication
+// Browser sessions send "Authorization: Bearer <JWT>". Session tokens are
+// HS256-signed with auth.jwt_secret (JWT_SECRET), and their sub claim is the
+// user ID. sessionAuthMiddleware checks the signature, expiry and, when
+// configured, issuer and audience before the request gets a principal.
+// Personal access tokens ("tm_pat_...") are verified by accessTokenMiddleware,
+// which sets the principal the same way.
+//
+// The principal is the only identity handlers see: requestUserID reads it and
+// never the X-User-ID header or a user_id parameter, which anyone can send.
+//
+// Browsers cannot set headers on a WebSocket handshake, so /ws also accepts
+// the JWT as a "bearer.<JWT>" entry in Sec-WebSocket-Protocol, offered next to
+// websocketProtocol, which is the one the server echoes back.
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// How a principal was authenticated
+const (
+	PrincipalSession = "session"
+	PrincipalToken   = "token"
+)
+
+// sessionClockSkew - Leeway for exp and nbf between the issuer's clock and ours
+const sessionClockSkew = 30 * time.Second
+
+// minJWTSecretLength - Shortest HS256 key accepted, in bytes
+const minJWTSecretLength = 32
+
+// WebSocket subprotocols: the one the server speaks, and the prefix of the
+// entry that carries a browser's session token
+const (
+	websocketProtocol     = "task-management"
+	webSocketBearerPrefix = "bearer."
+)
+
+var (
+	errSessionMalformed = errors.New("malformed session token")
+	errSessionSignature = errors.New("invalid session token signature")
+	errSessionExpired   = errors.New("session token has expired")
+	errSessionNotYet    = errors.New("session token is not valid yet")
+	errSessionClaims    = errors.New("session token was not issued for this service")
+)
+
+var sessionAuthTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "session_authentications_total",
+	Help: "Requests presenting a session JWT, by outcome.",
+}, []string{"result"})
+
+// AuthConfig - How session JWTs are verified
+type AuthConfig struct {
+	JWTSecret   string
+	JWTIssuer   string // required iss claim; empty accepts any
+	JWTAudience string // required aud entry; empty accepts any
+}
+
+var authConfig AuthConfig
+
+// Principal - The verified caller of a request
+type Principal struct {
+	UserID string
+	Method string // PrincipalSession or PrincipalToken
+}
+
+type principalKey struct{}
+
+// requestPrincipal - The request's verified caller, or nil when it is anonymous
+func requestPrincipal(r *http.Request) *Principal {
+	principal, _ := r.Context().Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// withPrincipal - Attach the verified caller to the request and its logger
+func withPrincipal(r *http.Request, principal *Principal) *http.Request {
+	if logger, ok := r.Context().Value(requestLoggerKey{}).(*RequestLogger); ok {
+		logger.userID = principal.UserID
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// sessionClaims - The registered claims a session token is checked against
+type sessionClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+}
+
+// hasAudience - Whether aud, a string or an array of strings, names audience
+func (sc *sessionClaims) hasAudience(audience string) bool {
+	var single string
+	if json.Unmarshal(sc.Audience, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(sc.Audience, &list) == nil {
+		for _, entry := range list {
+			if entry == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySessionToken - Check an HS256 JWT against config and return its claims
+func verifySessionToken(token string, config AuthConfig, now time.Time) (*sessionClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errSessionMalformed
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errSessionMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errSessionMalformed
+	}
+	// Only the algorithm we sign with; never "none" or an asymmetric alg keyed with our secret
+	if header.Alg != "HS256" {
+		return nil, errSessionSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errSessionMalformed
+	}
+	mac := hmac.New(sha256.New, []byte(config.JWTSecret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errSessionSignature
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errSessionMalformed
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil || claims.Subject == "" || claims.ExpiresAt == 0 {
+		return nil, errSessionMalformed
+	}
+	if now.Add(-sessionClockSkew).Unix() >= claims.ExpiresAt {
+		return nil, errSessionExpired
+	}
+	if claims.NotBefore != 0 && now.Add(sessionClockSkew).Unix() < claims.NotBefore {
+		return nil, errSessionNotYet
+	}
+	if config.JWTIssuer != "" && claims.Issuer != config.JWTIssuer {
+		return nil, errSessionClaims
+	}
+	if config.JWTAudience != "" && !claims.hasAudience(config.JWTAudience) {
+		return nil, errSessionClaims
+	}
+	return &claims, nil
+}
+
+// presentedSessionToken - The bearer value when it is not a personal access token
+func presentedSessionToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if header == "" && websocket.IsWebSocketUpgrade(r) {
+		return webSocketSessionToken(r)
+	}
+	scheme, value, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	if value = strings.TrimSpace(value); strings.HasPrefix(value, accessTokenPrefix) {
+		return ""
+	}
+	return value
+}
+
+// webSocketSessionToken - The JWT a browser offers as a "bearer.<JWT>" subprotocol,
+// since it cannot set the Authorization header on a WebSocket handshake
+func webSocketSessionToken(r *http.Request) string {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if token, ok := strings.CutPrefix(protocol, webSocketBearerPrefix); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+// sessionAuthMiddleware - Verify session JWTs and make their subject the request's principal
+func sessionAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := presentedSessionToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if authConfig.JWTSecret == "" {
+			sessionAuthTotal.WithLabelValues("unconfigured").Inc()
+			http.Error(w, "Session authentication unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		claims, err := verifySessionToken(token, authConfig, time.Now())
+		if err != nil {
+			sessionAuthTotal.WithLabelValues("rejected").Inc()
+			requestLogger(r).With("auth").Warn("Rejected session token", map[string]interface{}{"reason": err.Error()})
+			rejectAccessToken(w, http.StatusUnauthorized, "invalid_token", "", err.Error())
+			return
+		}
+		sessionAuthTotal.WithLabelValues("ok").Inc()
+		next.ServeHTTP(w, withPrincipal(r, &Principal{UserID: claims.Subject, Method: PrincipalSession}))
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+// Graceful shutdown
+// On SIGINT or SIGTERM the readiness probe starts failing at once so the load
+// balancer stops routing new traffic; after ReadinessDelay the HTTP server
+// stops accepting connections and waits for in-flight requests. WebSocket
+// connections are hijacked and not tracked by http.Server, so the hub sends
+// each client a 1012 (service restart) close frame with a reconnect hint.
+// Background workers then finish the delivery they are on - undelivered
+// notifications and webhooks stay in their Postgres outboxes - running timers
+// are saved for the next start, and finally the DB pool, the trace exporter
+// and the log file are closed. All steps share one deadline, GracePeriod.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ShutdownConfig - Timing of the shutdown sequence
+type ShutdownConfig struct {
+	GracePeriod      time.Duration // deadline for the whole sequence
+	ReadinessDelay   time.Duration // time between failing /ready and closing the listener
+	WSReconnectAfter time.Duration // reconnect hint sent to WebSocket clients
+	TimerStateFile   string        // where running timers are saved; empty discards them
+}
+
+var shutdownConfig ShutdownConfig
+
+// serve - Run server until it fails or a shutdown signal arrives
+func serve(server *http.Server) {
+	// Live log tails would otherwise hold Shutdown until the grace period ends
+	server.RegisterOnShutdown(func() {
+		if appLogger != nil {
+			appLogger.CloseSubscriptions()
+		}
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, http.ErrServerClosed) {
+			componentLogger("shutdown").Error(err, "Server failed", map[string]interface{}{"addr": server.Addr})
+			if appLogger != nil {
+				appLogger.Close()
+			}
+			os.Exit(1)
+		}
+	case sig := <-signals:
+		componentLogger("shutdown").Info("Shutting down", map[string]interface{}{"signal": sig.String(), "grace_period": shutdownConfig.GracePeriod.String()})
+		gracefulShutdown(server)
+	}
+}
+
+// gracefulShutdown - Drain traffic and workers, then release resources
+func gracefulShutdown(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownConfig.GracePeriod)
+	defer cancel()
+
+	if healthCheckService != nil {
+		healthCheckService.MarkShuttingDown()
+		healthCheckService.Stop()
+	}
+	if shutdownConfig.ReadinessDelay > 0 {
+		select {
+		case <-time.After(shutdownConfig.ReadinessDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		componentLogger("shutdown").Error(err, "HTTP server did not drain", nil)
+	} else {
+		componentLogger("shutdown").Info("HTTP server drained", nil)
+	}
+
+	if hub != nil {
+		hubCtx, hubCancel := context.WithTimeout(ctx, 5*time.Second)
+		closed := hub.CloseAll(hubCtx, shutdownConfig.WSReconnectAfter)
+		hubCancel()
+		componentLogger("shutdown").Info("Closed WebSocket connections", map[string]interface{}{"count": closed})
+	}
+
+	if inboundMail != nil {
+		shutdownStep(ctx, "inbound email", inboundMail.Stop)
+	}
+	if notificationPipeline != nil {
+		shutdownStep(ctx, "notification outbox", notificationPipeline.outbox.Stop)
+	}
+	if webhookDispatcher != nil {
+		shutdownStep(ctx, "webhook dispatcher", webhookDispatcher.Stop)
+	}
+
+	if timeTrackingEngine != nil && shutdownConfig.TimerStateFile != "" {
+		if saved, err := timeTrackingEngine.SaveActiveTimers(shutdownConfig.TimerStateFile); err != nil {
+			componentLogger("shutdown").Error(err, "Failed to save running timers", nil)
+		} else if saved > 0 {
+			componentLogger("shutdown").Info("Saved running timers", map[string]interface{}{"count": saved, "file": shutdownConfig.TimerStateFile})
+		}
+	}
+
+	if db != nil {
+		if err := db.Close(); err != nil {
+			componentLogger("shutdown").Error(err, "Failed to close database pool", nil)
+		}
+	}
+	if err := tracingShutdown(ctx); err != nil {
+		componentLogger("shutdown").Error(err, "Failed to flush traces", nil)
+	}
+
+	componentLogger("shutdown").Info("Shutdown complete", nil)
+	if appLogger != nil {
+		appLogger.Close()
+	}
+}
+
+// shutdownStep - Run stop, giving up (and saying so) when the grace period ends first
+func shutdownStep(ctx context.Context, name string, stop func()) {
+	done := make(chan struct{})
+	go func() {
+		stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		componentLogger("shutdown").Info("Stopped "+name, nil)
+	case <-ctx.Done():
+		componentLogger("shutdown").Error(ctx.Err(), "Gave up waiting for "+name, nil)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
@@ -124,6 +127,22 @@ func (ste *SimpleTimeTrackingEngine) StopTimeEntry(userID, entryID, notes string
 	return nil, nil // Entry not found
 }
 
+// ActiveTimerCount - Number of running time entries across all users
+func (ste *SimpleTimeTrackingEngine) ActiveTimerCount() int {
+	ste.mutex.RLock()
+	defer ste.mutex.RUnlock()
+
+	count := 0
+	for _, entries := range ste.timeEntries {
+		for _, entry := range entries {
+			if entry.IsActive {
+				count++
+			}
+		}
+	}
+	return count
+}
+
 // GetTimeEntries - Get time entries for user and/or task
 func (ste *SimpleTimeTrackingEngine) GetTimeEntries(userID, taskID string) ([]*SimpleTimeEntry, error) {
 	ste.mutex.RLock()
@@ -255,4 +274,52 @@ func (ste *SimpleTimeTrackingEngine) DetectActivity(userID string, context map[s
 // Helper function to generate IDs
 func generateID() string {
 	return time.Now().Format("20060102150405") + "000"
-}
\ No newline at end of file
+}
+// SaveActiveTimers - Write running time entries to path so a restart can resume them
+func (ste *SimpleTimeTrackingEngine) SaveActiveTimers(path string) (int, error) {
+	ste.mutex.RLock()
+	var active []*SimpleTimeEntry
+	for _, entries := range ste.timeEntries {
+		for _, entry := range entries {
+			if entry.IsActive {
+				active = append(active, entry)
+			}
+		}
+	}
+	data, err := json.Marshal(active)
+	ste.mutex.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return 0, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return 0, err
+	}
+	return len(active), os.Rename(tmp, path)
+}
+
+// RestoreActiveTimers - Resume entries saved by SaveActiveTimers and remove the file
+func (ste *SimpleTimeTrackingEngine) RestoreActiveTimers(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var active []*SimpleTimeEntry
+	if err := json.Unmarshal(data, &active); err != nil {
+		return 0, err
+	}
+
+	ste.mutex.Lock()
+	for _, entry := range active {
+		ste.timeEntries[entry.UserID] = append(ste.timeEntries[entry.UserID], entry)
+	}
+	ste.mutex.Unlock()
+	return len(active), os.Remove(path)
+}
@@ -0,0 +1,530 @@
+package main
+
+// Chat slash commands
+// Slack and Mattermost post a form when a user types /task in a channel. Both
+// platforms end up in the same command parser, which calls the task service:
+//
+//	/task create <title> [project:<id>] [priority:<p>] [@assignee]
+//	/task done <id>
+//	/task comment <id> <text>
+//	/task show <id>
+//	/task link <code>
+//	/task help
+//
+// Slack requests are verified with the signing secret (X-Slack-Signature),
+// Mattermost requests with the command token sent in the form.
+//
+// Commands run as the account linked to the sender's platform, team_id and
+// user_id in chat_account_links, never as whoever holds the user_name handle,
+// which chat users can change. Linking takes a short-lived code the user creates
+// while signed in (POST /me/chat-link-codes) and then sends with /task link, so
+// it proves control of both accounts. Unlinked senders can only link or get help.
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SlashCommandConfig - Secrets used to verify incoming commands
+type SlashCommandConfig struct {
+	SlackSigningSecret     string
+	MattermostCommandToken string
+}
+
+// SlashCommandResponse - Reply format understood by both Slack and Mattermost
+type SlashCommandResponse struct {
+	ResponseType string `json:"response_type"` // "ephemeral" or "in_channel"
+	Text         string `json:"text"`
+}
+
+// Chat platforms a link can belong to
+const (
+	ChatPlatformSlack      = "slack"
+	ChatPlatformMattermost = "mattermost"
+)
+
+// ChatIdentity - The sender of a command as the platform identifies them
+type ChatIdentity struct {
+	Platform   string `json:"platform"`
+	TeamID     string `json:"team_id"`
+	ChatUserID string `json:"chat_user_id"`
+}
+
+// ChatAccountLink - A chat identity commands run as an app user for
+type ChatAccountLink struct {
+	ChatIdentity
+	UserID   string    `json:"user_id"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// ChatAccountStore - Links between chat identities and app users
+type ChatAccountStore struct {
+	db *sql.DB
+}
+
+var slashCommandConfig SlashCommandConfig
+
+var chatAccounts *ChatAccountStore
+
+const slackSignatureMaxAge = 5 * time.Minute
+
+// chatLinkCodeLifetime - How long a code from POST /me/chat-link-codes can be redeemed
+const chatLinkCodeLifetime = 10 * time.Minute
+
+const slashCommandHelp = "Usage:\n" +
+	"`/task create <title> [project:<id>] [priority:low|medium|high] [@assignee]`\n" +
+	"`/task done <id>`\n" +
+	"`/task comment <id> <text>`\n" +
+	"`/task show <id>`\n" +
+	"`/task link <code>`"
+
+const chatAccountSchema = `
+CREATE TABLE IF NOT EXISTS chat_account_links (
+  platform VARCHAR(20) NOT NULL,
+  team_id VARCHAR(100) NOT NULL,
+  chat_user_id VARCHAR(100) NOT NULL,
+  user_id VARCHAR(50) NOT NULL,
+  linked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (platform, team_id, chat_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_account_links_user ON chat_account_links (user_id);
+
+CREATE TABLE IF NOT EXISTS chat_link_codes (
+  code_hash CHAR(64) PRIMARY KEY,
+  user_id VARCHAR(50) NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
+`
+
+// NewChatAccountStore - Create a store over db
+func NewChatAccountStore(db *sql.DB) *ChatAccountStore {
+	return &ChatAccountStore{db: db}
+}
+
+// EnsureSchema - Create the link and link code tables
+func (s *ChatAccountStore) EnsureSchema() error {
+	if s.db == nil {
+		return fmt.Errorf("database not available")
+	}
+	_, err := s.db.Exec(chatAccountSchema)
+	return err
+}
+
+// CreateLinkCode - A one-time code that links the sender of /task link to userID
+func (s *ChatAccountStore) CreateLinkCode(ctx context.Context, userID string) (string, time.Time, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	code := base32.StdEncoding.EncodeToString(buf)
+	expiresAt := time.Now().Add(chatLinkCodeLifetime)
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM chat_link_codes WHERE expires_at < NOW()"); err != nil {
+		return "", time.Time{}, err
+	}
+	if _, err := s.db.ExecContext(ctx,
+		"INSERT INTO chat_link_codes (code_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		hashAccessToken(code), userID, expiresAt,
+	); err != nil {
+		return "", time.Time{}, err
+	}
+	return code, expiresAt, nil
+}
+
+// RedeemLinkCode - Consume code and link identity to the user who created it
+func (s *ChatAccountStore) RedeemLinkCode(ctx context.Context, identity ChatIdentity, code string) (string, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx,
+		"DELETE FROM chat_link_codes WHERE code_hash = $1 AND expires_at > NOW() RETURNING user_id",
+		hashAccessToken(strings.ToUpper(code)),
+	).Scan(&userID)
+	if err != nil {
+		return "", err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO chat_account_links (platform, team_id, chat_user_id, user_id, linked_at) VALUES ($1, $2, $3, $4, NOW())
+		 ON CONFLICT (platform, team_id, chat_user_id) DO UPDATE SET user_id = EXCLUDED.user_id, linked_at = EXCLUDED.linked_at`,
+		identity.Platform, identity.TeamID, identity.ChatUserID, userID,
+	)
+	return userID, err
+}
+
+// LinkedUserID - The app user a chat identity is linked to, or sql.ErrNoRows
+func (s *ChatAccountStore) LinkedUserID(ctx context.Context, identity ChatIdentity) (string, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT user_id FROM chat_account_links WHERE platform = $1 AND team_id = $2 AND chat_user_id = $3",
+		identity.Platform, identity.TeamID, identity.ChatUserID,
+	).Scan(&userID)
+	return userID, err
+}
+
+// ListLinks - Chat identities linked to userID
+func (s *ChatAccountStore) ListLinks(ctx context.Context, userID string) ([]ChatAccountLink, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT platform, team_id, chat_user_id, user_id, linked_at FROM chat_account_links WHERE user_id = $1 ORDER BY linked_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ChatAccountLink{}
+	for rows.Next() {
+		var link ChatAccountLink
+		if err := rows.Scan(&link.Platform, &link.TeamID, &link.ChatUserID, &link.UserID, &link.LinkedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// Unlink - Remove one of userID's links, or sql.ErrNoRows
+func (s *ChatAccountStore) Unlink(ctx context.Context, userID string, identity ChatIdentity) error {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM chat_account_links WHERE platform = $1 AND team_id = $2 AND chat_user_id = $3 AND user_id = $4",
+		identity.Platform, identity.TeamID, identity.ChatUserID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// chatIdentity - The sender of a command form; both platforms post team_id and user_id
+func chatIdentity(platform string, form url.Values) (ChatIdentity, bool) {
+	identity := ChatIdentity{Platform: platform, TeamID: form.Get("team_id"), ChatUserID: form.Get("user_id")}
+	return identity, identity.TeamID != "" && identity.ChatUserID != ""
+}
+
+// verifySlackSignature - Check X-Slack-Signature against the raw body
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid request timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackSignatureMaxAge || age < -slackSignatureMaxAge {
+		return fmt.Errorf("request timestamp outside the allowed window")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// readSlashCommandForm - Read the body once so it can be both verified and parsed
+func readSlashCommandForm(r *http.Request) ([]byte, url.Values, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, form, nil
+}
+
+// slackCommandHandler - POST /integrations/slack/commands
+func slackCommandHandler(w http.ResponseWriter, r *http.Request) {
+	if slashCommandConfig.SlackSigningSecret == "" || taskService == nil || chatAccounts == nil {
+		http.Error(w, "Slack commands are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, form, err := readSlashCommandForm(r)
+	if err != nil {
+		http.Error(w, "Invalid command payload", http.StatusBadRequest)
+		return
+	}
+	if err := verifySlackSignature(slashCommandConfig.SlackSigningSecret, r.Header, body, time.Now()); err != nil {
+		http.Error(w, "Invalid request signature: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	identity, ok := chatIdentity(ChatPlatformSlack, form)
+	if !ok {
+		http.Error(w, "team_id and user_id are required", http.StatusBadRequest)
+		return
+	}
+
+	writeSlashCommandResponse(w, runSlashCommand(r.Context(), identity, form.Get("text")))
+}
+
+// mattermostCommandHandler - POST /integrations/mattermost/commands
+func mattermostCommandHandler(w http.ResponseWriter, r *http.Request) {
+	if slashCommandConfig.MattermostCommandToken == "" || taskService == nil || chatAccounts == nil {
+		http.Error(w, "Mattermost commands are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	_, form, err := readSlashCommandForm(r)
+	if err != nil {
+		http.Error(w, "Invalid command payload", http.StatusBadRequest)
+		return
+	}
+	token := form.Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(slashCommandConfig.MattermostCommandToken)) != 1 {
+		http.Error(w, "Invalid command token", http.StatusUnauthorized)
+		return
+	}
+	identity, ok := chatIdentity(ChatPlatformMattermost, form)
+	if !ok {
+		http.Error(w, "team_id and user_id are required", http.StatusBadRequest)
+		return
+	}
+
+	writeSlashCommandResponse(w, runSlashCommand(r.Context(), identity, form.Get("text")))
+}
+
+func writeSlashCommandResponse(w http.ResponseWriter, response SlashCommandResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func ephemeral(format string, args ...interface{}) SlashCommandResponse {
+	return SlashCommandResponse{ResponseType: "ephemeral", Text: fmt.Sprintf(format, args...)}
+}
+
+// runSlashCommand - Parse and execute "/task ..." on behalf of a chat user
+func runSlashCommand(ctx context.Context, identity ChatIdentity, text string) SlashCommandResponse {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ephemeral("%s", slashCommandHelp)
+	}
+	command, args := strings.ToLower(fields[0]), fields[1:]
+
+	switch command {
+	case "help":
+		return ephemeral("%s", slashCommandHelp)
+	case "link":
+		if len(args) != 1 {
+			return ephemeral("Usage: `/task link <code>`, with a link code from the app.")
+		}
+		userID, err := chatAccounts.RedeemLinkCode(ctx, identity, args[0])
+		if err == sql.ErrNoRows {
+			return ephemeral("That link code is invalid or has expired.")
+		}
+		if err != nil {
+			return ephemeral("Could not link your account: %v", err)
+		}
+		user, err := taskService.FindUserByID(ctx, userID)
+		if err != nil {
+			return ephemeral("Your chat account is linked.")
+		}
+		return ephemeral("Your chat account is linked to %s.", user.Username)
+	}
+
+	userID, err := chatAccounts.LinkedUserID(ctx, identity)
+	if err == sql.ErrNoRows {
+		return ephemeral("Your chat account is not linked. Create a link code in the app and run `/task link <code>`.")
+	}
+	if err != nil {
+		return ephemeral("Could not look up your account: %v", err)
+	}
+	user, err := taskService.FindUserByID(ctx, userID)
+	if err != nil {
+		return ephemeral("The account linked to your chat user no longer exists.")
+	}
+
+	switch command {
+	case "create", "new", "add":
+		task := &Task{Status: "todo", Priority: "medium"}
+		var title []string
+		for _, arg := range args {
+			switch {
+			case strings.HasPrefix(arg, "project:"):
+				task.ProjectID = strings.TrimPrefix(arg, "project:")
+			case strings.HasPrefix(arg, "priority:"):
+				task.Priority = strings.ToLower(strings.TrimPrefix(arg, "priority:"))
+			case strings.HasPrefix(arg, "@") && len(arg) > 1:
+				assignee, err := taskService.FindUserByUsername(ctx, arg[1:])
+				if err != nil {
+					return ephemeral("Unknown user %s.", arg)
+				}
+				task.AssigneeID = assignee.ID
+			default:
+				title = append(title, arg)
+			}
+		}
+		task.Title = strings.Join(title, " ")
+		if task.Title == "" {
+			return ephemeral("A title is required.\n%s", slashCommandHelp)
+		}
+		if task.Priority != "low" && task.Priority != "medium" && task.Priority != "high" {
+			return ephemeral("Priority must be low, medium or high.")
+		}
+		if task.ProjectID != "" {
+			if exists, err := taskService.ProjectExists(ctx, task.ProjectID); err != nil || !exists {
+				return ephemeral("Unknown project %s.", task.ProjectID)
+			}
+		}
+		if err := taskService.CreateTask(ctx, task, user.ID); err != nil {
+			return ephemeral("Could not create task: %v", err)
+		}
+		return SlashCommandResponse{ResponseType: "in_channel", Text: fmt.Sprintf("@%s created %s", user.Username, describeTask(task))}
+
+	case "done", "complete", "close":
+		if len(args) != 1 {
+			return ephemeral("Usage: `/task done <id>`")
+		}
+		task, err := taskService.SetTaskStatus(ctx, args[0], "completed", user.ID)
+		if err != nil {
+			return ephemeral("%s", slashCommandError(args[0], err))
+		}
+		return SlashCommandResponse{ResponseType: "in_channel", Text: fmt.Sprintf("@%s completed %s", user.Username, describeTask(task))}
+
+	case "comment":
+		if len(args) < 2 {
+			return ephemeral("Usage: `/task comment <id> <text>`")
+		}
+		if _, err := taskService.GetTask(ctx, args[0]); err != nil {
+			return ephemeral("%s", slashCommandError(args[0], err))
+		}
+		comment := &Comment{TaskID: args[0], UserID: user.ID, Content: strings.Join(args[1:], " ")}
+		if err := taskService.AddComment(ctx, comment); err != nil {
+			return ephemeral("Could not add comment: %v", err)
+		}
+		return ephemeral("Comment added to task %s.", args[0])
+
+	case "show", "get":
+		if len(args) != 1 {
+			return ephemeral("Usage: `/task show <id>`")
+		}
+		task, err := taskService.GetTask(ctx, args[0])
+		if err != nil {
+			return ephemeral("%s", slashCommandError(args[0], err))
+		}
+		reply := describeTask(task)
+		if task.Description != "" {
+			reply += "\n" + truncateText(task.Description, 500)
+		}
+		return ephemeral("%s", reply)
+
+	default:
+		return ephemeral("Unknown command %q.\n%s", command, slashCommandHelp)
+	}
+}
+
+func slashCommandError(taskID string, err error) string {
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("Task %s not found.", taskID)
+	}
+	return fmt.Sprintf("Could not update task %s: %v", taskID, err)
+}
+
+// ========================================
+// CHAT ACCOUNT LINK HANDLERS
+// ========================================
+
+// requireChatAccountSession - The signed-in user managing their own chat links
+func requireChatAccountSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if chatAccounts == nil {
+		http.Error(w, "Chat accounts unavailable", http.StatusServiceUnavailable)
+		return "", false
+	}
+	principal := requestPrincipal(r)
+	if principal == nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return "", false
+	}
+	if principal.Method != PrincipalSession {
+		http.Error(w, "Chat accounts can only be linked from a signed-in session", http.StatusForbidden)
+		return "", false
+	}
+	return principal.UserID, true
+}
+
+// createChatLinkCodeHandler - POST /me/chat-link-codes; the code is redeemed with /task link
+func createChatLinkCodeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireChatAccountSession(w, r)
+	if !ok {
+		return
+	}
+
+	code, expiresAt, err := chatAccounts.CreateLinkCode(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":       code,
+		"command":    "/task link " + code,
+		"expires_at": expiresAt,
+	})
+}
+
+// listMyChatAccountsHandler - GET /me/chat-accounts
+func listMyChatAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireChatAccountSession(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := chatAccounts.ListLinks(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"chat_accounts": links,
+		"total_count":   len(links),
+	})
+}
+
+// unlinkMyChatAccountHandler - DELETE /me/chat-accounts/{platform}/{teamID}/{chatUserID}
+func unlinkMyChatAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireChatAccountSession(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	identity := ChatIdentity{Platform: vars["platform"], TeamID: vars["teamID"], ChatUserID: vars["chatUserID"]}
+	if err := chatAccounts.Unlink(r.Context(), userID, identity); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Chat account link not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
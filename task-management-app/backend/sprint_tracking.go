@@ -0,0 +1,735 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// SprintTracker - Sprint planning, daily burndown snapshots and velocity
+type SprintTracker struct {
+	db *sql.DB
+}
+
+// Sprint - A time-boxed iteration with a goal and committed tasks
+type Sprint struct {
+	ID              string     `json:"id"`
+	ProjectID       string     `json:"project_id"`
+	Name            string     `json:"name"`
+	Goal            string     `json:"goal"`
+	StartDate       time.Time  `json:"start_date"`
+	EndDate         time.Time  `json:"end_date"`
+	Status          string     `json:"status"` // "planned", "active", "completed"
+	CommittedTasks  []string   `json:"committed_tasks"`
+	CommittedPoints int        `json:"committed_points"`
+	CompletedPoints int        `json:"completed_points"`
+	CreatedAt       time.Time  `json:"created_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+}
+
+// SprintSnapshot - Point-in-time record of sprint progress, one per day
+type SprintSnapshot struct {
+	SprintID        string    `json:"sprint_id"`
+	Date            time.Time `json:"date"`
+	ScopePoints     int       `json:"scope_points"`
+	CompletedPoints int       `json:"completed_points"`
+	RemainingPoints int       `json:"remaining_points"`
+	TotalTasks      int       `json:"total_tasks"`
+	CompletedTasks  int       `json:"completed_tasks"`
+	RecordedAt      time.Time `json:"recorded_at"`
+}
+
+// BurndownPoint - Actual vs. ideal remaining work for a sprint day
+type BurndownPoint struct {
+	Date            time.Time `json:"date"`
+	RemainingPoints *int      `json:"remaining_points,omitempty"`
+	IdealRemaining  float64   `json:"ideal_remaining"`
+}
+
+// BurnupPoint - Completed work vs. total scope for a sprint day
+type BurnupPoint struct {
+	Date            time.Time `json:"date"`
+	CompletedPoints *int      `json:"completed_points,omitempty"`
+	ScopePoints     *int      `json:"scope_points,omitempty"`
+}
+
+// VelocityReport - Completed points over recently finished sprints
+type VelocityReport struct {
+	ProjectID       string           `json:"project_id"`
+	SprintsCounted  int              `json:"sprints_counted"`
+	AverageVelocity float64          `json:"average_velocity"`
+	History         []SprintVelocity `json:"history"`
+}
+
+// SprintVelocity - Committed vs. completed points for a single sprint
+type SprintVelocity struct {
+	SprintID        string    `json:"sprint_id"`
+	Name            string    `json:"name"`
+	EndDate         time.Time `json:"end_date"`
+	CommittedPoints int       `json:"committed_points"`
+	CompletedPoints int       `json:"completed_points"`
+}
+
+const (
+	SprintStatusPlanned   = "planned"
+	SprintStatusActive    = "active"
+	SprintStatusCompleted = "completed"
+
+	// Number of completed sprints averaged into project velocity
+	defaultVelocityWindow = 3
+)
+
+const sprintSchema = `
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS story_points INTEGER;
+
+CREATE TABLE IF NOT EXISTS sprints (
+  id VARCHAR(50) PRIMARY KEY,
+  project_id VARCHAR(50) REFERENCES projects(id),
+  name VARCHAR(255) NOT NULL,
+  goal TEXT,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  status VARCHAR(50) DEFAULT 'planned',
+  committed_points INTEGER DEFAULT 0,
+  completed_points INTEGER DEFAULT 0,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  completed_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sprint_tasks (
+  sprint_id VARCHAR(50) REFERENCES sprints(id) ON DELETE CASCADE,
+  task_id VARCHAR(50) REFERENCES tasks(id) ON DELETE CASCADE,
+  added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (sprint_id, task_id)
+);
+
+CREATE TABLE IF NOT EXISTS sprint_snapshots (
+  sprint_id VARCHAR(50) REFERENCES sprints(id) ON DELETE CASCADE,
+  snapshot_date DATE NOT NULL,
+  scope_points INTEGER NOT NULL,
+  completed_points INTEGER NOT NULL,
+  remaining_points INTEGER NOT NULL,
+  total_tasks INTEGER NOT NULL,
+  completed_tasks INTEGER NOT NULL,
+  recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (sprint_id, snapshot_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sprints_project ON sprints(project_id);
+CREATE INDEX IF NOT EXISTS idx_sprint_tasks_task ON sprint_tasks(task_id);
+`
+
+// NewSprintTracker - Create a sprint tracker backed by PostgreSQL
+func NewSprintTracker(db *sql.DB) *SprintTracker {
+	return &SprintTracker{db: db}
+}
+
+// EnsureSchema - Create sprint tables and the story_points column if missing
+func (st *SprintTracker) EnsureSchema() error {
+	if st.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	_, err := st.db.Exec(sprintSchema)
+	return err
+}
+
+// StartSnapshotRecorder - Periodically record today's snapshot for active sprints
+func (st *SprintTracker) StartSnapshotRecorder(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	st.recordActiveSprintSnapshots()
+	for range ticker.C {
+		st.recordActiveSprintSnapshots()
+	}
+}
+
+func (st *SprintTracker) recordActiveSprintSnapshots() {
+	rows, err := st.db.Query("SELECT id FROM sprints WHERE status = $1", SprintStatusActive)
+	if err != nil {
+		componentLogger("sprints").Error(err, "Failed to list active sprints", nil)
+		return
+	}
+	var sprintIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			sprintIDs = append(sprintIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range sprintIDs {
+		if _, err := st.RecordSnapshot(id); err != nil {
+			componentLogger("sprints").Error(err, "Failed to record sprint snapshot", map[string]interface{}{"sprint_id": id})
+		}
+	}
+}
+
+// CreateSprint - Create a sprint and commit the given tasks to it
+func (st *SprintTracker) CreateSprint(sprint *Sprint) error {
+	if sprint.Name == "" || sprint.ProjectID == "" {
+		return fmt.Errorf("name and project_id are required")
+	}
+	if sprint.StartDate.IsZero() || sprint.EndDate.IsZero() || !sprint.EndDate.After(sprint.StartDate) {
+		return fmt.Errorf("end_date must be after start_date")
+	}
+
+	sprint.ID = uuid.New().String()
+	sprint.CreatedAt = time.Now()
+	if sprint.Status == "" {
+		sprint.Status = SprintStatusPlanned
+	}
+
+	_, err := st.db.Exec(
+		"INSERT INTO sprints (id, project_id, name, goal, start_date, end_date, status, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		sprint.ID, sprint.ProjectID, sprint.Name, sprint.Goal, sprint.StartDate, sprint.EndDate, sprint.Status, sprint.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(sprint.CommittedTasks) > 0 {
+		return st.CommitTasks(sprint.ID, sprint.CommittedTasks)
+	}
+	return nil
+}
+
+// GetSprint - Load a sprint with its committed task IDs
+func (st *SprintTracker) GetSprint(sprintID string) (*Sprint, error) {
+	var sprint Sprint
+	var goal sql.NullString
+	err := st.db.QueryRow(
+		"SELECT id, project_id, name, goal, start_date, end_date, status, committed_points, completed_points, created_at, completed_at FROM sprints WHERE id = $1",
+		sprintID,
+	).Scan(&sprint.ID, &sprint.ProjectID, &sprint.Name, &goal, &sprint.StartDate, &sprint.EndDate, &sprint.Status,
+		&sprint.CommittedPoints, &sprint.CompletedPoints, &sprint.CreatedAt, &sprint.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	sprint.Goal = goal.String
+
+	rows, err := st.db.Query("SELECT task_id FROM sprint_tasks WHERE sprint_id = $1 ORDER BY added_at", sprintID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sprint.CommittedTasks = []string{}
+	for rows.Next() {
+		var taskID string
+		if err := rows.Scan(&taskID); err != nil {
+			return nil, err
+		}
+		sprint.CommittedTasks = append(sprint.CommittedTasks, taskID)
+	}
+
+	// Planned and active sprints report live totals; completed sprints keep the values frozen at close
+	if sprint.Status != SprintStatusCompleted {
+		snapshot, err := st.currentTotals(sprintID)
+		if err != nil {
+			return nil, err
+		}
+		sprint.CommittedPoints = snapshot.ScopePoints
+		sprint.CompletedPoints = snapshot.CompletedPoints
+	}
+
+	return &sprint, nil
+}
+
+// ListSprints - List sprints for a project, newest first
+func (st *SprintTracker) ListSprints(projectID string) ([]*Sprint, error) {
+	rows, err := st.db.Query("SELECT id FROM sprints WHERE project_id = $1 ORDER BY start_date DESC", projectID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	sprints := []*Sprint{}
+	for _, id := range ids {
+		sprint, err := st.GetSprint(id)
+		if err != nil {
+			return nil, err
+		}
+		sprints = append(sprints, sprint)
+	}
+	return sprints, nil
+}
+
+// CommitTasks - Add tasks to a sprint's commitment; sql.ErrNoRows for an unknown sprint
+func (st *SprintTracker) CommitTasks(sprintID string, taskIDs []string) error {
+	var exists bool
+	if err := st.db.QueryRow("SELECT EXISTS (SELECT 1 FROM sprints WHERE id = $1)", sprintID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	_, err := st.db.Exec(
+		"INSERT INTO sprint_tasks (sprint_id, task_id) SELECT $1, unnest($2::varchar[]) ON CONFLICT DO NOTHING",
+		sprintID, pq.Array(taskIDs),
+	)
+	return err
+}
+
+// RemoveTask - Drop a task from a sprint's commitment
+func (st *SprintTracker) RemoveTask(sprintID, taskID string) error {
+	_, err := st.db.Exec("DELETE FROM sprint_tasks WHERE sprint_id = $1 AND task_id = $2", sprintID, taskID)
+	return err
+}
+
+// StartSprint - Mark a planned sprint active and record its first snapshot
+func (st *SprintTracker) StartSprint(sprintID string) (*Sprint, error) {
+	result, err := st.db.Exec("UPDATE sprints SET status = $1 WHERE id = $2 AND status = $3",
+		SprintStatusActive, sprintID, SprintStatusPlanned)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("sprint %s is not in planned state", sprintID)
+	}
+
+	if _, err := st.RecordSnapshot(sprintID); err != nil {
+		return nil, err
+	}
+	return st.GetSprint(sprintID)
+}
+
+// CompleteSprint - Close a sprint, freezing committed and completed points for velocity
+func (st *SprintTracker) CompleteSprint(sprintID string) (*Sprint, error) {
+	sprint, err := st.GetSprint(sprintID)
+	if err != nil {
+		return nil, err
+	}
+	if sprint.Status == SprintStatusCompleted {
+		return sprint, nil
+	}
+
+	snapshot, err := st.RecordSnapshot(sprintID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = st.db.Exec(
+		"UPDATE sprints SET status = $1, committed_points = $2, completed_points = $3, completed_at = $4 WHERE id = $5",
+		SprintStatusCompleted, snapshot.ScopePoints, snapshot.CompletedPoints, time.Now(), sprintID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetSprint(sprintID)
+}
+
+// currentTotals - Sum story points of committed tasks as they stand right now
+func (st *SprintTracker) currentTotals(sprintID string) (*SprintSnapshot, error) {
+	snapshot := &SprintSnapshot{SprintID: sprintID}
+	err := st.db.QueryRow(`
+		SELECT
+		  COALESCE(SUM(COALESCE(t.story_points, 0)), 0),
+		  COALESCE(SUM(CASE WHEN t.status = 'completed' THEN COALESCE(t.story_points, 0) ELSE 0 END), 0),
+		  COUNT(t.id),
+		  COUNT(t.id) FILTER (WHERE t.status = 'completed')
+		FROM sprint_tasks st JOIN tasks t ON t.id = st.task_id
+		WHERE st.sprint_id = $1`,
+		sprintID,
+	).Scan(&snapshot.ScopePoints, &snapshot.CompletedPoints, &snapshot.TotalTasks, &snapshot.CompletedTasks)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.RemainingPoints = snapshot.ScopePoints - snapshot.CompletedPoints
+	return snapshot, nil
+}
+
+// RecordSnapshot - Upsert today's burndown/burnup snapshot for a sprint
+func (st *SprintTracker) RecordSnapshot(sprintID string) (*SprintSnapshot, error) {
+	snapshot, err := st.currentTotals(sprintID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snapshot.Date = truncateToDay(now)
+	snapshot.RecordedAt = now
+
+	_, err = st.db.Exec(`
+		INSERT INTO sprint_snapshots (sprint_id, snapshot_date, scope_points, completed_points, remaining_points, total_tasks, completed_tasks, recorded_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (sprint_id, snapshot_date) DO UPDATE SET
+		  scope_points = EXCLUDED.scope_points,
+		  completed_points = EXCLUDED.completed_points,
+		  remaining_points = EXCLUDED.remaining_points,
+		  total_tasks = EXCLUDED.total_tasks,
+		  completed_tasks = EXCLUDED.completed_tasks,
+		  recorded_at = EXCLUDED.recorded_at`,
+		snapshot.SprintID, snapshot.Date, snapshot.ScopePoints, snapshot.CompletedPoints, snapshot.RemainingPoints,
+		snapshot.TotalTasks, snapshot.CompletedTasks, snapshot.RecordedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetSnapshots - All recorded snapshots for a sprint in date order
+func (st *SprintTracker) GetSnapshots(sprintID string) ([]SprintSnapshot, error) {
+	rows, err := st.db.Query(
+		"SELECT sprint_id, snapshot_date, scope_points, completed_points, remaining_points, total_tasks, completed_tasks, recorded_at FROM sprint_snapshots WHERE sprint_id = $1 ORDER BY snapshot_date",
+		sprintID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []SprintSnapshot
+	for rows.Next() {
+		var s SprintSnapshot
+		if err := rows.Scan(&s.SprintID, &s.Date, &s.ScopePoints, &s.CompletedPoints, &s.RemainingPoints,
+			&s.TotalTasks, &s.CompletedTasks, &s.RecordedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+// GetBurndown - Remaining points per sprint day alongside the ideal line
+func (st *SprintTracker) GetBurndown(sprintID string) ([]BurndownPoint, error) {
+	sprint, err := st.GetSprint(sprintID)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := st.GetSnapshots(sprintID)
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := indexSnapshotsByDay(snapshots)
+	days := sprintDays(sprint)
+	initialScope := float64(sprint.CommittedPoints)
+	if len(snapshots) > 0 {
+		initialScope = float64(snapshots[0].ScopePoints)
+	}
+
+	points := make([]BurndownPoint, 0, len(days))
+	for i, day := range days {
+		point := BurndownPoint{Date: day}
+		if len(days) > 1 {
+			point.IdealRemaining = initialScope * (1 - float64(i)/float64(len(days)-1))
+		}
+		if s, ok := byDay[day.Format("2006-01-02")]; ok {
+			remaining := s.RemainingPoints
+			point.RemainingPoints = &remaining
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// GetBurnup - Completed points and total scope per sprint day
+func (st *SprintTracker) GetBurnup(sprintID string) ([]BurnupPoint, error) {
+	sprint, err := st.GetSprint(sprintID)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := st.GetSnapshots(sprintID)
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := indexSnapshotsByDay(snapshots)
+	days := sprintDays(sprint)
+
+	points := make([]BurnupPoint, 0, len(days))
+	for _, day := range days {
+		point := BurnupPoint{Date: day}
+		if s, ok := byDay[day.Format("2006-01-02")]; ok {
+			completed, scope := s.CompletedPoints, s.ScopePoints
+			point.CompletedPoints = &completed
+			point.ScopePoints = &scope
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// GetVelocity - Average completed points over the last n completed sprints of a project
+func (st *SprintTracker) GetVelocity(projectID string, n int) (*VelocityReport, error) {
+	if n <= 0 {
+		n = defaultVelocityWindow
+	}
+
+	rows, err := st.db.Query(
+		"SELECT id, name, end_date, committed_points, completed_points FROM sprints WHERE project_id = $1 AND status = $2 ORDER BY end_date DESC LIMIT $3",
+		projectID, SprintStatusCompleted, n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &VelocityReport{ProjectID: projectID, History: []SprintVelocity{}}
+	total := 0
+	for rows.Next() {
+		var sv SprintVelocity
+		if err := rows.Scan(&sv.SprintID, &sv.Name, &sv.EndDate, &sv.CommittedPoints, &sv.CompletedPoints); err != nil {
+			return nil, err
+		}
+		total += sv.CompletedPoints
+		report.History = append(report.History, sv)
+	}
+
+	report.SprintsCounted = len(report.History)
+	if report.SprintsCounted > 0 {
+		report.AverageVelocity = float64(total) / float64(report.SprintsCounted)
+	}
+	return report, nil
+}
+
+// GetActiveSprint - The currently active sprint for a project, if any
+func (st *SprintTracker) GetActiveSprint(projectID string) (*Sprint, error) {
+	var sprintID string
+	err := st.db.QueryRow(
+		"SELECT id FROM sprints WHERE project_id = $1 AND status = $2 ORDER BY start_date DESC LIMIT 1",
+		projectID, SprintStatusActive,
+	).Scan(&sprintID)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetSprint(sprintID)
+}
+
+// BurndownRate - Points actually burned relative to the ideal line so far (1.0 = on track)
+func (st *SprintTracker) BurndownRate(sprint *Sprint) float64 {
+	days := sprintDays(sprint)
+	if len(days) < 2 || sprint.CommittedPoints == 0 {
+		return 0
+	}
+
+	elapsed := 0
+	today := truncateToDay(time.Now())
+	for i, day := range days {
+		if !day.After(today) {
+			elapsed = i
+		}
+	}
+	if elapsed == 0 {
+		return 0
+	}
+
+	idealBurned := float64(sprint.CommittedPoints) * float64(elapsed) / float64(len(days)-1)
+	return float64(sprint.CompletedPoints) / idealBurned
+}
+
+func indexSnapshotsByDay(snapshots []SprintSnapshot) map[string]SprintSnapshot {
+	byDay := make(map[string]SprintSnapshot, len(snapshots))
+	for _, s := range snapshots {
+		byDay[s.Date.Format("2006-01-02")] = s
+	}
+	return byDay
+}
+
+func sprintDays(sprint *Sprint) []time.Time {
+	var days []time.Time
+	end := truncateToDay(sprint.EndDate)
+	for day := truncateToDay(sprint.StartDate); !day.After(end); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ========================================
+// SPRINT HANDLERS
+// ========================================
+
+// createSprintHandler - Create a sprint with optional committed tasks
+func createSprintHandler(w http.ResponseWriter, r *http.Request) {
+	var sprint Sprint
+	if err := json.NewDecoder(r.Body).Decode(&sprint); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := sprintTracker.CreateSprint(&sprint); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := sprintTracker.GetSprint(sprint.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// getSprintHandler - Get a single sprint
+func getSprintHandler(w http.ResponseWriter, r *http.Request) {
+	sprint, err := sprintTracker.GetSprint(mux.Vars(r)["id"])
+	if err != nil {
+		writeSprintLookupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sprint)
+}
+
+// getProjectSprintsHandler - List sprints for a project
+func getProjectSprintsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["id"]
+
+	sprints, err := sprintTracker.ListSprints(projectID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"project_id": projectID,
+		"sprints":    sprints,
+		"timestamp":  time.Now(),
+	})
+}
+
+// commitSprintTasksHandler - Add tasks to a sprint's commitment
+func commitSprintTasksHandler(w http.ResponseWriter, r *http.Request) {
+	sprintID := mux.Vars(r)["id"]
+
+	var request struct {
+		TaskIDs []string `json:"task_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := sprintTracker.CommitTasks(sprintID, request.TaskIDs); err != nil {
+		writeSprintLookupError(w, err)
+		return
+	}
+
+	sprint, err := sprintTracker.GetSprint(sprintID)
+	if err != nil {
+		writeSprintLookupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sprint)
+}
+
+// removeSprintTaskHandler - Drop a task from a sprint
+func removeSprintTaskHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := sprintTracker.RemoveTask(vars["id"], vars["taskID"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startSprintHandler - Start a planned sprint
+func startSprintHandler(w http.ResponseWriter, r *http.Request) {
+	sprint, err := sprintTracker.StartSprint(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sprint)
+}
+
+// completeSprintHandler - Close a sprint and freeze its velocity numbers
+func completeSprintHandler(w http.ResponseWriter, r *http.Request) {
+	sprint, err := sprintTracker.CompleteSprint(mux.Vars(r)["id"])
+	if err != nil {
+		writeSprintLookupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sprint)
+}
+
+// getSprintBurndownHandler - Daily burndown and burnup series for a sprint
+func getSprintBurndownHandler(w http.ResponseWriter, r *http.Request) {
+	sprintID := mux.Vars(r)["id"]
+
+	burndown, err := sprintTracker.GetBurndown(sprintID)
+	if err != nil {
+		writeSprintLookupError(w, err)
+		return
+	}
+	burnup, err := sprintTracker.GetBurnup(sprintID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sprint_id": sprintID,
+		"burndown":  burndown,
+		"burnup":    burnup,
+		"timestamp": time.Now(),
+	})
+}
+
+// getProjectVelocityHandler - Velocity over the last N completed sprints
+func getProjectVelocityHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := mux.Vars(r)["id"]
+
+	window := defaultVelocityWindow
+	if s := r.URL.Query().Get("sprints"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "sprints must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		window = n
+	}
+
+	report, err := sprintTracker.GetVelocity(projectID, window)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func writeSprintLookupError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Sprint not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
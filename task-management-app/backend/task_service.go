@@ -0,0 +1,254 @@
+package main
+
+// Task and comment service
+// The single write path for tasks and comments. REST handlers, inbound email
+// and chat slash commands all go through it so validation, WebSocket
+// broadcasts and webhook events behave the same whatever the entry point.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TaskService - Task and comment operations shared by every entry point
+type TaskService struct {
+	db *sql.DB
+}
+
+// TaskValidationError - Input the service refuses; handlers map it to 400
+type TaskValidationError struct {
+	Message string
+}
+
+func (e *TaskValidationError) Error() string {
+	return e.Message
+}
+
+var taskService *TaskService
+
+func NewTaskService(db *sql.DB) *TaskService {
+	return &TaskService{db: db}
+}
+
+// coreSchema - Columns added to the core tables since the initial schema: row versions behind
+// ETags and If-Match on tasks and projects, and the profile locale notifications render in
+const coreSchema = `
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(20);
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+`
+
+// EnsureSchema - Add the newer columns to existing user, task and project tables
+func (ts *TaskService) EnsureSchema() error {
+	if ts.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	_, err := ts.db.Exec(coreSchema)
+	return err
+}
+
+// CreateTask - Validate and insert a task, then announce it
+func (ts *TaskService) CreateTask(ctx context.Context, task *Task, actor string) error {
+	if task.Title == "" || task.Status == "" || task.Priority == "" {
+		return &TaskValidationError{"Title, status, and priority are required"}
+	}
+
+	task.ID = uuid.New().String()
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+
+	_, err := ts.db.ExecContext(ctx,
+		"INSERT INTO tasks (id, title, description, status, priority, assignee_id, project_id, story_points, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10)",
+		task.ID, task.Title, task.Description, task.Status, task.Priority, task.AssigneeID, task.ProjectID, task.StoryPoints, task.CreatedAt, task.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	ts.broadcast(WSMsgTaskCreated, task, actor)
+	publishWebhookEvent(WebhookTaskCreated, task)
+	return nil
+}
+
+// GetTask - Load a task; sql.ErrNoRows when it does not exist
+func (ts *TaskService) GetTask(ctx context.Context, id string) (*Task, error) {
+	var task Task
+	err := ts.db.QueryRowContext(ctx,
+		"SELECT id, title, description, status, priority, assignee_id, COALESCE(project_id, ''), story_points, created_at, updated_at, version FROM tasks WHERE id = $1",
+		id,
+	).Scan(&task.ID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.AssigneeID, &task.ProjectID, &task.StoryPoints, &task.CreatedAt, &task.UpdatedAt, &task.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// UpdateTask - Replace a task's editable fields if it is still at task.Version, then
+// bump the version; sql.ErrNoRows when it does not exist, errVersionConflict when it moved on
+func (ts *TaskService) UpdateTask(ctx context.Context, id string, task *Task, actor string) error {
+	task.ID = id
+	task.UpdatedAt = time.Now()
+
+	err := ts.db.QueryRowContext(ctx,
+		"UPDATE tasks SET title = $1, description = $2, status = $3, priority = $4, assignee_id = $5, story_points = $6, updated_at = $7, version = version + 1 WHERE id = $8 AND version = $9 RETURNING COALESCE(project_id, ''), created_at, version",
+		task.Title, task.Description, task.Status, task.Priority, task.AssigneeID, task.StoryPoints, task.UpdatedAt, id, task.Version,
+	).Scan(&task.ProjectID, &task.CreatedAt, &task.Version)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := ts.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1)", id).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return errVersionConflict
+		}
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+
+	ts.broadcast(WSMsgTaskUpdated, task, actor)
+	publishWebhookEvent(WebhookTaskUpdated, task)
+	return nil
+}
+
+// SetTaskStatus - Change only the status of a task, on top of whatever version is current
+func (ts *TaskService) SetTaskStatus(ctx context.Context, id, status, actor string) (*Task, error) {
+	if status == "" {
+		return nil, &TaskValidationError{"status is required"}
+	}
+
+	for attempt := 0; ; attempt++ {
+		task, err := ts.GetTask(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		task.Status = status
+		err = ts.UpdateTask(ctx, id, task, actor)
+		if err == errVersionConflict && attempt < mergePatchAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return task, nil
+	}
+}
+
+// DeleteTask - Remove a task and announce it
+func (ts *TaskService) DeleteTask(ctx context.Context, id, actor string) error {
+	if _, err := ts.db.ExecContext(ctx, "DELETE FROM tasks WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	ts.broadcast(WSMsgTaskDeleted, map[string]string{"id": id}, actor)
+	publishWebhookEvent(WebhookTaskDeleted, map[string]string{"id": id})
+	return nil
+}
+
+// AddComment - Insert a comment on a task and announce it
+func (ts *TaskService) AddComment(ctx context.Context, comment *Comment) error {
+	if comment.TaskID == "" || comment.Content == "" {
+		return &TaskValidationError{"task_id and content are required"}
+	}
+
+	comment.ID = uuid.New().String()
+	comment.CreatedAt = time.Now()
+
+	_, err := ts.db.ExecContext(ctx,
+		"INSERT INTO comments (id, task_id, user_id, content, created_at) VALUES ($1, $2, $3, $4, $5)",
+		comment.ID, comment.TaskID, comment.UserID, comment.Content, comment.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	publishWebhookEvent(WebhookCommentCreated, comment)
+	return nil
+}
+
+// FindUserByID - Load the user behind an authenticated request
+func (ts *TaskService) FindUserByID(ctx context.Context, id string) (*User, error) {
+	return ts.findUser(ctx, "id = $1", id)
+}
+
+// FindUserByEmail - Resolve an inbound sender to a user
+func (ts *TaskService) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	return ts.findUser(ctx, "LOWER(email) = LOWER($1)", email)
+}
+
+// FindUserByUsername - Resolve a chat handle to a user
+func (ts *TaskService) FindUserByUsername(ctx context.Context, username string) (*User, error) {
+	return ts.findUser(ctx, "username = $1", username)
+}
+
+func (ts *TaskService) findUser(ctx context.Context, condition string, value string) (*User, error) {
+	var user User
+	err := ts.db.QueryRowContext(ctx,
+		"SELECT id, username, email, role, COALESCE(locale, ''), created_at FROM users WHERE "+condition, value,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Locale, &user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ProjectExists - Whether a project ID is known
+func (ts *TaskService) ProjectExists(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	err := ts.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM projects WHERE id = $1)", id).Scan(&exists)
+	return exists, err
+}
+
+// broadcast - Tell connected clients about a task change
+func (ts *TaskService) broadcast(msgType WSMessageType, data interface{}, actor string) {
+	if hub == nil {
+		return
+	}
+	if actor == "" {
+		actor = "system"
+	}
+
+	wsMessage := WSMessage{
+		ID:        generateID(),
+		Type:      msgType,
+		Data:      data,
+		UserID:    actor,
+		Username:  "System",
+		Room:      "general", // Could be project-specific
+		Timestamp: time.Now().Unix(),
+	}
+
+	select {
+	case hub.broadcast <- wsMessage:
+	default:
+		// Channel full, notification not sent
+		recordWSDrop(WSDropHubFull)
+		componentLogger("websocket").Warn("WebSocket channel full, notification not sent", map[string]interface{}{"type": msgType})
+	}
+}
+
+// taskServiceStatus - HTTP status for an error returned by the service
+func taskServiceStatus(err error) int {
+	if _, ok := err.(*TaskValidationError); ok {
+		return http.StatusBadRequest
+	}
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound
+	}
+	if err == errVersionConflict {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// describeTask - One-line summary used in chat and email replies
+func describeTask(task *Task) string {
+	return fmt.Sprintf("%s [%s, %s] (%s)", task.Title, task.Status, task.Priority, task.ID)
+}
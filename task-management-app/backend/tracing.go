@@ -0,0 +1,201 @@
+package main
+
+// OpenTelemetry tracing
+// Incoming requests continue the caller's W3C traceparent (or start a new
+// trace) and get a request ID, echoed back in X-Request-ID. Child spans are
+// recorded for SQL statements (via the otelsql driver wrapper), CouchDB calls
+// and notifier sends, whose outgoing HTTP requests (via otelhttp) are spans of
+// their own and pass traceparent on to the receiving service. SQL statements
+// issued without a traced context - e.g. background worker polling - are
+// skipped so they do not flood the backend with root spans. Notifications carry the trace context through the outbox
+// so a delivery made minutes later still joins the request that caused it.
+//
+// OTEL_TRACES_EXPORTER selects the exporter: "otlp" (OTLP/HTTP to
+// OTEL_EXPORTER_OTLP_ENDPOINT), "stdout" for local runs, or "none".
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingConfig - Exporter selection and service identity
+type TracingConfig struct {
+	Exporter     string // "otlp", "stdout" or "none"
+	OTLPEndpoint string // e.g. http://otel-collector:4318; empty uses the exporter default
+	ServiceName  string
+	Version      string
+}
+
+type requestIDKey struct{}
+
+var tracer = otel.Tracer("task-management-api")
+
+// tracingShutdown - Flushes and stops the exporter; a no-op until tracing is initialized
+var tracingShutdown = func(context.Context) error { return nil }
+
+// initTracing - Install the global tracer provider and W3C propagators
+func initTracing(config TracingConfig) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "", "none":
+		return nil
+	case "otlp":
+		var options []otlptracehttp.Option
+		if config.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.OTLPEndpoint))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return fmt.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", config.ServiceName),
+		attribute.String("service.version", config.Version),
+	))
+	if err != nil {
+		return err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	tracingShutdown = provider.Shutdown
+	return nil
+}
+
+// openTracedDB - sql.Open with a span per statement made under a traced context
+func openTracedDB(driverName, dataSourceName string) (*sql.DB, error) {
+	return otelsql.Open(driverName, dataSourceName,
+		otelsql.WithAttributes(attribute.String("db.system", "postgresql")),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
+}
+
+// tracingMiddleware - Server span per routed request, named after the route template
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", r.RemoteAddr),
+				attribute.String("user_agent.original", r.UserAgent()),
+				attribute.String("request.id", requestID),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, strconv.Itoa(status))
+		}
+	})
+}
+
+// traceIDs - Trace and request IDs of the active span, for log correlation
+func traceIDs(ctx context.Context) (string, string) {
+	if ctx == nil {
+		return "", ""
+	}
+	var traceID, requestID string
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.HasTraceID() {
+		traceID = spanContext.TraceID().String()
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		requestID = id
+	} else if spanContext.HasSpanID() {
+		requestID = spanContext.SpanID().String()
+	}
+	return traceID, requestID
+}
+
+// newTracedHTTPClient - HTTP client whose requests are child spans of their context
+func newTracedHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+}
+
+// injectTraceContext - Serialize the active trace context for storage
+func injectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// extractTraceContext - Restore a trace context saved by injectTraceContext
+func extractTraceContext(carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(carrier))
+}
+
+// endSpan - Record err on span (if any) and end it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
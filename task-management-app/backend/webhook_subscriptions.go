@@ -0,0 +1,955 @@
+package main
+
+// Outgoing webhook subscriptions
+// Integrations subscribe a URL to event types (task.*, comment.*, time_entry.*,
+// decision.*). Each event is wrapped in a versioned envelope and delivered to
+// every matching subscription through a PostgreSQL-backed queue with retries.
+//
+// Requests carry:
+//
+//	X-Webhook-Id         delivery ID (unique per attempt series)
+//	X-Webhook-Event      event type, e.g. task.created
+//	X-Webhook-Version    envelope version
+//	X-Webhook-Timestamp  Unix seconds when the request was signed
+//	X-Webhook-Signature  v1=hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// Receivers should recompute the signature and reject timestamps older than a
+// few minutes to defeat replays.
+//
+// Subscription URLs must reach the public internet: loopback, link-local and
+// private addresses are refused when a subscription is saved and again when
+// each delivery dials out, so DNS changes and redirects cannot aim deliveries
+// at internal services.
+//
+// Managing subscriptions and their deliveries is limited to admins. A secret is
+// returned in full only when it is created or rotated; otherwise it is masked.
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// WebhookEnvelopeVersion - Bumped whenever the envelope shape changes
+const WebhookEnvelopeVersion = "1"
+
+// Event types published to webhook subscribers
+const (
+	WebhookTaskCreated      = "task.created"
+	WebhookTaskUpdated      = "task.updated"
+	WebhookTaskDeleted      = "task.deleted"
+	WebhookCommentCreated   = "comment.created"
+	WebhookTimeEntryStarted = "time_entry.started"
+	WebhookTimeEntryStopped = "time_entry.stopped"
+	WebhookDecisionCreated  = "decision.created"
+)
+
+var webhookEventTypes = []string{
+	WebhookTaskCreated, WebhookTaskUpdated, WebhookTaskDeleted,
+	WebhookCommentCreated,
+	WebhookTimeEntryStarted, WebhookTimeEntryStopped,
+	WebhookDecisionCreated,
+}
+
+// WebhookSubscription - An endpoint receiving selected event types
+type WebhookSubscription struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookEnvelope - Versioned body posted to subscribers
+type WebhookEnvelope struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Version    string      `json:"version"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// WebhookDelivery - One event queued for one subscription
+type WebhookDelivery struct {
+	ID             string                   `json:"id"`
+	SubscriptionID string                   `json:"subscription_id"`
+	EventID        string                   `json:"event_id"`
+	EventType      string                   `json:"event_type"`
+	Status         NotificationStatus       `json:"status"`
+	Attempts       int                      `json:"attempts"`
+	ResponseCode   *int                     `json:"response_code,omitempty"`
+	LastError      string                   `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time               `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time               `json:"delivered_at,omitempty"`
+	RedeliveryOf   string                   `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time                `json:"created_at"`
+	AttemptLog     []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt - Outcome of a single HTTP request
+type WebhookDeliveryAttempt struct {
+	Attempt      int       `json:"attempt"`
+	ResponseCode *int      `json:"response_code,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+	AttemptedAt  time.Time `json:"attempted_at"`
+}
+
+// WebhookDispatcher - Stores subscriptions and delivers events to them
+type WebhookDispatcher struct {
+	db           *sql.DB
+	client       *http.Client
+	workers      int
+	batchSize    int
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	lease        time.Duration
+	pollInterval time.Duration
+	stop         chan bool
+	running      sync.WaitGroup
+}
+
+const webhookSchema = `
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+  id VARCHAR(50) PRIMARY KEY,
+  url TEXT NOT NULL,
+  secret VARCHAR(128) NOT NULL,
+  event_types TEXT[] NOT NULL,
+  description TEXT,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_events (
+  id VARCHAR(50) PRIMARY KEY,
+  type VARCHAR(100) NOT NULL,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id VARCHAR(50) PRIMARY KEY,
+  subscription_id VARCHAR(50) NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+  event_id VARCHAR(50) NOT NULL REFERENCES webhook_events(id) ON DELETE CASCADE,
+  status VARCHAR(50) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  response_code INTEGER,
+  last_error TEXT,
+  next_attempt_at TIMESTAMP,
+  delivered_at TIMESTAMP,
+  redelivery_of VARCHAR(50),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+  delivery_id VARCHAR(50) NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+  attempt INTEGER NOT NULL,
+  response_code INTEGER,
+  response_body TEXT,
+  error TEXT,
+  duration_ms BIGINT NOT NULL,
+  attempted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (delivery_id, attempt)
+);
+`
+
+var webhookDispatcher *WebhookDispatcher
+
+// NewWebhookDispatcher - Create a dispatcher with the given number of delivery workers
+func NewWebhookDispatcher(db *sql.DB, workers int) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:           db,
+		client:       newWebhookClient(10 * time.Second),
+		workers:      workers,
+		batchSize:    10,
+		maxAttempts:  8,
+		baseBackoff:  30 * time.Second,
+		maxBackoff:   6 * time.Hour,
+		lease:        2 * time.Minute,
+		pollInterval: 2 * time.Second,
+		stop:         make(chan bool),
+	}
+}
+
+// EnsureSchema - Create webhook tables if missing
+func (wd *WebhookDispatcher) EnsureSchema() error {
+	if wd.db == nil {
+		return fmt.Errorf("database not configured")
+	}
+	_, err := wd.db.Exec(webhookSchema)
+	return err
+}
+
+// matchesWebhookEvent - Whether a subscription pattern (exact, "family.*" or "*") covers an event type
+func matchesWebhookEvent(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	if family, ok := strings.CutSuffix(pattern, ".*"); ok {
+		return strings.HasPrefix(eventType, family+".")
+	}
+	return false
+}
+
+// validateWebhookEventTypes - Every pattern must cover at least one known event type
+func validateWebhookEventTypes(patterns []string) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("event_types must not be empty")
+	}
+	for _, pattern := range patterns {
+		known := false
+		for _, eventType := range webhookEventTypes {
+			if matchesWebhookEvent(pattern, eventType) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q", pattern)
+		}
+	}
+	return nil
+}
+
+// validateWebhookURL - Require an http(s) URL whose host only resolves to public addresses
+func validateWebhookURL(ctx context.Context, raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicAddress(ip) {
+			return errWebhookAddressBlocked
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("url host %s does not resolve: %v", host, err)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddress(addr.IP) {
+			return errWebhookAddressBlocked
+		}
+	}
+	return nil
+}
+
+var errWebhookAddressBlocked = errors.New("url must not point at a loopback, link-local or private address")
+
+// Shared address space for carrier-grade NAT, which net.IP does not classify as private
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicAddress - Whether ip is a unicast address outside loopback, link-local and private ranges
+func isPublicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() || carrierGradeNAT.Contains(ip))
+}
+
+// newWebhookClient - HTTP client that refuses to connect to non-public addresses; the check
+// runs on the address actually dialed, so it also covers redirects and re-resolved names
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicAddress(ip) {
+				return fmt.Errorf("refusing to deliver webhook to %s: %v", host, errWebhookAddressBlocked)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be the address dialed and hide the real destination from the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// maskWebhookSecret - Enough of a secret to tell which one is configured
+func maskWebhookSecret(secret string) string {
+	if len(secret) < 16 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// signWebhookPayload - v1 signature over "timestamp.body"
+func signWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish - Record an event and queue a delivery for every matching active subscription
+func (wd *WebhookDispatcher) Publish(eventType string, data interface{}) error {
+	rows, err := wd.db.Query("SELECT id, event_types FROM webhook_subscriptions WHERE active")
+	if err != nil {
+		return err
+	}
+	var subscriptionIDs []string
+	for rows.Next() {
+		var id string
+		var patterns []string
+		if err := rows.Scan(&id, pq.Array(&patterns)); err != nil {
+			rows.Close()
+			return err
+		}
+		for _, pattern := range patterns {
+			if matchesWebhookEvent(pattern, eventType) {
+				subscriptionIDs = append(subscriptionIDs, id)
+				break
+			}
+		}
+	}
+	rows.Close()
+
+	if len(subscriptionIDs) == 0 {
+		return nil
+	}
+
+	envelope := WebhookEnvelope{
+		ID:         "evt_" + uuid.New().String(),
+		Type:       eventType,
+		Version:    WebhookEnvelopeVersion,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %v", err)
+	}
+
+	tx, err := wd.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO webhook_events (id, type, payload, created_at) VALUES ($1, $2, $3, $4)",
+		envelope.ID, eventType, payload, envelope.OccurredAt,
+	); err != nil {
+		return err
+	}
+	for _, subscriptionID := range subscriptionIDs {
+		if _, err := tx.Exec(
+			"INSERT INTO webhook_deliveries (id, subscription_id, event_id, status, next_attempt_at) VALUES ($1, $2, $3, $4, NOW())",
+			uuid.New().String(), subscriptionID, envelope.ID, string(StatusPending),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// publishWebhookEvent - Fire-and-forget publish used by request handlers
+func publishWebhookEvent(eventType string, data interface{}) {
+	if webhookDispatcher == nil {
+		return
+	}
+	if err := webhookDispatcher.Publish(eventType, data); err != nil {
+		componentLogger("webhooks").Error(err, "Failed to publish webhook event", map[string]interface{}{"event_type": eventType})
+	}
+}
+
+// Start - Launch delivery workers that poll for due deliveries
+func (wd *WebhookDispatcher) Start() {
+	for i := 0; i < wd.workers; i++ {
+		wd.running.Add(1)
+		go func() {
+			defer wd.running.Done()
+			ticker := time.NewTicker(wd.pollInterval)
+			defer ticker.Stop()
+			for {
+				for wd.processBatch() > 0 {
+					select {
+					case <-wd.stop:
+						return
+					default:
+					}
+				}
+				select {
+				case <-ticker.C:
+				case <-wd.stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop - Stop delivery workers and wait for in-progress deliveries to finish
+func (wd *WebhookDispatcher) Stop() {
+	close(wd.stop)
+	wd.running.Wait()
+}
+
+type claimedWebhookDelivery struct {
+	id        string
+	eventType string
+	attempts  int
+	url       string
+	secret    string
+	payload   []byte
+}
+
+// claim - Lease a batch of due deliveries together with what is needed to send them
+func (wd *WebhookDispatcher) claim() ([]claimedWebhookDelivery, error) {
+	rows, err := wd.db.Query(`
+		WITH due AS (
+		  SELECT id FROM webhook_deliveries
+		  WHERE status IN ($3, $4, $1) AND next_attempt_at <= NOW()
+		  ORDER BY next_attempt_at
+		  LIMIT $5
+		  FOR UPDATE SKIP LOCKED
+		), claimed AS (
+		  UPDATE webhook_deliveries d
+		  SET status = $1, next_attempt_at = $2, updated_at = NOW()
+		  FROM due WHERE d.id = due.id
+		  RETURNING d.id, d.subscription_id, d.event_id, d.attempts
+		)
+		SELECT c.id, e.type, c.attempts, s.url, s.secret, e.payload
+		FROM claimed c
+		JOIN webhook_subscriptions s ON s.id = c.subscription_id
+		JOIN webhook_events e ON e.id = c.event_id`,
+		string(StatusInFlight), time.Now().Add(wd.lease), string(StatusPending), string(StatusRetrying), wd.batchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []claimedWebhookDelivery
+	for rows.Next() {
+		var c claimedWebhookDelivery
+		if err := rows.Scan(&c.id, &c.eventType, &c.attempts, &c.url, &c.secret, &c.payload); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, c)
+	}
+	return claimed, nil
+}
+
+// processBatch - Deliver one claimed batch and return how many deliveries were handled
+func (wd *WebhookDispatcher) processBatch() int {
+	claimed, err := wd.claim()
+	if err != nil {
+		componentLogger("webhooks").Error(err, "Failed to claim webhook deliveries", nil)
+		return 0
+	}
+
+	for _, c := range claimed {
+		wd.record(c, wd.send(c))
+	}
+	return len(claimed)
+}
+
+// send - POST the signed envelope and capture the response for the delivery log
+func (wd *WebhookDispatcher) send(c claimedWebhookDelivery) WebhookDeliveryAttempt {
+	attempt := WebhookDeliveryAttempt{Attempt: c.attempts + 1, AttemptedAt: time.Now()}
+	start := time.Now()
+
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(c.payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		attempt.DurationMs = time.Since(start).Milliseconds()
+		return attempt
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TaskManagement-Webhooks/"+WebhookEnvelopeVersion)
+	req.Header.Set("X-Webhook-Id", c.id)
+	req.Header.Set("X-Webhook-Event", c.eventType)
+	req.Header.Set("X-Webhook-Version", WebhookEnvelopeVersion)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhookPayload(c.secret, timestamp, c.payload))
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		attempt.DurationMs = time.Since(start).Milliseconds()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	code := resp.StatusCode
+	attempt.ResponseCode = &code
+	attempt.ResponseBody = string(body)
+	if code < 200 || code >= 300 {
+		attempt.Error = fmt.Sprintf("endpoint returned status %d", code)
+	}
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	return attempt
+}
+
+// record - Log the attempt and move the delivery to its next state
+func (wd *WebhookDispatcher) record(c claimedWebhookDelivery, attempt WebhookDeliveryAttempt) {
+	if _, err := wd.db.Exec(
+		"INSERT INTO webhook_delivery_attempts (delivery_id, attempt, response_code, response_body, error, duration_ms, attempted_at) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7) ON CONFLICT DO NOTHING",
+		c.id, attempt.Attempt, attempt.ResponseCode, attempt.ResponseBody, attempt.Error, attempt.DurationMs, attempt.AttemptedAt,
+	); err != nil {
+		componentLogger("webhooks").Error(err, "Failed to log webhook attempt", map[string]interface{}{"delivery_id": c.id})
+	}
+
+	var err error
+	if attempt.Error == "" {
+		_, err = wd.db.Exec(
+			"UPDATE webhook_deliveries SET status = $1, attempts = $2, response_code = $3, last_error = NULL, next_attempt_at = NULL, delivered_at = NOW(), updated_at = NOW() WHERE id = $4",
+			string(StatusSent), attempt.Attempt, attempt.ResponseCode, c.id,
+		)
+	} else {
+		componentLogger("webhooks").Warn("Webhook delivery failed", map[string]interface{}{"delivery_id": c.id, "event_type": c.eventType, "attempt": attempt.Attempt, "error": attempt.Error})
+		status := StatusRetrying
+		var nextAttempt *time.Time
+		if attempt.Attempt >= wd.maxAttempts {
+			status = StatusFailed
+		} else {
+			next := time.Now().Add(wd.backoff(attempt.Attempt))
+			nextAttempt = &next
+		}
+		_, err = wd.db.Exec(
+			"UPDATE webhook_deliveries SET status = $1, attempts = $2, response_code = $3, last_error = $4, next_attempt_at = $5, updated_at = NOW() WHERE id = $6",
+			string(status), attempt.Attempt, attempt.ResponseCode, attempt.Error, nextAttempt, c.id,
+		)
+	}
+	if err != nil {
+		componentLogger("webhooks").Error(err, "Failed to record webhook delivery", map[string]interface{}{"delivery_id": c.id})
+	}
+}
+
+// backoff - Delay before the given attempt, jittered like notification retries
+func (wd *WebhookDispatcher) backoff(attempt int) time.Duration {
+	return jitteredBackoff(wd.baseBackoff, wd.maxBackoff, attempt)
+}
+
+const webhookSubscriptionColumns = "id, url, secret, event_types, COALESCE(description, ''), active, created_at, updated_at"
+
+func scanWebhookSubscription(row interface{ Scan(...interface{}) error }) (*WebhookSubscription, error) {
+	var sub WebhookSubscription
+	if err := row.Scan(&sub.ID, &sub.URL, &sub.Secret, pq.Array(&sub.EventTypes), &sub.Description,
+		&sub.Active, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// ListSubscriptions - All subscriptions, newest first
+func (wd *WebhookDispatcher) ListSubscriptions() ([]WebhookSubscription, error) {
+	rows, err := wd.db.Query("SELECT " + webhookSubscriptionColumns + " FROM webhook_subscriptions ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *sub)
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription - Load one subscription including its secret
+func (wd *WebhookDispatcher) GetSubscription(id string) (*WebhookSubscription, error) {
+	return scanWebhookSubscription(wd.db.QueryRow(
+		"SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = $1", id,
+	))
+}
+
+// SaveSubscription - Insert or update a subscription
+func (wd *WebhookDispatcher) SaveSubscription(sub *WebhookSubscription) error {
+	sub.UpdatedAt = time.Now()
+	_, err := wd.db.Exec(`
+		INSERT INTO webhook_subscriptions (id, url, secret, event_types, description, active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET url = EXCLUDED.url, secret = EXCLUDED.secret, event_types = EXCLUDED.event_types,
+		  description = EXCLUDED.description, active = EXCLUDED.active, updated_at = EXCLUDED.updated_at`,
+		sub.ID, sub.URL, sub.Secret, pq.Array(sub.EventTypes), sub.Description, sub.Active, sub.CreatedAt, sub.UpdatedAt,
+	)
+	return err
+}
+
+// DeleteSubscription - Remove a subscription and its delivery log
+func (wd *WebhookDispatcher) DeleteSubscription(id string) error {
+	result, err := wd.db.Exec("DELETE FROM webhook_subscriptions WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const webhookDeliveryColumns = "d.id, d.subscription_id, d.event_id, e.type, d.status, d.attempts, d.response_code, COALESCE(d.last_error, ''), d.next_attempt_at, d.delivered_at, COALESCE(d.redelivery_of, ''), d.created_at"
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var status string
+	if err := row.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &status,
+		&delivery.Attempts, &delivery.ResponseCode, &delivery.LastError, &delivery.NextAttemptAt,
+		&delivery.DeliveredAt, &delivery.RedeliveryOf, &delivery.CreatedAt); err != nil {
+		return nil, err
+	}
+	delivery.Status = NotificationStatus(status)
+	return &delivery, nil
+}
+
+// ListDeliveries - Recent deliveries of a subscription with their attempt log
+func (wd *WebhookDispatcher) ListDeliveries(subscriptionID string, limit int) ([]WebhookDelivery, error) {
+	rows, err := wd.db.Query(
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries d JOIN webhook_events e ON e.id = d.event_id WHERE d.subscription_id = $1 ORDER BY d.created_at DESC LIMIT $2",
+		subscriptionID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []WebhookDelivery{}
+	index := make(map[string]int)
+	var ids []string
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[delivery.ID] = len(deliveries)
+		ids = append(ids, delivery.ID)
+		deliveries = append(deliveries, *delivery)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	attemptRows, err := wd.db.Query(
+		"SELECT delivery_id, attempt, response_code, COALESCE(response_body, ''), COALESCE(error, ''), duration_ms, attempted_at FROM webhook_delivery_attempts WHERE delivery_id = ANY($1) ORDER BY attempt",
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer attemptRows.Close()
+
+	for attemptRows.Next() {
+		var deliveryID string
+		var attempt WebhookDeliveryAttempt
+		if err := attemptRows.Scan(&deliveryID, &attempt.Attempt, &attempt.ResponseCode, &attempt.ResponseBody,
+			&attempt.Error, &attempt.DurationMs, &attempt.AttemptedAt); err != nil {
+			return nil, err
+		}
+		i := index[deliveryID]
+		deliveries[i].AttemptLog = append(deliveries[i].AttemptLog, attempt)
+	}
+	return deliveries, nil
+}
+
+// Redeliver - Queue a fresh delivery of the same event to the same subscription
+func (wd *WebhookDispatcher) Redeliver(subscriptionID, deliveryID string) (*WebhookDelivery, error) {
+	newID := uuid.New().String()
+	result, err := wd.db.Exec(`
+		INSERT INTO webhook_deliveries (id, subscription_id, event_id, status, next_attempt_at, redelivery_of)
+		SELECT $1, subscription_id, event_id, $2, NOW(), id FROM webhook_deliveries
+		WHERE id = $3 AND subscription_id = $4`,
+		newID, string(StatusPending), deliveryID, subscriptionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return scanWebhookDelivery(wd.db.QueryRow(
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries d JOIN webhook_events e ON e.id = d.event_id WHERE d.id = $1", newID,
+	))
+}
+
+// ========================================
+// WEBHOOK SUBSCRIPTION HANDLERS
+// ========================================
+
+type webhookSubscriptionRequest struct {
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+func requireWebhooks(w http.ResponseWriter) bool {
+	if webhookDispatcher == nil {
+		http.Error(w, "Webhooks unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func writeWebhookLookupError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// listWebhookSubscriptionsHandler - List subscriptions with masked secrets
+func listWebhookSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) || !requireWebhooks(w) {
+		return
+	}
+
+	subscriptions, err := webhookDispatcher.ListSubscriptions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = maskWebhookSecret(subscriptions[i].Secret)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subscriptions": subscriptions,
+		"event_types":   webhookEventTypes,
+		"total_count":   len(subscriptions),
+		"timestamp":     time.Now(),
+	})
+}
+
+// createWebhookSubscriptionHandler - Register an endpoint; the secret is only returned here
+func createWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) || !requireWebhooks(w) {
+		return
+	}
+
+	var request webhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhookURL(r.Context(), request.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhookEventTypes(request.EventTypes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret := request.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sub := &WebhookSubscription{
+		ID:          uuid.New().String(),
+		URL:         request.URL,
+		Secret:      secret,
+		EventTypes:  request.EventTypes,
+		Description: request.Description,
+		Active:      request.Active == nil || *request.Active,
+		CreatedAt:   time.Now(),
+	}
+	if err := webhookDispatcher.SaveSubscription(sub); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// getWebhookSubscriptionHandler - Get a subscription with its secret masked
+func getWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) || !requireWebhooks(w) {
+		return
+	}
+
+	sub, err := webhookDispatcher.GetSubscription(mux.Vars(r)["id"])
+	if err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+	sub.Secret = maskWebhookSecret(sub.Secret)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+// updateWebhookSubscriptionHandler - Change URL, events or state; a new secret rotates it
+func updateWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) || !requireWebhooks(w) {
+		return
+	}
+
+	sub, err := webhookDispatcher.GetSubscription(mux.Vars(r)["id"])
+	if err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+
+	var request webhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.URL != "" {
+		if err := validateWebhookURL(r.Context(), request.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sub.URL = request.URL
+	}
+	if request.EventTypes != nil {
+		if err := validateWebhookEventTypes(request.EventTypes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sub.EventTypes = request.EventTypes
+	}
+	if request.Description != "" {
+		sub.Description = request.Description
+	}
+	if request.Active != nil {
+		sub.Active = *request.Active
+	}
+	rotated := request.Secret != ""
+	if rotated {
+		sub.Secret = request.Secret
+	}
+
+	if err := webhookDispatcher.SaveSubscription(sub); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !rotated {
+		sub.Secret = maskWebhookSecret(sub.Secret)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+// deleteWebhookSubscriptionHandler - Remove a subscription
+func deleteWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) || !requireWebhooks(w) {
+		return
+	}
+
+	if err := webhookDispatcher.DeleteSubscription(mux.Vars(r)["id"]); err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveriesHandler - Delivery log of a subscription
+func listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) || !requireWebhooks(w) {
+		return
+	}
+
+	subscriptionID := mux.Vars(r)["id"]
+	if _, err := webhookDispatcher.GetSubscription(subscriptionID); err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	deliveries, err := webhookDispatcher.ListDeliveries(subscriptionID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries":  deliveries,
+		"total_count": len(deliveries),
+		"timestamp":   time.Now(),
+	})
+}
+
+// redeliverWebhookHandler - Queue a past delivery again
+func redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) || !requireWebhooks(w) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	delivery, err := webhookDispatcher.Redeliver(vars["id"], vars["deliveryID"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
@@ -9,7 +9,7 @@ export interface ProjectResponse {
 export interface ProjectCreateRequest {
   name: string;
   description?: string;
-  owner_id: string;
+  owner_id?: string; // ignored on create: the signed-in user owns new projects
   team_members?: string[];
 }
 
@@ -26,8 +26,9 @@ class ProjectService {
     return apiService.post<Project>('/projects', project);
   }
 
-  async updateProject(id: string, updates: Partial<ProjectCreateRequest>): Promise<Project> {
-    return apiService.put<Project>(`/projects/${id}`, updates);
+  // owner_id is not patchable; the server rejects it
+  async updateProject(id: string, updates: Partial<Omit<ProjectCreateRequest, 'owner_id'>>): Promise<Project> {
+    return apiService.patch<Project>(`/projects/${id}`, updates);
   }
 
   async getProjectTasks(projectId: string): Promise<{
@@ -49,7 +49,7 @@ class TaskService {
   }
 
   async updateTask(id: string, updates: Partial<TaskCreateRequest>): Promise<Task> {
-    return apiService.put<Task>(`/tasks/${id}`, updates);
+    return apiService.patch<Task>(`/tasks/${id}`, updates);
   }
 
   async deleteTask(id: string): Promise<void> {
@@ -1,6 +1,7 @@
 import { writable, get } from 'svelte/store';
 import { tasksStore, commentsStore } from './data';
 import { showSuccess, showInfo, showError } from './toast';
+import { userStore } from './user';
 
 // Enhanced WebSocket message interface matching backend structure
 export interface WebSocketMessage {
@@ -58,24 +59,30 @@ export const connectedUsersStore = writable<string[]>([]);
 // User info
 let currentUserId = `user_${Date.now()}_${Math.random().toString(36).substr(2, 9)}`;
 let currentUsername = 'Anonymous User';
+let sessionToken: string | null = null;
 
 // Configuration
 let reconnectAttempts = 0;
 const maxReconnectAttempts = 5;
 const reconnectDelay = 3000;
 
-export function setUserInfo(userId: string, username: string) {
+export function setUserInfo(userId: string, username: string, token?: string) {
   currentUserId = userId;
   currentUsername = username;
+  sessionToken = token ?? null;
 }
 
 export function connectWebSocket() {
-  const wsUrl = `${import.meta.env.VITE_WS_URL || 'ws://localhost:8082/api/v1/ws'}?user_id=${currentUserId}&username=${encodeURIComponent(currentUsername)}`;
+  // The server takes the user from the session token, not the URL. Browsers
+  // cannot set headers on a WebSocket, so the token rides as a subprotocol.
+  const wsUrl = import.meta.env.VITE_WS_URL || 'ws://localhost:8082/api/v1/ws';
+  const token = sessionToken ?? (get(userStore) as { token?: string } | null)?.token;
+  const protocols = token ? ['task-management', `bearer.${token}`] : undefined;
   
   connectionStatusStore.set('connecting');
   
   try {
-    const ws = new WebSocket(wsUrl);
+    const ws = new WebSocket(wsUrl, protocols);
     
     ws.onopen = () => {
       console.log('✅ Enhanced WebSocket connected');